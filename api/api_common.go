@@ -3,10 +3,13 @@ package api
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/filecoin-project/lotus/build"
+	metrics "github.com/libp2p/go-libp2p-core/metrics"
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
+	protocol "github.com/libp2p/go-libp2p-core/protocol"
 )
 
 type Permission = string
@@ -25,6 +28,24 @@ type Common interface {
 	NetDisconnect(context.Context, peer.ID) error
 	NetFindPeer(context.Context, peer.ID) (peer.AddrInfo, error)
 
+	// NetPeerScores returns reputation scores of known peers, best first
+	NetPeerScores(context.Context) ([]PeerScore, error)
+
+	// NetBandwidthStats returns total bandwidth used by libp2p
+	NetBandwidthStats(ctx context.Context) (metrics.Stats, error)
+	// NetBandwidthStatsByPeer returns bandwidth used by libp2p, by peer ID
+	NetBandwidthStatsByPeer(ctx context.Context) (map[string]metrics.Stats, error)
+	// NetBandwidthStatsByProtocol returns bandwidth used by libp2p, by protocol
+	NetBandwidthStatsByProtocol(ctx context.Context) (map[protocol.ID]metrics.Stats, error)
+
+	// NetBlockAdd blocks connections with a peer ID, multiaddr or CIDR subnet.
+	// Zero duration blocks permanently
+	NetBlockAdd(ctx context.Context, target string, dur time.Duration, reason string) error
+	// NetBlockRemove lifts a block on the given target
+	NetBlockRemove(ctx context.Context, target string) error
+	// NetBlockList lists active connection blocks
+	NetBlockList(ctx context.Context) ([]NetBlockRule, error)
+
 	// ID returns peerID of libp2p node backing this API
 	ID(context.Context) (peer.ID, error)
 
@@ -35,6 +56,28 @@ type Common interface {
 	LogSetLevel(context.Context, string, string) error
 }
 
+// PeerScore is the reputation of a peer, as observed in chain protocols
+type PeerScore struct {
+	ID        peer.ID
+	Score     float64
+	Protected bool
+
+	// Events is a count of observed events by type
+	Events map[string]uint64
+}
+
+// NetBlockRule is a connection block on a peer, multiaddr or subnet
+type NetBlockRule struct {
+	// Type is one of "peer", "addr" or "subnet"
+	Type   string
+	Target string
+	Reason string
+
+	Created time.Time
+	// Expires is zero for permanent blocks
+	Expires time.Time
+}
+
 // Version provides various build-time information
 type Version struct {
 	Version string
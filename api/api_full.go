@@ -9,6 +9,7 @@ import (
 	"github.com/libp2p/go-libp2p-core/peer"
 
 	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
 	"github.com/filecoin-project/go-fil-markets/storagemarket"
 	"github.com/filecoin-project/specs-actors/actors/abi"
 	"github.com/filecoin-project/specs-actors/actors/abi/big"
@@ -95,8 +96,29 @@ type FullNode interface {
 	// ClientImport imports file under the specified path into filestore
 	ClientImport(ctx context.Context, ref FileRef) (cid.Cid, error)
 	ClientStartDeal(ctx context.Context, params *StartDealParams) (*cid.Cid, error)
+	// ClientStartDealAuto starts deals for the requested number of replicas
+	// with miners selected by price, power and past deal success. Deals that
+	// fail are retried with other miners
+	ClientStartDealAuto(ctx context.Context, params *StartDealAutoParams) (*DealPlacement, error)
+	// ClientListDealPlacements lists deals started by ClientStartDealAuto
+	ClientListDealPlacements(ctx context.Context) ([]DealPlacement, error)
+	// ClientMonitoredDeals lists active deals with their health, as last
+	// checked by the deal monitor
+	ClientMonitoredDeals(ctx context.Context) ([]MonitoredDeal, error)
+	// ClientDealAlerts streams deals which got slashed, faulted or are near
+	// expiry
+	ClientDealAlerts(ctx context.Context) (<-chan MonitoredDeal, error)
+	// ClientRenewDeal starts a new deal for the data of the deal. With miner
+	// set the deal is made with that miner for the same price, otherwise
+	// miners are selected automatically for at most maxPrice per GiB per epoch
+	ClientRenewDeal(ctx context.Context, proposal cid.Cid, miner address.Address, maxPrice types.BigInt) error
 	ClientGetDealInfo(context.Context, cid.Cid) (*DealInfo, error)
 	ClientListDeals(ctx context.Context) ([]DealInfo, error)
+	// ClientListRetrievals lists retrieval deals made by this node, including
+	// finished ones
+	ClientListRetrievals(ctx context.Context) ([]RetrievalInfo, error)
+	// ClientGetRetrievalUpdates streams state changes of retrieval deals
+	ClientGetRetrievalUpdates(ctx context.Context) (<-chan RetrievalInfo, error)
 	ClientHasLocal(ctx context.Context, root cid.Cid) (bool, error)
 	ClientFindData(ctx context.Context, root cid.Cid) ([]QueryOffer, error)
 	ClientRetrieve(ctx context.Context, order RetrievalOrder, ref FileRef) error
@@ -104,8 +126,12 @@ type FullNode interface {
 	ClientCalcCommP(ctx context.Context, inpath string, miner address.Address) (*CommPRet, error)
 	ClientGenCar(ctx context.Context, ref FileRef, outpath string) error
 
-	// ClientUnimport removes references to the specified file from filestore
-	//ClientUnimport(path string)
+	// ClientRemoveImport removes an import, with its filestore references and
+	// the blocks no other import uses
+	ClientRemoveImport(ctx context.Context, root cid.Cid) error
+	// ClientGCBlockstore removes blocks from the client blockstore which
+	// aren't part of an import or of data for unfinished storage deals
+	ClientGCBlockstore(ctx context.Context) (*ClientGCResult, error)
 
 	// ClientListImports lists imported files and their root CIDs
 	ClientListImports(ctx context.Context) ([]Import, error)
@@ -118,6 +144,10 @@ type FullNode interface {
 	StateGetActor(ctx context.Context, actor address.Address, tsk types.TipSetKey) (*types.Actor, error)
 	StateReadState(ctx context.Context, act *types.Actor, tsk types.TipSetKey) (*ActorState, error)
 	StateListMessages(ctx context.Context, match *types.Message, tsk types.TipSetKey, toht abi.ChainEpoch) ([]cid.Cid, error)
+	// StateMinerRewards returns what the miner earned for each block it mined
+	// and what was burnt from its funds between the from epoch and the
+	// tipset, for each epoch with either, oldest first
+	StateMinerRewards(ctx context.Context, maddr address.Address, from abi.ChainEpoch, tsk types.TipSetKey) ([]MinerReward, error)
 
 	StateNetworkName(context.Context) (dtypes.NetworkName, error)
 	StateMinerSectors(context.Context, address.Address, *abi.BitField, bool, types.TipSetKey) ([]*ChainSectorInfo, error)
@@ -127,6 +157,8 @@ type FullNode interface {
 	StateMinerInfo(context.Context, address.Address, types.TipSetKey) (miner.MinerInfo, error)
 	StateMinerDeadlines(context.Context, address.Address, types.TipSetKey) (*miner.Deadlines, error)
 	StateMinerFaults(context.Context, address.Address, types.TipSetKey) ([]abi.SectorNumber, error)
+	// StateMinerRecoveries returns faulty sectors which the miner declared as recovered
+	StateMinerRecoveries(context.Context, address.Address, types.TipSetKey) ([]abi.SectorNumber, error)
 	StateMinerInitialPledgeCollateral(context.Context, address.Address, abi.SectorNumber, types.TipSetKey) (types.BigInt, error)
 	StateMinerAvailableBalance(context.Context, address.Address, types.TipSetKey) (types.BigInt, error)
 	StateSectorPreCommitInfo(context.Context, address.Address, abi.SectorNumber, types.TipSetKey) (miner.SectorPreCommitOnChainInfo, error)
@@ -179,11 +211,46 @@ type MinerSectors struct {
 	Pset uint64
 }
 
+// MinerReward is what a miner earned for a block it mined, and what was burnt
+// from its funds at an epoch
+type MinerReward struct {
+	Epoch abi.ChainEpoch
+	// Block the miner mined, undefined if it didn't mine one at the epoch
+	Block cid.Cid
+
+	// Reward is the amount paid to the miner actor, the block reward plus
+	// GasReward, minus Penalty
+	Reward    types.BigInt
+	GasReward types.BigInt
+	Penalty   types.BigInt
+	// Burnt is what was burnt from the miner's funds: fault fees, penalties
+	// for undeclared faults and termination fees
+	Burnt types.BigInt
+
+	// Funds locked in the miner actor after the tipset was applied
+	LockedFunds       types.BigInt
+	PreCommitDeposits types.BigInt
+}
+
 type Import struct {
 	Status   filestore.Status
 	Key      cid.Cid
 	FilePath string
 	Size     uint64
+
+	// Imported is when the data was imported, zero for imports made before
+	// import metadata was recorded
+	Imported time.Time
+	// Deals proposed for the imported data
+	Deals []cid.Cid
+	// Retrieved is set for data retrieved from a storage miner, which may
+	// only be partially stored
+	Retrieved bool
+}
+
+type ClientGCResult struct {
+	Kept    uint64
+	Removed uint64
 }
 
 type DealInfo struct {
@@ -201,6 +268,25 @@ type DealInfo struct {
 	DealID abi.DealID
 }
 
+// RetrievalInfo is the state of a retrieval deal
+type RetrievalInfo struct {
+	ID         retrievalmarket.DealID
+	PayloadCID cid.Cid
+	// Peer is the provider for client deals, and the client for provider
+	// deals
+	Peer    peer.ID
+	Status  retrievalmarket.DealStatus
+	Message string
+
+	PricePerByte abi.TokenAmount
+	// Bytes and Funds transferred so far
+	Bytes uint64
+	Funds abi.TokenAmount
+
+	Started time.Time
+	Updated time.Time
+}
+
 type MsgLookup struct {
 	Receipt types.MessageReceipt
 	TipSet  *types.TipSet
@@ -304,10 +390,16 @@ type MarketDeal struct {
 }
 
 type RetrievalOrder struct {
-	// TODO: make this less unixfs specific
 	Root cid.Cid
 	Size uint64
-	// TODO: support offset
+
+	// Path selects a sub-DAG below Root by unixfs link names, eg. dir/file
+	Path string
+	// Offset and Length select a byte range of the unixfs file at Root/Path,
+	// zero Length reads to the end of the file
+	Offset uint64
+	Length uint64
+
 	Total                   types.BigInt
 	PaymentInterval         uint64
 	PaymentIntervalIncrease uint64
@@ -338,6 +430,87 @@ type StartDealParams struct {
 	DealStartEpoch    abi.ChainEpoch
 }
 
+type StartDealAutoParams struct {
+	Data   *storagemarket.DataRef
+	Wallet address.Address
+	// MaxPrice per GiB per epoch, miners asking more aren't used
+	MaxPrice          types.BigInt
+	MinBlocksDuration uint64
+	DealStartEpoch    abi.ChainEpoch
+	Replicas          int
+	// Exclude these miners from selection
+	Exclude []address.Address
+}
+
+// DealPlacement tracks the deals started by ClientStartDealAuto
+type DealPlacement struct {
+	ID     uint64
+	Params StartDealAutoParams
+	// PieceSize of the data, used to compute the price of deals
+	PieceSize abi.PaddedPieceSize
+
+	Deals []PlacedDeal
+	// Candidates which weren't used yet, best first. Failed deals are retried
+	// with them
+	Candidates []DealCandidate
+
+	Created time.Time
+}
+
+type PlacedDeal struct {
+	Miner       address.Address
+	ProposalCid cid.Cid
+	State       storagemarket.StorageDealStatus
+	Message     string
+}
+
+// DealHealth is the state of an active deal as seen by the deal monitor
+type DealHealth string
+
+const (
+	DealHealthy  DealHealth = "active"
+	DealFaulted  DealHealth = "faulted"
+	DealSlashed  DealHealth = "slashed"
+	DealExpiring DealHealth = "expiring"
+	DealExpired  DealHealth = "expired"
+)
+
+type MonitoredDeal struct {
+	ProposalCid   cid.Cid
+	DealID        abi.DealID
+	Provider      address.Address
+	Client        address.Address
+	Data          *storagemarket.DataRef
+	PieceCID      cid.Cid
+	PieceSize     abi.PaddedPieceSize
+	PricePerEpoch types.BigInt
+	StartEpoch    abi.ChainEpoch
+	EndEpoch      abi.ChainEpoch
+
+	// Sector storing the deal, once it was found
+	Sector      abi.SectorNumber
+	SectorKnown bool
+
+	Health  DealHealth
+	Message string
+	// Checked is the epoch the deal was last checked at
+	Checked abi.ChainEpoch
+
+	// Renewals are proposals of deals renewing this one with a chosen miner,
+	// RenewalPlacements placements renewing it with selected miners
+	Renewals          []cid.Cid
+	RenewalPlacements []uint64
+}
+
+type DealCandidate struct {
+	Miner address.Address
+	Peer  peer.ID
+	// Price per GiB per epoch the miner asks
+	Price types.BigInt
+	Power types.BigInt
+	Score float64
+}
+
 type IpldObject struct {
 	Cid cid.Cid
 	Obj interface{}
@@ -353,10 +526,30 @@ type ActiveSync struct {
 	Start   time.Time
 	End     time.Time
 	Message string
+
+	LastProgress time.Time
+}
+
+// SyncRecovery is an action taken by the sync watchdog to recover from a
+// stalled sync
+type SyncRecovery struct {
+	Time   time.Time
+	Reason string
+
+	// Worker is the sync worker which got cancelled, -1 if no sync was running
+	Worker int
+	Target *types.TipSet
+
+	DroppedPeers []peer.ID
+	// Retry is the tipset sync was restarted with, if any
+	Retry *types.TipSet
 }
 
 type SyncState struct {
 	ActiveSyncs []ActiveSync
+
+	// Recoveries lists recent sync watchdog actions, oldest first
+	Recoveries []SyncRecovery
 }
 
 type SyncStateStage int
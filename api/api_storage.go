@@ -3,8 +3,10 @@ package api
 import (
 	"bytes"
 	"context"
+	"time"
 
 	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
 
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-fil-markets/storagemarket"
@@ -24,9 +26,15 @@ type StorageMiner interface {
 	ActorSectorSize(context.Context, address.Address) (abi.SectorSize, error)
 
 	MiningBase(context.Context) (*types.TipSet, error)
+	// MinerRoundsHistory returns up to n most recent mining rounds, oldest
+	// first
+	MinerRoundsHistory(ctx context.Context, n int) ([]MiningRound, error)
 
 	// Temp api for testing
 	PledgeSector(context.Context) error
+	// PledgeSectors queues n committed capacity sectors, started as sealing
+	// limits allow
+	PledgeSectors(ctx context.Context, n int) error
 
 	// Get the status of a given sector by ID
 	SectorsStatus(context.Context, abi.SectorNumber) (SectorInfo, error)
@@ -38,6 +46,35 @@ type StorageMiner interface {
 
 	SectorsUpdate(context.Context, abi.SectorNumber, SectorState) error
 
+	// SectorsExtend sends messages extending on-chain expiration of the given
+	// sectors
+	SectorsExtend(ctx context.Context, sectors []abi.SectorNumber, newExpiration abi.ChainEpoch) ([]cid.Cid, error)
+	// SectorsTerminateFee estimates the fee for terminating the given sectors now
+	SectorsTerminateFee(ctx context.Context, sectors []abi.SectorNumber) (types.BigInt, error)
+	// SectorsTerminate sends a message terminating the given sectors early
+	SectorsTerminate(ctx context.Context, sectors []abi.SectorNumber) (cid.Cid, error)
+	// SectorsInactive lists sealed sectors with data in storage, which are no
+	// longer active on chain
+	SectorsInactive(ctx context.Context) ([]abi.SectorNumber, error)
+	// SectorsRemove removes stored data of sectors which are no longer active
+	// on chain
+	SectorsRemove(ctx context.Context, sectors []abi.SectorNumber) error
+
+	// SectorsNotify returns a channel with state changes of all sectors
+	SectorsNotify(ctx context.Context) (<-chan SectorChange, error)
+
+	// SectorsCheck checks files of the given sectors in storage, or of all
+	// sectors if none are given
+	SectorsCheck(ctx context.Context, sectors []abi.SectorNumber, opts ScrubOptions) ([]SectorCheck, error)
+	// SectorsScrubStatus returns results of the last full storage scrub
+	SectorsScrubStatus(ctx context.Context) (ScrubStatus, error)
+
+	// ProvingHistory lists recorded window PoSt attempts, oldest first
+	ProvingHistory(ctx context.Context) ([]WindowPoStAttempt, error)
+	// ProvingDryRun generates a window PoSt for the given deadline without
+	// submitting it
+	ProvingDryRun(ctx context.Context, deadline uint64) (WindowPoStAttempt, error)
+
 	StorageList(ctx context.Context) (map[stores.ID][]stores.Decl, error)
 	StorageLocal(ctx context.Context) (map[stores.ID]string, error)
 	StorageStat(ctx context.Context, id stores.ID) (stores.FsStat, error)
@@ -45,16 +82,42 @@ type StorageMiner interface {
 	// WorkerConnect tells the node to connect to workers RPC
 	WorkerConnect(context.Context, string) error
 	WorkerStats(context.Context) (map[uint64]storiface.WorkerStats, error)
+	// WorkerTasks returns running and queued tasks of remote workers, by
+	// worker URL
+	WorkerTasks(context.Context) (map[string]WorkerTasks, error)
+	// WorkerJobs lists sealing jobs, running and queued on remote workers or
+	// scheduled by the miner
+	WorkerJobs(context.Context) ([]WorkerJob, error)
+
+	// SealingAbort cancels a sealing job, the sector moves to a failed state
+	// which is retried. Workers can't stop a running task, an aborted job
+	// keeps its task slot until the worker finishes it
+	SealingAbort(ctx context.Context, job uint64) error
 
 	stores.SectorIndex
 
 	MarketImportDealData(ctx context.Context, propcid cid.Cid, path string) error
 	MarketListDeals(ctx context.Context) ([]storagemarket.StorageDeal, error)
 	MarketListIncompleteDeals(ctx context.Context) ([]storagemarket.MinerDeal, error)
+	MarketListRetrievalDeals(ctx context.Context) ([]RetrievalInfo, error)
+	MarketGetRetrievalPolicy(ctx context.Context) (*RetrievalPolicy, error)
+	// MarketSetRetrievalPolicy changes retrieval prices and client rules. The
+	// policy is stored, and used instead of the config on restart
+	MarketSetRetrievalPolicy(ctx context.Context, policy *RetrievalPolicy) error
 	MarketSetPrice(context.Context, types.BigInt) error
+	// MarketSetAsk signs a new storage ask, valid for duration epochs
+	MarketSetAsk(ctx context.Context, price types.BigInt, minPieceSize, maxPieceSize abi.PaddedPieceSize, duration abi.ChainEpoch) error
+	MarketGetAsk(ctx context.Context) (*storagemarket.SignedStorageAsk, error)
 
 	DealsImportData(ctx context.Context, dealPropCid cid.Cid, file string) error
 	DealsList(ctx context.Context) ([]storagemarket.StorageDeal, error)
+	// DealsPendingImport lists offline deals waiting for their data, the ones
+	// starting first first
+	DealsPendingImport(ctx context.Context) ([]storagemarket.MinerDeal, error)
+	// DealsImportDir imports the files in dir for pending offline deals. Files
+	// are matched to deals by their name, which is the piece CID, optionally
+	// with an extension
+	DealsImportDir(ctx context.Context, dir string) ([]DealImportResult, error)
 
 	StorageAddLocal(ctx context.Context, path string) error
 }
@@ -91,6 +154,154 @@ type SectorInfo struct {
 	Log []SectorLog
 }
 
+// SectorChange is a sector state machine update
+type SectorChange struct {
+	Sector abi.SectorNumber
+	Time   time.Time
+
+	// From is empty for new sectors
+	From SectorState
+	To   SectorState
+
+	LastErr string
+
+	// Log entries added with this change, events and errors which caused it
+	Log []SectorLog
+}
+
+type ScrubOptions struct {
+	// Verify proves each sector against its on-chain SealedCID
+	Verify bool
+	// Repair moves misplaced sector files into long-term storage, and fetches
+	// damaged files again from a good copy
+	Repair bool
+}
+
+// SectorCheck is the result of checking files of a single sector
+type SectorCheck struct {
+	Sector  abi.SectorNumber
+	Checked time.Time
+
+	// Storage the sector files are declared in
+	Sealed []stores.ID
+	Cache  []stores.ID
+
+	// OnChain is false for sectors which are still sealing, files of those
+	// are only listed
+	OnChain bool
+	// Misplaced is set when sector files aren't in long-term storage of the
+	// miner or a worker
+	Misplaced bool
+	// Repaired describes the repair done on the sector, if any
+	Repaired string
+	// Verified is set when the sector was proven against its on-chain SealedCID
+	Verified bool
+
+	Err string
+}
+
+type ScrubStatus struct {
+	Running bool
+	LastRun time.Time
+	Results []SectorCheck
+}
+
+type PoStResult string
+
+const (
+	PoStRunning      PoStResult = "running"
+	PoStNoPartitions PoStResult = "no-partitions"
+	PoStProved       PoStResult = "proved" // dry run finished
+	PoStSubmitted    PoStResult = "submitted"
+	PoStLanded       PoStResult = "landed"
+	PoStFailed       PoStResult = "failed"
+	PoStAborted      PoStResult = "aborted"
+)
+
+// WindowPoStAttempt is a record of a single window PoSt run
+type WindowPoStAttempt struct {
+	ID     uint64
+	DryRun bool
+
+	Deadline    uint64
+	PeriodStart abi.ChainEpoch
+	Challenge   abi.ChainEpoch
+	Close       abi.ChainEpoch
+	// Height is the chain height proving started at
+	Height abi.ChainEpoch
+
+	Partitions []uint64
+	Sectors    uint64
+	Skipped    uint64
+
+	Start time.Time
+	// Elapsed is the time proof generation took
+	Elapsed time.Duration
+
+	Message *cid.Cid
+	// Included is the height the PoSt message landed at
+	Included abi.ChainEpoch
+
+	Result PoStResult
+	Error  string
+}
+
+// DealImportResult is the outcome of importing a file for an offline deal
+type DealImportResult struct {
+	File        string
+	PieceCID    cid.Cid
+	ProposalCid cid.Cid
+	Error       string
+}
+
+// RetrievalPolicy sets retrieval prices, and which clients can retrieve
+type RetrievalPolicy struct {
+	PricePerByte abi.TokenAmount
+	// UnsealPrice is spread over the bytes of pieces which have to be
+	// unsealed for the retrieval
+	UnsealPrice abi.TokenAmount
+
+	PaymentInterval         uint64
+	PaymentIntervalIncrease uint64
+
+	// AllowedPeers, when not empty, limits retrievals to these clients
+	AllowedPeers []peer.ID
+	BlockedPeers []peer.ID
+}
+
+// BlockInclusion tells whether a mined block made it into the canonical chain
+type BlockInclusion string
+
+const (
+	BlockPending  BlockInclusion = "pending"
+	BlockIncluded BlockInclusion = "included"
+	BlockOrphaned BlockInclusion = "orphaned"
+)
+
+// MiningRound is a record of a single block production attempt
+type MiningRound struct {
+	Epoch      abi.ChainEpoch
+	Base       types.TipSetKey
+	BaseHeight abi.ChainEpoch
+	NullRounds abi.ChainEpoch
+
+	Start time.Time
+	Won   bool
+
+	// WinningPoStTime is the time computing the winning PoSt took
+	WinningPoStTime time.Duration
+	// CreateTime is the time from the start of the round until the block was
+	// created
+	CreateTime time.Duration
+	// PropagationDelay is how long after the block timestamp it was submitted
+	PropagationDelay time.Duration
+
+	Block     *cid.Cid
+	Inclusion BlockInclusion
+
+	Error string
+}
+
 type SealedRef struct {
 	SectorID abi.SectorNumber
 	Offset   uint64
@@ -2,6 +2,7 @@ package api
 
 import (
 	"context"
+	"time"
 
 	"github.com/filecoin-project/sector-storage/sealtasks"
 	"github.com/filecoin-project/sector-storage/stores"
@@ -19,9 +20,53 @@ type WorkerApi interface {
 	TaskTypes(context.Context) (map[sealtasks.TaskType]struct{}, error) // TaskType -> Weight
 	Paths(context.Context) ([]stores.StoragePath, error)
 	Info(context.Context) (storiface.WorkerInfo, error)
+	// Limits returns task limits and resource budgets the miner should
+	// respect when assigning tasks to this worker
+	Limits(context.Context) (WorkerLimits, error)
 
 	storage.Sealer
 	Fetch(context.Context, abi.SectorID, stores.SectorFileType, bool) error
 
 	Closing(context.Context) (<-chan struct{}, error)
 }
+
+// WorkerLimits are per-worker limits on sealing work. Zero values mean no
+// limit
+type WorkerLimits struct {
+	// MaxTasks limits concurrently running tasks by type
+	MaxTasks map[sealtasks.TaskType]int
+
+	// CPUs and Memory (in bytes) budget worker resources available for tasks
+	CPUs   uint64
+	Memory uint64
+}
+
+// WorkerTasks counts sealing tasks assigned to a remote worker
+type WorkerTasks struct {
+	Hostname string
+	Limits   WorkerLimits
+
+	Running map[sealtasks.TaskType]int
+	Queued  map[sealtasks.TaskType]int
+}
+
+// WorkerJob is a sealing task of the miner
+type WorkerJob struct {
+	ID     uint64
+	Sector abi.SectorID
+	Task   sealtasks.TaskType
+
+	// Worker is the URL of the remote worker the job is assigned to. It's
+	// empty while the job waits in the scheduler, or runs on the miner's own
+	// worker
+	Worker   string
+	Hostname string
+
+	// Running is false while the job waits for a free task slot on the worker
+	Running bool
+	// Aborted jobs keep running on the worker until it finishes the task
+	Aborted bool
+	// Start is when the job started running, or was queued if it isn't
+	// running yet
+	Start time.Time
+}
@@ -2,10 +2,13 @@ package apistruct
 
 import (
 	"context"
+	"time"
 
 	"github.com/ipfs/go-cid"
+	metrics "github.com/libp2p/go-libp2p-core/metrics"
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
+	protocol "github.com/libp2p/go-libp2p-core/protocol"
 
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-fil-markets/storagemarket"
@@ -39,6 +42,15 @@ type CommonStruct struct {
 		NetAddrsListen   func(context.Context) (peer.AddrInfo, error)                  `perm:"read"`
 		NetDisconnect    func(context.Context, peer.ID) error                          `perm:"write"`
 		NetFindPeer      func(context.Context, peer.ID) (peer.AddrInfo, error)         `perm:"read"`
+		NetPeerScores    func(context.Context) ([]api.PeerScore, error)                `perm:"read"`
+
+		NetBandwidthStats           func(ctx context.Context) (metrics.Stats, error)                 `perm:"read"`
+		NetBandwidthStatsByPeer     func(ctx context.Context) (map[string]metrics.Stats, error)      `perm:"read"`
+		NetBandwidthStatsByProtocol func(ctx context.Context) (map[protocol.ID]metrics.Stats, error) `perm:"read"`
+
+		NetBlockAdd    func(ctx context.Context, target string, dur time.Duration, reason string) error `perm:"admin"`
+		NetBlockRemove func(ctx context.Context, target string) error                                   `perm:"admin"`
+		NetBlockList   func(ctx context.Context) ([]api.NetBlockRule, error)                            `perm:"read"`
 
 		ID      func(context.Context) (peer.ID, error)     `perm:"read"`
 		Version func(context.Context) (api.Version, error) `perm:"read"`
@@ -101,17 +113,26 @@ type FullNodeStruct struct {
 		WalletExport         func(context.Context, address.Address) (*types.KeyInfo, error)                       `perm:"admin"`
 		WalletImport         func(context.Context, *types.KeyInfo) (address.Address, error)                       `perm:"admin"`
 
-		ClientImport      func(ctx context.Context, ref api.FileRef) (cid.Cid, error)                                          `perm:"admin"`
-		ClientListImports func(ctx context.Context) ([]api.Import, error)                                                      `perm:"write"`
-		ClientHasLocal    func(ctx context.Context, root cid.Cid) (bool, error)                                                `perm:"write"`
-		ClientFindData    func(ctx context.Context, root cid.Cid) ([]api.QueryOffer, error)                                    `perm:"read"`
-		ClientStartDeal   func(ctx context.Context, params *api.StartDealParams) (*cid.Cid, error)                             `perm:"admin"`
-		ClientGetDealInfo func(context.Context, cid.Cid) (*api.DealInfo, error)                                                `perm:"read"`
-		ClientListDeals   func(ctx context.Context) ([]api.DealInfo, error)                                                    `perm:"write"`
-		ClientRetrieve    func(ctx context.Context, order api.RetrievalOrder, ref api.FileRef) error                           `perm:"admin"`
-		ClientQueryAsk    func(ctx context.Context, p peer.ID, miner address.Address) (*storagemarket.SignedStorageAsk, error) `perm:"read"`
-		ClientCalcCommP   func(ctx context.Context, inpath string, miner address.Address) (*api.CommPRet, error)               `perm:"read"`
-		ClientGenCar      func(ctx context.Context, ref api.FileRef, outpath string) error                                     `perm:"write"`
+		ClientImport              func(ctx context.Context, ref api.FileRef) (cid.Cid, error)                                          `perm:"admin"`
+		ClientListImports         func(ctx context.Context) ([]api.Import, error)                                                      `perm:"write"`
+		ClientRemoveImport        func(ctx context.Context, root cid.Cid) error                                                        `perm:"admin"`
+		ClientGCBlockstore        func(ctx context.Context) (*api.ClientGCResult, error)                                               `perm:"admin"`
+		ClientHasLocal            func(ctx context.Context, root cid.Cid) (bool, error)                                                `perm:"write"`
+		ClientFindData            func(ctx context.Context, root cid.Cid) ([]api.QueryOffer, error)                                    `perm:"read"`
+		ClientStartDeal           func(ctx context.Context, params *api.StartDealParams) (*cid.Cid, error)                             `perm:"admin"`
+		ClientStartDealAuto       func(ctx context.Context, params *api.StartDealAutoParams) (*api.DealPlacement, error)               `perm:"admin"`
+		ClientListDealPlacements  func(ctx context.Context) ([]api.DealPlacement, error)                                               `perm:"read"`
+		ClientMonitoredDeals      func(ctx context.Context) ([]api.MonitoredDeal, error)                                               `perm:"read"`
+		ClientDealAlerts          func(ctx context.Context) (<-chan api.MonitoredDeal, error)                                          `perm:"read"`
+		ClientRenewDeal           func(ctx context.Context, proposal cid.Cid, miner address.Address, maxPrice types.BigInt) error      `perm:"write"`
+		ClientGetDealInfo         func(context.Context, cid.Cid) (*api.DealInfo, error)                                                `perm:"read"`
+		ClientListDeals           func(ctx context.Context) ([]api.DealInfo, error)                                                    `perm:"write"`
+		ClientListRetrievals      func(ctx context.Context) ([]api.RetrievalInfo, error)                                               `perm:"write"`
+		ClientGetRetrievalUpdates func(ctx context.Context) (<-chan api.RetrievalInfo, error)                                          `perm:"write"`
+		ClientRetrieve            func(ctx context.Context, order api.RetrievalOrder, ref api.FileRef) error                           `perm:"admin"`
+		ClientQueryAsk            func(ctx context.Context, p peer.ID, miner address.Address) (*storagemarket.SignedStorageAsk, error) `perm:"read"`
+		ClientCalcCommP           func(ctx context.Context, inpath string, miner address.Address) (*api.CommPRet, error)               `perm:"read"`
+		ClientGenCar              func(ctx context.Context, ref api.FileRef, outpath string) error                                     `perm:"write"`
 
 		StateNetworkName                  func(context.Context) (dtypes.NetworkName, error)                                                                   `perm:"read"`
 		StateMinerSectors                 func(context.Context, address.Address, *abi.BitField, bool, types.TipSetKey) ([]*api.ChainSectorInfo, error)        `perm:"read"`
@@ -121,6 +142,7 @@ type FullNodeStruct struct {
 		StateMinerInfo                    func(context.Context, address.Address, types.TipSetKey) (miner.MinerInfo, error)                                    `perm:"read"`
 		StateMinerDeadlines               func(context.Context, address.Address, types.TipSetKey) (*miner.Deadlines, error)                                   `perm:"read"`
 		StateMinerFaults                  func(context.Context, address.Address, types.TipSetKey) ([]abi.SectorNumber, error)                                 `perm:"read"`
+		StateMinerRecoveries              func(context.Context, address.Address, types.TipSetKey) ([]abi.SectorNumber, error)                                 `perm:"read"`
 		StateMinerInitialPledgeCollateral func(context.Context, address.Address, abi.SectorNumber, types.TipSetKey) (types.BigInt, error)                     `perm:"read"`
 		StateMinerAvailableBalance        func(context.Context, address.Address, types.TipSetKey) (types.BigInt, error)                                       `perm:"read"`
 		StateSectorPreCommitInfo          func(context.Context, address.Address, abi.SectorNumber, types.TipSetKey) (miner.SectorPreCommitOnChainInfo, error) `perm:"read"`
@@ -143,6 +165,7 @@ type FullNodeStruct struct {
 		StateGetReceipt                   func(context.Context, cid.Cid, types.TipSetKey) (*types.MessageReceipt, error)                                      `perm:"read"`
 		StateMinerSectorCount             func(context.Context, address.Address, types.TipSetKey) (api.MinerSectors, error)                                   `perm:"read"`
 		StateListMessages                 func(ctx context.Context, match *types.Message, tsk types.TipSetKey, toht abi.ChainEpoch) ([]cid.Cid, error)        `perm:"read"`
+		StateMinerRewards                 func(context.Context, address.Address, abi.ChainEpoch, types.TipSetKey) ([]api.MinerReward, error)                  `perm:"read"`
 		StateCompute                      func(context.Context, abi.ChainEpoch, []*types.Message, types.TipSetKey) (*api.ComputeStateOutput, error)           `perm:"read"`
 
 		MsigGetAvailableBalance func(context.Context, address.Address, types.TipSetKey) (types.BigInt, error)                                                                    `perm:"read"`
@@ -180,22 +203,47 @@ type StorageMinerStruct struct {
 		ActorAddress    func(context.Context) (address.Address, error)                 `perm:"read"`
 		ActorSectorSize func(context.Context, address.Address) (abi.SectorSize, error) `perm:"read"`
 
-		MiningBase func(context.Context) (*types.TipSet, error) `perm:"read"`
+		MiningBase         func(context.Context) (*types.TipSet, error)          `perm:"read"`
+		MinerRoundsHistory func(context.Context, int) ([]api.MiningRound, error) `perm:"read"`
 
-		MarketImportDealData      func(context.Context, cid.Cid, string) error                   `perm:"write"`
-		MarketListDeals           func(ctx context.Context) ([]storagemarket.StorageDeal, error) `perm:"read"`
-		MarketListIncompleteDeals func(ctx context.Context) ([]storagemarket.MinerDeal, error)   `perm:"read"`
-		MarketSetPrice            func(context.Context, types.BigInt) error                      `perm:"admin"`
+		MarketImportDealData      func(context.Context, cid.Cid, string) error                                                        `perm:"write"`
+		MarketListDeals           func(ctx context.Context) ([]storagemarket.StorageDeal, error)                                      `perm:"read"`
+		MarketListIncompleteDeals func(ctx context.Context) ([]storagemarket.MinerDeal, error)                                        `perm:"read"`
+		MarketListRetrievalDeals  func(ctx context.Context) ([]api.RetrievalInfo, error)                                              `perm:"read"`
+		MarketGetRetrievalPolicy  func(ctx context.Context) (*api.RetrievalPolicy, error)                                             `perm:"read"`
+		MarketSetRetrievalPolicy  func(ctx context.Context, policy *api.RetrievalPolicy) error                                        `perm:"admin"`
+		MarketSetPrice            func(context.Context, types.BigInt) error                                                           `perm:"admin"`
+		MarketSetAsk              func(context.Context, types.BigInt, abi.PaddedPieceSize, abi.PaddedPieceSize, abi.ChainEpoch) error `perm:"admin"`
+		MarketGetAsk              func(context.Context) (*storagemarket.SignedStorageAsk, error)                                      `perm:"read"`
 
-		PledgeSector func(context.Context) error `perm:"write"`
+		PledgeSector  func(context.Context) error      `perm:"write"`
+		PledgeSectors func(context.Context, int) error `perm:"write"`
 
 		SectorsStatus func(context.Context, abi.SectorNumber) (api.SectorInfo, error) `perm:"read"`
 		SectorsList   func(context.Context) ([]abi.SectorNumber, error)               `perm:"read"`
 		SectorsRefs   func(context.Context) (map[string][]api.SealedRef, error)       `perm:"read"`
 		SectorsUpdate func(context.Context, abi.SectorNumber, api.SectorState) error  `perm:"write"`
 
+		SectorsExtend       func(context.Context, []abi.SectorNumber, abi.ChainEpoch) ([]cid.Cid, error) `perm:"admin"`
+		SectorsTerminateFee func(context.Context, []abi.SectorNumber) (types.BigInt, error)              `perm:"read"`
+		SectorsTerminate    func(context.Context, []abi.SectorNumber) (cid.Cid, error)                   `perm:"admin"`
+		SectorsInactive     func(context.Context) ([]abi.SectorNumber, error)                            `perm:"read"`
+		SectorsRemove       func(context.Context, []abi.SectorNumber) error                              `perm:"admin"`
+
+		SectorsNotify func(context.Context) (<-chan api.SectorChange, error) `perm:"read"`
+
+		SectorsCheck       func(context.Context, []abi.SectorNumber, api.ScrubOptions) ([]api.SectorCheck, error) `perm:"admin"`
+		SectorsScrubStatus func(context.Context) (api.ScrubStatus, error)                                         `perm:"read"`
+
 		WorkerConnect func(context.Context, string) error                             `perm:"admin"` // TODO: worker perm
 		WorkerStats   func(context.Context) (map[uint64]storiface.WorkerStats, error) `perm:"admin"`
+		WorkerTasks   func(context.Context) (map[string]api.WorkerTasks, error)       `perm:"admin"`
+		WorkerJobs    func(context.Context) ([]api.WorkerJob, error)                  `perm:"admin"`
+
+		SealingAbort func(context.Context, uint64) error `perm:"admin"`
+
+		ProvingHistory func(context.Context) ([]api.WindowPoStAttempt, error)       `perm:"read"`
+		ProvingDryRun  func(context.Context, uint64) (api.WindowPoStAttempt, error) `perm:"admin"`
 
 		StorageList          func(context.Context) (map[stores.ID][]stores.Decl, error)                                                                     `perm:"admin"`
 		StorageLocal         func(context.Context) (map[stores.ID]string, error)                                                                            `perm:"admin"`
@@ -208,8 +256,10 @@ type StorageMinerStruct struct {
 		StorageBestAlloc     func(ctx context.Context, allocate stores.SectorFileType, spt abi.RegisteredProof, sealing bool) ([]stores.StorageInfo, error) `perm:"admin"`
 		StorageReportHealth  func(ctx context.Context, id stores.ID, report stores.HealthReport) error                                                      `perm:"admin"`
 
-		DealsImportData func(ctx context.Context, dealPropCid cid.Cid, file string) error `perm:"write"`
-		DealsList       func(ctx context.Context) ([]storagemarket.StorageDeal, error)    `perm:"read"`
+		DealsImportData    func(ctx context.Context, dealPropCid cid.Cid, file string) error     `perm:"write"`
+		DealsList          func(ctx context.Context) ([]storagemarket.StorageDeal, error)        `perm:"read"`
+		DealsPendingImport func(ctx context.Context) ([]storagemarket.MinerDeal, error)          `perm:"read"`
+		DealsImportDir     func(ctx context.Context, dir string) ([]api.DealImportResult, error) `perm:"write"`
 
 		StorageAddLocal func(ctx context.Context, path string) error `perm:"admin"`
 	}
@@ -224,6 +274,7 @@ type WorkerStruct struct {
 		TaskTypes func(context.Context) (map[sealtasks.TaskType]struct{}, error) `perm:"admin"`
 		Paths     func(context.Context) ([]stores.StoragePath, error)            `perm:"admin"`
 		Info      func(context.Context) (storiface.WorkerInfo, error)            `perm:"admin"`
+		Limits    func(context.Context) (api.WorkerLimits, error)                `perm:"admin"`
 
 		SealPreCommit1 func(ctx context.Context, sector abi.SectorID, ticket abi.SealRandomness, pieces []abi.PieceInfo) (storage.PreCommit1Out, error)                                                           `perm:"admin"`
 		SealPreCommit2 func(context.Context, abi.SectorID, storage.PreCommit1Out) (cids storage.SectorCids, err error)                                                                                            `perm:"admin"`
@@ -271,6 +322,34 @@ func (c *CommonStruct) NetFindPeer(ctx context.Context, p peer.ID) (peer.AddrInf
 	return c.Internal.NetFindPeer(ctx, p)
 }
 
+func (c *CommonStruct) NetPeerScores(ctx context.Context) ([]api.PeerScore, error) {
+	return c.Internal.NetPeerScores(ctx)
+}
+
+func (c *CommonStruct) NetBandwidthStats(ctx context.Context) (metrics.Stats, error) {
+	return c.Internal.NetBandwidthStats(ctx)
+}
+
+func (c *CommonStruct) NetBandwidthStatsByPeer(ctx context.Context) (map[string]metrics.Stats, error) {
+	return c.Internal.NetBandwidthStatsByPeer(ctx)
+}
+
+func (c *CommonStruct) NetBandwidthStatsByProtocol(ctx context.Context) (map[protocol.ID]metrics.Stats, error) {
+	return c.Internal.NetBandwidthStatsByProtocol(ctx)
+}
+
+func (c *CommonStruct) NetBlockAdd(ctx context.Context, target string, dur time.Duration, reason string) error {
+	return c.Internal.NetBlockAdd(ctx, target, dur, reason)
+}
+
+func (c *CommonStruct) NetBlockRemove(ctx context.Context, target string) error {
+	return c.Internal.NetBlockRemove(ctx, target)
+}
+
+func (c *CommonStruct) NetBlockList(ctx context.Context) ([]api.NetBlockRule, error) {
+	return c.Internal.NetBlockList(ctx)
+}
+
 // ID implements API.ID
 func (c *CommonStruct) ID(ctx context.Context) (peer.ID, error) {
 	return c.Internal.ID(ctx)
@@ -295,6 +374,14 @@ func (c *FullNodeStruct) ClientListImports(ctx context.Context) ([]api.Import, e
 	return c.Internal.ClientListImports(ctx)
 }
 
+func (c *FullNodeStruct) ClientRemoveImport(ctx context.Context, root cid.Cid) error {
+	return c.Internal.ClientRemoveImport(ctx, root)
+}
+
+func (c *FullNodeStruct) ClientGCBlockstore(ctx context.Context) (*api.ClientGCResult, error) {
+	return c.Internal.ClientGCBlockstore(ctx)
+}
+
 func (c *FullNodeStruct) ClientImport(ctx context.Context, ref api.FileRef) (cid.Cid, error) {
 	return c.Internal.ClientImport(ctx, ref)
 }
@@ -310,6 +397,21 @@ func (c *FullNodeStruct) ClientFindData(ctx context.Context, root cid.Cid) ([]ap
 func (c *FullNodeStruct) ClientStartDeal(ctx context.Context, params *api.StartDealParams) (*cid.Cid, error) {
 	return c.Internal.ClientStartDeal(ctx, params)
 }
+func (c *FullNodeStruct) ClientStartDealAuto(ctx context.Context, params *api.StartDealAutoParams) (*api.DealPlacement, error) {
+	return c.Internal.ClientStartDealAuto(ctx, params)
+}
+func (c *FullNodeStruct) ClientListDealPlacements(ctx context.Context) ([]api.DealPlacement, error) {
+	return c.Internal.ClientListDealPlacements(ctx)
+}
+func (c *FullNodeStruct) ClientMonitoredDeals(ctx context.Context) ([]api.MonitoredDeal, error) {
+	return c.Internal.ClientMonitoredDeals(ctx)
+}
+func (c *FullNodeStruct) ClientDealAlerts(ctx context.Context) (<-chan api.MonitoredDeal, error) {
+	return c.Internal.ClientDealAlerts(ctx)
+}
+func (c *FullNodeStruct) ClientRenewDeal(ctx context.Context, proposal cid.Cid, miner address.Address, maxPrice types.BigInt) error {
+	return c.Internal.ClientRenewDeal(ctx, proposal, miner, maxPrice)
+}
 func (c *FullNodeStruct) ClientGetDealInfo(ctx context.Context, deal cid.Cid) (*api.DealInfo, error) {
 	return c.Internal.ClientGetDealInfo(ctx, deal)
 }
@@ -318,6 +420,14 @@ func (c *FullNodeStruct) ClientListDeals(ctx context.Context) ([]api.DealInfo, e
 	return c.Internal.ClientListDeals(ctx)
 }
 
+func (c *FullNodeStruct) ClientListRetrievals(ctx context.Context) ([]api.RetrievalInfo, error) {
+	return c.Internal.ClientListRetrievals(ctx)
+}
+
+func (c *FullNodeStruct) ClientGetRetrievalUpdates(ctx context.Context) (<-chan api.RetrievalInfo, error) {
+	return c.Internal.ClientGetRetrievalUpdates(ctx)
+}
+
 func (c *FullNodeStruct) ClientRetrieve(ctx context.Context, order api.RetrievalOrder, ref api.FileRef) error {
 	return c.Internal.ClientRetrieve(ctx, order, ref)
 }
@@ -537,6 +647,10 @@ func (c *FullNodeStruct) StateMinerFaults(ctx context.Context, actor address.Add
 	return c.Internal.StateMinerFaults(ctx, actor, tsk)
 }
 
+func (c *FullNodeStruct) StateMinerRecoveries(ctx context.Context, actor address.Address, tsk types.TipSetKey) ([]abi.SectorNumber, error) {
+	return c.Internal.StateMinerRecoveries(ctx, actor, tsk)
+}
+
 func (c *FullNodeStruct) StateMinerInitialPledgeCollateral(ctx context.Context, maddr address.Address, snum abi.SectorNumber, tsk types.TipSetKey) (types.BigInt, error) {
 	return c.Internal.StateMinerInitialPledgeCollateral(ctx, maddr, snum, tsk)
 }
@@ -621,6 +735,10 @@ func (c *FullNodeStruct) StateListMessages(ctx context.Context, match *types.Mes
 	return c.Internal.StateListMessages(ctx, match, tsk, toht)
 }
 
+func (c *FullNodeStruct) StateMinerRewards(ctx context.Context, maddr address.Address, from abi.ChainEpoch, tsk types.TipSetKey) ([]api.MinerReward, error) {
+	return c.Internal.StateMinerRewards(ctx, maddr, from, tsk)
+}
+
 func (c *FullNodeStruct) StateCompute(ctx context.Context, height abi.ChainEpoch, msgs []*types.Message, tsk types.TipSetKey) (*api.ComputeStateOutput, error) {
 	return c.Internal.StateCompute(ctx, height, msgs, tsk)
 }
@@ -707,6 +825,10 @@ func (c *StorageMinerStruct) MiningBase(ctx context.Context) (*types.TipSet, err
 	return c.Internal.MiningBase(ctx)
 }
 
+func (c *StorageMinerStruct) MinerRoundsHistory(ctx context.Context, n int) ([]api.MiningRound, error) {
+	return c.Internal.MinerRoundsHistory(ctx, n)
+}
+
 func (c *StorageMinerStruct) ActorSectorSize(ctx context.Context, addr address.Address) (abi.SectorSize, error) {
 	return c.Internal.ActorSectorSize(ctx, addr)
 }
@@ -715,6 +837,10 @@ func (c *StorageMinerStruct) PledgeSector(ctx context.Context) error {
 	return c.Internal.PledgeSector(ctx)
 }
 
+func (c *StorageMinerStruct) PledgeSectors(ctx context.Context, n int) error {
+	return c.Internal.PledgeSectors(ctx, n)
+}
+
 // Get the status of a given sector by ID
 func (c *StorageMinerStruct) SectorsStatus(ctx context.Context, sid abi.SectorNumber) (api.SectorInfo, error) {
 	return c.Internal.SectorsStatus(ctx, sid)
@@ -733,6 +859,46 @@ func (c *StorageMinerStruct) SectorsUpdate(ctx context.Context, id abi.SectorNum
 	return c.Internal.SectorsUpdate(ctx, id, state)
 }
 
+func (c *StorageMinerStruct) SectorsExtend(ctx context.Context, sectors []abi.SectorNumber, newExpiration abi.ChainEpoch) ([]cid.Cid, error) {
+	return c.Internal.SectorsExtend(ctx, sectors, newExpiration)
+}
+
+func (c *StorageMinerStruct) SectorsTerminateFee(ctx context.Context, sectors []abi.SectorNumber) (types.BigInt, error) {
+	return c.Internal.SectorsTerminateFee(ctx, sectors)
+}
+
+func (c *StorageMinerStruct) SectorsTerminate(ctx context.Context, sectors []abi.SectorNumber) (cid.Cid, error) {
+	return c.Internal.SectorsTerminate(ctx, sectors)
+}
+
+func (c *StorageMinerStruct) SectorsInactive(ctx context.Context) ([]abi.SectorNumber, error) {
+	return c.Internal.SectorsInactive(ctx)
+}
+
+func (c *StorageMinerStruct) SectorsRemove(ctx context.Context, sectors []abi.SectorNumber) error {
+	return c.Internal.SectorsRemove(ctx, sectors)
+}
+
+func (c *StorageMinerStruct) SectorsNotify(ctx context.Context) (<-chan api.SectorChange, error) {
+	return c.Internal.SectorsNotify(ctx)
+}
+
+func (c *StorageMinerStruct) SectorsCheck(ctx context.Context, sectors []abi.SectorNumber, opts api.ScrubOptions) ([]api.SectorCheck, error) {
+	return c.Internal.SectorsCheck(ctx, sectors, opts)
+}
+
+func (c *StorageMinerStruct) SectorsScrubStatus(ctx context.Context) (api.ScrubStatus, error) {
+	return c.Internal.SectorsScrubStatus(ctx)
+}
+
+func (c *StorageMinerStruct) ProvingHistory(ctx context.Context) ([]api.WindowPoStAttempt, error) {
+	return c.Internal.ProvingHistory(ctx)
+}
+
+func (c *StorageMinerStruct) ProvingDryRun(ctx context.Context, deadline uint64) (api.WindowPoStAttempt, error) {
+	return c.Internal.ProvingDryRun(ctx, deadline)
+}
+
 func (c *StorageMinerStruct) WorkerConnect(ctx context.Context, url string) error {
 	return c.Internal.WorkerConnect(ctx, url)
 }
@@ -741,6 +907,18 @@ func (c *StorageMinerStruct) WorkerStats(ctx context.Context) (map[uint64]storif
 	return c.Internal.WorkerStats(ctx)
 }
 
+func (c *StorageMinerStruct) WorkerTasks(ctx context.Context) (map[string]api.WorkerTasks, error) {
+	return c.Internal.WorkerTasks(ctx)
+}
+
+func (c *StorageMinerStruct) WorkerJobs(ctx context.Context) ([]api.WorkerJob, error) {
+	return c.Internal.WorkerJobs(ctx)
+}
+
+func (c *StorageMinerStruct) SealingAbort(ctx context.Context, job uint64) error {
+	return c.Internal.SealingAbort(ctx, job)
+}
+
 func (c *StorageMinerStruct) StorageAttach(ctx context.Context, si stores.StorageInfo, st stores.FsStat) error {
 	return c.Internal.StorageAttach(ctx, si, st)
 }
@@ -793,10 +971,30 @@ func (c *StorageMinerStruct) MarketListIncompleteDeals(ctx context.Context) ([]s
 	return c.Internal.MarketListIncompleteDeals(ctx)
 }
 
+func (c *StorageMinerStruct) MarketListRetrievalDeals(ctx context.Context) ([]api.RetrievalInfo, error) {
+	return c.Internal.MarketListRetrievalDeals(ctx)
+}
+
+func (c *StorageMinerStruct) MarketGetRetrievalPolicy(ctx context.Context) (*api.RetrievalPolicy, error) {
+	return c.Internal.MarketGetRetrievalPolicy(ctx)
+}
+
+func (c *StorageMinerStruct) MarketSetRetrievalPolicy(ctx context.Context, policy *api.RetrievalPolicy) error {
+	return c.Internal.MarketSetRetrievalPolicy(ctx, policy)
+}
+
 func (c *StorageMinerStruct) MarketSetPrice(ctx context.Context, p types.BigInt) error {
 	return c.Internal.MarketSetPrice(ctx, p)
 }
 
+func (c *StorageMinerStruct) MarketSetAsk(ctx context.Context, price types.BigInt, minPieceSize, maxPieceSize abi.PaddedPieceSize, duration abi.ChainEpoch) error {
+	return c.Internal.MarketSetAsk(ctx, price, minPieceSize, maxPieceSize, duration)
+}
+
+func (c *StorageMinerStruct) MarketGetAsk(ctx context.Context) (*storagemarket.SignedStorageAsk, error) {
+	return c.Internal.MarketGetAsk(ctx)
+}
+
 func (c *StorageMinerStruct) DealsImportData(ctx context.Context, dealPropCid cid.Cid, file string) error {
 	return c.Internal.DealsImportData(ctx, dealPropCid, file)
 }
@@ -805,6 +1003,14 @@ func (c *StorageMinerStruct) DealsList(ctx context.Context) ([]storagemarket.Sto
 	return c.Internal.DealsList(ctx)
 }
 
+func (c *StorageMinerStruct) DealsPendingImport(ctx context.Context) ([]storagemarket.MinerDeal, error) {
+	return c.Internal.DealsPendingImport(ctx)
+}
+
+func (c *StorageMinerStruct) DealsImportDir(ctx context.Context, dir string) ([]api.DealImportResult, error) {
+	return c.Internal.DealsImportDir(ctx, dir)
+}
+
 func (c *StorageMinerStruct) StorageAddLocal(ctx context.Context, path string) error {
 	return c.Internal.StorageAddLocal(ctx, path)
 }
@@ -827,6 +1033,10 @@ func (w *WorkerStruct) Info(ctx context.Context) (storiface.WorkerInfo, error) {
 	return w.Internal.Info(ctx)
 }
 
+func (w *WorkerStruct) Limits(ctx context.Context) (api.WorkerLimits, error) {
+	return w.Internal.Limits(ctx)
+}
+
 func (w *WorkerStruct) SealPreCommit1(ctx context.Context, sector abi.SectorID, ticket abi.SealRandomness, pieces []abi.PieceInfo) (storage.PreCommit1Out, error) {
 	return w.Internal.SealPreCommit1(ctx, sector, ticket, pieces)
 }
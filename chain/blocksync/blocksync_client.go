@@ -21,10 +21,13 @@ import (
 	"golang.org/x/xerrors"
 
 	cborutil "github.com/filecoin-project/go-cbor-util"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
 	"github.com/filecoin-project/lotus/chain/store"
 	"github.com/filecoin-project/lotus/chain/types"
 	incrt "github.com/filecoin-project/lotus/lib/increadtimeout"
 	"github.com/filecoin-project/lotus/lib/peermgr"
+	"github.com/filecoin-project/lotus/lib/peerrep"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
 )
 
@@ -37,11 +40,11 @@ type BlockSync struct {
 	peerMgr   *peermgr.PeerMgr
 }
 
-func NewBlockSyncClient(bserv dtypes.ChainBlockService, h host.Host, pmgr peermgr.MaybePeerMgr, gs dtypes.Graphsync) *BlockSync {
+func NewBlockSyncClient(bserv dtypes.ChainBlockService, h host.Host, pmgr peermgr.MaybePeerMgr, gs dtypes.Graphsync, rep *peerrep.PeerRep) *BlockSync {
 	return &BlockSync{
 		bserv:     bserv,
 		host:      h,
-		syncPeers: newPeerTracker(pmgr.Mgr),
+		syncPeers: newPeerTracker(pmgr.Mgr, rep),
 		peerMgr:   pmgr.Mgr,
 		gsync:     gs,
 	}
@@ -179,7 +182,8 @@ func (bs *BlockSync) GetChainMessages(ctx context.Context, h *types.TipSet, coun
 	ctx, span := trace.StartSpan(ctx, "GetChainMessages")
 	defer span.End()
 
-	peers := bs.getPeers()
+	// don't ask peers which told us they don't have the history we need
+	peers := bs.getPeersWithHistory(h.Height() - abi.ChainEpoch(count))
 	// randomize the first few peers so we don't always pick the same peer
 	shufflePrefix(peers)
 
@@ -349,6 +353,13 @@ func (bs *BlockSync) GetBlock(ctx context.Context, c cid.Cid) (*types.BlockHeade
 }
 
 func (bs *BlockSync) AddPeer(p peer.ID) {
+	// peers speaking older hello versions don't advertise capabilities, so
+	// assume they serve chain data
+	if caps, ok := peermgr.GetPeerCapabilities(bs.host.Peerstore(), p); ok && !caps.Capabilities.CanServeChain() {
+		log.Debugw("not adding peer which doesn't serve chain data", "peer", p, "caps", caps.Capabilities)
+		return
+	}
+
 	bs.syncPeers.addPeer(p)
 }
 
@@ -356,10 +367,30 @@ func (bs *BlockSync) RemovePeer(p peer.ID) {
 	bs.syncPeers.removePeer(p)
 }
 
+// PeerCapabilities returns capabilities the peer advertised in hello, if any
+func (bs *BlockSync) PeerCapabilities(p peer.ID) (peermgr.PeerCapabilities, bool) {
+	return peermgr.GetPeerCapabilities(bs.host.Peerstore(), p)
+}
+
 func (bs *BlockSync) getPeers() []peer.ID {
 	return bs.syncPeers.prefSortedPeers()
 }
 
+// getPeersWithHistory returns peers which may have chain data at the given
+// height. Peers which didn't advertise their oldest state are assumed to have
+// all of it
+func (bs *BlockSync) getPeersWithHistory(h abi.ChainEpoch) []peer.ID {
+	peers := bs.getPeers()
+	out := peers[:0]
+	for _, p := range peers {
+		if caps, ok := peermgr.GetPeerCapabilities(bs.host.Peerstore(), p); ok && caps.OldestStateHeight > h {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
 func (bs *BlockSync) FetchMessagesByCids(ctx context.Context, cids []cid.Cid) ([]*types.Message, error) {
 	out := make([]*types.Message, len(cids))
 
@@ -451,12 +482,14 @@ type bsPeerTracker struct {
 	avgGlobalTime time.Duration
 
 	pmgr *peermgr.PeerMgr
+	rep  *peerrep.PeerRep
 }
 
-func newPeerTracker(pmgr *peermgr.PeerMgr) *bsPeerTracker {
+func newPeerTracker(pmgr *peermgr.PeerMgr, rep *peerrep.PeerRep) *bsPeerTracker {
 	return &bsPeerTracker{
 		peers: make(map[peer.ID]*peerStats),
 		pmgr:  pmgr,
+		rep:   rep,
 	}
 }
 
@@ -478,13 +511,25 @@ const (
 	newPeerMul = 0.9
 )
 
+// reputationMul scales the expected cost of requesting data from a peer by its
+// reputation: well behaved peers get up to 2x cheaper, misbehaving peers
+// quickly go to the end of the list
+func reputationMul(score float64) float64 {
+	if score >= 0 {
+		return 1 - 0.5*score/peerrep.MaxScore
+	}
+	return 1 - score/10
+}
+
 func (bpt *bsPeerTracker) prefSortedPeers() []peer.ID {
 	// TODO: this could probably be cached, but as long as its not too many peers, fine for now
 	bpt.lk.Lock()
 	defer bpt.lk.Unlock()
 	out := make([]peer.ID, 0, len(bpt.peers))
+	repMul := make(map[peer.ID]float64, len(bpt.peers))
 	for p := range bpt.peers {
 		out = append(out, p)
+		repMul[p] = reputationMul(bpt.rep.Score(p))
 	}
 
 	// sort by 'expected cost' of requesting data from that peer
@@ -522,7 +567,7 @@ func (bpt *bsPeerTracker) prefSortedPeers() []peer.ID {
 			costJ = getPeerInitLat(out[j])
 		}
 
-		return costI < costJ
+		return costI*repMul[out[i]] < costJ*repMul[out[j]]
 	})
 
 	return out
@@ -561,6 +606,8 @@ func (bpt *bsPeerTracker) logSuccess(p peer.ID, dur time.Duration) {
 	bpt.lk.Lock()
 	defer bpt.lk.Unlock()
 
+	bpt.rep.Record(p, peerrep.EvtBlockSyncSuccess)
+
 	if pi, ok := bpt.peers[p]; !ok {
 		log.Warnw("log success called on peer not in tracker", "peerid", p.String())
 		return
@@ -574,6 +621,9 @@ func (bpt *bsPeerTracker) logSuccess(p peer.ID, dur time.Duration) {
 func (bpt *bsPeerTracker) logFailure(p peer.ID, dur time.Duration) {
 	bpt.lk.Lock()
 	defer bpt.lk.Unlock()
+
+	bpt.rep.Record(p, peerrep.EvtBlockSyncFailure)
+
 	if pi, ok := bpt.peers[p]; !ok {
 		log.Warn("log failure called on peer not in tracker", "peerid", p.String())
 		return
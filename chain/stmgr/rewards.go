@@ -0,0 +1,156 @@
+package stmgr
+
+import (
+	"bytes"
+	"context"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+	"github.com/filecoin-project/specs-actors/actors/builtin/reward"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+// GetMinerRewards walks the chain back from ts down to the from epoch, and
+// returns what the miner earned for each block it mined and what was burnt
+// from its funds, for each epoch with either, oldest first. Every tipset in
+// the range is re-executed to find burnt fees, so this is slow over long
+// ranges
+func GetMinerRewards(ctx context.Context, sm *StateManager, ts *types.TipSet, maddr address.Address, from abi.ChainEpoch) ([]api.MinerReward, error) {
+	mid, err := sm.LookupID(ctx, maddr, ts)
+	if err != nil {
+		return nil, xerrors.Errorf("looking up miner id: %w", err)
+	}
+
+	var out []api.MinerReward
+	for ts.Height() >= from {
+		r, err := minerEpochReward(ctx, sm, ts, mid)
+		if err != nil {
+			return nil, xerrors.Errorf("getting rewards at %d: %w", ts.Height(), err)
+		}
+		if r != nil {
+			out = append(out, *r)
+		}
+
+		if ts.Height() == 0 {
+			break
+		}
+
+		next, err := sm.cs.LoadTipSet(ts.Parents())
+		if err != nil {
+			return nil, xerrors.Errorf("loading next tipset: %w", err)
+		}
+		ts = next
+	}
+
+	// reverse, so the oldest reward comes first
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+
+	return out, nil
+}
+
+// minerEpochReward executes the tipset, and returns the reward for the block
+// of the miner and what was burnt from its funds. It returns nil if the miner
+// didn't mine a block and nothing was burnt
+func minerEpochReward(ctx context.Context, sm *StateManager, ts *types.TipSet, mid address.Address) (*api.MinerReward, error) {
+	st, trace, err := sm.ExecutionTrace(ctx, ts)
+	if err != nil {
+		return nil, xerrors.Errorf("executing tipset: %w", err)
+	}
+
+	out := &api.MinerReward{
+		Epoch:     ts.Height(),
+		Reward:    big.Zero(),
+		GasReward: big.Zero(),
+		Penalty:   big.Zero(),
+		Burnt:     minerBurns(trace, mid),
+	}
+
+	// tipsets contain at most one block of each miner
+	var mined bool
+	for _, b := range ts.Blocks() {
+		if b.Miner != mid {
+			continue
+		}
+
+		mined = true
+		out.Block = b.Cid()
+		if err := blockReward(out, trace, mid); err != nil {
+			return nil, xerrors.Errorf("getting reward for block %s: %w", b.Cid(), err)
+		}
+	}
+	if !mined && out.Burnt.IsZero() {
+		return nil, nil
+	}
+
+	var mas miner.State
+	if _, err := sm.LoadActorStateRaw(ctx, mid, &mas, st); err != nil {
+		return nil, xerrors.Errorf("loading miner state: %w", err)
+	}
+	out.LockedFunds = mas.LockedFunds
+	out.PreCommitDeposits = mas.PreCommitDeposits
+
+	return out, nil
+}
+
+// blockReward sets the reward paid to the miner for its block from the reward
+// message in the trace
+func blockReward(out *api.MinerReward, trace []*api.InvocResult, mid address.Address) error {
+	for _, ir := range trace {
+		if ir.Msg.To != builtin.RewardActorAddr || ir.Msg.Method != builtin.MethodsReward.AwardBlockReward {
+			continue
+		}
+
+		var params reward.AwardBlockRewardParams
+		if err := params.UnmarshalCBOR(bytes.NewReader(ir.Msg.Params)); err != nil {
+			return xerrors.Errorf("unmarshaling award params: %w", err)
+		}
+		if params.Miner != mid {
+			continue
+		}
+
+		out.GasReward = params.GasReward
+		out.Penalty = params.Penalty
+
+		// the reward actor pays out the block reward plus gas fees, reduced
+		// by the penalty
+		for _, sub := range ir.InternalExecutions {
+			if sub.Msg.To == mid && sub.MsgRct.ExitCode == 0 {
+				out.Reward = big.Add(out.Reward, sub.Msg.Value)
+			}
+		}
+		return nil
+	}
+
+	return xerrors.Errorf("no reward message found")
+}
+
+// minerBurns sums funds the miner actor burnt in the trace. Fault fees and
+// penalties for undeclared faults are burnt in cron, termination fees and
+// fees for declared faults in messages to the miner
+func minerBurns(trace []*api.InvocResult, mid address.Address) abi.TokenAmount {
+	burnt := big.Zero()
+
+	var walk func([]*types.ExecutionResult)
+	walk = func(ers []*types.ExecutionResult) {
+		for _, er := range ers {
+			if er.Msg.From == mid && er.Msg.To == builtin.BurntFundsActorAddr && er.MsgRct.ExitCode == 0 {
+				burnt = big.Add(burnt, er.Msg.Value)
+			}
+			walk(er.Subcalls)
+		}
+	}
+	for _, ir := range trace {
+		walk(ir.InternalExecutions)
+	}
+
+	return burnt
+}
@@ -0,0 +1,113 @@
+package stmgr
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	"github.com/filecoin-project/specs-actors/actors/builtin/reward"
+	"github.com/filecoin-project/specs-actors/actors/runtime/exitcode"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/actors"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+func send(from, to address.Address, v int64, exit exitcode.ExitCode, subcalls ...*types.ExecutionResult) *types.ExecutionResult {
+	return &types.ExecutionResult{
+		Msg:      &types.Message{From: from, To: to, Value: abi.NewTokenAmount(v)},
+		MsgRct:   &types.MessageReceipt{ExitCode: exit},
+		Subcalls: subcalls,
+	}
+}
+
+func TestMinerBurns(t *testing.T) {
+	mid, other := mustIDAddress(t, 1000), mustIDAddress(t, 1001)
+	burnt := builtin.BurntFundsActorAddr
+
+	trace := []*api.InvocResult{
+		// fault fees and undeclared fault penalties are burnt in cron
+		{
+			Msg: &types.Message{To: builtin.CronActorAddr},
+			InternalExecutions: []*types.ExecutionResult{
+				send(builtin.CronActorAddr, builtin.StoragePowerActorAddr, 0, 0,
+					send(builtin.StoragePowerActorAddr, mid, 0, 0,
+						send(mid, burnt, 10, 0),
+						send(mid, burnt, 5, 0),
+					),
+					send(builtin.StoragePowerActorAddr, other, 0, 0,
+						send(other, burnt, 100, 0),
+					),
+				),
+			},
+		},
+		// termination fees in messages to the miner
+		{
+			Msg: &types.Message{To: mid},
+			InternalExecutions: []*types.ExecutionResult{
+				send(mid, burnt, 20, 0),
+				// failed sends don't burn anything
+				send(mid, burnt, 1000, 16),
+				send(mid, other, 1000, 0),
+			},
+		},
+	}
+
+	if b := minerBurns(trace, mid); !b.Equals(big.NewInt(35)) {
+		t.Fatalf("expected 35 burnt, got %s", b)
+	}
+	if b := minerBurns(trace, other); !b.Equals(big.NewInt(100)) {
+		t.Fatalf("expected 100 burnt, got %s", b)
+	}
+}
+
+func TestBlockReward(t *testing.T) {
+	mid, other := mustIDAddress(t, 1000), mustIDAddress(t, 1001)
+
+	award := func(m address.Address, paid int64) *api.InvocResult {
+		params, err := actors.SerializeParams(&reward.AwardBlockRewardParams{
+			Miner:     m,
+			Penalty:   abi.NewTokenAmount(3),
+			GasReward: abi.NewTokenAmount(7),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return &api.InvocResult{
+			Msg: &types.Message{
+				To:     builtin.RewardActorAddr,
+				Method: builtin.MethodsReward.AwardBlockReward,
+				Params: params,
+			},
+			InternalExecutions: []*types.ExecutionResult{
+				send(builtin.RewardActorAddr, m, paid, 0),
+				send(builtin.RewardActorAddr, builtin.BurntFundsActorAddr, 3, 0),
+			},
+		}
+	}
+
+	out := &api.MinerReward{Reward: big.Zero()}
+	if err := blockReward(out, []*api.InvocResult{award(other, 50), award(mid, 104)}, mid); err != nil {
+		t.Fatal(err)
+	}
+	if !out.Reward.Equals(big.NewInt(104)) || !out.GasReward.Equals(big.NewInt(7)) || !out.Penalty.Equals(big.NewInt(3)) {
+		t.Fatalf("unexpected reward %+v", out)
+	}
+
+	if err := blockReward(&api.MinerReward{}, []*api.InvocResult{award(other, 50)}, mid); err == nil {
+		t.Fatal("expected error without a reward message for the miner")
+	}
+}
+
+func mustIDAddress(t *testing.T, id uint64) address.Address {
+	t.Helper()
+
+	a, err := address.NewIDAddress(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
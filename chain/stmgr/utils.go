@@ -268,6 +268,26 @@ func GetMinerFaults(ctx context.Context, sm *StateManager, ts *types.TipSet, mad
 	return out, nil
 }
 
+func GetMinerRecoveries(ctx context.Context, sm *StateManager, ts *types.TipSet, maddr address.Address) ([]abi.SectorNumber, error) {
+	var mas miner.State
+	_, err := sm.LoadActorState(ctx, maddr, &mas, ts)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load miner actor state: %w", err)
+	}
+
+	recoveries, err := mas.Recoveries.All(miner.SectorsMax)
+	if err != nil {
+		return nil, xerrors.Errorf("reading recoveries bit set: %w", err)
+	}
+
+	out := make([]abi.SectorNumber, len(recoveries))
+	for i, r := range recoveries {
+		out[i] = abi.SectorNumber(r)
+	}
+
+	return out, nil
+}
+
 func GetStorageDeal(ctx context.Context, sm *StateManager, dealId abi.DealID, ts *types.TipSet) (*api.MarketDeal, error) {
 	var state market.State
 	if _, err := sm.LoadActorState(ctx, builtin.StorageMarketActorAddr, &state, ts); err != nil {
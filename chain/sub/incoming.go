@@ -19,6 +19,7 @@ import (
 	"github.com/filecoin-project/lotus/chain"
 	"github.com/filecoin-project/lotus/chain/messagepool"
 	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/peerrep"
 	"github.com/filecoin-project/lotus/metrics"
 )
 
@@ -89,19 +90,24 @@ type BlockValidator struct {
 	recvBlocks *blockReceiptCache
 
 	blacklist func(peer.ID)
+
+	rep *peerrep.PeerRep
 }
 
-func NewBlockValidator(blacklist func(peer.ID)) *BlockValidator {
+func NewBlockValidator(blacklist func(peer.ID), rep *peerrep.PeerRep) *BlockValidator {
 	p, _ := lru.New2Q(4096)
 	return &BlockValidator{
 		peers:      p,
 		killThresh: 10,
 		blacklist:  blacklist,
 		recvBlocks: newBlockReceiptCache(),
+		rep:        rep,
 	}
 }
 
 func (bv *BlockValidator) flagPeer(p peer.ID) {
+	bv.rep.Record(p, peerrep.EvtPubsubReject)
+
 	v, ok := bv.peers.Get(p)
 	if !ok {
 		bv.peers.Add(p, int(1))
@@ -145,6 +151,7 @@ func (bv *BlockValidator) Validate(ctx context.Context, pid peer.ID, msg *pubsub
 	}
 
 	msg.ValidatorData = blk
+	bv.rep.Record(pid, peerrep.EvtPubsubAccept)
 	stats.Record(ctx, metrics.BlockValidationSuccess.M(1))
 	return pubsub.ValidationAccept
 }
@@ -174,10 +181,11 @@ func (brc *blockReceiptCache) add(bcid cid.Cid) int {
 
 type MessageValidator struct {
 	mpool *messagepool.MessagePool
+	rep   *peerrep.PeerRep
 }
 
-func NewMessageValidator(mp *messagepool.MessagePool) *MessageValidator {
-	return &MessageValidator{mp}
+func NewMessageValidator(mp *messagepool.MessagePool, rep *peerrep.PeerRep) *MessageValidator {
+	return &MessageValidator{mp, rep}
 }
 
 func (mv *MessageValidator) Validate(ctx context.Context, pid peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
@@ -187,6 +195,7 @@ func (mv *MessageValidator) Validate(ctx context.Context, pid peer.ID, msg *pubs
 		log.Warnf("failed to decode incoming message: %s", err)
 		ctx, _ = tag.New(ctx, tag.Insert(metrics.FailureType, "decode"))
 		stats.Record(ctx, metrics.MessageValidationFailure.M(1))
+		mv.rep.Record(pid, peerrep.EvtPubsubReject)
 		return pubsub.ValidationReject
 	}
 
@@ -47,6 +47,7 @@ import (
 	"github.com/filecoin-project/lotus/chain/store"
 	"github.com/filecoin-project/lotus/chain/types"
 	"github.com/filecoin-project/lotus/chain/vm"
+	"github.com/filecoin-project/lotus/lib/peerrep"
 	"github.com/filecoin-project/lotus/lib/sigs"
 	"github.com/filecoin-project/lotus/metrics"
 )
@@ -55,6 +56,10 @@ var log = logging.Logger("chain")
 
 var LocalIncoming = "incoming"
 
+// persistBatchSize is how many synced tipsets are persisted before reporting
+// progress
+const persistBatchSize = 1000
+
 type Syncer struct {
 	// The interface for accessing and putting tipsets into local storage
 	store *store.ChainStore
@@ -85,9 +90,11 @@ type Syncer struct {
 	receiptTracker *blockReceiptTracker
 
 	verifier ffiwrapper.Verifier
+
+	rep *peerrep.PeerRep
 }
 
-func NewSyncer(sm *stmgr.StateManager, bsync *blocksync.BlockSync, connmgr connmgr.ConnManager, self peer.ID, beacon beacon.RandomBeacon, verifier ffiwrapper.Verifier) (*Syncer, error) {
+func NewSyncer(sm *stmgr.StateManager, bsync *blocksync.BlockSync, connmgr connmgr.ConnManager, self peer.ID, beacon beacon.RandomBeacon, verifier ffiwrapper.Verifier, rep *peerrep.PeerRep) (*Syncer, error) {
 	gen, err := sm.ChainStore().GetGenesis()
 	if err != nil {
 		return nil, xerrors.Errorf("getting genesis block: %w", err)
@@ -109,11 +116,15 @@ func NewSyncer(sm *stmgr.StateManager, bsync *blocksync.BlockSync, connmgr connm
 		receiptTracker: newBlockReceiptTracker(),
 		connmgr:        connmgr,
 		verifier:       verifier,
+		rep:            rep,
 
 		incoming: pubsub.New(50),
 	}
 
 	s.syncmgr = NewSyncManager(s.Sync)
+	s.syncmgr.getHead = s.store.GetHeaviestTipSet
+	s.syncmgr.dropPeer = s.Bsync.RemovePeer
+	s.syncmgr.peerCaps = s.Bsync.PeerCapabilities
 	return s, nil
 }
 
@@ -168,6 +179,7 @@ func (syncer *Syncer) InformNewHead(from peer.ID, fts *store.FullTipSet) bool {
 	}
 
 	syncer.Bsync.AddPeer(from)
+	syncer.receiptTracker.Add(from, fts.TipSet())
 
 	bestPweight := syncer.store.GetHeaviestTipSet().Blocks()[0].ParentWeight
 	targetWeight := fts.TipSet().Blocks()[0].ParentWeight
@@ -422,6 +434,10 @@ func (syncer *Syncer) Sync(ctx context.Context, maybeHead *types.TipSet) error {
 	}
 
 	if err := syncer.collectChain(ctx, maybeHead); err != nil {
+		for _, p := range syncer.receiptTracker.GetPeers(maybeHead) {
+			syncer.rep.Record(p, peerrep.EvtSyncFailure)
+		}
+
 		span.AddAttributes(trace.StringAttribute("col_error", err.Error()))
 		span.SetStatus(trace.Status{
 			Code:    13,
@@ -440,6 +456,9 @@ func (syncer *Syncer) Sync(ctx context.Context, maybeHead *types.TipSet) error {
 	}
 
 	peers := syncer.receiptTracker.GetPeers(maybeHead)
+	for _, p := range peers {
+		syncer.rep.Record(p, peerrep.EvtSyncSuccess)
+	}
 	if len(peers) > 0 {
 		syncer.connmgr.TagPeer(peers[0], "new-block", 40)
 
@@ -1331,17 +1350,28 @@ func (syncer *Syncer) collectChain(ctx context.Context, ts *types.TipSet) error
 	}
 
 	ss.SetStage(api.StagePersistHeaders)
+	ss.SetHeight(0)
 
-	toPersist := make([]*types.BlockHeader, 0, len(headers)*int(build.BlocksPerEpoch))
-	for _, ts := range headers {
-		toPersist = append(toPersist, ts.Blocks()...)
-	}
-	if err := syncer.store.PersistBlockHeaders(toPersist...); err != nil {
-		err = xerrors.Errorf("failed to persist synced blocks to the chainstore: %w", err)
-		ss.Error(err)
-		return err
+	// persist from the oldest tipset up, reporting progress after each batch
+	// so long header chains don't look stalled
+	for i := len(headers); i > 0; i -= persistBatchSize {
+		start := i - persistBatchSize
+		if start < 0 {
+			start = 0
+		}
+
+		toPersist := make([]*types.BlockHeader, 0, (i-start)*int(build.BlocksPerEpoch))
+		for _, ts := range headers[start:i] {
+			toPersist = append(toPersist, ts.Blocks()...)
+		}
+		if err := syncer.store.PersistBlockHeaders(toPersist...); err != nil {
+			err = xerrors.Errorf("failed to persist synced blocks to the chainstore: %w", err)
+			ss.Error(err)
+			return err
+		}
+
+		ss.SetHeight(headers[start].Height())
 	}
-	toPersist = nil
 
 	ss.SetStage(api.StageMessages)
 
@@ -1373,6 +1403,11 @@ func (syncer *Syncer) State() []SyncerState {
 	return out
 }
 
+// Recoveries returns recent actions taken by the sync watchdog
+func (syncer *Syncer) Recoveries() []api.SyncRecovery {
+	return syncer.syncmgr.Recoveries()
+}
+
 func (syncer *Syncer) MarkBad(blk cid.Cid) {
 	syncer.bad.Add(blk, "manually marked bad")
 }
@@ -4,8 +4,11 @@ import (
 	"context"
 	"sort"
 	"sync"
+	"time"
 
+	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/peermgr"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 )
 
@@ -37,6 +40,21 @@ type SyncManager struct {
 
 	doSync func(context.Context, *types.TipSet) error
 
+	// watchdog state, see sync_watchdog.go
+	wdLk         sync.Mutex
+	activeWork   []*workerSync
+	recoveries   []api.SyncRecovery
+	lastHead     *types.TipSet
+	lastHeadTime time.Time
+
+	// getHead returns the current chain head, used to detect a stuck head,
+	// dropPeer stops using the peer for chain sync. Both are optional
+	getHead  func() *types.TipSet
+	dropPeer func(peer.ID)
+
+	// peerCaps returns capabilities a peer advertised in hello, optional
+	peerCaps func(peer.ID) (peermgr.PeerCapabilities, bool)
+
 	stop chan struct{}
 
 	// Sync Scheduler fields
@@ -55,21 +73,27 @@ type syncResult struct {
 const syncWorkerCount = 3
 
 func NewSyncManager(sync SyncFunc) *SyncManager {
-	return &SyncManager{
+	sm := &SyncManager{
 		bspThresh:       1,
 		peerHeads:       make(map[peer.ID]*types.TipSet),
 		syncTargets:     make(chan *types.TipSet),
 		syncResults:     make(chan *syncResult),
 		syncStates:      make([]*SyncerState, syncWorkerCount),
+		activeWork:      make([]*workerSync, syncWorkerCount),
 		incomingTipSets: make(chan *types.TipSet),
 		activeSyncs:     make(map[types.TipSetKey]*types.TipSet),
 		doSync:          sync,
 		stop:            make(chan struct{}),
 	}
+	for i := range sm.syncStates {
+		sm.syncStates[i] = &SyncerState{}
+	}
+	return sm
 }
 
 func (sm *SyncManager) Start() {
 	go sm.syncScheduler()
+	go sm.watchdog()
 	for i := 0; i < syncWorkerCount; i++ {
 		go sm.syncWorker(i)
 	}
@@ -82,6 +106,13 @@ func (sm *SyncManager) Stop() {
 func (sm *SyncManager) SetPeerHead(ctx context.Context, p peer.ID, ts *types.TipSet) {
 	sm.lk.Lock()
 	defer sm.lk.Unlock()
+
+	if sm.getBootstrapState() == BSStateInit && !sm.canServe(p) {
+		// don't bootstrap from peers which can't give us the chain
+		log.Debugw("not counting peer towards sync bootstrap", "peer", p)
+		return
+	}
+
 	sm.peerHeads[p] = ts
 
 	if sm.getBootstrapState() == BSStateInit {
@@ -104,6 +135,28 @@ func (sm *SyncManager) SetPeerHead(ctx context.Context, p peer.ID, ts *types.Tip
 	sm.incomingTipSets <- ts
 }
 
+// canServe returns false if the peer advertised that it can't serve chain
+// data, or doesn't have state back to our head. Peers speaking older hello
+// versions are assumed to serve everything
+func (sm *SyncManager) canServe(p peer.ID) bool {
+	if sm.peerCaps == nil {
+		return true
+	}
+
+	caps, ok := sm.peerCaps(p)
+	if !ok {
+		return true
+	}
+	if !caps.Capabilities.CanServeChain() {
+		return false
+	}
+	// 0 means the peer doesn't know yet
+	if caps.OldestStateHeight > 0 && sm.getHead != nil && caps.OldestStateHeight > sm.getHead().Height() {
+		return false
+	}
+	return true
+}
+
 type syncBucketSet struct {
 	buckets []*syncTargetBucket
 }
@@ -372,8 +425,7 @@ func (sm *SyncManager) scheduleWorkSent() {
 }
 
 func (sm *SyncManager) syncWorker(id int) {
-	ss := &SyncerState{}
-	sm.syncStates[id] = ss
+	ss := sm.syncStates[id]
 	for {
 		select {
 		case ts, ok := <-sm.syncTargets:
@@ -382,7 +434,11 @@ func (sm *SyncManager) syncWorker(id int) {
 				return
 			}
 
-			ctx := context.WithValue(context.TODO(), syncStateKey{}, ss)
+			ctx, cancel := context.WithCancel(context.TODO())
+			ws := &workerSync{cancel: cancel, done: make(chan struct{})}
+			sm.setActiveWork(id, ws)
+
+			ctx = context.WithValue(ctx, syncStateKey{}, ss)
 			err := sm.doSync(ctx, ts)
 			if err != nil {
 				log.Errorf("sync error: %+v", err)
@@ -392,6 +448,10 @@ func (sm *SyncManager) syncWorker(id int) {
 				ts:      ts,
 				success: err == nil,
 			}
+
+			sm.setActiveWork(id, nil)
+			cancel()
+			close(ws.done)
 		}
 	}
 }
@@ -6,8 +6,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/libp2p/go-libp2p-core/peer"
+
+	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/chain/types"
 	"github.com/filecoin-project/lotus/chain/types/mock"
+	"github.com/filecoin-project/lotus/lib/peermgr"
 )
 
 var genTs = mock.TipSet(mock.MkBlock(nil, 0, 0))
@@ -148,3 +152,103 @@ func TestSyncManager(t *testing.T) {
 		op3.done()
 	})
 }
+
+func TestSyncManagerCapabilities(t *testing.T) {
+	ctx := context.Background()
+
+	a := mock.TipSet(mock.MkBlock(genTs, 1, 1))
+	b := mock.TipSet(mock.MkBlock(a, 1, 2))
+
+	caps := map[peer.ID]peermgr.PeerCapabilities{
+		"storage": {Capabilities: peermgr.CapStorage},
+		"pruned":  {Capabilities: peermgr.CapBlockSync, OldestStateHeight: 10},
+		"unknown": {Capabilities: peermgr.CapBlockSync},
+		"full":    {Capabilities: peermgr.CapGraphsyncSync, OldestStateHeight: 1},
+	}
+
+	runSyncMgrTest(t, "testBootstrapCapabilities", 3, func(t *testing.T, sm *SyncManager, stc chan *syncOp) {
+		sm.getHead = func() *types.TipSet { return a }
+		sm.peerCaps = func(p peer.ID) (peermgr.PeerCapabilities, bool) {
+			c, ok := caps[p]
+			return c, ok
+		}
+
+		// peers which can't serve the chain from our head don't count
+		sm.SetPeerHead(ctx, "storage", b)
+		sm.SetPeerHead(ctx, "pruned", b)
+		sm.SetPeerHead(ctx, "unknown", b)
+		sm.SetPeerHead(ctx, "full", b)
+		assertNoOp(t, stc)
+
+		// peers speaking older hello versions do
+		sm.SetPeerHead(ctx, "old", b)
+		assertGetSyncOp(t, stc, b)
+	})
+}
+
+func TestSyncWatchdog(t *testing.T) {
+	ctx := context.Background()
+
+	a := mock.TipSet(mock.MkBlock(genTs, 1, 1))
+	b := mock.TipSet(mock.MkBlock(genTs, 2, 2))
+
+	syncTargets := make(chan *types.TipSet, 4)
+	sm := NewSyncManager(func(ctx context.Context, ts *types.TipSet) error {
+		ss := extractSyncState(ctx)
+		ss.Init(genTs, ts)
+		syncTargets <- ts
+
+		if ts.Equals(a) {
+			// never makes progress until cancelled
+			<-ctx.Done()
+			ss.Error(ctx.Err())
+			return ctx.Err()
+		}
+
+		ss.SetStage(api.StageSyncComplete)
+		return nil
+	})
+
+	var dropped []peer.ID
+	sm.dropPeer = func(p peer.ID) {
+		dropped = append(dropped, p)
+	}
+
+	sm.Start()
+	defer sm.Stop()
+
+	sm.SetPeerHead(ctx, "peer1", a)
+	select {
+	case ts := <-syncTargets:
+		assertTsEqual(t, ts, a)
+	case <-time.After(time.Second):
+		t.Fatal("expected sync to start")
+	}
+
+	sm.SetPeerHead(ctx, "peer2", b)
+
+	sm.checkStalled(time.Now())
+	if len(sm.Recoveries()) != 0 {
+		t.Fatal("watchdog shouldn't act on syncs making progress")
+	}
+
+	sm.checkStalled(time.Now().Add(SyncStallTimeout + time.Second))
+
+	select {
+	case ts := <-syncTargets:
+		assertTsEqual(t, ts, b)
+	case <-time.After(time.Second):
+		t.Fatal("expected sync to be retried with another target")
+	}
+
+	recs := sm.Recoveries()
+	if len(recs) != 1 {
+		t.Fatalf("expected 1 recovery, got %d", len(recs))
+	}
+	if len(recs[0].DroppedPeers) != 1 || recs[0].DroppedPeers[0] != "peer1" || len(dropped) != 1 {
+		t.Fatalf("expected peer1 to be dropped, got %v", recs[0].DroppedPeers)
+	}
+	if !recs[0].Retry.Equals(b) {
+		t.Fatalf("expected retry with %s, got %s", b.Cids(), recs[0].Retry.Cids())
+	}
+}
@@ -0,0 +1,200 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+var (
+	// SyncStallTimeout is how long a sync can go without advancing its stage
+	// or height before the watchdog cancels it
+	SyncStallTimeout = 5 * time.Minute
+
+	// HeadStallTimeout is how long the chain head can stay the same while
+	// peers report heavier heads before the watchdog restarts sync
+	HeadStallTimeout = 10 * time.Duration(build.BlockDelay) * time.Second
+
+	watchdogInterval = 30 * time.Second
+)
+
+const maxSyncRecoveries = 16
+
+func (sm *SyncManager) watchdog() {
+	tick := time.NewTicker(watchdogInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+			sm.checkStalled(time.Now())
+		case <-sm.stop:
+			return
+		}
+	}
+}
+
+func (sm *SyncManager) checkStalled(now time.Time) {
+	var stalled bool
+
+	for id, ss := range sm.syncStates {
+		snap := ss.Snapshot()
+		if !snap.active() || now.Sub(snap.LastProgress) < SyncStallTimeout {
+			continue
+		}
+
+		sm.recover(id, snap.Target, fmt.Sprintf("%s made no progress for %s", SyncStageString(snap.Stage), now.Sub(snap.LastProgress).Truncate(time.Second)))
+		stalled = true
+	}
+
+	if stalled || sm.getHead == nil || !sm.IsBootstrapped() {
+		return
+	}
+
+	head := sm.getHead()
+
+	sm.wdLk.Lock()
+	if sm.lastHead == nil || !sm.lastHead.Equals(head) {
+		sm.lastHead = head
+		sm.lastHeadTime = now
+	}
+	headAge := now.Sub(sm.lastHeadTime)
+	sm.wdLk.Unlock()
+
+	if headAge < HeadStallTimeout {
+		return
+	}
+
+	sm.lk.Lock()
+	best, err := sm.selectSyncTarget()
+	sm.lk.Unlock()
+	if err != nil || best == nil || !best.ParentWeight().GreaterThan(head.ParentWeight()) {
+		// nobody has anything better, the network may just be quiet
+		return
+	}
+
+	reason := fmt.Sprintf("chain head stuck at %d for %s", head.Height(), headAge.Truncate(time.Second))
+
+	var cancelled bool
+	for id, ss := range sm.syncStates {
+		snap := ss.Snapshot()
+		if !snap.active() {
+			continue
+		}
+
+		sm.recover(id, snap.Target, reason)
+		cancelled = true
+	}
+
+	if !cancelled {
+		sm.recover(-1, nil, reason)
+	}
+
+	sm.wdLk.Lock()
+	sm.lastHeadTime = now
+	sm.wdLk.Unlock()
+}
+
+// recover cancels the sync running in the given worker, drops peers which
+// gave us the sync target, and restarts sync with the best remaining target
+func (sm *SyncManager) recover(worker int, target *types.TipSet, reason string) {
+	log.Warnw("sync watchdog recovering stalled sync", "worker", worker, "reason", reason)
+
+	rec := api.SyncRecovery{
+		Time:   time.Now(),
+		Reason: reason,
+		Worker: worker,
+		Target: target,
+	}
+
+	var done <-chan struct{}
+	if worker >= 0 {
+		sm.wdLk.Lock()
+		ws := sm.activeWork[worker]
+		sm.wdLk.Unlock()
+
+		if ws != nil {
+			ws.cancel()
+			done = ws.done
+		}
+	}
+
+	sm.lk.Lock()
+	if target != nil {
+		for p, ts := range sm.peerHeads {
+			if ts.Equals(target) {
+				delete(sm.peerHeads, p)
+				rec.DroppedPeers = append(rec.DroppedPeers, p)
+			}
+		}
+	}
+	retry, err := sm.selectSyncTarget()
+	sm.lk.Unlock()
+	if err != nil {
+		log.Errorf("sync watchdog: selecting new sync target: %s", err)
+	}
+
+	if sm.dropPeer != nil {
+		for _, p := range rec.DroppedPeers {
+			sm.dropPeer(p)
+		}
+	}
+
+	if retry != nil {
+		rec.Retry = retry
+		go func() {
+			// wait for the scheduler to process the cancelled sync, so the
+			// retry isn't bucketed with it and dropped
+			if done != nil {
+				select {
+				case <-done:
+				case <-sm.stop:
+					return
+				}
+			}
+
+			if sm.getBootstrapState() != BSStateComplete {
+				sm.setBootstrapState(BSStateSelected)
+			}
+
+			select {
+			case sm.incomingTipSets <- retry:
+			case <-sm.stop:
+			}
+		}()
+	}
+
+	sm.wdLk.Lock()
+	sm.recoveries = append(sm.recoveries, rec)
+	if len(sm.recoveries) > maxSyncRecoveries {
+		sm.recoveries = sm.recoveries[len(sm.recoveries)-maxSyncRecoveries:]
+	}
+	sm.wdLk.Unlock()
+}
+
+// workerSync is a sync running in a worker
+type workerSync struct {
+	cancel context.CancelFunc
+	// done is closed once the scheduler received the sync result
+	done chan struct{}
+}
+
+func (sm *SyncManager) setActiveWork(worker int, ws *workerSync) {
+	sm.wdLk.Lock()
+	defer sm.wdLk.Unlock()
+	sm.activeWork[worker] = ws
+}
+
+// Recoveries returns recent actions taken by the sync watchdog, oldest first
+func (sm *SyncManager) Recoveries() []api.SyncRecovery {
+	sm.wdLk.Lock()
+	defer sm.wdLk.Unlock()
+
+	out := make([]api.SyncRecovery, len(sm.recoveries))
+	copy(out, sm.recoveries)
+	return out
+}
@@ -37,6 +37,10 @@ type SyncerState struct {
 	Message string
 	Start   time.Time
 	End     time.Time
+
+	// LastProgress is when the sync last advanced a stage or height, used to
+	// detect stalled syncs
+	LastProgress time.Time
 }
 
 func (ss *SyncerState) SetStage(v api.SyncStateStage) {
@@ -47,6 +51,7 @@ func (ss *SyncerState) SetStage(v api.SyncStateStage) {
 	ss.lk.Lock()
 	defer ss.lk.Unlock()
 	ss.Stage = v
+	ss.LastProgress = time.Now()
 	if v == api.StageSyncComplete {
 		ss.End = time.Now()
 	}
@@ -66,6 +71,7 @@ func (ss *SyncerState) Init(base, target *types.TipSet) {
 	ss.Message = ""
 	ss.Start = time.Now()
 	ss.End = time.Time{}
+	ss.LastProgress = ss.Start
 }
 
 func (ss *SyncerState) SetHeight(h abi.ChainEpoch) {
@@ -76,6 +82,7 @@ func (ss *SyncerState) SetHeight(h abi.ChainEpoch) {
 	ss.lk.Lock()
 	defer ss.lk.Unlock()
 	ss.Height = h
+	ss.LastProgress = time.Now()
 }
 
 func (ss *SyncerState) Error(err error) {
@@ -101,5 +108,12 @@ func (ss *SyncerState) Snapshot() SyncerState {
 		Message: ss.Message,
 		Start:   ss.Start,
 		End:     ss.End,
+
+		LastProgress: ss.LastProgress,
 	}
 }
+
+// active returns true if the sync is in progress, meant to be called on snapshots
+func (ss *SyncerState) active() bool {
+	return ss.Target != nil && ss.End.IsZero()
+}
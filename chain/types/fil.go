@@ -1,6 +1,7 @@
 package types
 
 import (
+	"encoding"
 	"fmt"
 	"math/big"
 	"strings"
@@ -40,3 +41,23 @@ func ParseFIL(s string) (FIL, error) {
 
 	return FIL{r.Num()}, nil
 }
+
+func (f FIL) MarshalText() (text []byte, err error) {
+	if f.Int == nil {
+		return []byte("0"), nil
+	}
+	return []byte(f.String()), nil
+}
+
+func (f *FIL) UnmarshalText(text []byte) error {
+	p, err := ParseFIL(string(text))
+	if err != nil {
+		return err
+	}
+
+	*f = p
+	return nil
+}
+
+var _ encoding.TextMarshaler = FIL{}
+var _ encoding.TextUnmarshaler = (*FIL)(nil)
@@ -1,18 +1,25 @@
 package cli
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
 	"text/tabwriter"
+	"time"
 
 	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"golang.org/x/xerrors"
 	"gopkg.in/urfave/cli.v2"
 
 	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
 	"github.com/filecoin-project/go-fil-markets/storagemarket"
 	"github.com/filecoin-project/specs-actors/actors/abi"
 	"github.com/filecoin-project/specs-actors/actors/builtin/market"
@@ -28,12 +35,20 @@ var clientCmd = &cli.Command{
 		clientImportCmd,
 		clientCommPCmd,
 		clientLocalCmd,
+		clientRemoveImportCmd,
+		clientGCCmd,
 		clientDealCmd,
+		clientDealAutoCmd,
+		clientPlacementsCmd,
 		clientFindCmd,
 		clientRetrieveCmd,
 		clientQueryAskCmd,
 		clientListDeals,
+		clientDealHealthCmd,
+		clientRenewDealCmd,
+		clientRetrievalsCmd,
 		clientCarGenCmd,
+		clientOfflineCmd,
 	},
 }
 
@@ -150,12 +165,66 @@ var clientLocalCmd = &cli.Command{
 			return err
 		}
 		for _, v := range list {
-			fmt.Printf("%s %s %d %s\n", v.Key, v.FilePath, v.Size, v.Status)
+			imported := "-"
+			if !v.Imported.IsZero() {
+				imported = v.Imported.Format(time.Stamp)
+			}
+			path := v.FilePath
+			if v.Retrieved {
+				path = "(retrieved)"
+			}
+			fmt.Printf("%s %s %d %s %s deals:%d\n", v.Key, path, v.Size, v.Status, imported, len(v.Deals))
 		}
 		return nil
 	},
 }
 
+var clientRemoveImportCmd = &cli.Command{
+	Name:      "remove-import",
+	Usage:     "Remove imported data and its blocks not used by other imports",
+	ArgsUsage: "[dataCid]",
+	Action: func(cctx *cli.Context) error {
+		if !cctx.Args().Present() {
+			return xerrors.New("expected data cid")
+		}
+
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		root, err := cid.Parse(cctx.Args().First())
+		if err != nil {
+			return err
+		}
+
+		return api.ClientRemoveImport(ctx, root)
+	},
+}
+
+var clientGCCmd = &cli.Command{
+	Name:  "gc",
+	Usage: "Remove blocks not used by imports or unfinished deals from the client blockstore",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		res, err := api.ClientGCBlockstore(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("removed %d blocks, kept %d\n", res.Removed, res.Kept)
+		return nil
+	},
+}
+
 var clientDealCmd = &cli.Command{
 	Name:      "deal",
 	Usage:     "Initialize storage deal with a miner",
@@ -268,6 +337,128 @@ var clientDealCmd = &cli.Command{
 	},
 }
 
+var clientDealAutoCmd = &cli.Command{
+	Name:      "deal-auto",
+	Usage:     "Start storage deals for replicas of data with automatically selected miners",
+	ArgsUsage: "[dataCid maxPrice duration]",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  "replicas",
+			Usage: "number of miners to store the data with",
+			Value: 1,
+		},
+		&cli.StringFlag{
+			Name:  "from",
+			Usage: "specify address to fund the deals with",
+		},
+		&cli.Int64Flag{
+			Name:  "start-epoch",
+			Usage: "specify the epoch that the deals should start at",
+			Value: -1,
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		if cctx.NArg() != 3 {
+			return xerrors.New("expected 3 args: dataCid, maxPrice, duration")
+		}
+
+		data, err := cid.Parse(cctx.Args().Get(0))
+		if err != nil {
+			return err
+		}
+
+		maxPrice, err := types.ParseFIL(cctx.Args().Get(1))
+		if err != nil {
+			return err
+		}
+
+		dur, err := strconv.ParseInt(cctx.Args().Get(2), 10, 32)
+		if err != nil {
+			return err
+		}
+
+		var a address.Address
+		if from := cctx.String("from"); from != "" {
+			a, err = address.NewFromString(from)
+			if err != nil {
+				return xerrors.Errorf("failed to parse 'from' address: %w", err)
+			}
+		} else {
+			a, err = api.WalletDefaultAddress(ctx)
+			if err != nil {
+				return err
+			}
+		}
+
+		pl, err := api.ClientStartDealAuto(ctx, &lapi.StartDealAutoParams{
+			Data: &storagemarket.DataRef{
+				TransferType: storagemarket.TTGraphsync,
+				Root:         data,
+			},
+			Wallet:            a,
+			MaxPrice:          types.BigInt(maxPrice),
+			MinBlocksDuration: uint64(dur),
+			DealStartEpoch:    abi.ChainEpoch(cctx.Int64("start-epoch")),
+			Replicas:          cctx.Int("replicas"),
+		})
+		if err != nil {
+			return err
+		}
+
+		printPlacement(pl)
+		return nil
+	},
+}
+
+var clientPlacementsCmd = &cli.Command{
+	Name:  "placements",
+	Usage: "List deals started with automatically selected miners",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		pls, err := api.ClientListDealPlacements(ctx)
+		if err != nil {
+			return err
+		}
+
+		for i := range pls {
+			if i > 0 {
+				fmt.Println()
+			}
+			printPlacement(&pls[i])
+		}
+		return nil
+	},
+}
+
+func printPlacement(pl *lapi.DealPlacement) {
+	fmt.Printf("Placement %d: %s, %d replicas, piece size %s, %d candidates left\n",
+		pl.ID, pl.Params.Data.Root, pl.Params.Replicas, types.SizeStr(types.NewInt(uint64(pl.PieceSize))), len(pl.Candidates))
+
+	w := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Miner\tDealCid\tState\tMessage\n")
+	for _, d := range pl.Deals {
+		dc := "-"
+		if d.ProposalCid.Defined() {
+			dc = d.ProposalCid.String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", d.Miner, dc, storagemarket.DealStates[d.State], d.Message)
+	}
+	_ = w.Flush()
+}
+
 var clientFindCmd = &cli.Command{
 	Name:      "find",
 	Usage:     "find data in the network",
@@ -331,6 +522,18 @@ var clientRetrieveCmd = &cli.Command{
 			Name:  "car",
 			Usage: "export to a car file instead of a regular file",
 		},
+		&cli.StringFlag{
+			Name:  "path",
+			Usage: "retrieve only the file or directory at this unixfs path below the root",
+		},
+		&cli.Uint64Flag{
+			Name:  "offset",
+			Usage: "retrieve a byte range of the file starting at this offset",
+		},
+		&cli.Uint64Flag{
+			Name:  "length",
+			Usage: "length of the byte range to retrieve, 0 retrieves to the end of the file",
+		},
 	},
 	Action: func(cctx *cli.Context) error {
 		if cctx.NArg() != 2 {
@@ -360,17 +563,8 @@ var clientRetrieveCmd = &cli.Command{
 			return err
 		}
 
-		// Check if we already have this data locally
-
-		/*has, err := api.ClientHasLocal(ctx, file)
-		if err != nil {
-			return err
-		}
-
-		if has {
-			fmt.Println("Success: Already in local storage")
-			return nil
-		}*/ // TODO: fix
+		// data already stored locally isn't retrieved again, so interrupted
+		// retrievals can be resumed by running the command again
 
 		offers, err := api.ClientFindData(ctx, file)
 		if err != nil {
@@ -388,7 +582,12 @@ var clientRetrieveCmd = &cli.Command{
 			Path:  cctx.Args().Get(1),
 			IsCAR: cctx.Bool("car"),
 		}
-		if err := api.ClientRetrieve(ctx, offers[0].Order(payer), ref); err != nil {
+		order := offers[0].Order(payer)
+		order.Path = cctx.String("path")
+		order.Offset = cctx.Uint64("offset")
+		order.Length = cctx.Uint64("length")
+
+		if err := api.ClientRetrieve(ctx, order, ref); err != nil {
 			return xerrors.Errorf("Retrieval Failed: %w", err)
 		}
 
@@ -536,3 +735,452 @@ type deal struct {
 	LocalDeal        lapi.DealInfo
 	OnChainDealState market.DealState
 }
+
+var clientDealHealthCmd = &cli.Command{
+	Name:  "deal-health",
+	Usage: "List active storage deals with their health, as checked by the deal monitor",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "watch",
+			Usage: "keep printing deals which got slashed, faulted or are near expiry",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		if cctx.Bool("watch") {
+			alerts, err := api.ClientDealAlerts(ctx)
+			if err != nil {
+				return err
+			}
+
+			for d := range alerts {
+				fmt.Printf("epoch %d: deal %d with %s is %s\n", d.Checked, d.DealID, d.Provider, d.Health)
+				if d.Message != "" {
+					fmt.Printf("\t%s\n", d.Message)
+				}
+			}
+			return nil
+		}
+
+		deals, err := api.ClientMonitoredDeals(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "DealId\tProvider\tPieceCID\tSector\tEnd\tHealth\tChecked\tRenewals\tMessage\n")
+		for _, d := range deals {
+			sector := "?"
+			if d.SectorKnown {
+				sector = fmt.Sprint(d.Sector)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\t%d\t%d\t%s\n",
+				d.DealID, d.Provider, d.PieceCID, sector, d.EndEpoch, d.Health, d.Checked,
+				len(d.Renewals)+len(d.RenewalPlacements), d.Message)
+		}
+		return w.Flush()
+	},
+}
+
+var clientRenewDealCmd = &cli.Command{
+	Name:      "renew-deal",
+	Usage:     "Start a new deal for the data of an active deal",
+	ArgsUsage: "[proposalCid]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "miner",
+			Usage: "miner to renew with, for the same price; the deal's miner by default",
+		},
+		&cli.StringFlag{
+			Name:  "max-price",
+			Usage: "select other miners asking at most this price per GiB per epoch",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		if cctx.NArg() != 1 {
+			return xerrors.New("expected 1 arg: proposalCid")
+		}
+
+		proposal, err := cid.Parse(cctx.Args().First())
+		if err != nil {
+			return err
+		}
+
+		var miner address.Address
+		maxPrice := types.EmptyInt
+		switch {
+		case cctx.IsSet("miner") && cctx.IsSet("max-price"):
+			return xerrors.New("--miner and --max-price can't be used together")
+		case cctx.IsSet("miner"):
+			miner, err = address.NewFromString(cctx.String("miner"))
+			if err != nil {
+				return err
+			}
+		case cctx.IsSet("max-price"):
+			p, err := types.ParseFIL(cctx.String("max-price"))
+			if err != nil {
+				return err
+			}
+			maxPrice = types.BigInt(p)
+		default:
+			deals, err := api.ClientMonitoredDeals(ctx)
+			if err != nil {
+				return err
+			}
+			for _, d := range deals {
+				if d.ProposalCid.Equals(proposal) {
+					miner = d.Provider
+				}
+			}
+			if miner == address.Undef {
+				return xerrors.Errorf("deal %s isn't monitored", proposal)
+			}
+		}
+
+		return api.ClientRenewDeal(ctx, proposal, miner, maxPrice)
+	},
+}
+
+var clientRetrievalsCmd = &cli.Command{
+	Name:  "retrievals",
+	Usage: "List retrieval deals",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "watch",
+			Usage: "keep printing retrieval deal updates",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		if cctx.Bool("watch") {
+			updates, err := api.ClientGetRetrievalUpdates(ctx)
+			if err != nil {
+				return err
+			}
+
+			for r := range updates {
+				fmt.Printf("%s: deal %d with %s: %s, %s received, %s FIL spent\n",
+					r.Updated.Format(time.Stamp), r.ID, r.Peer, retrievalmarket.DealStatuses[r.Status],
+					types.SizeStr(types.NewInt(r.Bytes)), types.FIL(r.Funds))
+				if r.Message != "" {
+					fmt.Printf("\t%s\n", r.Message)
+				}
+			}
+			return nil
+		}
+
+		deals, err := api.ClientListRetrievals(ctx)
+		if err != nil {
+			return err
+		}
+
+		return PrintRetrievals(os.Stdout, deals)
+	},
+}
+
+// PrintRetrievals prints a table of retrieval deals
+func PrintRetrievals(out io.Writer, deals []lapi.RetrievalInfo) error {
+	w := tabwriter.NewWriter(out, 2, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "ID	PayloadCID	Peer	State	Bytes	Funds	PricePerByte	Started	Message\n")
+	for _, d := range deals {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			d.ID, d.PayloadCID, d.Peer, retrievalmarket.DealStatuses[d.Status],
+			types.SizeStr(types.NewInt(d.Bytes)), types.FIL(d.Funds), types.FIL(d.PricePerByte),
+			d.Started.Format(time.Stamp), d.Message)
+	}
+	return w.Flush()
+}
+
+var clientOfflineCmd = &cli.Command{
+	Name:  "offline",
+	Usage: "Make deals for data shipped to miners outside the network",
+	Subcommands: []*cli.Command{
+		clientOfflinePrepareCmd,
+		clientOfflineDealCmd,
+	},
+}
+
+// offlinePiece is an entry of the manifest written by `client offline prepare`
+type offlinePiece struct {
+	File      string
+	Car       string
+	Root      cid.Cid
+	PieceCID  cid.Cid
+	PieceSize abi.UnpaddedPieceSize
+	// Proposal of the deal made for the piece by `client offline deal`
+	Proposal *cid.Cid `json:",omitempty"`
+}
+
+func readManifest(path string) ([]offlinePiece, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("reading manifest: %w", err)
+	}
+
+	var pieces []offlinePiece
+	if err := json.Unmarshal(b, &pieces); err != nil {
+		return nil, xerrors.Errorf("parsing manifest: %w", err)
+	}
+	return pieces, nil
+}
+
+func writeManifest(path string, pieces []offlinePiece) error {
+	b, err := json.MarshalIndent(pieces, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return xerrors.Errorf("writing manifest: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+var clientOfflinePrepareCmd = &cli.Command{
+	Name:      "prepare",
+	Usage:     "Generate car files and their piece CIDs for many files",
+	ArgsUsage: "[minerAddress outputDir inputPath...]",
+	Description: `Every input file, or file below an input directory, is turned into a car
+   file in outputDir named after its piece CID, which is what miners match
+   shipped files to deals by. The files are listed in outputDir/manifest.json,
+   which is resumable and used by 'client offline deal'. The node and the
+   command have to share the filesystem.`,
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		if cctx.NArg() < 3 {
+			return xerrors.New("expected at least 3 args: minerAddress, outputDir, inputPath")
+		}
+
+		miner, err := address.NewFromString(cctx.Args().First())
+		if err != nil {
+			return err
+		}
+
+		outDir, err := filepath.Abs(cctx.Args().Get(1))
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(outDir, 0755); err != nil {
+			return err
+		}
+
+		manifest := filepath.Join(outDir, "manifest.json")
+		var pieces []offlinePiece
+		if _, err := os.Stat(manifest); err == nil {
+			if pieces, err = readManifest(manifest); err != nil {
+				return err
+			}
+		}
+		done := map[string]bool{}
+		for _, p := range pieces {
+			done[p.File] = true
+		}
+
+		var inputs []string
+		for _, arg := range cctx.Args().Slice()[2:] {
+			err := filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if info.Mode().IsRegular() {
+					abs, err := filepath.Abs(path)
+					if err != nil {
+						return err
+					}
+					inputs = append(inputs, abs)
+				}
+				return nil
+			})
+			if err != nil {
+				return xerrors.Errorf("listing input files: %w", err)
+			}
+		}
+
+		for i, in := range inputs {
+			if done[in] {
+				continue
+			}
+
+			tmp := filepath.Join(outDir, fmt.Sprintf("prepare-%d.car.tmp", i))
+			if err := api.ClientGenCar(ctx, lapi.FileRef{Path: in}, tmp); err != nil {
+				return xerrors.Errorf("generating car for %s: %w", in, err)
+			}
+
+			root, err := carRoot(tmp)
+			if err != nil {
+				return err
+			}
+
+			commP, err := api.ClientCalcCommP(ctx, tmp, miner)
+			if err != nil {
+				return xerrors.Errorf("computing piece CID for %s: %w", in, err)
+			}
+
+			carPath := filepath.Join(outDir, commP.Root.String()+".car")
+			if err := os.Rename(tmp, carPath); err != nil {
+				return err
+			}
+
+			pieces = append(pieces, offlinePiece{
+				File:      in,
+				Car:       carPath,
+				Root:      root,
+				PieceCID:  commP.Root,
+				PieceSize: commP.Size,
+			})
+			if err := writeManifest(manifest, pieces); err != nil {
+				return err
+			}
+
+			fmt.Printf("%s: piece %s, %s\n", in, commP.Root, types.SizeStr(types.NewInt(uint64(commP.Size))))
+		}
+
+		return nil
+	},
+}
+
+// carRoot reads the root CID from the header of a car file
+func carRoot(path string) (cid.Cid, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return cid.Undef, err
+	}
+	defer f.Close() // nolint:errcheck
+
+	h, _, err := car.ReadHeader(bufio.NewReader(f))
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("reading car header of %s: %w", path, err)
+	}
+	if len(h.Roots) != 1 {
+		return cid.Undef, xerrors.Errorf("car %s has %d roots, expected 1", path, len(h.Roots))
+	}
+	return h.Roots[0], nil
+}
+
+var clientOfflineDealCmd = &cli.Command{
+	Name:      "deal",
+	Usage:     "Propose deals without online data transfer for the pieces in a manifest",
+	ArgsUsage: "[manifest miner price duration]",
+	Description: `Proposes a deal for each piece in a manifest written by 'client offline
+   prepare' which doesn't have one yet, and records the proposals in the
+   manifest. The price is per GiB per epoch. Ship the car files to the miner,
+   who imports them with 'lotus-storage-miner deals import-dir'.`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "from",
+			Usage: "specify address to fund the deals with",
+		},
+		&cli.Int64Flag{
+			Name:  "start-epoch",
+			Usage: "specify the epoch that the deals should start at",
+			Value: -1,
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		if cctx.NArg() != 4 {
+			return xerrors.New("expected 4 args: manifest, miner, price, duration")
+		}
+
+		manifest := cctx.Args().Get(0)
+		pieces, err := readManifest(manifest)
+		if err != nil {
+			return err
+		}
+
+		miner, err := address.NewFromString(cctx.Args().Get(1))
+		if err != nil {
+			return err
+		}
+
+		price, err := types.ParseFIL(cctx.Args().Get(2))
+		if err != nil {
+			return err
+		}
+
+		dur, err := strconv.ParseInt(cctx.Args().Get(3), 10, 32)
+		if err != nil {
+			return err
+		}
+
+		var a address.Address
+		if from := cctx.String("from"); from != "" {
+			a, err = address.NewFromString(from)
+			if err != nil {
+				return xerrors.Errorf("failed to parse 'from' address: %w", err)
+			}
+		} else {
+			a, err = api.WalletDefaultAddress(ctx)
+			if err != nil {
+				return err
+			}
+		}
+
+		for i, p := range pieces {
+			if p.Proposal != nil {
+				continue
+			}
+
+			pieceCid := p.PieceCID
+			epochPrice := types.BigDiv(types.BigMul(types.BigInt(price), types.NewInt(uint64(p.PieceSize.Padded()))), types.NewInt(1<<30))
+
+			proposal, err := api.ClientStartDeal(ctx, &lapi.StartDealParams{
+				Data: &storagemarket.DataRef{
+					TransferType: storagemarket.TTManual,
+					Root:         p.Root,
+					PieceCid:     &pieceCid,
+					PieceSize:    p.PieceSize,
+				},
+				Wallet:            a,
+				Miner:             miner,
+				EpochPrice:        epochPrice,
+				MinBlocksDuration: uint64(dur),
+				DealStartEpoch:    abi.ChainEpoch(cctx.Int64("start-epoch")),
+			})
+			if err != nil {
+				return xerrors.Errorf("proposing deal for %s: %w", p.File, err)
+			}
+
+			pieces[i].Proposal = proposal
+			if err := writeManifest(manifest, pieces); err != nil {
+				return err
+			}
+
+			fmt.Printf("%s: piece %s, deal %s\n", p.File, p.PieceCID, proposal)
+		}
+
+		return nil
+	},
+}
@@ -2,13 +2,20 @@ package cli
 
 import (
 	"fmt"
+	"os"
 	"sort"
 	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/libp2p/go-libp2p-core/metrics"
 	"github.com/libp2p/go-libp2p-core/peer"
+	protocol "github.com/libp2p/go-libp2p-core/protocol"
 
+	"golang.org/x/xerrors"
 	"gopkg.in/urfave/cli.v2"
 
+	"github.com/filecoin-project/lotus/chain/types"
 	"github.com/filecoin-project/lotus/lib/addrutil"
 )
 
@@ -21,6 +28,9 @@ var netCmd = &cli.Command{
 		netListen,
 		netId,
 		netFindPeer,
+		netScores,
+		netBandwidthCmd,
+		netBlockCmd,
 	},
 }
 
@@ -160,3 +170,225 @@ var netFindPeer = &cli.Command{
 		return nil
 	},
 }
+
+var netScores = &cli.Command{
+	Name:  "scores",
+	Usage: "Print peer reputation scores",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "events",
+			Usage: "print observed event counts",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		scores, err := api.NetPeerScores(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range scores {
+			var protected string
+			if s.Protected {
+				protected = " (protected)"
+			}
+			fmt.Printf("%s, %.2f%s\n", s.ID, s.Score, protected)
+
+			if cctx.Bool("events") {
+				evts := make([]string, 0, len(s.Events))
+				for e := range s.Events {
+					evts = append(evts, e)
+				}
+				sort.Strings(evts)
+
+				for _, e := range evts {
+					fmt.Printf("\t%s: %d\n", e, s.Events[e])
+				}
+			}
+		}
+
+		return nil
+	},
+}
+
+var netBandwidthCmd = &cli.Command{
+	Name:  "bandwidth",
+	Usage: "Print bandwidth usage information",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "by-peer",
+			Usage: "list bandwidth usage by peer",
+		},
+		&cli.BoolFlag{
+			Name:  "by-protocol",
+			Usage: "list bandwidth usage by protocol",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		tw := tabwriter.NewWriter(os.Stdout, 4, 4, 2, ' ', 0)
+		fmt.Fprintf(tw, "Segment\tTotalIn\tTotalOut\tRateIn\tRateOut\n")
+
+		printStats := func(name string, s metrics.Stats) {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s/s\t%s/s\n", name,
+				types.SizeStr(types.NewInt(uint64(s.TotalIn))),
+				types.SizeStr(types.NewInt(uint64(s.TotalOut))),
+				types.SizeStr(types.NewInt(uint64(s.RateIn))),
+				types.SizeStr(types.NewInt(uint64(s.RateOut))))
+		}
+
+		switch {
+		case cctx.Bool("by-peer"):
+			bw, err := api.NetBandwidthStatsByPeer(ctx)
+			if err != nil {
+				return err
+			}
+
+			var peers []string
+			for p := range bw {
+				peers = append(peers, p)
+			}
+			sort.Slice(peers, func(i, j int) bool {
+				return bw[peers[i]].TotalIn+bw[peers[i]].TotalOut > bw[peers[j]].TotalIn+bw[peers[j]].TotalOut
+			})
+
+			for _, p := range peers {
+				printStats(p, bw[p])
+			}
+		case cctx.Bool("by-protocol"):
+			bw, err := api.NetBandwidthStatsByProtocol(ctx)
+			if err != nil {
+				return err
+			}
+
+			var protos []string
+			for p := range bw {
+				protos = append(protos, string(p))
+			}
+			sort.Strings(protos)
+
+			for _, p := range protos {
+				name := p
+				if name == "" {
+					name = "<unknown>"
+				}
+				printStats(name, bw[protocol.ID(p)])
+			}
+		default:
+			s, err := api.NetBandwidthStats(ctx)
+			if err != nil {
+				return err
+			}
+
+			printStats("Total", s)
+		}
+
+		return tw.Flush()
+	},
+}
+
+var netBlockCmd = &cli.Command{
+	Name:  "block",
+	Usage: "Manage blocked peers, addresses and subnets",
+	Subcommands: []*cli.Command{
+		netBlockAdd,
+		netBlockRemove,
+		netBlockList,
+	},
+}
+
+var netBlockAdd = &cli.Command{
+	Name:      "add",
+	Usage:     "Block connections with a peer ID, multiaddr or CIDR subnet",
+	ArgsUsage: "[peerId | multiaddr | subnet]",
+	Flags: []cli.Flag{
+		&cli.DurationFlag{
+			Name:  "duration",
+			Usage: "how long to block for, blocks permanently when not set",
+		},
+		&cli.StringFlag{
+			Name:  "reason",
+			Usage: "reason for the block, for future reference",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		if cctx.Args().Len() != 1 {
+			return xerrors.New("expected 1 argument")
+		}
+
+		return api.NetBlockAdd(ctx, cctx.Args().First(), cctx.Duration("duration"), cctx.String("reason"))
+	},
+}
+
+var netBlockRemove = &cli.Command{
+	Name:      "remove",
+	Usage:     "Lift a block",
+	ArgsUsage: "[peerId | multiaddr | subnet]",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		if cctx.Args().Len() != 1 {
+			return xerrors.New("expected 1 argument")
+		}
+
+		return api.NetBlockRemove(ctx, cctx.Args().First())
+	},
+}
+
+var netBlockList = &cli.Command{
+	Name:  "list",
+	Usage: "List active blocks",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		rules, err := api.NetBlockList(ctx)
+		if err != nil {
+			return err
+		}
+
+		sort.Slice(rules, func(i, j int) bool {
+			return rules[i].Created.Before(rules[j].Created)
+		})
+
+		tw := tabwriter.NewWriter(os.Stdout, 4, 4, 2, ' ', 0)
+		fmt.Fprintf(tw, "Type\tTarget\tExpires\tReason\n")
+		for _, r := range rules {
+			expires := "never"
+			if !r.Expires.IsZero() {
+				expires = time.Until(r.Expires).Truncate(time.Second).String()
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Type, r.Target, expires, r.Reason)
+		}
+
+		return tw.Flush()
+	},
+}
@@ -70,10 +70,33 @@ var syncStatusCmd = &cli.Command{
 			} else {
 				fmt.Printf("\tElapsed: %s\n", ss.End.Sub(ss.Start))
 			}
+			if ss.End.IsZero() && !ss.LastProgress.IsZero() {
+				fmt.Printf("\tLast progress: %s ago\n", time.Since(ss.LastProgress).Truncate(time.Second))
+			}
 			if ss.Stage == api.StageSyncErrored {
 				fmt.Printf("\tError: %s\n", ss.Message)
 			}
 		}
+
+		if len(state.Recoveries) > 0 {
+			fmt.Println("watchdog recoveries:")
+		}
+		for _, r := range state.Recoveries {
+			fmt.Printf("%s: %s\n", r.Time.Format(time.Stamp), r.Reason)
+			if r.Worker >= 0 {
+				fmt.Printf("\tCancelled worker %d", r.Worker)
+				if r.Target != nil {
+					fmt.Printf(" syncing to %d", r.Target.Height())
+				}
+				fmt.Println()
+			}
+			if len(r.DroppedPeers) > 0 {
+				fmt.Printf("\tDropped peers: %s\n", r.DroppedPeers)
+			}
+			if r.Retry != nil {
+				fmt.Printf("\tRetrying with: %s (%d)\n", r.Retry.Cids(), r.Retry.Height())
+			}
+		}
 		return nil
 	},
 }
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-units"
+	"golang.org/x/xerrors"
+	"gopkg.in/urfave/cli.v2"
+
+	"github.com/filecoin-project/sector-storage/sealtasks"
+
+	"github.com/filecoin-project/lotus/api"
+)
+
+var taskNames = map[string]sealtasks.TaskType{
+	"addpiece":   sealtasks.TTAddPiece,
+	"precommit1": sealtasks.TTPreCommit1,
+	"precommit2": sealtasks.TTPreCommit2,
+	"commit1":    sealtasks.TTCommit1,
+	"commit2":    sealtasks.TTCommit2,
+	"finalize":   sealtasks.TTFinalize,
+	"fetch":      sealtasks.TTFetch,
+}
+
+func taskNameList() []string {
+	out := make([]string, 0, len(taskNames))
+	for name := range taskNames {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func parseLimits(cctx *cli.Context) (api.WorkerLimits, error) {
+	limits := api.WorkerLimits{
+		MaxTasks: map[sealtasks.TaskType]int{},
+		CPUs:     cctx.Uint64("cpus"),
+	}
+
+	for _, s := range cctx.StringSlice("max-tasks") {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 {
+			return api.WorkerLimits{}, xerrors.Errorf("malformed task limit %q, expected type=count", s)
+		}
+
+		tt, ok := taskNames[kv[0]]
+		if !ok {
+			return api.WorkerLimits{}, xerrors.Errorf("unknown task type %q", kv[0])
+		}
+
+		n, err := strconv.Atoi(kv[1])
+		if err != nil || n < 0 {
+			return api.WorkerLimits{}, xerrors.Errorf("malformed task limit %q: expected a non-negative count", s)
+		}
+
+		limits.MaxTasks[tt] = n
+	}
+
+	if m := cctx.String("memory"); m != "" {
+		mem, err := units.RAMInBytes(m)
+		if err != nil {
+			return api.WorkerLimits{}, xerrors.Errorf("parsing memory budget: %w", err)
+		}
+		limits.Memory = uint64(mem)
+	}
+
+	return limits, nil
+}
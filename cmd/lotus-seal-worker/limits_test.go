@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+
+	"gopkg.in/urfave/cli.v2"
+
+	"github.com/filecoin-project/sector-storage/sealtasks"
+)
+
+func limitsContext(t *testing.T, args ...string) *cli.Context {
+	set := flag.NewFlagSet("run", flag.ContinueOnError)
+	for _, f := range runCmd.Flags {
+		// slice flags keep parsed values in the flag, so each context
+		// needs a fresh copy
+		if sf, ok := f.(*cli.StringSliceFlag); ok {
+			cp := *sf
+			cp.Value = nil
+			f = &cp
+		}
+		f.Apply(set)
+	}
+	if err := set.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return cli.NewContext(nil, set, nil)
+}
+
+func TestParseLimits(t *testing.T) {
+	limits, err := parseLimits(limitsContext(t, "--max-tasks", "precommit1=2", "--max-tasks", "commit2=0", "--cpus", "8", "--memory", "96GiB"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if limits.MaxTasks[sealtasks.TTPreCommit1] != 2 || limits.MaxTasks[sealtasks.TTCommit2] != 0 || len(limits.MaxTasks) != 2 {
+		t.Errorf("unexpected task limits %v", limits.MaxTasks)
+	}
+	if limits.CPUs != 8 || limits.Memory != 96<<30 {
+		t.Errorf("unexpected budgets %+v", limits)
+	}
+
+	limits, err = parseLimits(limitsContext(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(limits.MaxTasks) != 0 || limits.CPUs != 0 || limits.Memory != 0 {
+		t.Errorf("expected no limits, got %+v", limits)
+	}
+
+	for args, expect := range map[string]string{
+		"--max-tasks precommit1":      "expected type=count",
+		"--max-tasks seal=1":          "unknown task type",
+		"--max-tasks precommit1=-1":   "non-negative count",
+		"--max-tasks precommit1=many": "non-negative count",
+		"--memory lots":               "parsing memory budget",
+	} {
+		_, err := parseLimits(limitsContext(t, strings.Fields(args)...))
+		if err == nil || !strings.Contains(err.Error(), expect) {
+			t.Errorf("%s: expected error containing %q, got %v", args, expect, err)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
@@ -26,6 +27,7 @@ import (
 	"github.com/filecoin-project/lotus/lib/jsonrpc"
 	"github.com/filecoin-project/lotus/lib/lotuslog"
 	"github.com/filecoin-project/lotus/node/repo"
+	"github.com/filecoin-project/lotus/storage"
 	"github.com/filecoin-project/sector-storage"
 	"github.com/filecoin-project/sector-storage/sealtasks"
 	"github.com/filecoin-project/sector-storage/stores"
@@ -104,6 +106,18 @@ var runCmd = &cli.Command{
 			Usage: "enable commit (32G sectors: all cores or GPUs, 128GiB Memory + 64GiB swap)",
 			Value: true,
 		},
+		&cli.StringSliceFlag{
+			Name:  "max-tasks",
+			Usage: "limit concurrently running tasks of a type, e.g. precommit1=2 (types: " + strings.Join(taskNameList(), ", ") + ")",
+		},
+		&cli.Uint64Flag{
+			Name:  "cpus",
+			Usage: "number of CPU cores the miner may use for tasks on this worker, 0 means all",
+		},
+		&cli.StringFlag{
+			Name:  "memory",
+			Usage: "amount of memory the miner may use for tasks on this worker, e.g. 96GiB, empty means all",
+		},
 	},
 	Action: func(cctx *cli.Context) error {
 		if !cctx.Bool("enable-gpu-proving") {
@@ -169,6 +183,11 @@ var runCmd = &cli.Command{
 			return xerrors.Errorf("no task types specified")
 		}
 
+		limits, err := parseLimits(cctx)
+		if err != nil {
+			return err
+		}
+
 		// Open repo
 
 		repoPath := cctx.String(FlagStorageRepo)
@@ -263,6 +282,7 @@ var runCmd = &cli.Command{
 				SealProof: spt,
 				TaskTypes: taskTypes,
 			}, remote, localStore, nodeApi),
+			limits: limits,
 		}
 
 		mux := mux.NewRouter()
@@ -273,7 +293,7 @@ var runCmd = &cli.Command{
 		rpcServer.Register("Filecoin", apistruct.PermissionedWorkerAPI(workerApi))
 
 		mux.Handle("/rpc/v0", rpcServer)
-		mux.PathPrefix("/remote").HandlerFunc((&stores.FetchHandler{Local: localStore}).ServeHTTP)
+		mux.PathPrefix("/remote").HandlerFunc(storage.RemoteStatHandler(storage.StorePaths{Local: localStore}, (&stores.FetchHandler{Local: localStore}).ServeHTTP))
 		mux.PathPrefix("/").Handler(http.DefaultServeMux) // pprof
 
 		ah := &auth.Handler{
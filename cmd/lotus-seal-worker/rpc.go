@@ -5,16 +5,23 @@ import (
 
 	"github.com/filecoin-project/specs-storage/storage"
 
+	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/build"
 	"github.com/filecoin-project/sector-storage"
 )
 
 type worker struct {
 	*sectorstorage.LocalWorker
+
+	limits api.WorkerLimits
 }
 
 func (w *worker) Version(context.Context) (build.Version, error) {
 	return build.APIVersion, nil
 }
 
+func (w *worker) Limits(context.Context) (api.WorkerLimits, error) {
+	return w.limits, nil
+}
+
 var _ storage.Sealer = &worker{}
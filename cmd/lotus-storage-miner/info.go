@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"time"
 
 	"github.com/fatih/color"
 	"golang.org/x/xerrors"
@@ -135,6 +136,13 @@ var infoCmd = &cli.Command{
 			return err
 		}
 
+		fmt.Println()
+
+		fmt.Println("Mining:")
+		if err := miningInfo(ctx, nodeApi); err != nil {
+			return err
+		}
+
 		// TODO: grab actr state / info
 		//  * Sealed sectors (count / bytes)
 		//  * Power
@@ -217,3 +225,61 @@ func sectorsInfo(ctx context.Context, napi api.StorageMiner) error {
 
 	return nil
 }
+
+// blocks taking longer than this to propagate risk missing the next epoch
+const lateBlockDelay = 6 * time.Second
+
+func miningInfo(ctx context.Context, napi api.StorageMiner) error {
+	rounds, err := napi.MinerRoundsHistory(ctx, 2880)
+	if err != nil {
+		return xerrors.Errorf("getting mining rounds: %w", err)
+	}
+	if len(rounds) == 0 {
+		fmt.Println("\tNo mining rounds recorded")
+		return nil
+	}
+
+	var won, mined, included, orphaned, late, failed int
+	var totalDelay, maxDelay time.Duration
+	for _, r := range rounds {
+		if r.Won {
+			won++
+		}
+		if r.Error != "" {
+			failed++
+		}
+		if r.Block == nil {
+			continue
+		}
+
+		mined++
+		switch r.Inclusion {
+		case api.BlockIncluded:
+			included++
+		case api.BlockOrphaned:
+			orphaned++
+		}
+
+		totalDelay += r.PropagationDelay
+		if r.PropagationDelay > maxDelay {
+			maxDelay = r.PropagationDelay
+		}
+		if r.PropagationDelay > lateBlockDelay {
+			late++
+		}
+	}
+
+	fmt.Printf("\tRounds: %d (epochs %d - %d)\n", len(rounds), rounds[0].Epoch, rounds[len(rounds)-1].Epoch)
+	fmt.Printf("\tWon: %d\n", won)
+	fmt.Printf("\tBlocks: %d (%s included, %s orphaned, %d pending)\n", mined,
+		color.GreenString("%d", included), color.RedString("%d", orphaned), mined-included-orphaned)
+	if failed > 0 {
+		color.Red("\tFailed: %d", failed)
+	}
+	if mined > 0 {
+		fmt.Printf("\tPropagation: avg %s, max %s, %d over %s\n",
+			(totalDelay / time.Duration(mined)).Truncate(time.Millisecond), maxDelay.Truncate(time.Millisecond), late, lateBlockDelay)
+	}
+
+	return nil
+}
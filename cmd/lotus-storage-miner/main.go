@@ -25,6 +25,8 @@ func main() {
 		dealsCmd,
 		infoCmd,
 		initCmd,
+		marketCmd,
+		retrievalDealsCmd,
 		rewardsCmd,
 		runCmd,
 		sectorsCmd,
@@ -3,11 +3,23 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
 
-	"github.com/filecoin-project/lotus/chain/types"
-	lcli "github.com/filecoin-project/lotus/cli"
+	"github.com/docker/go-units"
 	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
 	"gopkg.in/urfave/cli.v2"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+
+	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/chain/types"
+	lcli "github.com/filecoin-project/lotus/cli"
 )
 
 var setPriceCmd = &cli.Command{
@@ -36,12 +48,145 @@ var setPriceCmd = &cli.Command{
 	},
 }
 
+var marketCmd = &cli.Command{
+	Name:  "market",
+	Usage: "manage the storage ask",
+	Subcommands: []*cli.Command{
+		marketGetAskCmd,
+		marketSetAskCmd,
+	},
+}
+
+var marketGetAskCmd = &cli.Command{
+	Name:  "get-ask",
+	Usage: "print the current signed storage ask",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		fnapi, fcloser, err := lcli.GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer fcloser()
+
+		ctx := lcli.DaemonContext(cctx)
+
+		sask, err := api.MarketGetAsk(ctx)
+		if err != nil {
+			return err
+		}
+		ask := sask.Ask
+
+		head, err := fnapi.ChainHead(ctx)
+		if err != nil {
+			return xerrors.Errorf("getting chain head: %w", err)
+		}
+
+		fmt.Printf("Miner:\t\t%s\n", ask.Miner)
+		fmt.Printf("Price:\t\t%s FIL / GiB / Epoch\n", types.FIL(ask.Price))
+		fmt.Printf("Min Piece Size:\t%s\n", types.SizeStr(types.NewInt(uint64(ask.MinPieceSize))))
+		fmt.Printf("Max Piece Size:\t%s\n", types.SizeStr(types.NewInt(uint64(ask.MaxPieceSize))))
+		fmt.Printf("Signed At:\t%d\n", ask.Timestamp)
+
+		left := ask.Expiry - head.Height()
+		if left > 0 {
+			fmt.Printf("Expiry:\t\t%d (in %d epochs, ~%s)\n", ask.Expiry, left, time.Duration(left)*time.Duration(build.BlockDelay)*time.Second)
+		} else {
+			fmt.Printf("Expiry:\t\t%d (expired)\n", ask.Expiry)
+		}
+		fmt.Printf("SeqNo:\t\t%d\n", ask.SeqNo)
+
+		return nil
+	},
+}
+
+var marketSetAskCmd = &cli.Command{
+	Name:  "set-ask",
+	Usage: "sign a new storage ask, unset options keep their current values",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "price",
+			Usage: "price in FIL / GiB / Epoch",
+		},
+		&cli.StringFlag{
+			Name:  "min-piece-size",
+			Usage: "minimum piece size, e.g. 256B",
+		},
+		&cli.StringFlag{
+			Name:  "max-piece-size",
+			Usage: "maximum piece size, e.g. 32GiB",
+		},
+		&cli.Int64Flag{
+			Name:  "duration",
+			Usage: "how long the ask is valid for, in epochs",
+			Value: 100 * builtin.EpochsInDay,
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.DaemonContext(cctx)
+
+		cur, err := api.MarketGetAsk(ctx)
+		if err != nil {
+			return err
+		}
+
+		price := types.BigInt(cur.Ask.Price)
+		if cctx.IsSet("price") {
+			fp, err := types.ParseFIL(cctx.String("price"))
+			if err != nil {
+				return xerrors.Errorf("parsing price: %w", err)
+			}
+			price = types.BigInt(fp)
+		}
+
+		minSize, maxSize := cur.Ask.MinPieceSize, cur.Ask.MaxPieceSize
+		if cctx.IsSet("min-piece-size") {
+			if minSize, err = parsePieceSize(cctx.String("min-piece-size")); err != nil {
+				return err
+			}
+		}
+		if cctx.IsSet("max-piece-size") {
+			if maxSize, err = parsePieceSize(cctx.String("max-piece-size")); err != nil {
+				return err
+			}
+		}
+
+		return api.MarketSetAsk(ctx, price, minSize, maxSize, abi.ChainEpoch(cctx.Int64("duration")))
+	},
+}
+
+func parsePieceSize(s string) (abi.PaddedPieceSize, error) {
+	n, err := units.RAMInBytes(s)
+	if err != nil {
+		return 0, xerrors.Errorf("parsing piece size %q: %w", s, err)
+	}
+
+	size := abi.PaddedPieceSize(n)
+	if err := size.Validate(); err != nil {
+		return 0, xerrors.Errorf("invalid piece size %q: %w", s, err)
+	}
+
+	return size, nil
+}
+
 var dealsCmd = &cli.Command{
 	Name:  "deals",
 	Usage: "interact with your deals",
 	Subcommands: []*cli.Command{
 		dealsImportDataCmd,
 		dealsListCmd,
+		dealsPendingCmd,
+		dealsImportDirCmd,
 	},
 }
 
@@ -100,3 +245,224 @@ var dealsListCmd = &cli.Command{
 		return nil
 	},
 }
+
+var dealsPendingCmd = &cli.Command{
+	Name:  "pending",
+	Usage: "List offline deals waiting for their data, the ones starting first first",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.DaemonContext(cctx)
+
+		deals, err := api.DealsPendingImport(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "ProposalCid\tClient\tPieceCID\tSize\tStart\n")
+		for _, d := range deals {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n",
+				d.ProposalCid, d.Proposal.Client, d.Proposal.PieceCID,
+				types.SizeStr(types.NewInt(uint64(d.Proposal.PieceSize))), d.Proposal.StartEpoch)
+		}
+		return w.Flush()
+	},
+}
+
+var dealsImportDirCmd = &cli.Command{
+	Name:      "import-dir",
+	Usage:     "Import data for pending offline deals from files named after their piece CID",
+	ArgsUsage: "<dir>",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.DaemonContext(cctx)
+
+		if !cctx.Args().Present() {
+			return fmt.Errorf("must specify directory to import from")
+		}
+
+		dir, err := filepath.Abs(cctx.Args().First())
+		if err != nil {
+			return err
+		}
+
+		res, err := api.DealsImportDir(ctx, dir)
+		if err != nil {
+			return err
+		}
+
+		var failed int
+		for _, r := range res {
+			if r.Error != "" {
+				failed++
+				fmt.Printf("%s: %s\n", r.File, r.Error)
+				continue
+			}
+			fmt.Printf("%s: imported for deal %s\n", r.File, r.ProposalCid)
+		}
+
+		if failed > 0 {
+			return xerrors.Errorf("%d of %d imports failed", failed, len(res))
+		}
+		return nil
+	},
+}
+
+var retrievalDealsCmd = &cli.Command{
+	Name:  "retrieval-deals",
+	Usage: "Manage retrieval deals",
+	Subcommands: []*cli.Command{
+		retrievalDealsListCmd,
+		retrievalDealsGetPolicyCmd,
+		retrievalDealsSetPolicyCmd,
+	},
+}
+
+var retrievalDealsGetPolicyCmd = &cli.Command{
+	Name:  "get-policy",
+	Usage: "Print retrieval prices and client rules",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		p, err := api.MarketGetRetrievalPolicy(lcli.DaemonContext(cctx))
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Price per byte: %s FIL\n", types.FIL(p.PricePerByte))
+		fmt.Printf("Unseal price: %s FIL\n", types.FIL(p.UnsealPrice))
+		fmt.Printf("Payment interval: %s (+%s per payment)\n",
+			types.SizeStr(types.NewInt(p.PaymentInterval)), types.SizeStr(types.NewInt(p.PaymentIntervalIncrease)))
+		for _, pid := range p.AllowedPeers {
+			fmt.Printf("Allowed: %s\n", pid)
+		}
+		for _, pid := range p.BlockedPeers {
+			fmt.Printf("Blocked: %s\n", pid)
+		}
+		return nil
+	},
+}
+
+var retrievalDealsSetPolicyCmd = &cli.Command{
+	Name:  "set-policy",
+	Usage: "Change retrieval prices and client rules",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "price",
+			Usage: "price per byte in FIL",
+		},
+		&cli.StringFlag{
+			Name:  "unseal-price",
+			Usage: "price for unsealing a piece in FIL",
+		},
+		&cli.Uint64Flag{
+			Name:  "payment-interval",
+			Usage: "bytes sent before asking for payment",
+		},
+		&cli.Uint64Flag{
+			Name:  "payment-interval-increase",
+			Usage: "growth of the payment interval after each payment",
+		},
+		&cli.StringSliceFlag{
+			Name:  "allow",
+			Usage: "only allow retrievals by these client peer IDs",
+		},
+		&cli.StringSliceFlag{
+			Name:  "block",
+			Usage: "block retrievals by these client peer IDs",
+		},
+		&cli.BoolFlag{
+			Name:  "clear-peers",
+			Usage: "remove all allow and block rules",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.DaemonContext(cctx)
+
+		p, err := api.MarketGetRetrievalPolicy(ctx)
+		if err != nil {
+			return err
+		}
+
+		if cctx.IsSet("price") {
+			f, err := types.ParseFIL(cctx.String("price"))
+			if err != nil {
+				return xerrors.Errorf("parsing price: %w", err)
+			}
+			p.PricePerByte = abi.TokenAmount(f)
+		}
+		if cctx.IsSet("unseal-price") {
+			f, err := types.ParseFIL(cctx.String("unseal-price"))
+			if err != nil {
+				return xerrors.Errorf("parsing unseal price: %w", err)
+			}
+			p.UnsealPrice = abi.TokenAmount(f)
+		}
+		if cctx.IsSet("payment-interval") {
+			p.PaymentInterval = cctx.Uint64("payment-interval")
+		}
+		if cctx.IsSet("payment-interval-increase") {
+			p.PaymentIntervalIncrease = cctx.Uint64("payment-interval-increase")
+		}
+
+		if cctx.Bool("clear-peers") {
+			p.AllowedPeers = nil
+			p.BlockedPeers = nil
+		}
+		for _, s := range cctx.StringSlice("allow") {
+			pid, err := peer.Decode(s)
+			if err != nil {
+				return xerrors.Errorf("parsing peer ID %q: %w", s, err)
+			}
+			p.AllowedPeers = append(p.AllowedPeers, pid)
+		}
+		for _, s := range cctx.StringSlice("block") {
+			pid, err := peer.Decode(s)
+			if err != nil {
+				return xerrors.Errorf("parsing peer ID %q: %w", s, err)
+			}
+			p.BlockedPeers = append(p.BlockedPeers, pid)
+		}
+
+		return api.MarketSetRetrievalPolicy(ctx, p)
+	},
+}
+
+var retrievalDealsListCmd = &cli.Command{
+	Name:  "list",
+	Usage: "List retrieval deals served by the miner",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		deals, err := api.MarketListRetrievalDeals(lcli.DaemonContext(cctx))
+		if err != nil {
+			return err
+		}
+
+		return lcli.PrintRetrievals(os.Stdout, deals)
+	},
+}
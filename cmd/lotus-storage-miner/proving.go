@@ -3,6 +3,11 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/build"
 	"github.com/filecoin-project/lotus/chain/types"
 	lcli "github.com/filecoin-project/lotus/cli"
@@ -18,6 +23,8 @@ var provingCmd = &cli.Command{
 	Subcommands: []*cli.Command{
 		provingInfoCmd,
 		provingDeadlinesCmd,
+		provingHistoryCmd,
+		provingDryRunCmd,
 	},
 }
 
@@ -210,3 +217,127 @@ var provingDeadlinesCmd = &cli.Command{
 		return nil
 	},
 }
+
+var provingHistoryCmd = &cli.Command{
+	Name:  "history",
+	Usage: "list recorded window PoSt attempts",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  "limit",
+			Usage: "number of most recent attempts to show",
+			Value: 48,
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "include dry runs",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		hist, err := nodeApi.ProvingHistory(ctx)
+		if err != nil {
+			return xerrors.Errorf("getting proving history: %w", err)
+		}
+
+		var atts []api.WindowPoStAttempt
+		for _, att := range hist {
+			if att.DryRun && !cctx.Bool("dry-run") {
+				continue
+			}
+			atts = append(atts, att)
+		}
+		if limit := cctx.Int("limit"); limit > 0 && len(atts) > limit {
+			atts = atts[len(atts)-limit:]
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "Started\tDeadline\tPartitions\tSectors\tSkipped\tProving\tMargin\tResult\tMessage")
+		for _, att := range atts {
+			dl := fmt.Sprint(att.Deadline)
+			if att.DryRun {
+				dl += " (dry)"
+			}
+
+			margin := "-"
+			if att.Included > 0 {
+				margin = fmt.Sprintf("%d epochs", att.Close-att.Included)
+			}
+
+			msg := "-"
+			if att.Message != nil {
+				msg = att.Message.String()
+			}
+
+			result := string(att.Result)
+			if att.Error != "" {
+				result += ": " + att.Error
+			}
+
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%s\t%s\t%s\t%s\n",
+				att.Start.Format(time.Stamp),
+				dl,
+				len(att.Partitions),
+				att.Sectors,
+				att.Skipped,
+				att.Elapsed.Truncate(time.Millisecond),
+				margin,
+				result,
+				msg,
+			)
+		}
+
+		return tw.Flush()
+	},
+}
+
+var provingDryRunCmd = &cli.Command{
+	Name:      "dry-run",
+	Usage:     "generate a window PoSt for a deadline without submitting it",
+	ArgsUsage: "<deadline>",
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		if cctx.Args().Len() != 1 {
+			return xerrors.Errorf("must pass deadline index")
+		}
+
+		dl, err := strconv.ParseUint(cctx.Args().First(), 10, 64)
+		if err != nil {
+			return xerrors.Errorf("parsing deadline index: %w", err)
+		}
+
+		att, err := nodeApi.ProvingDryRun(ctx, dl)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Deadline:\t%d (period start %d, challenge %d, close %d)\n", att.Deadline, att.PeriodStart, att.Challenge, att.Close)
+		fmt.Printf("Partitions:\t%d\n", len(att.Partitions))
+		fmt.Printf("Sectors:\t%d (%d skipped)\n", att.Sectors, att.Skipped)
+		fmt.Printf("Proving took:\t%s\n", att.Elapsed.Truncate(time.Millisecond))
+
+		// time between the challenge and deadline close is all we have to
+		// generate and land the proof
+		avail := att.Close - att.Challenge
+		fmt.Printf("Available:\t%d epochs (%s) from challenge to deadline close\n", avail, time.Duration(avail)*time.Duration(build.BlockDelay)*time.Second)
+		fmt.Printf("Result:\t\t%s\n", att.Result)
+		if att.Error != "" {
+			fmt.Printf("Error:\t\t%s\n", att.Error)
+		}
+
+		return nil
+	},
+}
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"os"
 
+	"golang.org/x/xerrors"
 	"gopkg.in/urfave/cli.v2"
 
+	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/chain/actors"
 	"github.com/filecoin-project/lotus/chain/types"
 	lcli "github.com/filecoin-project/lotus/cli"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
 	"github.com/filecoin-project/specs-actors/actors/builtin"
 	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
 )
@@ -16,9 +23,132 @@ var rewardsCmd = &cli.Command{
 	Name: "rewards",
 	Subcommands: []*cli.Command{
 		rewardsRedeemCmd,
+		rewardsListCmd,
 	},
 }
 
+var rewardsListCmd = &cli.Command{
+	Name:  "list",
+	Usage: "List rewards for mined blocks, and fees and penalties burnt in an epoch range",
+	Flags: []cli.Flag{
+		&cli.Int64Flag{
+			Name:  "from",
+			Usage: "first epoch of the range",
+		},
+		&cli.Int64Flag{
+			Name:  "to",
+			Usage: "last epoch of the range, defaults to the chain head",
+		},
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "output format, csv or json",
+			Value: "csv",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		fapi, acloser, err := lcli.GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer acloser()
+
+		ctx := lcli.ReqContext(cctx)
+
+		format := cctx.String("format")
+		if format != "csv" && format != "json" {
+			return xerrors.Errorf("unknown output format %q", format)
+		}
+
+		maddr, err := nodeApi.ActorAddress(ctx)
+		if err != nil {
+			return err
+		}
+
+		tsk := types.EmptyTSK
+		if cctx.IsSet("to") {
+			if cctx.Int64("to") < cctx.Int64("from") {
+				return xerrors.Errorf("--to must not be below --from")
+			}
+
+			ts, err := fapi.ChainGetTipSetByHeight(ctx, abi.ChainEpoch(cctx.Int64("to")), types.EmptyTSK)
+			if err != nil {
+				return xerrors.Errorf("getting tipset at %d: %w", cctx.Int64("to"), err)
+			}
+			tsk = ts.Key()
+		}
+
+		rewards, err := fapi.StateMinerRewards(ctx, maddr, abi.ChainEpoch(cctx.Int64("from")), tsk)
+		if err != nil {
+			return xerrors.Errorf("getting rewards: %w", err)
+		}
+
+		if format == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(rewards)
+		}
+
+		return printRewardsCSV(rewards)
+	},
+}
+
+func printRewardsCSV(rewards []api.MinerReward) error {
+	w := csv.NewWriter(os.Stdout)
+	if err := w.Write([]string{"epoch", "block", "reward", "gas_reward", "penalty", "burnt", "locked_funds", "precommit_deposits"}); err != nil {
+		return err
+	}
+
+	var blocks int
+	reward, gas, penalty, burnt := big.Zero(), big.Zero(), big.Zero(), big.Zero()
+	for _, r := range rewards {
+		reward = big.Add(reward, r.Reward)
+		gas = big.Add(gas, r.GasReward)
+		penalty = big.Add(penalty, r.Penalty)
+		burnt = big.Add(burnt, r.Burnt)
+
+		var block string
+		if r.Block.Defined() {
+			block = r.Block.String()
+			blocks++
+		}
+
+		if err := w.Write([]string{
+			fmt.Sprint(r.Epoch),
+			block,
+			types.FIL(r.Reward).String(),
+			types.FIL(r.GasReward).String(),
+			types.FIL(r.Penalty).String(),
+			types.FIL(r.Burnt).String(),
+			types.FIL(r.LockedFunds).String(),
+			types.FIL(r.PreCommitDeposits).String(),
+		}); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Write([]string{
+		"total",
+		fmt.Sprint(blocks),
+		types.FIL(reward).String(),
+		types.FIL(gas).String(),
+		types.FIL(penalty).String(),
+		types.FIL(burnt).String(),
+		"",
+		"",
+	}); err != nil {
+		return err
+	}
+
+	w.Flush()
+	return w.Error()
+}
+
 var rewardsRedeemCmd = &cli.Command{
 	Name:  "redeem",
 	Usage: "Redeem block rewards",
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"sort"
 	"strconv"
+	"strings"
 	"text/tabwriter"
 	"time"
 
@@ -27,12 +29,78 @@ var sectorsCmd = &cli.Command{
 		sectorsRefsCmd,
 		sectorsUpdateCmd,
 		sectorsPledgeCmd,
+		sectorsNotifyCmd,
+		sectorsExtendCmd,
+		sectorsTerminateCmd,
+		sectorsRemoveCmd,
+	},
+}
+
+var sectorsNotifyCmd = &cli.Command{
+	Name:  "notify",
+	Usage: "Print sector state changes as they happen",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "print changes as JSON, one per line",
+		},
+		&cli.BoolFlag{
+			Name:  "log",
+			Usage: "display event log entries of each change",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := lcli.ReqContext(cctx)
+
+		changes, err := nodeApi.SectorsNotify(ctx)
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		for change := range changes {
+			if cctx.Bool("json") {
+				if err := enc.Encode(change); err != nil {
+					return err
+				}
+				continue
+			}
+
+			from := change.From
+			if from == "" {
+				from = "-"
+			}
+			fmt.Printf("%s\t%d\t%s -> %s\n", change.Time.Format(time.Stamp), change.Sector, from, change.To)
+			if change.LastErr != "" && strings.Contains(string(change.To), "Fail") {
+				fmt.Printf("\t\terror: %s\n", change.LastErr)
+			}
+
+			if cctx.Bool("log") {
+				for _, l := range change.Log {
+					fmt.Printf("\t\t[%s]\t%s\n", l.Kind, l.Message)
+				}
+			}
+		}
+
+		return nil
 	},
 }
 
 var sectorsPledgeCmd = &cli.Command{
 	Name:  "pledge",
 	Usage: "store random data in a sector",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  "count",
+			Usage: "number of sectors to pledge, started as sealing limits allow",
+			Value: 1,
+		},
+	},
 	Action: func(cctx *cli.Context) error {
 		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
 		if err != nil {
@@ -41,7 +109,7 @@ var sectorsPledgeCmd = &cli.Command{
 		defer closer()
 		ctx := lcli.ReqContext(cctx)
 
-		return nodeApi.PledgeSector(ctx)
+		return nodeApi.PledgeSectors(ctx, cctx.Int("count"))
 	},
 }
 
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/urfave/cli.v2"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/chain/types"
+	lcli "github.com/filecoin-project/lotus/cli"
+)
+
+var sectorsExtendCmd = &cli.Command{
+	Name:      "extend",
+	Usage:     "Extend on-chain expiration of sectors",
+	ArgsUsage: "[sectorNum ...]",
+	Flags: []cli.Flag{
+		&cli.Int64Flag{
+			Name:  "expiration",
+			Usage: "new expiration epoch of the sectors",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if !cctx.IsSet("expiration") {
+			return xerrors.Errorf("must pass --expiration")
+		}
+
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := lcli.ReqContext(cctx)
+
+		sectors, err := parseSectorNumbers(cctx.Args().Slice())
+		if err != nil {
+			return err
+		}
+
+		msgs, err := nodeApi.SectorsExtend(ctx, sectors, abi.ChainEpoch(cctx.Int64("expiration")))
+		if err != nil {
+			return err
+		}
+
+		for i, msg := range msgs {
+			fmt.Printf("sector %d: %s\n", sectors[i], msg)
+		}
+		return nil
+	},
+}
+
+var sectorsTerminateCmd = &cli.Command{
+	Name:      "terminate",
+	Usage:     "Terminate sectors early, burning the termination fee",
+	ArgsUsage: "[sectorNum ...]",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "really-do-it",
+			Usage: "send the termination message, without this flag only the fee is shown",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := lcli.ReqContext(cctx)
+
+		sectors, err := parseSectorNumbers(cctx.Args().Slice())
+		if err != nil {
+			return err
+		}
+
+		fee, err := nodeApi.SectorsTerminateFee(ctx, sectors)
+		if err != nil {
+			return xerrors.Errorf("estimating termination fee: %w", err)
+		}
+		fmt.Printf("Termination fee: %s FIL\n", types.FIL(fee))
+
+		if !cctx.Bool("really-do-it") {
+			fmt.Println("Pass --really-do-it to terminate the sectors")
+			return nil
+		}
+
+		msg, err := nodeApi.SectorsTerminate(ctx, sectors)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Terminate message: %s\n", msg)
+		return nil
+	},
+}
+
+var sectorsRemoveCmd = &cli.Command{
+	Name:      "remove",
+	Usage:     "Remove stored data of sectors which are terminated or expired",
+	ArgsUsage: "[sectorNum ...]",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "inactive",
+			Usage: "remove all sectors which are no longer active on chain",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := lcli.ReqContext(cctx)
+
+		var sectors []abi.SectorNumber
+		if cctx.Bool("inactive") {
+			if cctx.Args().Present() {
+				return xerrors.Errorf("--inactive can't be combined with sector numbers")
+			}
+
+			sectors, err = nodeApi.SectorsInactive(ctx)
+			if err != nil {
+				return err
+			}
+			if len(sectors) == 0 {
+				fmt.Println("No inactive sectors with stored data")
+				return nil
+			}
+		} else {
+			sectors, err = parseSectorNumbers(cctx.Args().Slice())
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := nodeApi.SectorsRemove(ctx, sectors); err != nil {
+			return err
+		}
+
+		fmt.Printf("Removed %d sectors\n", len(sectors))
+		return nil
+	},
+}
+
+func parseSectorNumbers(args []string) ([]abi.SectorNumber, error) {
+	if len(args) == 0 {
+		return nil, xerrors.Errorf("must specify at least one sector number")
+	}
+
+	out := make([]abi.SectorNumber, len(args))
+	for i, arg := range args {
+		n, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			return nil, xerrors.Errorf("could not parse sector number %q: %w", arg, err)
+		}
+		out[i] = abi.SectorNumber(n)
+	}
+	return out, nil
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/specs-actors/actors/abi"
 
+	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/chain/types"
 	lcli "github.com/filecoin-project/lotus/cli"
 	"github.com/filecoin-project/sector-storage/stores"
@@ -34,6 +35,7 @@ var storageCmd = &cli.Command{
 		storageAttachCmd,
 		storageListCmd,
 		storageFindCmd,
+		storageScrubCmd,
 	},
 }
 
@@ -380,3 +382,118 @@ var storageFindCmd = &cli.Command{
 		return nil
 	},
 }
+
+var storageScrubCmd = &cli.Command{
+	Name:      "scrub",
+	Usage:     "check sector files in storage",
+	ArgsUsage: "[sector numbers...]",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "verify",
+			Usage: "prove each sector against its on-chain SealedCID (slow)",
+		},
+		&cli.BoolFlag{
+			Name:  "repair",
+			Usage: "move or fetch misplaced sector files into local long-term storage",
+		},
+		&cli.BoolFlag{
+			Name:  "last",
+			Usage: "print results of the last background scrub instead of running a new one",
+		},
+		&cli.BoolFlag{
+			Name:  "all",
+			Usage: "also print sectors without problems",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := lcli.ReqContext(cctx)
+
+		var res []api.SectorCheck
+		if cctx.Bool("last") {
+			st, err := nodeApi.SectorsScrubStatus(ctx)
+			if err != nil {
+				return err
+			}
+
+			if st.LastRun.IsZero() {
+				fmt.Println("No scrub has completed yet")
+				return nil
+			}
+			fmt.Printf("Last scrub: %s", st.LastRun.Format(time.RFC3339))
+			if st.Running {
+				fmt.Print(" (scrub in progress)")
+			}
+			fmt.Println()
+
+			res = st.Results
+		} else {
+			var sectors []abi.SectorNumber
+			for _, s := range cctx.Args().Slice() {
+				n, err := strconv.ParseUint(s, 10, 64)
+				if err != nil {
+					return xerrors.Errorf("parsing sector number %q: %w", s, err)
+				}
+				sectors = append(sectors, abi.SectorNumber(n))
+			}
+
+			res, err = nodeApi.SectorsCheck(ctx, sectors, api.ScrubOptions{
+				Verify: cctx.Bool("verify"),
+				Repair: cctx.Bool("repair"),
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		var bad, misplaced, repaired, sealing int
+		for _, r := range res {
+			var status string
+			switch {
+			case !r.OnChain:
+				sealing++
+				status = "sealing"
+			case r.Err != "":
+				bad++
+				status = color.RedString("error: %s", r.Err)
+			case r.Repaired != "":
+				repaired++
+				status = color.YellowString("repaired: %s", r.Repaired)
+			case r.Misplaced:
+				misplaced++
+				status = color.YellowString("misplaced")
+			case r.Verified:
+				status = color.GreenString("ok, verified")
+			default:
+				status = color.GreenString("ok")
+			}
+
+			if !cctx.Bool("all") && r.Err == "" && r.Repaired == "" && !r.Misplaced {
+				continue
+			}
+
+			fmt.Printf("%d:\t%s\n", r.Sector, status)
+			fmt.Printf("\tSealed: %s; Cache: %s\n", storageIDList(r.Sealed), storageIDList(r.Cache))
+		}
+
+		fmt.Printf("Checked %d sectors: %d bad, %d misplaced, %d repaired, %d sealing\n", len(res), bad, misplaced, repaired, sealing)
+
+		return nil
+	},
+}
+
+func storageIDList(ids []stores.ID) string {
+	if len(ids) == 0 {
+		return "none"
+	}
+
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = string(id)
+	}
+	return strings.Join(strs, ", ")
+}
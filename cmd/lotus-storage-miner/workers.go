@@ -2,14 +2,21 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"sort"
+	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/fatih/color"
+	"golang.org/x/xerrors"
 	"gopkg.in/urfave/cli.v2"
 
+	"github.com/filecoin-project/sector-storage/sealtasks"
 	"github.com/filecoin-project/sector-storage/storiface"
 
+	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/chain/types"
 	lcli "github.com/filecoin-project/lotus/cli"
 )
@@ -19,6 +26,78 @@ var workersCmd = &cli.Command{
 	Usage: "interact with workers",
 	Subcommands: []*cli.Command{
 		workersListCmd,
+		workersJobsCmd,
+		workersAbortCmd,
+	},
+}
+
+var workersJobsCmd = &cli.Command{
+	Name:  "jobs",
+	Usage: "list running, queued and scheduled sealing jobs",
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		jobs, err := nodeApi.WorkerJobs(ctx)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+		fmt.Fprintf(tw, "ID\tSector\tTask\tState\tWorker\tTime\n")
+		for _, j := range jobs {
+			state := "queued"
+			switch {
+			case j.Aborted:
+				state = "aborted"
+			case j.Worker == "":
+				state = "scheduled"
+			case j.Running:
+				state = "running"
+			}
+
+			worker := j.Hostname
+			if j.Worker == "" {
+				worker = "(miner)"
+			}
+
+			fmt.Fprintf(tw, "%d\t%d\t%s\t%s\t%s\t%s\n", j.ID, j.Sector.Number, j.Task, state, worker, time.Since(j.Start).Truncate(time.Second))
+		}
+
+		return tw.Flush()
+	},
+}
+
+var workersAbortCmd = &cli.Command{
+	Name:  "abort",
+	Usage: "abort a sealing job, the sector will retry the failed step",
+	Description: `Workers can't stop a task which is already running. An aborted job is
+   listed until the worker finishes its task, and keeps the task slot until then.`,
+	ArgsUsage: "[jobID]",
+	Action: func(cctx *cli.Context) error {
+		nodeApi, closer, err := lcli.GetStorageMinerAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := lcli.ReqContext(cctx)
+
+		if !cctx.Args().Present() {
+			return xerrors.Errorf("must specify a job ID to abort")
+		}
+
+		id, err := strconv.ParseUint(cctx.Args().First(), 10, 64)
+		if err != nil {
+			return xerrors.Errorf("could not parse job ID: %w", err)
+		}
+
+		return nodeApi.SealingAbort(ctx, id)
 	},
 }
 
@@ -44,6 +123,17 @@ var workersListCmd = &cli.Command{
 			return err
 		}
 
+		tasks, err := nodeApi.WorkerTasks(ctx)
+		if err != nil {
+			return err
+		}
+
+		// remote workers are tracked by URL, match them to stats by hostname
+		tasksByHost := map[string][]api.WorkerTasks{}
+		for _, t := range tasks {
+			tasksByHost[t.Hostname] = append(tasksByHost[t.Hostname], t)
+		}
+
 		type sortableStat struct {
 			id uint64
 			storiface.WorkerStats
@@ -101,8 +191,50 @@ var workersListCmd = &cli.Command{
 			for _, gpu := range stat.Info.Resources.GPUs {
 				fmt.Printf("\tGPU: %s\n", color.New(gpuCol).Sprintf("%s, %sused", gpu, gpuUse))
 			}
+
+			printWorkerTasks(tasksByHost[stat.Info.Hostname])
 		}
 
 		return nil
 	},
 }
+
+func printWorkerTasks(tasks []api.WorkerTasks) {
+	running := map[sealtasks.TaskType]int{}
+	queued := map[sealtasks.TaskType]int{}
+	limits := map[sealtasks.TaskType]int{}
+	for _, t := range tasks {
+		for tt, n := range t.Running {
+			running[tt] += n
+		}
+		for tt, n := range t.Queued {
+			queued[tt] += n
+		}
+		for tt, n := range t.Limits.MaxTasks {
+			limits[tt] += n
+		}
+	}
+
+	tts := map[sealtasks.TaskType]struct{}{}
+	for _, m := range []map[sealtasks.TaskType]int{running, queued, limits} {
+		for tt := range m {
+			tts[tt] = struct{}{}
+		}
+	}
+
+	sorted := make([]sealtasks.TaskType, 0, len(tts))
+	for tt := range tts {
+		sorted = append(sorted, tt)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	for _, tt := range sorted {
+		limit := "-"
+		if limits[tt] > 0 {
+			limit = fmt.Sprint(limits[tt])
+		}
+		fmt.Printf("\tTASK: %s: %d running, %d queued, limit %s\n", tt, running[tt], queued[tt], limit)
+	}
+}
@@ -55,6 +55,7 @@ func main() {
 
 	err = gen.WriteTupleEncodersToFile("./node/hello/cbor_gen.go", "hello",
 		hello.HelloMessage{},
+		hello.HelloMessageV2{},
 		hello.LatencyMessage{},
 	)
 	if err != nil {
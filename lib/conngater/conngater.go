@@ -0,0 +1,354 @@
+package conngater
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	swarm "github.com/libp2p/go-libp2p-swarm"
+	mafilter "github.com/libp2p/go-maddr-filter"
+	ma "github.com/multiformats/go-multiaddr"
+	"golang.org/x/xerrors"
+)
+
+var log = logging.Logger("conngater")
+
+type RuleType string
+
+const (
+	RulePeer   RuleType = "peer"
+	RuleAddr   RuleType = "addr"
+	RuleSubnet RuleType = "subnet"
+)
+
+// Rule blocks connections with a peer, a multiaddr (and any address it is a
+// prefix of), or an IP subnet
+type Rule struct {
+	Type   RuleType
+	Target string
+	Reason string
+
+	Created time.Time
+	// Expires is when the rule stops applying, zero for permanent rules
+	Expires time.Time
+
+	peer   peer.ID
+	maddr  ma.Multiaddr
+	subnet *net.IPNet
+}
+
+func (r *Rule) expired(now time.Time) bool {
+	return !r.Expires.IsZero() && now.After(r.Expires)
+}
+
+// ParseRule figures out what kind of rule the target describes
+func ParseRule(target string) (*Rule, error) {
+	r := &Rule{Target: target}
+	if err := r.parse(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Rule) parse() error {
+	if p, err := peer.Decode(r.Target); err == nil {
+		r.Type = RulePeer
+		r.peer = p
+		return nil
+	}
+
+	if _, ipnet, err := net.ParseCIDR(r.Target); err == nil {
+		r.Type = RuleSubnet
+		r.subnet = ipnet
+		r.Target = ipnet.String()
+		return nil
+	}
+
+	if a, err := ma.NewMultiaddr(r.Target); err == nil {
+		r.Type = RuleAddr
+		r.maddr = a
+		r.Target = a.String()
+		return nil
+	}
+
+	return xerrors.Errorf("%q is not a peer ID, CIDR subnet or multiaddr", r.Target)
+}
+
+func (r *Rule) matches(p peer.ID, a ma.Multiaddr) bool {
+	switch r.Type {
+	case RulePeer:
+		return p == r.peer
+	case RuleAddr:
+		return bytes.HasPrefix(a.Bytes(), r.maddr.Bytes())
+	case RuleSubnet:
+		f := mafilter.NewFilters()
+		f.AddFilter(*r.subnet, mafilter.ActionDeny)
+		return f.AddrBlocked(a)
+	}
+	return false
+}
+
+// Gater blocks connections according to a persisted list of rules. Blocked
+// peers and addresses are neither dialed nor accepted by the transports it
+// wraps, existing connections are closed when a rule is added
+type Gater struct {
+	lk    sync.Mutex
+	rules map[string]*Rule
+
+	ds datastore.Batching
+
+	// set when attached to a host
+	net   network.Network
+	swarm *swarm.Swarm
+}
+
+func NewGater(ds datastore.Batching) (*Gater, error) {
+	g := &Gater{
+		rules: map[string]*Rule{},
+		ds:    namespace.Wrap(ds, datastore.NewKey("/conngater")),
+	}
+
+	res, err := g.ds.Query(query.Query{})
+	if err != nil {
+		return nil, xerrors.Errorf("querying rules: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, xerrors.Errorf("iterating rules: %w", r.Error)
+		}
+
+		var rule Rule
+		if err := json.Unmarshal(r.Value, &rule); err != nil {
+			return nil, xerrors.Errorf("decoding rule %s: %w", r.Key, err)
+		}
+		if err := rule.parse(); err != nil {
+			log.Errorf("ignoring invalid stored rule %s: %s", rule.Target, err)
+			continue
+		}
+
+		g.rules[rule.Target] = &rule
+	}
+
+	return g, nil
+}
+
+func ruleKey(target string) datastore.Key {
+	return datastore.NewKey(base64.RawURLEncoding.EncodeToString([]byte(target)))
+}
+
+// Attach lets rules close existing connections of the host, and filters
+// subnets in its swarm before connections are set up
+func (g *Gater) Attach(h host.Host) {
+	g.lk.Lock()
+	defer g.lk.Unlock()
+
+	g.net = h.Network()
+	if s, ok := g.net.(*swarm.Swarm); ok {
+		g.swarm = s
+	}
+
+	for _, r := range g.rules {
+		g.enforce(r)
+	}
+
+	// relayed connections don't go through the gated transports
+	g.net.Notify(&network.NotifyBundle{
+		ConnectedF: func(_ network.Network, c network.Conn) {
+			if !relayed(c.RemoteMultiaddr()) {
+				return
+			}
+			if r := g.blocked(c.RemotePeer(), c.RemoteMultiaddr()); r != nil {
+				log.Infow("closing relayed connection to blocked peer", "peer", c.RemotePeer(), "addr", c.RemoteMultiaddr(), "rule", r.Target)
+				go c.Close() // nolint:errcheck
+			}
+		},
+	})
+}
+
+func relayed(a ma.Multiaddr) bool {
+	_, err := a.ValueForProtocol(ma.P_CIRCUIT)
+	return err == nil
+}
+
+// enforce applies the rule to the network, caller must hold the lock
+func (g *Gater) enforce(r *Rule) {
+	if g.net == nil {
+		return
+	}
+
+	if r.Type == RuleSubnet && g.swarm != nil {
+		g.swarm.Filters.AddFilter(*r.subnet, mafilter.ActionDeny)
+	}
+
+	for _, c := range g.net.Conns() {
+		if r.matches(c.RemotePeer(), c.RemoteMultiaddr()) {
+			log.Infow("closing blocked connection", "peer", c.RemotePeer(), "addr", c.RemoteMultiaddr(), "rule", r.Target)
+			go c.Close() // nolint:errcheck
+		}
+	}
+}
+
+// unenforce reverts network changes made in enforce, caller must hold the lock
+func (g *Gater) unenforce(r *Rule) {
+	if r.Type == RuleSubnet && g.swarm != nil {
+		g.swarm.Filters.RemoveLiteral(*r.subnet)
+	}
+}
+
+// blocked returns the first rule blocking the peer or address
+func (g *Gater) blocked(p peer.ID, a ma.Multiaddr) *Rule {
+	g.lk.Lock()
+	defer g.lk.Unlock()
+
+	now := time.Now()
+	for _, r := range g.rules {
+		if r.expired(now) {
+			continue
+		}
+		if r.matches(p, a) {
+			return r
+		}
+	}
+	return nil
+}
+
+// PeerBlocked checks whether there is a rule for the peer ID
+func (g *Gater) PeerBlocked(p peer.ID) bool {
+	g.lk.Lock()
+	defer g.lk.Unlock()
+
+	r, ok := g.rules[p.String()]
+	return ok && !r.expired(time.Now())
+}
+
+// Add adds a rule for the target, which can be a peer ID, a multiaddr or a
+// CIDR subnet. Zero duration means the rule never expires
+func (g *Gater) Add(target string, dur time.Duration, reason string) error {
+	r, err := ParseRule(target)
+	if err != nil {
+		return err
+	}
+
+	r.Reason = reason
+	r.Created = time.Now()
+	if dur > 0 {
+		r.Expires = r.Created.Add(dur)
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	g.lk.Lock()
+	defer g.lk.Unlock()
+
+	if err := g.ds.Put(ruleKey(r.Target), b); err != nil {
+		return xerrors.Errorf("persisting rule: %w", err)
+	}
+
+	if old, ok := g.rules[r.Target]; ok {
+		g.unenforce(old)
+	}
+	g.rules[r.Target] = r
+	g.enforce(r)
+
+	log.Infow("added connection block rule", "type", r.Type, "target", r.Target, "expires", r.Expires, "reason", reason)
+	return nil
+}
+
+// BlockPeer is a shorthand for automatically blocking misbehaving peers
+func (g *Gater) BlockPeer(p peer.ID, dur time.Duration, reason string) {
+	if err := g.Add(p.String(), dur, reason); err != nil {
+		log.Errorf("blocking peer %s: %s", p, err)
+	}
+}
+
+func (g *Gater) Remove(target string) error {
+	r, err := ParseRule(target)
+	if err != nil {
+		return err
+	}
+
+	g.lk.Lock()
+	defer g.lk.Unlock()
+
+	return g.remove(r.Target)
+}
+
+// remove deletes a rule, caller must hold the lock
+func (g *Gater) remove(target string) error {
+	r, ok := g.rules[target]
+	if !ok {
+		return xerrors.Errorf("no rule for %s", target)
+	}
+
+	if err := g.ds.Delete(ruleKey(target)); err != nil {
+		return xerrors.Errorf("deleting rule: %w", err)
+	}
+
+	g.unenforce(r)
+	delete(g.rules, target)
+	return nil
+}
+
+// List returns all rules which haven't expired
+func (g *Gater) List() []Rule {
+	g.lk.Lock()
+	defer g.lk.Unlock()
+
+	now := time.Now()
+	out := make([]Rule, 0, len(g.rules))
+	for _, r := range g.rules {
+		if r.expired(now) {
+			continue
+		}
+		out = append(out, *r)
+	}
+	return out
+}
+
+// Run periodically removes expired rules
+func (g *Gater) Run(ctx context.Context) {
+	tick := time.NewTicker(time.Minute)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+			g.removeExpired()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (g *Gater) removeExpired() {
+	g.lk.Lock()
+	defer g.lk.Unlock()
+
+	now := time.Now()
+	for t, r := range g.rules {
+		if !r.expired(now) {
+			continue
+		}
+
+		log.Infow("connection block rule expired", "type", r.Type, "target", t)
+		if err := g.remove(t); err != nil {
+			log.Errorf("removing expired rule: %s", err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package conngater
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+)
+
+func TestParseRule(t *testing.T) {
+	for target, typ := range map[string]RuleType{
+		"12D3KooWGzxzKZYveHXtpG6AsrUJBcWxHBFS2HsEoGTxrMLvKXtf": RulePeer,
+		"10.0.0.0/8":                RuleSubnet,
+		"/ip4/1.2.3.4":              RuleAddr,
+		"/ip4/1.2.3.4/tcp/1347":     RuleAddr,
+		"2001:db8::/32":             RuleSubnet,
+		"/ip6/2001:db8::1/tcp/1347": RuleAddr,
+	} {
+		r, err := ParseRule(target)
+		if err != nil {
+			t.Fatalf("parsing %s: %s", target, err)
+		}
+		if r.Type != typ {
+			t.Errorf("%s: expected rule type %s, got %s", target, typ, r.Type)
+		}
+	}
+
+	if _, err := ParseRule("not a target"); err == nil {
+		t.Fatal("expected error parsing invalid target")
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+
+	g, err := NewGater(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := g.Add("10.0.0.0/8", 0, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Add("/ip4/1.2.3.4", time.Hour, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Add("/ip4/5.6.7.8", time.Hour, "expires"); err != nil {
+		t.Fatal(err)
+	}
+	g.rules["/ip4/5.6.7.8"].Expires = time.Now().Add(-time.Second)
+
+	if l := g.List(); len(l) != 2 {
+		t.Fatalf("expected 2 active rules, got %d", len(l))
+	}
+
+	g.removeExpired()
+
+	g2, err := NewGater(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := g2.List(); len(l) != 2 {
+		t.Fatalf("expected 2 persisted rules, got %d", len(l))
+	}
+
+	if err := g2.Remove("10.0.0.0/8"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g2.Remove("10.0.0.0/8"); err == nil {
+		t.Fatal("expected error removing missing rule")
+	}
+
+	g3, err := NewGater(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := g3.List(); len(l) != 1 || l[0].Target != "/ip4/1.2.3.4" {
+		t.Fatalf("unexpected rules after removal: %v", l)
+	}
+}
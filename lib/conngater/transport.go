@@ -0,0 +1,66 @@
+package conngater
+
+import (
+	"context"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/transport"
+	ma "github.com/multiformats/go-multiaddr"
+	"golang.org/x/xerrors"
+)
+
+// Transport wraps a libp2p transport so it doesn't dial blocked peers and
+// addresses, and drops accepted connections from them before the swarm sees
+// them
+func (g *Gater) Transport(t transport.Transport) transport.Transport {
+	return &gatedTransport{Transport: t, g: g}
+}
+
+type gatedTransport struct {
+	transport.Transport
+
+	g *Gater
+}
+
+func (t *gatedTransport) Dial(ctx context.Context, raddr ma.Multiaddr, p peer.ID) (transport.CapableConn, error) {
+	if r := t.g.blocked(p, raddr); r != nil {
+		return nil, xerrors.Errorf("dialing %s at %s blocked by rule %s", p, raddr, r.Target)
+	}
+	return t.Transport.Dial(ctx, raddr, p)
+}
+
+func (t *gatedTransport) Listen(laddr ma.Multiaddr) (transport.Listener, error) {
+	l, err := t.Transport.Listen(laddr)
+	if err != nil {
+		return nil, err
+	}
+	return &gatedListener{Listener: l, g: t.g}, nil
+}
+
+type gatedListener struct {
+	transport.Listener
+
+	g *Gater
+}
+
+// Accept returns the next connection which isn't blocked. The peer is only
+// known once the connection is secured, so blocked peers are closed after the
+// handshake
+func (l *gatedListener) Accept() (transport.CapableConn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		r := l.g.blocked(c.RemotePeer(), c.RemoteMultiaddr())
+		if r == nil {
+			return c, nil
+		}
+
+		log.Debugw("dropping blocked connection", "peer", c.RemotePeer(), "addr", c.RemoteMultiaddr(), "rule", r.Target)
+		if err := c.Close(); err != nil {
+			log.Debugf("closing blocked connection: %s", err)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package conngater
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/transport"
+	ma "github.com/multiformats/go-multiaddr"
+	"golang.org/x/xerrors"
+)
+
+type testConn struct {
+	transport.CapableConn
+
+	peer   peer.ID
+	addr   ma.Multiaddr
+	closed bool
+}
+
+func (c *testConn) RemotePeer() peer.ID {
+	return c.peer
+}
+
+func (c *testConn) RemoteMultiaddr() ma.Multiaddr {
+	return c.addr
+}
+
+func (c *testConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+type testTransport struct {
+	transport.Transport
+
+	dialed []peer.ID
+	conns  []*testConn
+}
+
+func (t *testTransport) Dial(ctx context.Context, raddr ma.Multiaddr, p peer.ID) (transport.CapableConn, error) {
+	t.dialed = append(t.dialed, p)
+	return &testConn{peer: p, addr: raddr}, nil
+}
+
+func (t *testTransport) Listen(laddr ma.Multiaddr) (transport.Listener, error) {
+	return &testListener{t: t}, nil
+}
+
+type testListener struct {
+	transport.Listener
+
+	t *testTransport
+}
+
+func (l *testListener) Accept() (transport.CapableConn, error) {
+	if len(l.t.conns) == 0 {
+		return nil, xerrors.New("listener closed")
+	}
+	c := l.t.conns[0]
+	l.t.conns = l.t.conns[1:]
+	return c, nil
+}
+
+func mustPeer(t *testing.T, s string) peer.ID {
+	p, err := peer.Decode(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestTransport(t *testing.T) {
+	g, err := NewGater(dssync.MutexWrap(datastore.NewMapDatastore()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocked := mustPeer(t, "12D3KooWGzxzKZYveHXtpG6AsrUJBcWxHBFS2HsEoGTxrMLvKXtf")
+	good := mustPeer(t, "QmcgpsyWgH8Y8ajJz1Cu72KnS5uo2Aa2LpzU7kinSupNKC")
+
+	for _, target := range []string{blocked.String(), "10.0.0.0/8", "/ip4/1.2.3.4/tcp/1347"} {
+		if err := g.Add(target, 0, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tpt := &testTransport{}
+	gt := g.Transport(tpt)
+
+	for addr, p := range map[string]peer.ID{
+		"/ip4/8.8.8.8/tcp/1347": blocked,
+		"/ip4/10.1.2.3/tcp/1":   good,
+		"/ip4/1.2.3.4/tcp/1347": good,
+	} {
+		_, err := gt.Dial(context.TODO(), ma.StringCast(addr), p)
+		if err == nil || !strings.Contains(err.Error(), "blocked by rule") {
+			t.Errorf("dialing %s at %s: expected blocked, got %v", p, addr, err)
+		}
+	}
+	if len(tpt.dialed) != 0 {
+		t.Fatalf("expected no dials, got %v", tpt.dialed)
+	}
+
+	if _, err := gt.Dial(context.TODO(), ma.StringCast("/ip4/1.2.3.4/tcp/1348"), good); err != nil {
+		t.Fatal(err)
+	}
+
+	conns := []*testConn{
+		{peer: blocked, addr: ma.StringCast("/ip4/8.8.8.8/tcp/1")},
+		{peer: good, addr: ma.StringCast("/ip4/10.0.0.1/tcp/1")},
+		{peer: good, addr: ma.StringCast("/ip4/8.8.8.8/tcp/1")},
+	}
+	tpt.conns = append(tpt.conns, conns...)
+
+	l, err := gt.Listen(ma.StringCast("/ip4/0.0.0.0/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != conns[2] {
+		t.Fatalf("expected only the unblocked connection, got %s at %s", c.RemotePeer(), c.RemoteMultiaddr())
+	}
+	if !conns[0].closed || !conns[1].closed || conns[2].closed {
+		t.Fatal("expected blocked connections to be closed")
+	}
+
+	// expired rules don't apply
+	g.rules[blocked.String()].Expires = time.Now().Add(-time.Second)
+	if _, err := gt.Dial(context.TODO(), ma.StringCast("/ip4/8.8.8.8/tcp/1347"), blocked); err != nil {
+		t.Fatal(err)
+	}
+}
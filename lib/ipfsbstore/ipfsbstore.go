@@ -18,6 +18,9 @@ import (
 	"github.com/ipfs/interface-go-ipfs-core/path"
 )
 
+// ErrNotSupported is returned for operations the ipfs node API doesn't allow
+var ErrNotSupported = xerrors.New("not supported by the ipfs blockstore")
+
 type IpfsBstore struct {
 	ctx context.Context
 	api iface.CoreAPI
@@ -36,7 +39,7 @@ func NewIpfsBstore(ctx context.Context) (*IpfsBstore, error) {
 }
 
 func (i *IpfsBstore) DeleteBlock(cid cid.Cid) error {
-	return xerrors.Errorf("not supported")
+	return ErrNotSupported
 }
 
 func (i *IpfsBstore) Has(cid cid.Cid) (bool, error) {
@@ -96,7 +99,7 @@ func (i *IpfsBstore) PutMany(blocks []blocks.Block) error {
 }
 
 func (i *IpfsBstore) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
-	return nil, xerrors.Errorf("not supported")
+	return nil, ErrNotSupported
 }
 
 func (i *IpfsBstore) HashOnRead(enabled bool) {
@@ -0,0 +1,77 @@
+package peermgr
+
+import (
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+)
+
+// Capability is a set of services a filecoin peer advertises through hello
+type Capability uint64
+
+const (
+	CapBlockSync Capability = 1 << iota
+	CapGraphsyncSync
+	// CapSnapshot is for peers serving chain snapshots. There is no protocol
+	// serving snapshots to peers yet, so lotus never sets it. The bit keeps
+	// its place so the bits after it don't change on the wire
+	CapSnapshot
+	CapRetrieval
+	CapStorage
+)
+
+func (c Capability) Has(o Capability) bool {
+	return c&o == o
+}
+
+// CanServeChain returns true if the peer serves chain data over any of the
+// chain sync protocols
+func (c Capability) CanServeChain() bool {
+	return c&(CapBlockSync|CapGraphsyncSync) != 0
+}
+
+func (c Capability) String() string {
+	names := []string{"blocksync", "graphsync", "snapshot", "retrieval", "storage"}
+
+	var out string
+	for i, n := range names {
+		if c&(1<<uint(i)) == 0 {
+			continue
+		}
+		if out != "" {
+			out += ","
+		}
+		out += n
+	}
+	return out
+}
+
+// PeerCapabilities is what a peer told us about itself in hello
+type PeerCapabilities struct {
+	Capabilities Capability
+
+	// OldestStateHeight is the height of the oldest tipset the peer has state
+	// for, peers won't be able to serve history from before that height. 0 if
+	// the peer doesn't know yet
+	OldestStateHeight abi.ChainEpoch
+}
+
+const pstoreCapsKey = "fil/hello/caps"
+
+// SetPeerCapabilities records capabilities advertised by a peer in the peerstore
+func SetPeerCapabilities(ps peerstore.Peerstore, p peer.ID, caps PeerCapabilities) error {
+	return ps.Put(p, pstoreCapsKey, caps)
+}
+
+// GetPeerCapabilities returns capabilities advertised by a peer, if it told us
+// about them. Peers speaking older hello versions don't advertise capabilities
+func GetPeerCapabilities(ps peerstore.Peerstore, p peer.ID) (PeerCapabilities, bool) {
+	v, err := ps.Get(p, pstoreCapsKey)
+	if err != nil {
+		return PeerCapabilities{}, false
+	}
+
+	caps, ok := v.(PeerCapabilities)
+	return caps, ok
+}
@@ -0,0 +1,268 @@
+package peerrep
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p-core/connmgr"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+var log = logging.Logger("peerrep")
+
+// Event is an observation about a peer's behaviour which affects its reputation
+type Event int
+
+const (
+	EvtHelloOK Event = iota
+	EvtHelloBadGenesis
+	EvtBlockSyncSuccess
+	EvtBlockSyncFailure
+	EvtPubsubAccept
+	EvtPubsubReject
+	EvtSyncSuccess
+	EvtSyncFailure
+
+	evtCount // keep this last
+)
+
+var evtNames = [evtCount]string{
+	EvtHelloOK:          "hello-ok",
+	EvtHelloBadGenesis:  "hello-bad-genesis",
+	EvtBlockSyncSuccess: "blocksync-success",
+	EvtBlockSyncFailure: "blocksync-failure",
+	EvtPubsubAccept:     "pubsub-accept",
+	EvtPubsubReject:     "pubsub-reject",
+	EvtSyncSuccess:      "sync-success",
+	EvtSyncFailure:      "sync-failure",
+}
+
+// evtWeights is how much a single event moves the peer score
+var evtWeights = [evtCount]float64{
+	EvtHelloOK:          5,
+	EvtHelloBadGenesis:  -500,
+	EvtBlockSyncSuccess: 1,
+	EvtBlockSyncFailure: -5,
+	EvtPubsubAccept:     0.5,
+	EvtPubsubReject:     -50,
+	EvtSyncSuccess:      2,
+	EvtSyncFailure:      -10,
+}
+
+func (e Event) String() string {
+	if e < 0 || e >= evtCount {
+		return "unknown"
+	}
+	return evtNames[e]
+}
+
+const (
+	MaxScore = 100
+	MinScore = -1000
+
+	// ProtectThreshold is the score above which peers are protected from
+	// being trimmed by the connection manager
+	ProtectThreshold = 50
+
+	// BanThreshold is the score below which peers are banned
+	BanThreshold = -500
+	// BanDuration is how long automatic bans last
+	BanDuration = time.Hour
+
+	// scores halve every scoreHalfLife, so peers can recover from
+	// transient misbehaviour and good peers have to keep being good
+	scoreHalfLife = time.Hour
+
+	// entries with scores this close to zero, which we haven't heard about in
+	// a while are dropped
+	pruneEpsilon = 0.1
+	pruneAge     = 6 * time.Hour
+
+	connMgrTag  = "peerrep"
+	tagInterval = 30 * time.Second
+)
+
+// PeerScore is a snapshot of a peers reputation
+type PeerScore struct {
+	ID        peer.ID
+	Score     float64
+	Protected bool
+	Events    map[string]uint64
+}
+
+type peerRecord struct {
+	score     float64
+	updated   time.Time
+	lastSeen  time.Time
+	protected bool
+	banned    bool
+	events    [evtCount]uint64
+}
+
+// PeerRep tracks the reputation of peers based on their observed behaviour in
+// chain protocols (hello, blocksync, pubsub and chain sync)
+type PeerRep struct {
+	lk    sync.Mutex
+	peers map[peer.ID]*peerRecord
+
+	cmgr connmgr.ConnManager
+	ban  BanFunc
+
+	clock func() time.Time
+}
+
+// BanFunc is called when a peer score drops below BanThreshold
+type BanFunc func(p peer.ID, dur time.Duration, reason string)
+
+func NewPeerRep(cmgr connmgr.ConnManager, ban BanFunc) *PeerRep {
+	return &PeerRep{
+		peers: make(map[peer.ID]*peerRecord),
+		cmgr:  cmgr,
+		ban:   ban,
+		clock: time.Now,
+	}
+}
+
+// decay brings the record score up to date, caller must hold the lock
+func (pr *PeerRep) decay(rec *peerRecord, now time.Time) {
+	elapsed := now.Sub(rec.updated)
+	if elapsed > 0 {
+		rec.score *= math.Pow(0.5, float64(elapsed)/float64(scoreHalfLife))
+	}
+	rec.updated = now
+}
+
+// Record applies an observed event to the reputation of the given peer
+func (pr *PeerRep) Record(p peer.ID, evt Event) {
+	if evt < 0 || evt >= evtCount {
+		log.Warnf("unknown peer reputation event %d", evt)
+		return
+	}
+
+	pr.lk.Lock()
+	defer pr.lk.Unlock()
+
+	now := pr.clock()
+	rec, ok := pr.peers[p]
+	if !ok {
+		rec = &peerRecord{updated: now}
+		pr.peers[p] = rec
+	}
+
+	pr.decay(rec, now)
+	rec.score += evtWeights[evt]
+	if rec.score > MaxScore {
+		rec.score = MaxScore
+	}
+	if rec.score < MinScore {
+		rec.score = MinScore
+	}
+	rec.events[evt]++
+	rec.lastSeen = now
+
+	if rec.score > BanThreshold {
+		rec.banned = false
+	} else if !rec.banned && pr.ban != nil {
+		rec.banned = true
+		go pr.ban(p, BanDuration, fmt.Sprintf("peer reputation %.1f (last event: %s)", rec.score, evt))
+	}
+}
+
+// Score returns the current reputation of the given peer, unknown peers have
+// a neutral score of zero
+func (pr *PeerRep) Score(p peer.ID) float64 {
+	pr.lk.Lock()
+	defer pr.lk.Unlock()
+
+	rec, ok := pr.peers[p]
+	if !ok {
+		return 0
+	}
+
+	pr.decay(rec, pr.clock())
+	return rec.score
+}
+
+// Scores returns reputation of all known peers, best peers first
+func (pr *PeerRep) Scores() []PeerScore {
+	pr.lk.Lock()
+	defer pr.lk.Unlock()
+
+	now := pr.clock()
+	out := make([]PeerScore, 0, len(pr.peers))
+	for p, rec := range pr.peers {
+		pr.decay(rec, now)
+
+		evts := make(map[string]uint64)
+		for e, n := range rec.events {
+			if n > 0 {
+				evts[Event(e).String()] = n
+			}
+		}
+
+		out = append(out, PeerScore{
+			ID:        p,
+			Score:     rec.score,
+			Protected: rec.protected,
+			Events:    evts,
+		})
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Score > out[j].Score
+	})
+
+	return out
+}
+
+func (pr *PeerRep) Run(ctx context.Context) {
+	tick := time.NewTicker(tagInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+			pr.tagPeers()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// tagPeers propagates peer scores to the connection manager, and drops
+// records of peers we don't care about anymore
+func (pr *PeerRep) tagPeers() {
+	pr.lk.Lock()
+	defer pr.lk.Unlock()
+
+	now := pr.clock()
+	for p, rec := range pr.peers {
+		pr.decay(rec, now)
+
+		if math.Abs(rec.score) < pruneEpsilon && now.Sub(rec.lastSeen) > pruneAge {
+			if rec.protected {
+				pr.cmgr.Unprotect(p, connMgrTag)
+			}
+			pr.cmgr.UntagPeer(p, connMgrTag)
+			delete(pr.peers, p)
+			continue
+		}
+
+		pr.cmgr.TagPeer(p, connMgrTag, int(rec.score))
+
+		protect := rec.score >= ProtectThreshold
+		if protect != rec.protected {
+			if protect {
+				pr.cmgr.Protect(p, connMgrTag)
+			} else {
+				pr.cmgr.Unprotect(p, connMgrTag)
+			}
+			rec.protected = protect
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package peerrep
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/connmgr"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+func TestRecordAndDecay(t *testing.T) {
+	now := time.Unix(1000, 0)
+
+	pr := NewPeerRep(&connmgr.NullConnMgr{}, nil)
+	pr.clock = func() time.Time { return now }
+
+	good := peer.ID("good")
+	bad := peer.ID("bad")
+
+	for i := 0; i < 10; i++ {
+		pr.Record(good, EvtBlockSyncSuccess)
+	}
+	pr.Record(bad, EvtPubsubReject)
+
+	if s := pr.Score(good); s != 10 {
+		t.Fatalf("expected score 10, got %f", s)
+	}
+	if s := pr.Score(bad); s != evtWeights[EvtPubsubReject] {
+		t.Fatalf("expected score %f, got %f", evtWeights[EvtPubsubReject], s)
+	}
+	if s := pr.Score(peer.ID("unknown")); s != 0 {
+		t.Fatalf("expected unknown peer to have neutral score, got %f", s)
+	}
+
+	scores := pr.Scores()
+	if len(scores) != 2 || scores[0].ID != good || scores[1].ID != bad {
+		t.Fatalf("unexpected scores ordering: %v", scores)
+	}
+	if scores[0].Events[EvtBlockSyncSuccess.String()] != 10 {
+		t.Fatalf("expected 10 blocksync successes, got %d", scores[0].Events[EvtBlockSyncSuccess.String()])
+	}
+
+	now = now.Add(scoreHalfLife)
+	if s := pr.Score(good); s != 5 {
+		t.Fatalf("expected score to halve after half-life, got %f", s)
+	}
+}
+
+func TestScoreBounds(t *testing.T) {
+	pr := NewPeerRep(&connmgr.NullConnMgr{}, nil)
+	p := peer.ID("p")
+
+	for i := 0; i < 1000; i++ {
+		pr.Record(p, EvtHelloOK)
+	}
+	if s := pr.Score(p); s > MaxScore {
+		t.Fatalf("score %f above max", s)
+	}
+
+	for i := 0; i < 100; i++ {
+		pr.Record(p, EvtHelloBadGenesis)
+	}
+	if s := pr.Score(p); s < MinScore {
+		t.Fatalf("score %f below min", s)
+	}
+}
+
+func TestBan(t *testing.T) {
+	banned := make(chan peer.ID, 2)
+	pr := NewPeerRep(&connmgr.NullConnMgr{}, func(p peer.ID, dur time.Duration, reason string) {
+		banned <- p
+	})
+	p := peer.ID("p")
+
+	for i := 0; i < 10; i++ {
+		pr.Record(p, EvtHelloBadGenesis)
+	}
+
+	select {
+	case b := <-banned:
+		if b != p {
+			t.Fatalf("banned wrong peer %s", b)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("peer wasn't banned")
+	}
+
+	select {
+	case <-banned:
+		t.Fatal("peer banned twice")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
@@ -0,0 +1,211 @@
+package dealfilter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/builtin/market"
+
+	"github.com/filecoin-project/lotus/node/config"
+)
+
+var log = logging.Logger("dealfilter")
+
+// CommandTimeout is how long the external filter command can take to decide
+var CommandTimeout = 30 * time.Second
+
+// DealLister lists deals known to the storage provider
+type DealLister func() ([]storagemarket.MinerDeal, error)
+
+// Filter decides which storage deals the miner accepts, based on the
+// Dealmaking section of the miner config
+type Filter struct {
+	cfg config.DealmakingConfig
+
+	allowed map[address.Address]struct{}
+	blocked map[address.Address]struct{}
+
+	deals DealLister
+}
+
+func New(cfg config.DealmakingConfig) (*Filter, error) {
+	f := &Filter{
+		cfg: cfg,
+	}
+
+	var err error
+	if f.allowed, err = parseAddrs(cfg.AllowedClients); err != nil {
+		return nil, xerrors.Errorf("parsing allowed clients: %w", err)
+	}
+	if f.blocked, err = parseAddrs(cfg.BlockedClients); err != nil {
+		return nil, xerrors.Errorf("parsing blocked clients: %w", err)
+	}
+
+	return f, nil
+}
+
+func parseAddrs(addrs []string) (map[address.Address]struct{}, error) {
+	if len(addrs) == 0 {
+		return nil, nil
+	}
+
+	out := map[address.Address]struct{}{}
+	for _, s := range addrs {
+		a, err := address.NewFromString(s)
+		if err != nil {
+			return nil, xerrors.Errorf("parsing address %q: %w", s, err)
+		}
+		out[a] = struct{}{}
+	}
+	return out, nil
+}
+
+// SetDealLister sets the source of deals counted against MaxDealsInProgress.
+// It must be called before the provider starts handling deals
+func (f *Filter) SetDealLister(l DealLister) {
+	f.deals = l
+}
+
+// Input is what the external filter command receives on stdin
+type Input struct {
+	ProposalCid cid.Cid
+	ClientPeer  peer.ID
+	Proposal    market.DealProposal
+	Ref         *storagemarket.DataRef
+
+	// Height is the current chain height
+	Height abi.ChainEpoch
+}
+
+// Check returns an error describing why the deal should be rejected, or nil
+// if it passes all rules
+func (f *Filter) Check(ctx context.Context, deal storagemarket.MinerDeal, height abi.ChainEpoch) error {
+	prop := deal.Proposal
+
+	if _, ok := f.blocked[prop.Client]; ok {
+		return xerrors.Errorf("client %s is blocked", prop.Client)
+	}
+	if f.allowed != nil {
+		if _, ok := f.allowed[prop.Client]; !ok {
+			return xerrors.Errorf("client %s is not allowed", prop.Client)
+		}
+	}
+
+	if f.cfg.MinPieceSize > 0 && uint64(prop.PieceSize) < f.cfg.MinPieceSize {
+		return xerrors.Errorf("piece size %d below minimum %d", prop.PieceSize, f.cfg.MinPieceSize)
+	}
+	if f.cfg.MaxPieceSize > 0 && uint64(prop.PieceSize) > f.cfg.MaxPieceSize {
+		return xerrors.Errorf("piece size %d above maximum %d", prop.PieceSize, f.cfg.MaxPieceSize)
+	}
+
+	duration := prop.Duration()
+	if f.cfg.MinDuration > 0 && duration < abi.ChainEpoch(f.cfg.MinDuration) {
+		return xerrors.Errorf("deal duration %d below minimum %d epochs", duration, f.cfg.MinDuration)
+	}
+	if f.cfg.MaxDuration > 0 && duration > abi.ChainEpoch(f.cfg.MaxDuration) {
+		return xerrors.Errorf("deal duration %d above maximum %d epochs", duration, f.cfg.MaxDuration)
+	}
+
+	if f.cfg.StartEpochBuffer > 0 && prop.StartEpoch < height+abi.ChainEpoch(f.cfg.StartEpochBuffer) {
+		return xerrors.Errorf("deal starts at %d, need at least %d epochs from current height %d", prop.StartEpoch, f.cfg.StartEpochBuffer, height)
+	}
+
+	if f.cfg.MaxDealsInProgress > 0 && f.deals != nil {
+		n, err := f.inProgress(deal.ProposalCid)
+		if err != nil {
+			return xerrors.Errorf("counting deals in progress: %w", err)
+		}
+		if n >= f.cfg.MaxDealsInProgress {
+			return xerrors.Errorf("too many deals in progress (%d, max %d)", n, f.cfg.MaxDealsInProgress)
+		}
+	}
+
+	if f.cfg.Filter != "" {
+		if err := f.runCommand(ctx, Input{
+			ProposalCid: deal.ProposalCid,
+			ClientPeer:  deal.Client,
+			Proposal:    prop,
+			Ref:         deal.Ref,
+			Height:      height,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// inProgress counts deals which were accepted, but aren't active or failed
+// yet, not counting the deal being checked
+func (f *Filter) inProgress(self cid.Cid) (int, error) {
+	deals, err := f.deals()
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, d := range deals {
+		if self.Defined() && d.ProposalCid.Equals(self) {
+			continue
+		}
+
+		switch d.State {
+		case storagemarket.StorageDealProposalNotFound,
+			storagemarket.StorageDealProposalRejected,
+			storagemarket.StorageDealActive,
+			storagemarket.StorageDealFailing,
+			storagemarket.StorageDealNotFound,
+			storagemarket.StorageDealError,
+			storagemarket.StorageDealCompleted:
+			continue
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// runCommand calls the external filter with the deal as JSON on stdin. Exit
+// status 0 accepts the deal, otherwise the output is the rejection reason
+func (f *Filter) runCommand(ctx context.Context, in Input) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return xerrors.Errorf("marshaling filter input: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, CommandTimeout)
+	defer cancel()
+
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", f.cfg.Filter)
+	cmd.Stdin = bytes.NewReader(b)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok && ctx.Err() == nil {
+			reason := strings.TrimSpace(out.String())
+			if reason == "" {
+				reason = err.Error()
+			}
+			return xerrors.Errorf("rejected by filter: %s", reason)
+		}
+
+		log.Errorw("running deal filter command", "command", f.cfg.Filter, "error", err, "output", out.String())
+		return xerrors.Errorf("running deal filter: %w", err)
+	}
+
+	return nil
+}
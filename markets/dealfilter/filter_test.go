@@ -0,0 +1,125 @@
+package dealfilter
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/builtin/market"
+
+	"github.com/filecoin-project/lotus/node/config"
+)
+
+func testDeal(client address.Address, size abi.PaddedPieceSize, start, end abi.ChainEpoch) storagemarket.MinerDeal {
+	return storagemarket.MinerDeal{
+		ClientDealProposal: market.ClientDealProposal{
+			Proposal: market.DealProposal{
+				Client:     client,
+				PieceSize:  size,
+				StartEpoch: start,
+				EndEpoch:   end,
+			},
+		},
+	}
+}
+
+func TestFilterRules(t *testing.T) {
+	good, _ := address.NewIDAddress(100)
+	bad, _ := address.NewIDAddress(101)
+	other, _ := address.NewIDAddress(102)
+
+	f, err := New(config.DealmakingConfig{
+		AllowedClients:   []string{good.String(), bad.String()},
+		BlockedClients:   []string{bad.String()},
+		MinPieceSize:     256,
+		MaxPieceSize:     2048,
+		MinDuration:      100,
+		MaxDuration:      1000,
+		StartEpochBuffer: 50,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	cases := []struct {
+		name   string
+		deal   storagemarket.MinerDeal
+		reject string
+	}{
+		{"ok", testDeal(good, 1024, 100, 500), ""},
+		{"blocked", testDeal(bad, 1024, 100, 500), "blocked"},
+		{"not allowed", testDeal(other, 1024, 100, 500), "not allowed"},
+		{"small", testDeal(good, 128, 100, 500), "below minimum"},
+		{"big", testDeal(good, 4096, 100, 500), "above maximum"},
+		{"short", testDeal(good, 1024, 100, 150), "duration"},
+		{"long", testDeal(good, 1024, 100, 5000), "duration"},
+		{"soon", testDeal(good, 1024, 20, 500), "need at least"},
+	}
+
+	for _, c := range cases {
+		err := f.Check(ctx, c.deal, 10)
+		switch {
+		case c.reject == "" && err != nil:
+			t.Errorf("%s: unexpected rejection: %s", c.name, err)
+		case c.reject != "" && err == nil:
+			t.Errorf("%s: deal wasn't rejected", c.name)
+		case c.reject != "" && !strings.Contains(err.Error(), c.reject):
+			t.Errorf("%s: unexpected rejection reason: %s", c.name, err)
+		}
+	}
+}
+
+func TestFilterInProgress(t *testing.T) {
+	f, err := New(config.DealmakingConfig{MaxDealsInProgress: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deals := []storagemarket.MinerDeal{
+		{State: storagemarket.StorageDealTransferring},
+		{State: storagemarket.StorageDealActive},
+		{State: storagemarket.StorageDealError},
+	}
+	f.SetDealLister(func() ([]storagemarket.MinerDeal, error) {
+		return deals, nil
+	})
+
+	client, _ := address.NewIDAddress(100)
+	if err := f.Check(context.Background(), testDeal(client, 1024, 100, 500), 10); err != nil {
+		t.Fatalf("expected deal to be accepted: %s", err)
+	}
+
+	deals = append(deals, storagemarket.MinerDeal{State: storagemarket.StorageDealSealing})
+	if err := f.Check(context.Background(), testDeal(client, 1024, 100, 500), 10); err == nil {
+		t.Fatal("expected deal to be rejected")
+	}
+}
+
+func TestFilterCommand(t *testing.T) {
+	client, _ := address.NewIDAddress(100)
+
+	accept, err := New(config.DealmakingConfig{Filter: "cat > /dev/null"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := accept.Check(context.Background(), testDeal(client, 1024, 100, 500), 10); err != nil {
+		t.Fatalf("expected deal to be accepted: %s", err)
+	}
+
+	reject, err := New(config.DealmakingConfig{Filter: "grep -q '\"PieceSize\":2048' || (echo too small; exit 1)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = reject.Check(context.Background(), testDeal(client, 1024, 100, 500), 10)
+	if err == nil || !strings.Contains(err.Error(), "too small") {
+		t.Fatalf("expected rejection from filter, got: %v", err)
+	}
+	if err := reject.Check(context.Background(), testDeal(client, 2048, 100, 500), 10); err != nil {
+		t.Fatalf("expected deal to be accepted: %s", err)
+	}
+}
@@ -0,0 +1,84 @@
+package dealfilter
+
+import (
+	"context"
+
+	"github.com/filecoin-project/go-address"
+	cborutil "github.com/filecoin-project/go-cbor-util"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-fil-markets/storagemarket/impl/providerutils"
+	"github.com/filecoin-project/go-fil-markets/storagemarket/network"
+
+	"github.com/filecoin-project/lotus/markets/gate"
+)
+
+// NewNetwork wraps the storage market network, and rejects deal proposals
+// which don't pass the filter before they reach the storage provider
+func NewNetwork(net network.StorageMarketNetwork, filter *Filter, node storagemarket.StorageProviderNode, miner address.Address) network.StorageMarketNetwork {
+	n := &netFilter{
+		filter: filter,
+		node:   node,
+		miner:  miner,
+	}
+	return gate.StorageNetwork(net, n.check, n.reject)
+}
+
+type netFilter struct {
+	filter *Filter
+	node   storagemarket.StorageProviderNode
+	miner  address.Address
+}
+
+func (n *netFilter) check(s network.StorageDealStream, proposal network.Proposal) error {
+	if proposal.DealProposal == nil {
+		// let the provider deal with malformed proposals
+		return nil
+	}
+
+	nd, err := cborutil.AsIpld(proposal.DealProposal)
+	if err != nil {
+		return err
+	}
+
+	_, height, err := n.node.GetChainHead(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	return n.filter.Check(context.TODO(), storagemarket.MinerDeal{
+		ClientDealProposal: *proposal.DealProposal,
+		ProposalCid:        nd.Cid(),
+		Client:             s.RemotePeer(),
+		Ref:                proposal.Piece,
+	}, height)
+}
+
+// reject sends a signed rejection, the same way the provider does
+func (n *netFilter) reject(s network.StorageDealStream, proposal network.Proposal, reason string) error {
+	nd, err := cborutil.AsIpld(proposal.DealProposal)
+	if err != nil {
+		return err
+	}
+
+	resp := network.Response{
+		State:    storagemarket.StorageDealFailing,
+		Message:  reason,
+		Proposal: nd.Cid(),
+	}
+
+	ctx := context.TODO()
+	tok, _, err := n.node.GetChainHead(ctx)
+	if err != nil {
+		return err
+	}
+
+	sig, err := providerutils.SignMinerData(ctx, &resp, n.miner, tok, n.node.GetMinerWorkerAddress, n.node.SignBytes)
+	if err != nil {
+		return err
+	}
+
+	return s.WriteDealResponse(network.SignedResponse{
+		Response:  resp,
+		Signature: sig,
+	})
+}
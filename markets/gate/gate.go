@@ -0,0 +1,197 @@
+package gate
+
+import (
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p-core/peer"
+
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	rmnet "github.com/filecoin-project/go-fil-markets/retrievalmarket/network"
+	smnet "github.com/filecoin-project/go-fil-markets/storagemarket/network"
+)
+
+var log = logging.Logger("markets-gate")
+
+// proposal is a deal proposal read from a stream, before it reaches the
+// provider
+type proposal struct {
+	market string
+	client peer.ID
+
+	// check returns an error if the proposal should be rejected, reject tells
+	// the client why
+	check  func() error
+	reject func(reason string) error
+	close  func() error
+	// pass hands the stream with the already read proposal to the provider
+	pass func()
+}
+
+func (p *proposal) handle() {
+	if err := p.check(); err != nil {
+		log.Infow("rejected deal", "market", p.market, "client", p.client, "reason", err)
+		if err := p.reject(err.Error()); err != nil {
+			log.Warnw("sending deal rejection", "market", p.market, "error", err)
+		}
+		p.close() // nolint:errcheck
+		return
+	}
+
+	p.pass()
+}
+
+// StorageCheck returns an error if a storage deal proposal should be rejected
+type StorageCheck func(s smnet.StorageDealStream, proposal smnet.Proposal) error
+
+// StorageReject tells the client its proposal was rejected
+type StorageReject func(s smnet.StorageDealStream, proposal smnet.Proposal, reason string) error
+
+// StorageNetwork wraps the storage market network, and rejects deal proposals
+// which don't pass the check before they reach the storage provider
+func StorageNetwork(net smnet.StorageMarketNetwork, check StorageCheck, reject StorageReject) smnet.StorageMarketNetwork {
+	return &storageNetwork{
+		StorageMarketNetwork: net,
+		check:                check,
+		reject:               reject,
+	}
+}
+
+type storageNetwork struct {
+	smnet.StorageMarketNetwork
+
+	check  StorageCheck
+	reject StorageReject
+}
+
+func (n *storageNetwork) SetDelegate(r smnet.StorageReceiver) error {
+	return n.StorageMarketNetwork.SetDelegate(&storageReceiver{StorageReceiver: r, n: n})
+}
+
+type storageReceiver struct {
+	smnet.StorageReceiver
+	n *storageNetwork
+}
+
+func (r *storageReceiver) HandleDealStream(s smnet.StorageDealStream) {
+	prop, err := s.ReadDealProposal()
+	if err != nil {
+		log.Errorf("failed to read proposal message: %+v", err)
+		s.Close() // nolint:errcheck
+		return
+	}
+
+	p := &proposal{
+		market: "storage",
+		client: s.RemotePeer(),
+		check: func() error {
+			return r.n.check(s, prop)
+		},
+		reject: func(reason string) error {
+			return r.n.reject(s, prop, reason)
+		},
+		close: s.Close,
+		pass: func() {
+			r.StorageReceiver.HandleDealStream(&storageStream{StorageDealStream: s, proposal: prop})
+		},
+	}
+	p.handle()
+}
+
+// storageStream hands the already read proposal to the provider
+type storageStream struct {
+	smnet.StorageDealStream
+	proposal smnet.Proposal
+	read     bool
+}
+
+func (s *storageStream) ReadDealProposal() (smnet.Proposal, error) {
+	if !s.read {
+		s.read = true
+		return s.proposal, nil
+	}
+	return s.StorageDealStream.ReadDealProposal()
+}
+
+// RetrievalCheck returns an error if a retrieval deal proposal should be
+// rejected
+type RetrievalCheck func(s rmnet.RetrievalDealStream, proposal retrievalmarket.DealProposal) error
+
+// QueryWrapper wraps query streams before they reach the retrieval provider
+type QueryWrapper func(s rmnet.RetrievalQueryStream) rmnet.RetrievalQueryStream
+
+// RetrievalNetwork wraps the retrieval market network, and rejects deal
+// proposals which don't pass the check before they reach the retrieval
+// provider. Query streams are wrapped with query, if it's set
+func RetrievalNetwork(net rmnet.RetrievalMarketNetwork, check RetrievalCheck, query QueryWrapper) rmnet.RetrievalMarketNetwork {
+	return &retrievalNetwork{
+		RetrievalMarketNetwork: net,
+		check:                  check,
+		query:                  query,
+	}
+}
+
+type retrievalNetwork struct {
+	rmnet.RetrievalMarketNetwork
+
+	check RetrievalCheck
+	query QueryWrapper
+}
+
+func (n *retrievalNetwork) SetDelegate(r rmnet.RetrievalReceiver) error {
+	return n.RetrievalMarketNetwork.SetDelegate(&retrievalReceiver{RetrievalReceiver: r, n: n})
+}
+
+type retrievalReceiver struct {
+	rmnet.RetrievalReceiver
+	n *retrievalNetwork
+}
+
+func (r *retrievalReceiver) HandleQueryStream(s rmnet.RetrievalQueryStream) {
+	if r.n.query != nil {
+		s = r.n.query(s)
+	}
+	r.RetrievalReceiver.HandleQueryStream(s)
+}
+
+func (r *retrievalReceiver) HandleDealStream(s rmnet.RetrievalDealStream) {
+	prop, err := s.ReadDealProposal()
+	if err != nil {
+		log.Errorf("failed to read retrieval proposal: %+v", err)
+		s.Close() // nolint:errcheck
+		return
+	}
+
+	p := &proposal{
+		market: "retrieval",
+		client: s.Receiver(),
+		check: func() error {
+			return r.n.check(s, prop)
+		},
+		reject: func(reason string) error {
+			return s.WriteDealResponse(retrievalmarket.DealResponse{
+				Status:  retrievalmarket.DealStatusRejected,
+				ID:      prop.ID,
+				Message: reason,
+			})
+		},
+		close: s.Close,
+		pass: func() {
+			r.RetrievalReceiver.HandleDealStream(&retrievalStream{RetrievalDealStream: s, proposal: prop})
+		},
+	}
+	p.handle()
+}
+
+// retrievalStream hands the already read proposal to the provider
+type retrievalStream struct {
+	rmnet.RetrievalDealStream
+	proposal retrievalmarket.DealProposal
+	read     bool
+}
+
+func (s *retrievalStream) ReadDealProposal() (retrievalmarket.DealProposal, error) {
+	if !s.read {
+		s.read = true
+		return s.proposal, nil
+	}
+	return s.RetrievalDealStream.ReadDealProposal()
+}
@@ -21,12 +21,14 @@ type retrievalProviderNode struct {
 	miner  *storage.Miner
 	sealer sectorstorage.SectorManager
 	full   api.FullNode
+	cache  *UnsealedCache
 }
 
 // NewRetrievalProviderNode returns a new node adapter for a retrieval provider that talks to the
-// Lotus Node
-func NewRetrievalProviderNode(miner *storage.Miner, sealer sectorstorage.SectorManager, full api.FullNode) retrievalmarket.RetrievalProviderNode {
-	return &retrievalProviderNode{miner, sealer, full}
+// Lotus Node. The cache may be nil, in which case pieces are unsealed for
+// every retrieval
+func NewRetrievalProviderNode(miner *storage.Miner, sealer sectorstorage.SectorManager, full api.FullNode, cache *UnsealedCache) retrievalmarket.RetrievalProviderNode {
+	return &retrievalProviderNode{miner, sealer, full, cache}
 }
 
 func (rpn *retrievalProviderNode) GetMinerWorkerAddress(ctx context.Context, miner address.Address, tok shared.TipSetToken) (address.Address, error) {
@@ -40,6 +42,12 @@ func (rpn *retrievalProviderNode) GetMinerWorkerAddress(ctx context.Context, min
 }
 
 func (rpn *retrievalProviderNode) UnsealSector(ctx context.Context, sectorID uint64, offset uint64, length uint64) (io.ReadCloser, error) {
+	return rpn.cache.Get(ctx, sectorID, offset, length, func(ctx context.Context) (io.ReadCloser, error) {
+		return rpn.unseal(ctx, sectorID, offset, length)
+	})
+}
+
+func (rpn *retrievalProviderNode) unseal(ctx context.Context, sectorID uint64, offset uint64, length uint64) (io.ReadCloser, error) {
 	si, err := rpn.miner.GetSectorInfo(abi.SectorNumber(sectorID))
 	if err != nil {
 		return nil, err
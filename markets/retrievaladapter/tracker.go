@@ -0,0 +1,163 @@
+package retrievaladapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+
+	"github.com/filecoin-project/lotus/api"
+)
+
+var log = logging.Logger("retrievaladapter")
+
+// DealTracker records the state of retrieval deals in the datastore, so they
+// can be listed after they are done, and streams state changes to
+// subscribers
+type DealTracker struct {
+	ds datastore.Datastore
+
+	lk   sync.Mutex
+	subs map[chan api.RetrievalInfo]struct{}
+}
+
+func NewDealTracker(ds datastore.Datastore) *DealTracker {
+	return &DealTracker{
+		ds:   ds,
+		subs: map[chan api.RetrievalInfo]struct{}{},
+	}
+}
+
+// ClientEvent records a retrieval client deal update, it can be passed to
+// RetrievalClient.SubscribeToEvents
+func (t *DealTracker) ClientEvent(event retrievalmarket.ClientEvent, state retrievalmarket.ClientDealState) {
+	t.update(api.RetrievalInfo{
+		ID:           state.ID,
+		PayloadCID:   state.PayloadCID,
+		Peer:         state.Sender,
+		Status:       state.Status,
+		Message:      state.Message,
+		PricePerByte: state.PricePerByte,
+		Bytes:        state.TotalReceived,
+		Funds:        state.FundsSpent,
+	})
+}
+
+// ProviderEvent records a retrieval provider deal update, it can be passed
+// to RetrievalProvider.SubscribeToEvents
+func (t *DealTracker) ProviderEvent(event retrievalmarket.ProviderEvent, state retrievalmarket.ProviderDealState) {
+	t.update(api.RetrievalInfo{
+		ID:           state.ID,
+		PayloadCID:   state.PayloadCID,
+		Peer:         state.Receiver,
+		Status:       state.Status,
+		Message:      state.Message,
+		PricePerByte: state.PricePerByte,
+		Bytes:        state.TotalSent,
+		Funds:        state.FundsReceived,
+	})
+}
+
+func dealKey(p peer.ID, id retrievalmarket.DealID) datastore.Key {
+	return datastore.NewKey(fmt.Sprintf("/%s/%d", p, id))
+}
+
+func (t *DealTracker) update(info api.RetrievalInfo) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	k := dealKey(info.Peer, info.ID)
+
+	info.Started = time.Now()
+	b, err := t.ds.Get(k)
+	switch err {
+	case nil:
+		var prev api.RetrievalInfo
+		if err := json.Unmarshal(b, &prev); err != nil {
+			log.Errorf("unmarshaling retrieval deal %s: %+v", k, err)
+			break
+		}
+		info.Started = prev.Started
+	case datastore.ErrNotFound:
+	default:
+		log.Errorf("getting retrieval deal %s: %+v", k, err)
+	}
+	info.Updated = time.Now()
+
+	b, err = json.Marshal(&info)
+	if err != nil {
+		log.Errorf("marshaling retrieval deal %s: %+v", k, err)
+		return
+	}
+	if err := t.ds.Put(k, b); err != nil {
+		log.Errorf("storing retrieval deal %s: %+v", k, err)
+	}
+
+	for sub := range t.subs {
+		select {
+		case sub <- info:
+		default:
+			log.Warnw("retrieval update subscriber too slow, dropping update", "deal", info.ID, "peer", info.Peer)
+		}
+	}
+}
+
+// List returns all recorded retrieval deals, oldest first
+func (t *DealTracker) List() ([]api.RetrievalInfo, error) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	res, err := t.ds.Query(query.Query{})
+	if err != nil {
+		return nil, xerrors.Errorf("querying retrieval deals: %w", err)
+	}
+
+	ents, err := res.Rest()
+	if err != nil {
+		return nil, xerrors.Errorf("reading retrieval deals: %w", err)
+	}
+
+	out := make([]api.RetrievalInfo, len(ents))
+	for i, ent := range ents {
+		if err := json.Unmarshal(ent.Value, &out[i]); err != nil {
+			return nil, xerrors.Errorf("unmarshaling retrieval deal %s: %w", ent.Key, err)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Started.Before(out[j].Started)
+	})
+
+	return out, nil
+}
+
+// Updates returns a channel of deal state changes, closed when ctx is done
+func (t *DealTracker) Updates(ctx context.Context) <-chan api.RetrievalInfo {
+	ch := make(chan api.RetrievalInfo, 16)
+
+	t.lk.Lock()
+	t.subs[ch] = struct{}{}
+	t.lk.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		t.lk.Lock()
+		delete(t.subs, ch)
+		t.lk.Unlock()
+
+		close(ch)
+	}()
+
+	return ch
+}
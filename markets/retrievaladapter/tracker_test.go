@@ -0,0 +1,177 @@
+package retrievaladapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/test"
+
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/api"
+)
+
+func clientState(id retrievalmarket.DealID, p peer.ID, status retrievalmarket.DealStatus, received uint64, spent int64) retrievalmarket.ClientDealState {
+	return retrievalmarket.ClientDealState{
+		DealProposal: retrievalmarket.DealProposal{
+			ID:     id,
+			Params: retrievalmarket.NewParamsV0(abi.NewTokenAmount(2), 0, 0),
+		},
+		Status:        status,
+		Sender:        p,
+		TotalReceived: received,
+		FundsSpent:    abi.NewTokenAmount(spent),
+	}
+}
+
+func nextUpdate(t *testing.T, updates <-chan api.RetrievalInfo) api.RetrievalInfo {
+	t.Helper()
+
+	select {
+	case info := <-updates:
+		return info
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for update")
+	}
+	return api.RetrievalInfo{}
+}
+
+func TestDealTrackerClientEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tr := NewDealTracker(dssync.MutexWrap(datastore.NewMapDatastore()))
+	updates := tr.Updates(ctx)
+	prov := test.RandPeerIDFatal(t)
+
+	events := []struct {
+		event    retrievalmarket.ClientEvent
+		status   retrievalmarket.DealStatus
+		received uint64
+		spent    int64
+	}{
+		{retrievalmarket.ClientEventOpen, retrievalmarket.DealStatusNew, 0, 0},
+		{retrievalmarket.ClientEventDealAccepted, retrievalmarket.DealStatusAccepted, 0, 0},
+		{retrievalmarket.ClientEventBlocksReceived, retrievalmarket.DealStatusOngoing, 100, 0},
+		{retrievalmarket.ClientEventComplete, retrievalmarket.DealStatusCompleted, 200, 400},
+	}
+
+	var started time.Time
+	for i, e := range events {
+		tr.ClientEvent(e.event, clientState(1, prov, e.status, e.received, e.spent))
+
+		info := nextUpdate(t, updates)
+		if info.ID != 1 || info.Peer != prov || info.Status != e.status || info.Bytes != e.received || !info.Funds.Equals(abi.NewTokenAmount(e.spent)) {
+			t.Fatalf("event %d: unexpected update %+v", i, info)
+		}
+		if i == 0 {
+			started = info.Started
+		}
+		if !info.Started.Equal(started) || info.Updated.Before(info.Started) {
+			t.Fatalf("event %d: expected the start time to be kept, got started %s, updated %s", i, info.Started, info.Updated)
+		}
+	}
+
+	deals, err := tr.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deals) != 1 {
+		t.Fatalf("expected 1 deal, got %+v", deals)
+	}
+	if d := deals[0]; d.Status != retrievalmarket.DealStatusCompleted || d.Bytes != 200 || !d.Funds.Equals(abi.NewTokenAmount(400)) || !d.PricePerByte.Equals(abi.NewTokenAmount(2)) || !d.Started.Equal(started) {
+		t.Fatalf("unexpected deal %+v", d)
+	}
+
+	cancel()
+	for range updates {
+		t.Fatal("unexpected update")
+	}
+}
+
+func TestDealTrackerProviderEvents(t *testing.T) {
+	tr := NewDealTracker(dssync.MutexWrap(datastore.NewMapDatastore()))
+	client := test.RandPeerIDFatal(t)
+
+	state := retrievalmarket.ProviderDealState{
+		DealProposal: retrievalmarket.DealProposal{ID: 3},
+		Status:       retrievalmarket.DealStatusOngoing,
+		Receiver:     client,
+		TotalSent:    10,
+	}
+	tr.ProviderEvent(retrievalmarket.ProviderEventBlocksCompleted, state)
+
+	state.Status = retrievalmarket.DealStatusFailed
+	state.Message = "payment failed"
+	tr.ProviderEvent(retrievalmarket.ProviderEventSaveVoucherFailed, state)
+
+	deals, err := tr.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deals) != 1 || deals[0].Peer != client || deals[0].Bytes != 10 || deals[0].Status != retrievalmarket.DealStatusFailed || deals[0].Message != "payment failed" {
+		t.Fatalf("unexpected deals %+v", deals)
+	}
+}
+
+func TestDealTrackerList(t *testing.T) {
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	client := NewDealTracker(namespace.Wrap(ds, datastore.NewKey("/client")))
+	provider := NewDealTracker(namespace.Wrap(ds, datastore.NewKey("/provider")))
+	a, b, c := test.RandPeerIDFatal(t), test.RandPeerIDFatal(t), test.RandPeerIDFatal(t)
+
+	// deal IDs are only unique per peer
+	for _, d := range []struct {
+		id retrievalmarket.DealID
+		p  peer.ID
+	}{{5, a}, {1, b}, {1, a}} {
+		client.ClientEvent(retrievalmarket.ClientEventOpen, clientState(d.id, d.p, retrievalmarket.DealStatusNew, 0, 0))
+		time.Sleep(time.Millisecond)
+	}
+	// updates don't change the order
+	client.ClientEvent(retrievalmarket.ClientEventComplete, clientState(5, a, retrievalmarket.DealStatusCompleted, 0, 0))
+
+	provider.ProviderEvent(retrievalmarket.ProviderEventOpen, retrievalmarket.ProviderDealState{
+		DealProposal: retrievalmarket.DealProposal{ID: 1},
+		Receiver:     c,
+	})
+
+	// deals are still listed after restarts
+	client = NewDealTracker(namespace.Wrap(ds, datastore.NewKey("/client")))
+
+	deals, err := client.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deals) != 3 {
+		t.Fatalf("expected only the 3 client deals, got %+v", deals)
+	}
+	expect := []struct {
+		id     retrievalmarket.DealID
+		p      peer.ID
+		status retrievalmarket.DealStatus
+	}{
+		{5, a, retrievalmarket.DealStatusCompleted},
+		{1, b, retrievalmarket.DealStatusNew},
+		{1, a, retrievalmarket.DealStatusNew},
+	}
+	for i, e := range expect {
+		if d := deals[i]; d.ID != e.id || d.Peer != e.p || d.Status != e.status {
+			t.Errorf("deal %d: expected %d with %s in %d, got %+v", i, e.id, e.p, e.status, d)
+		}
+	}
+
+	deals, err = provider.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deals) != 1 || deals[0].Peer != c {
+		t.Fatalf("expected only the provider deal, got %+v", deals)
+	}
+}
@@ -0,0 +1,251 @@
+package retrievaladapter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// UnsealedCache keeps unsealed copies of pieces which get retrieved often, so
+// they don't have to be unsealed for every retrieval
+type UnsealedCache struct {
+	dir string
+	// hot is how many retrievals make a piece worth keeping unsealed
+	hot int
+	// maxSize of all kept copies in bytes, 0 means no limit
+	maxSize uint64
+
+	lk      sync.Mutex
+	counts  map[string]int
+	entries map[string]*cacheEntry
+	size    uint64
+	// storing has a channel for each piece being copied, closed once the copy
+	// is done
+	storing map[string]chan struct{}
+}
+
+type cacheEntry struct {
+	size     uint64
+	lastUsed time.Time
+}
+
+// NewUnsealedCache returns a cache keeping copies in dir. A piece is kept
+// once it was retrieved hot times
+func NewUnsealedCache(dir string, hot int, maxSize uint64) (*UnsealedCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, xerrors.Errorf("creating unsealed cache dir: %w", err)
+	}
+
+	c := &UnsealedCache{
+		dir:     dir,
+		hot:     hot,
+		maxSize: maxSize,
+
+		counts:  map[string]int{},
+		entries: map[string]*cacheEntry{},
+		storing: map[string]chan struct{}{},
+	}
+
+	ents, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, xerrors.Errorf("reading unsealed cache dir: %w", err)
+	}
+	for _, ent := range ents {
+		if filepath.Ext(ent.Name()) == ".tmp" {
+			// interrupted copy
+			if err := os.Remove(filepath.Join(dir, ent.Name())); err != nil {
+				log.Warnf("removing partial unsealed copy: %+v", err)
+			}
+			continue
+		}
+
+		c.entries[ent.Name()] = &cacheEntry{
+			size:     uint64(ent.Size()),
+			lastUsed: ent.ModTime(),
+		}
+		c.size += uint64(ent.Size())
+	}
+
+	return c, nil
+}
+
+func cacheKey(sectorID uint64, offset uint64, length uint64) string {
+	return fmt.Sprintf("s-%d-%d-%d", sectorID, offset, length)
+}
+
+// Has returns whether an unsealed copy of the piece is kept
+func (c *UnsealedCache) Has(sectorID uint64, offset uint64, length uint64) bool {
+	if c == nil {
+		return false
+	}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	_, ok := c.entries[cacheKey(sectorID, offset, length)]
+	return ok
+}
+
+// Get returns the unsealed piece, from a kept copy if there is one. Otherwise
+// it calls unseal, and keeps a copy if the piece is hot. Only one retrieval
+// copies a piece, others wait for the copy
+func (c *UnsealedCache) Get(ctx context.Context, sectorID uint64, offset uint64, length uint64, unseal func(context.Context) (io.ReadCloser, error)) (io.ReadCloser, error) {
+	if c == nil {
+		return unseal(ctx)
+	}
+
+	key := cacheKey(sectorID, offset, length)
+	path := filepath.Join(c.dir, key)
+
+	c.lk.Lock()
+	for {
+		if ent, ok := c.entries[key]; ok {
+			ent.lastUsed = time.Now()
+			c.lk.Unlock()
+
+			f, err := os.Open(path)
+			if err == nil {
+				return f, nil
+			}
+
+			log.Warnf("opening unsealed copy, unsealing again: %+v", err)
+			c.remove(key)
+			c.lk.Lock()
+			continue
+		}
+
+		wait, ok := c.storing[key]
+		if !ok {
+			break
+		}
+
+		c.lk.Unlock()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		c.lk.Lock()
+	}
+
+	c.counts[key]++
+	keep := c.counts[key] >= c.hot
+	if keep {
+		c.storing[key] = make(chan struct{})
+	}
+	c.lk.Unlock()
+
+	if !keep {
+		return unseal(ctx)
+	}
+	defer c.stored(key)
+
+	r, err := unseal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.store(key, path, r); err != nil {
+		log.Errorf("keeping unsealed copy of %s: %+v", key, err)
+		// the reader was consumed, unseal again
+		return unseal(ctx)
+	}
+
+	return os.Open(path)
+}
+
+// stored wakes retrievals waiting for the copy of the piece
+func (c *UnsealedCache) stored(key string) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	close(c.storing[key])
+	delete(c.storing, key)
+}
+
+func (c *UnsealedCache) store(key string, path string, r io.ReadCloser) error {
+	defer r.Close() // nolint:errcheck
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	n, err := io.Copy(f, r)
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	delete(c.counts, key)
+	c.entries[key] = &cacheEntry{
+		size:     uint64(n),
+		lastUsed: time.Now(),
+	}
+	c.size += uint64(n)
+	c.evict(key)
+
+	return nil
+}
+
+// evict removes the least recently used copies until the cache fits in
+// maxSize, keeping the one just added. Called with the lock held
+func (c *UnsealedCache) evict(keep string) {
+	if c.maxSize == 0 || c.size <= c.maxSize {
+		return
+	}
+
+	keys := make([]string, 0, len(c.entries))
+	for k := range c.entries {
+		if k != keep {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.entries[keys[i]].lastUsed.Before(c.entries[keys[j]].lastUsed)
+	})
+
+	for _, k := range keys {
+		if c.size <= c.maxSize {
+			return
+		}
+
+		if err := os.Remove(filepath.Join(c.dir, k)); err != nil && !os.IsNotExist(err) {
+			log.Warnf("removing unsealed copy %s: %+v", k, err)
+			continue
+		}
+		c.size -= c.entries[k].size
+		delete(c.entries, k)
+	}
+}
+
+func (c *UnsealedCache) remove(key string) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if ent, ok := c.entries[key]; ok {
+		c.size -= ent.size
+		delete(c.entries, key)
+	}
+}
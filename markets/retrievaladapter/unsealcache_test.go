@@ -0,0 +1,168 @@
+package retrievaladapter
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+type testUnsealer struct {
+	lk    sync.Mutex
+	calls int
+
+	data    []byte
+	release chan struct{}
+}
+
+func (u *testUnsealer) unseal(ctx context.Context) (io.ReadCloser, error) {
+	u.lk.Lock()
+	u.calls++
+	u.lk.Unlock()
+
+	if u.release != nil {
+		<-u.release
+	}
+	return ioutil.NopCloser(bytes.NewReader(u.data)), nil
+}
+
+func (u *testUnsealer) called() int {
+	u.lk.Lock()
+	defer u.lk.Unlock()
+	return u.calls
+}
+
+func newTestCache(t *testing.T, hot int, maxSize uint64) (*UnsealedCache, string) {
+	dir, err := ioutil.TempDir("", "lotus-unsealed-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewUnsealedCache(dir, hot, maxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, dir
+}
+
+func read(c *UnsealedCache, sector uint64, length uint64, u *testUnsealer) (string, error) {
+	r, err := c.Get(context.TODO(), sector, 0, length, u.unseal)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close() // nolint:errcheck
+
+	b, err := ioutil.ReadAll(r)
+	return string(b), err
+}
+
+func get(t *testing.T, c *UnsealedCache, sector uint64, length uint64, u *testUnsealer) string {
+	t.Helper()
+
+	out, err := read(c, sector, length, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestUnsealedCacheHot(t *testing.T) {
+	c, dir := newTestCache(t, 2, 0)
+	defer os.RemoveAll(dir) // nolint:errcheck
+
+	u := &testUnsealer{data: []byte("piece")}
+
+	if got := get(t, c, 1, 5, u); got != "piece" || c.Has(1, 0, 5) {
+		t.Fatalf("expected the piece to be unsealed without a copy, got %q", got)
+	}
+	if got := get(t, c, 1, 5, u); got != "piece" || !c.Has(1, 0, 5) {
+		t.Fatalf("expected the hot piece to be kept, got %q", got)
+	}
+	if got := get(t, c, 1, 5, u); got != "piece" || u.called() != 2 {
+		t.Fatalf("expected the kept copy to be read, got %q after %d unseals", got, u.called())
+	}
+
+	// kept copies are found again, partial copies are removed
+	if err := ioutil.WriteFile(filepath.Join(dir, cacheKey(2, 0, 5)+".tmp"), []byte("pie"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewUnsealedCache(dir, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Has(1, 0, 5) || c.size != 5 {
+		t.Fatalf("expected the kept copy to be loaded, size %d", c.size)
+	}
+	if _, err := os.Stat(filepath.Join(dir, cacheKey(2, 0, 5)+".tmp")); !os.IsNotExist(err) {
+		t.Fatalf("expected the partial copy to be removed, got %v", err)
+	}
+}
+
+func TestUnsealedCacheConcurrent(t *testing.T) {
+	c, dir := newTestCache(t, 1, 0)
+	defer os.RemoveAll(dir) // nolint:errcheck
+
+	u := &testUnsealer{data: []byte("piece"), release: make(chan struct{})}
+
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := read(c, 1, 5, u)
+			if err == nil && got != "piece" {
+				err = xerrors.Errorf("unexpected piece data %q", got)
+			}
+			errs <- err
+		}()
+	}
+
+	close(u.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if u.called() != 1 {
+		t.Fatalf("expected the piece to be unsealed once, got %d", u.called())
+	}
+	if c.size != 5 || len(c.storing) != 0 {
+		t.Fatalf("unexpected size %d, %d copies in progress", c.size, len(c.storing))
+	}
+}
+
+func TestUnsealedCacheEvict(t *testing.T) {
+	c, dir := newTestCache(t, 1, 10)
+	defer os.RemoveAll(dir) // nolint:errcheck
+
+	u := &testUnsealer{data: []byte("piece!")}
+
+	for sector := uint64(1); sector <= 3; sector++ {
+		get(t, c, sector, 6, u)
+	}
+	if c.Has(1, 0, 6) || c.Has(2, 0, 6) || !c.Has(3, 0, 6) {
+		t.Fatal("expected only the last copy to be kept")
+	}
+	if c.size != 6 {
+		t.Fatalf("expected size 6, got %d", c.size)
+	}
+
+	ents, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ents) != 1 {
+		t.Fatalf("expected 1 kept file, got %d", len(ents))
+	}
+}
@@ -0,0 +1,71 @@
+package retrievalpolicy
+
+import (
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket/network"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+
+	"github.com/filecoin-project/lotus/markets/gate"
+)
+
+// NewNetwork wraps the retrieval market network. It rejects deal proposals
+// from clients the policy doesn't allow, and adds the unseal price to query
+// responses and the price checked for deals
+func NewNetwork(net network.RetrievalMarketNetwork, policy *Policy) network.RetrievalMarketNetwork {
+	return gate.RetrievalNetwork(net, policy.checkDeal, func(s network.RetrievalQueryStream) network.RetrievalQueryStream {
+		return &queryStream{RetrievalQueryStream: s, policy: policy}
+	})
+}
+
+func (p *Policy) checkDeal(s network.RetrievalDealStream, proposal retrievalmarket.DealProposal) error {
+	if err := p.CheckPeer(s.Receiver()); err != nil {
+		return err
+	}
+
+	extra, err := p.UnsealPricePerByte(proposal.PayloadCID)
+	if err != nil {
+		// let the provider reject deals for unknown payloads
+		log.Warnf("getting unseal price: %+v", err)
+		return nil
+	}
+	if extra.IsZero() {
+		return nil
+	}
+
+	min := big.Add(p.Get().PricePerByte, extra)
+	if proposal.PricePerByte.LessThan(min) {
+		return xerrors.Errorf("price per byte %s below %s, which includes unsealing", proposal.PricePerByte, min)
+	}
+	return nil
+}
+
+// queryStream adds the unseal price to the price in query responses
+type queryStream struct {
+	network.RetrievalQueryStream
+	policy *Policy
+
+	payload cid.Cid
+}
+
+func (s *queryStream) ReadQuery() (retrievalmarket.Query, error) {
+	q, err := s.RetrievalQueryStream.ReadQuery()
+	if err == nil {
+		s.payload = q.PayloadCID
+	}
+	return q, err
+}
+
+func (s *queryStream) WriteQueryResponse(resp retrievalmarket.QueryResponse) error {
+	if resp.Status == retrievalmarket.QueryResponseAvailable && s.payload.Defined() {
+		extra, err := s.policy.UnsealPricePerByte(s.payload)
+		if err != nil {
+			log.Warnf("getting unseal price: %+v", err)
+		} else {
+			resp.MinPricePerByte = big.Add(resp.MinPricePerByte, extra)
+		}
+	}
+	return s.RetrievalQueryStream.WriteQueryResponse(resp)
+}
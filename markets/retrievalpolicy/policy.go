@@ -0,0 +1,219 @@
+package retrievalpolicy
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-fil-markets/piecestore"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/markets/retrievaladapter"
+	"github.com/filecoin-project/lotus/node/config"
+)
+
+var log = logging.Logger("retrievalpolicy")
+
+// policyKey is where the policy set through the API is stored, it's used
+// instead of the config on restart
+var policyKey = datastore.NewKey("/retrieval-policy/latest")
+
+// Policy decides which clients can retrieve from the miner, and what the
+// miner charges for retrievals
+type Policy struct {
+	ds     datastore.Datastore
+	pieces piecestore.PieceStore
+	cache  *retrievaladapter.UnsealedCache
+
+	lk      sync.RWMutex
+	policy  api.RetrievalPolicy
+	allowed map[peer.ID]struct{}
+	blocked map[peer.ID]struct{}
+}
+
+func New(cfg config.RetrievalConfig, ds datastore.Datastore, pieces piecestore.PieceStore, cache *retrievaladapter.UnsealedCache) (*Policy, error) {
+	p := &Policy{
+		ds:     ds,
+		pieces: pieces,
+		cache:  cache,
+	}
+
+	b, err := ds.Get(policyKey)
+	switch err {
+	case nil:
+		var pol api.RetrievalPolicy
+		if err := json.Unmarshal(b, &pol); err != nil {
+			return nil, xerrors.Errorf("unmarshaling stored retrieval policy: %w", err)
+		}
+		if err := p.set(pol); err != nil {
+			return nil, xerrors.Errorf("stored retrieval policy: %w", err)
+		}
+		return p, nil
+	case datastore.ErrNotFound:
+	default:
+		return nil, xerrors.Errorf("loading retrieval policy: %w", err)
+	}
+
+	pol := api.RetrievalPolicy{
+		PricePerByte:            abi.TokenAmount(cfg.PricePerByte),
+		UnsealPrice:             abi.TokenAmount(cfg.UnsealPrice),
+		PaymentInterval:         cfg.PaymentInterval,
+		PaymentIntervalIncrease: cfg.PaymentIntervalIncrease,
+	}
+
+	if pol.AllowedPeers, err = parsePeers(cfg.AllowedPeers); err != nil {
+		return nil, xerrors.Errorf("parsing allowed peers: %w", err)
+	}
+	if pol.BlockedPeers, err = parsePeers(cfg.BlockedPeers); err != nil {
+		return nil, xerrors.Errorf("parsing blocked peers: %w", err)
+	}
+
+	if err := p.set(pol); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func parsePeers(ps []string) ([]peer.ID, error) {
+	var out []peer.ID
+	for _, s := range ps {
+		p, err := peer.Decode(s)
+		if err != nil {
+			return nil, xerrors.Errorf("parsing peer ID %q: %w", s, err)
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func peerSet(ps []peer.ID) map[peer.ID]struct{} {
+	if len(ps) == 0 {
+		return nil
+	}
+
+	out := make(map[peer.ID]struct{}, len(ps))
+	for _, p := range ps {
+		out[p] = struct{}{}
+	}
+	return out
+}
+
+// Get returns the current policy
+func (p *Policy) Get() api.RetrievalPolicy {
+	p.lk.RLock()
+	defer p.lk.RUnlock()
+
+	return p.policy
+}
+
+// Set replaces and stores the policy. Prices and payment intervals also have
+// to be set on the retrieval provider
+func (p *Policy) Set(pol api.RetrievalPolicy) error {
+	if err := validate(&pol); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(pol)
+	if err != nil {
+		return xerrors.Errorf("marshaling retrieval policy: %w", err)
+	}
+	if err := p.ds.Put(policyKey, b); err != nil {
+		return xerrors.Errorf("storing retrieval policy: %w", err)
+	}
+
+	return p.set(pol)
+}
+
+func (p *Policy) set(pol api.RetrievalPolicy) error {
+	if err := validate(&pol); err != nil {
+		return err
+	}
+
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	p.policy = pol
+	p.allowed = peerSet(pol.AllowedPeers)
+	p.blocked = peerSet(pol.BlockedPeers)
+	return nil
+}
+
+func validate(pol *api.RetrievalPolicy) error {
+	if pol.PricePerByte.Int == nil || pol.PricePerByte.LessThan(big.Zero()) {
+		return xerrors.Errorf("invalid price per byte")
+	}
+	if pol.UnsealPrice.Int == nil {
+		pol.UnsealPrice = big.Zero()
+	}
+	if pol.UnsealPrice.LessThan(big.Zero()) {
+		return xerrors.Errorf("invalid unseal price")
+	}
+	if pol.PaymentInterval == 0 {
+		return xerrors.Errorf("payment interval must be positive")
+	}
+	return nil
+}
+
+// CheckPeer returns an error if the client isn't allowed to retrieve
+func (p *Policy) CheckPeer(client peer.ID) error {
+	p.lk.RLock()
+	defer p.lk.RUnlock()
+
+	if _, ok := p.blocked[client]; ok {
+		return xerrors.Errorf("client %s is blocked", client)
+	}
+	if p.allowed != nil {
+		if _, ok := p.allowed[client]; !ok {
+			return xerrors.Errorf("client %s is not allowed", client)
+		}
+	}
+	return nil
+}
+
+// UnsealPricePerByte returns what is added to the price per byte for the
+// payload, the unseal price spread over the bytes of its piece. It's zero if
+// an unsealed copy of the piece is kept
+func (p *Policy) UnsealPricePerByte(payload cid.Cid) (abi.TokenAmount, error) {
+	p.lk.RLock()
+	price := p.policy.UnsealPrice
+	p.lk.RUnlock()
+
+	if price.IsZero() {
+		return big.Zero(), nil
+	}
+
+	ci, err := p.pieces.GetCIDInfo(payload)
+	if err != nil {
+		return big.Zero(), xerrors.Errorf("getting cid info: %w", err)
+	}
+	if len(ci.PieceBlockLocations) == 0 {
+		return big.Zero(), xerrors.Errorf("no pieces contain %s", payload)
+	}
+
+	pi, err := p.pieces.GetPieceInfo(ci.PieceBlockLocations[0].PieceCID)
+	if err != nil {
+		return big.Zero(), xerrors.Errorf("getting piece info: %w", err)
+	}
+
+	var length uint64
+	for _, d := range pi.Deals {
+		if p.cache.Has(d.SectorID, d.Offset, d.Length) {
+			return big.Zero(), nil
+		}
+		length = d.Length
+	}
+	if length == 0 {
+		return big.Zero(), nil
+	}
+
+	// round up, so the whole unseal price gets paid
+	n := big.NewIntUnsigned(length)
+	return big.Div(big.Sub(big.Add(price, n), big.NewInt(1)), n), nil
+}
@@ -0,0 +1,141 @@
+package retrievalpolicy
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-fil-markets/piecestore"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/node/config"
+)
+
+type testPieceStore struct {
+	piecestore.PieceStore
+
+	piece cid.Cid
+	deals []piecestore.DealInfo
+}
+
+func (ps *testPieceStore) GetCIDInfo(payload cid.Cid) (piecestore.CIDInfo, error) {
+	if payload != ps.piece {
+		return piecestore.CIDInfo{}, xerrors.New("not found")
+	}
+	return piecestore.CIDInfo{
+		CID:                 payload,
+		PieceBlockLocations: []piecestore.PieceBlockLocation{{PieceCID: ps.piece}},
+	}, nil
+}
+
+func (ps *testPieceStore) GetPieceInfo(piece cid.Cid) (piecestore.PieceInfo, error) {
+	return piecestore.PieceInfo{PieceCID: piece, Deals: ps.deals}, nil
+}
+
+func testConfig(allowed, blocked []string) config.RetrievalConfig {
+	return config.RetrievalConfig{
+		PricePerByte:    types.FIL(types.NewInt(2)),
+		UnsealPrice:     types.FIL(types.NewInt(10)),
+		PaymentInterval: 1 << 20,
+		AllowedPeers:    allowed,
+		BlockedPeers:    blocked,
+	}
+}
+
+func TestPolicyPeers(t *testing.T) {
+	const otherID = "QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN"
+	client, err := peer.Decode("QmcgpsyWgH8Y8ajJz1Cu72KnS5uo2Aa2LpzU7kinSupNKC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := peer.Decode(otherID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+
+	p, err := New(testConfig(nil, []string{otherID}), ds, &testPieceStore{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.CheckPeer(client); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.CheckPeer(other); err == nil {
+		t.Fatal("expected blocked client to be rejected")
+	}
+
+	pol := p.Get()
+	pol.BlockedPeers = nil
+	pol.AllowedPeers = []peer.ID{other}
+	if err := p.Set(pol); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.CheckPeer(client); err == nil {
+		t.Fatal("expected client which isn't allowed to be rejected")
+	}
+	if err := p.CheckPeer(other); err != nil {
+		t.Fatal(err)
+	}
+
+	pol.PaymentInterval = 0
+	if err := p.Set(pol); err == nil {
+		t.Fatal("expected invalid policy to be rejected")
+	}
+
+	// the policy set last is used instead of the config after restarts
+	p, err = New(testConfig(nil, nil), ds, &testPieceStore{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.CheckPeer(client); err == nil {
+		t.Fatal("expected the stored policy to be used")
+	}
+	if p.Get().PaymentInterval != 1<<20 {
+		t.Fatalf("unexpected payment interval %d", p.Get().PaymentInterval)
+	}
+}
+
+func TestUnsealPricePerByte(t *testing.T) {
+	piece, err := cid.Parse("bafkqaaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := &testPieceStore{
+		piece: piece,
+		deals: []piecestore.DealInfo{{SectorID: 1, Length: 4}},
+	}
+
+	p, err := New(testConfig(nil, nil), dssync.MutexWrap(datastore.NewMapDatastore()), ps, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the unseal price of 10 over 4 bytes rounds up
+	extra, err := p.UnsealPricePerByte(piece)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !extra.Equals(big.NewInt(3)) {
+		t.Fatalf("expected 3, got %s", extra)
+	}
+
+	if _, err := p.UnsealPricePerByte(cid.Undef); err == nil {
+		t.Fatal("expected error for unknown payload")
+	}
+
+	pol := p.Get()
+	pol.UnsealPrice = abi.NewTokenAmount(0)
+	if err := p.Set(pol); err != nil {
+		t.Fatal(err)
+	}
+	if extra, err := p.UnsealPricePerByte(piece); err != nil || !extra.IsZero() {
+		t.Fatalf("expected no unseal price, got %s (%v)", extra, err)
+	}
+}
@@ -0,0 +1,139 @@
+package miner
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// LeaseConfig configures the mining lease
+type LeaseConfig struct {
+	// Path of the lease file, on storage shared by all processes which may
+	// mine with the miner actor. Empty disables the lease
+	Path string
+	// TTL is how long the lease stays valid without being renewed
+	TTL time.Duration
+}
+
+// Lease makes sure only one process mines blocks for a miner actor at a time,
+// so a hot standby can take over once the active process stops renewing it
+type Lease struct {
+	cfg    LeaseConfig
+	holder string
+}
+
+type leaseRecord struct {
+	Holder  string
+	Expires time.Time
+}
+
+// NewLease returns a lease for this process, or nil if no lease path is
+// configured. Methods of a nil lease always succeed
+func NewLease(cfg LeaseConfig) (*Lease, error) {
+	if cfg.Path == "" {
+		return nil, nil
+	}
+	if cfg.TTL <= 0 {
+		return nil, xerrors.Errorf("mining lease TTL must be positive")
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, xerrors.Errorf("getting hostname: %w", err)
+	}
+
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return &Lease{
+		cfg:    cfg,
+		holder: fmt.Sprintf("%s/%d/%s", host, os.Getpid(), hex.EncodeToString(nonce)),
+	}, nil
+}
+
+// Acquire takes the lease, or renews it if this process holds it already. It
+// returns an error if another process holds an unexpired lease
+func (l *Lease) Acquire() error {
+	if l == nil {
+		return nil
+	}
+
+	cur, err := l.read()
+	if err != nil {
+		return err
+	}
+	if cur != nil && cur.Holder != l.holder && time.Now().Before(cur.Expires) {
+		return xerrors.Errorf("mining lease held by %s until %s", cur.Holder, cur.Expires.Format(time.RFC3339))
+	}
+
+	b, err := json.Marshal(&leaseRecord{
+		Holder:  l.holder,
+		Expires: time.Now().Add(l.cfg.TTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	// write and rename so readers never see a partial record
+	tmp := fmt.Sprintf("%s.%s.tmp", l.cfg.Path, filepath.Base(l.holder))
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return xerrors.Errorf("writing mining lease: %w", err)
+	}
+	if err := os.Rename(tmp, l.cfg.Path); err != nil {
+		return xerrors.Errorf("replacing mining lease: %w", err)
+	}
+
+	// another process may have taken the lease at the same time, whoever
+	// renamed last holds it
+	cur, err = l.read()
+	if err != nil {
+		return err
+	}
+	if cur == nil || cur.Holder != l.holder {
+		return xerrors.Errorf("lost race for mining lease")
+	}
+
+	return nil
+}
+
+// Release gives up the lease if this process holds it
+func (l *Lease) Release() error {
+	if l == nil {
+		return nil
+	}
+
+	cur, err := l.read()
+	if err != nil {
+		return err
+	}
+	if cur == nil || cur.Holder != l.holder {
+		return nil
+	}
+
+	return os.Remove(l.cfg.Path)
+}
+
+func (l *Lease) read() (*leaseRecord, error) {
+	b, err := ioutil.ReadFile(l.cfg.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("reading mining lease: %w", err)
+	}
+
+	var out leaseRecord
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, xerrors.Errorf("parsing mining lease %s: %w", l.cfg.Path, err)
+	}
+	return &out, nil
+}
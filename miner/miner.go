@@ -10,7 +10,6 @@ import (
 	address "github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/specs-actors/actors/abi"
 	"github.com/filecoin-project/specs-actors/actors/crypto"
-	lru "github.com/hashicorp/golang-lru"
 
 	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/build"
@@ -19,6 +18,7 @@ import (
 	"github.com/filecoin-project/lotus/chain/store"
 	"github.com/filecoin-project/lotus/chain/types"
 
+	"github.com/ipfs/go-datastore"
 	logging "github.com/ipfs/go-log/v2"
 	"go.opencensus.io/trace"
 	"golang.org/x/xerrors"
@@ -29,12 +29,7 @@ var log = logging.Logger("miner")
 // returns a callback reporting whether we mined a blocks in this round
 type waitFunc func(ctx context.Context, baseTime uint64) (func(bool), error)
 
-func NewMiner(api api.FullNode, epp gen.WinningPoStProver, beacon beacon.RandomBeacon, addr address.Address) *Miner {
-	arc, err := lru.NewARC(10000)
-	if err != nil {
-		panic(err)
-	}
-
+func NewMiner(api api.FullNode, epp gen.WinningPoStProver, beacon beacon.RandomBeacon, addr address.Address, ds datastore.Batching, lease *Lease) *Miner {
 	return &Miner{
 		api:     api,
 		epp:     epp,
@@ -47,7 +42,9 @@ func NewMiner(api api.FullNode, epp gen.WinningPoStProver, beacon beacon.RandomB
 
 			return func(bool) {}, nil
 		},
-		minedBlockHeights: arc,
+		sf:     NewSlashFilter(ds),
+		rounds: newRoundHistory(ds),
+		lease:  lease,
 	}
 }
 
@@ -66,7 +63,9 @@ type Miner struct {
 
 	lastWork *MiningBase
 
-	minedBlockHeights *lru.ARCCache
+	sf     *SlashFilter
+	rounds *roundHistory
+	lease  *Lease
 }
 
 func (m *Miner) Address() address.Address {
@@ -97,7 +96,7 @@ func (m *Miner) Stop(ctx context.Context) error {
 
 	select {
 	case <-stopping:
-		return nil
+		return m.lease.Release()
 	case <-ctx.Done():
 		return ctx.Err()
 	}
@@ -149,6 +148,11 @@ func (m *Miner) mine(ctx context.Context) {
 			log.Errorf("failed to get best mining candidate: %s", err)
 			continue
 		}
+		if err := m.lease.Acquire(); err != nil {
+			log.Warnf("not mining: %s", err)
+			m.niceSleep(build.BlockDelay * time.Second)
+			continue
+		}
 		if base.TipSet.Equals(lastBase.TipSet) && lastBase.NullRounds == base.NullRounds {
 			log.Warnf("BestMiningCandidate from the previous round: %s (nulls:%d)", lastBase.TipSet.Cids(), lastBase.NullRounds)
 			m.niceSleep(build.BlockDelay * time.Second)
@@ -156,9 +160,21 @@ func (m *Miner) mine(ctx context.Context) {
 		}
 		lastBase = *base
 
-		b, err := m.mineOne(ctx, base)
+		m.rounds.checkInclusion(ctx, m.api, base.TipSet)
+
+		rnd := &api.MiningRound{
+			Epoch:      base.TipSet.Height() + base.NullRounds + 1,
+			Base:       base.TipSet.Key(),
+			BaseHeight: base.TipSet.Height(),
+			NullRounds: base.NullRounds,
+			Start:      time.Now(),
+		}
+
+		b, err := m.mineOne(ctx, base, rnd)
 		if err != nil {
 			log.Errorf("mining block failed: %+v", err)
+			rnd.Error = err.Error()
+			m.rounds.put(rnd)
 			continue
 		}
 
@@ -176,18 +192,36 @@ func (m *Miner) mine(ctx context.Context) {
 					"time", time.Now(), "duration", time.Since(btime))
 			}
 
-			// TODO: should do better 'anti slash' protection here
-			blkKey := fmt.Sprintf("%d", b.Header.Height)
-			if _, ok := m.minedBlockHeights.Get(blkKey); ok {
-				log.Warnw("Created a block at the same height as another block we've created", "height", b.Header.Height, "miner", b.Header.Miner, "parents", b.Header.Parents)
+			if err := m.sf.MinedBlock(b.Header, base.TipSet.Height()+base.NullRounds); err != nil {
+				log.Errorf("<!!> SLASH FILTER ERROR: %s", err)
+				rnd.Error = err.Error()
+				m.rounds.put(rnd)
 				continue
 			}
 
-			m.minedBlockHeights.Add(blkKey, true)
+			// the lease could have been taken over while we were computing
+			// the block
+			if err := m.lease.Acquire(); err != nil {
+				log.Errorf("not submitting mined block: %s", err)
+				rnd.Error = err.Error()
+				m.rounds.put(rnd)
+				continue
+			}
+
+			rnd.PropagationDelay = time.Since(btime)
 			if err := m.api.SyncSubmitBlock(ctx, b); err != nil {
 				log.Errorf("failed to submit newly mined block: %s", err)
+				rnd.Error = err.Error()
+			} else {
+				bcid := b.Cid()
+				rnd.Block = &bcid
+				rnd.Inclusion = api.BlockPending
 			}
+			m.rounds.put(rnd)
+			m.rounds.prune()
 		} else {
+			m.rounds.put(rnd)
+
 			nextRound := time.Unix(int64(base.TipSet.MinTimestamp()+uint64(build.BlockDelay*base.NullRounds)), 0)
 
 			select {
@@ -246,7 +280,8 @@ func (m *Miner) hasPower(ctx context.Context, addr address.Address, ts *types.Ti
 	return !power.MinerPower.QualityAdjPower.Equals(types.NewInt(0)), nil
 }
 
-func (m *Miner) mineOne(ctx context.Context, base *MiningBase) (*types.BlockMsg, error) {
+// mineOne attempts to mine a block on the base, filling in the round record
+func (m *Miner) mineOne(ctx context.Context, base *MiningBase, rnd *api.MiningRound) (*types.BlockMsg, error) {
 	log.Debugw("attempting to mine a block", "tipset", types.LogCids(base.TipSet.Cids()))
 	start := time.Now()
 
@@ -299,6 +334,7 @@ func (m *Miner) mineOne(ctx context.Context, base *MiningBase) (*types.BlockMsg,
 		base.NullRounds++
 		return nil, nil
 	}
+	rnd.Won = true
 
 	buf := new(bytes.Buffer)
 	if err := m.address.MarshalCBOR(buf); err != nil {
@@ -312,10 +348,12 @@ func (m *Miner) mineOne(ctx context.Context, base *MiningBase) (*types.BlockMsg,
 
 	prand := abi.PoStRandomness(rand)
 
+	postStart := time.Now()
 	postProof, err := m.epp.ComputeProof(ctx, mbi.Sectors, prand)
 	if err != nil {
 		return nil, xerrors.Errorf("failed to compute winning post proof: %w", err)
 	}
+	rnd.WinningPoStTime = time.Since(postStart)
 
 	// get pending messages early,
 	pending, err := m.api.MpoolPending(context.TODO(), base.TipSet.Key())
@@ -330,6 +368,7 @@ func (m *Miner) mineOne(ctx context.Context, base *MiningBase) (*types.BlockMsg,
 	}
 
 	dur := time.Since(start)
+	rnd.CreateTime = dur
 	log.Infow("mined new block", "cid", b.Cid(), "height", b.Header.Height, "took", dur)
 	if dur > time.Second*build.BlockDelay {
 		log.Warn("CAUTION: block production took longer than the block delay. Your computer may not be fast enough to keep up")
@@ -0,0 +1,199 @@
+package miner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+const (
+	// maxRoundHistory is the number of mining rounds kept in the datastore,
+	// about two days of epochs
+	maxRoundHistory = 6000
+	// inclusionDepth is how many epochs after a mined block its inclusion in
+	// the canonical chain gets checked
+	inclusionDepth = 5
+)
+
+var roundHistoryPrefix = datastore.NewKey("/mining/rounds")
+
+// roundHistory records mining rounds in the metadata datastore
+type roundHistory struct {
+	ds datastore.Batching
+	lk sync.Mutex
+
+	// pending are rounds with blocks which weren't checked for inclusion yet
+	pending []*api.MiningRound
+}
+
+func newRoundHistory(ds datastore.Batching) *roundHistory {
+	h := &roundHistory{
+		ds: namespace.Wrap(ds, roundHistoryPrefix),
+	}
+
+	// pick up blocks mined before a restart
+	rounds, err := h.list(inclusionDepth * 10)
+	if err != nil {
+		log.Errorf("loading mining rounds: %+v", err)
+		return h
+	}
+	for i := range rounds {
+		if rounds[i].Inclusion == api.BlockPending {
+			h.pending = append(h.pending, &rounds[i])
+		}
+	}
+
+	return h
+}
+
+func roundKey(epoch abi.ChainEpoch) datastore.Key {
+	// zero padded so keys sort by epoch
+	return datastore.NewKey(fmt.Sprintf("%020d", epoch))
+}
+
+// put stores the round, the history is best-effort so errors are only logged
+func (h *roundHistory) put(rnd *api.MiningRound) {
+	b, err := json.Marshal(rnd)
+	if err != nil {
+		log.Errorf("marshaling mining round: %+v", err)
+		return
+	}
+
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	if err := h.ds.Put(roundKey(rnd.Epoch), b); err != nil {
+		log.Errorf("storing mining round: %+v", err)
+	}
+
+	if rnd.Inclusion == api.BlockPending {
+		h.pending = append(h.pending, rnd)
+	}
+}
+
+// inclusionAPI is the part of the full node API used to check inclusion of
+// mined blocks
+type inclusionAPI interface {
+	ChainGetTipSetByHeight(context.Context, abi.ChainEpoch, types.TipSetKey) (*types.TipSet, error)
+}
+
+// checkInclusion looks up whether blocks mined at least inclusionDepth epochs
+// before the given tipset made it into the chain
+func (h *roundHistory) checkInclusion(ctx context.Context, a inclusionAPI, ts *types.TipSet) {
+	h.lk.Lock()
+	pending := h.pending
+	h.pending = nil
+	h.lk.Unlock()
+
+	for i, rnd := range pending {
+		if rnd.Epoch+inclusionDepth > ts.Height() {
+			h.lk.Lock()
+			h.pending = append(h.pending, pending[i:]...)
+			h.lk.Unlock()
+			return
+		}
+
+		at, err := a.ChainGetTipSetByHeight(ctx, rnd.Epoch, ts.Key())
+		if err != nil {
+			log.Errorf("checking inclusion of block %s: %+v", rnd.Block, err)
+			h.lk.Lock()
+			h.pending = append(h.pending, pending[i:]...)
+			h.lk.Unlock()
+			return
+		}
+
+		rnd.Inclusion = api.BlockOrphaned
+		if at.Height() == rnd.Epoch {
+			for _, c := range at.Cids() {
+				if c.Equals(*rnd.Block) {
+					rnd.Inclusion = api.BlockIncluded
+					break
+				}
+			}
+		}
+
+		if rnd.Inclusion == api.BlockOrphaned {
+			log.Warnw("mined block was orphaned", "cid", rnd.Block, "height", rnd.Epoch)
+		}
+
+		h.put(rnd)
+	}
+}
+
+func (h *roundHistory) prune() {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	res, err := h.ds.Query(query.Query{
+		KeysOnly: true,
+		Orders:   []query.Order{query.OrderByKeyDescending{}},
+		Offset:   maxRoundHistory,
+	})
+	if err != nil {
+		log.Errorf("listing mining rounds: %+v", err)
+		return
+	}
+
+	ents, err := res.Rest()
+	if err != nil {
+		log.Errorf("listing mining rounds: %+v", err)
+		return
+	}
+
+	for _, ent := range ents {
+		if err := h.ds.Delete(datastore.NewKey(ent.Key)); err != nil {
+			log.Errorf("pruning mining rounds: %+v", err)
+			return
+		}
+	}
+}
+
+// list returns up to n most recent rounds, oldest first. All rounds are
+// returned if n isn't positive
+func (h *roundHistory) list(n int) ([]api.MiningRound, error) {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	q := query.Query{
+		Orders: []query.Order{query.OrderByKeyDescending{}},
+	}
+	if n > 0 {
+		q.Limit = n
+	}
+
+	res, err := h.ds.Query(q)
+	if err != nil {
+		return nil, xerrors.Errorf("querying mining rounds: %w", err)
+	}
+
+	ents, err := res.Rest()
+	if err != nil {
+		return nil, xerrors.Errorf("reading mining rounds: %w", err)
+	}
+
+	out := make([]api.MiningRound, len(ents))
+	for i, ent := range ents {
+		// newest rounds come first
+		if err := json.Unmarshal(ent.Value, &out[len(ents)-1-i]); err != nil {
+			return nil, xerrors.Errorf("unmarshaling mining round %s: %w", ent.Key, err)
+		}
+	}
+
+	return out, nil
+}
+
+// RoundsHistory returns up to n most recent mining rounds, oldest first
+func (m *Miner) RoundsHistory(n int) ([]api.MiningRound, error) {
+	return m.rounds.list(n)
+}
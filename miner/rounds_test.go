@@ -0,0 +1,118 @@
+package miner
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/types/mock"
+)
+
+// testChain returns the tipset at the height, or the one before it for null
+// rounds
+type testChain map[abi.ChainEpoch]*types.TipSet
+
+func (c testChain) ChainGetTipSetByHeight(ctx context.Context, h abi.ChainEpoch, tsk types.TipSetKey) (*types.TipSet, error) {
+	for ; h >= 0; h-- {
+		if ts, ok := c[h]; ok {
+			return ts, nil
+		}
+	}
+	return nil, datastore.ErrNotFound
+}
+
+func minedRound(epoch abi.ChainEpoch, block cid.Cid) *api.MiningRound {
+	return &api.MiningRound{
+		Epoch:     epoch,
+		Won:       true,
+		Block:     &block,
+		Inclusion: api.BlockPending,
+	}
+}
+
+func TestRoundHistoryList(t *testing.T) {
+	h := newRoundHistory(dssync.MutexWrap(datastore.NewMapDatastore()))
+
+	// stored out of order, listed by epoch
+	for _, e := range []abi.ChainEpoch{3, 1, 12, 2, 100} {
+		h.put(&api.MiningRound{Epoch: e})
+	}
+
+	rounds, err := h.list(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rounds) != 3 || rounds[0].Epoch != 3 || rounds[1].Epoch != 12 || rounds[2].Epoch != 100 {
+		t.Fatalf("expected the 3 most recent rounds oldest first, got %+v", rounds)
+	}
+
+	rounds, err = h.list(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rounds) != 5 || rounds[0].Epoch != 1 || rounds[4].Epoch != 100 {
+		t.Fatalf("expected all rounds, got %+v", rounds)
+	}
+}
+
+func TestRoundHistoryCheckInclusion(t *testing.T) {
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	h := newRoundHistory(ds)
+
+	chain := testChain{}
+	var ts *types.TipSet
+	for i := uint64(0); i <= 10; i++ {
+		ts = mock.TipSet(mock.MkBlock(ts, 1, i))
+		// epoch 4 is a null round
+		if ts.Height() != 4 {
+			chain[ts.Height()] = ts
+		}
+	}
+	head := chain[10]
+
+	other := mock.TipSet(mock.MkBlock(chain[2], 1, 100)).Cids()[0]
+
+	h.put(minedRound(3, chain[3].Cids()[0]))
+	h.put(minedRound(4, other))
+	h.put(minedRound(5, other))
+	// not deep enough to be checked
+	h.put(minedRound(6, chain[6].Cids()[0]))
+
+	h.checkInclusion(context.TODO(), chain, head)
+
+	rounds, err := h.list(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []api.BlockInclusion{api.BlockIncluded, api.BlockOrphaned, api.BlockOrphaned, api.BlockPending}
+	if len(rounds) != len(expect) {
+		t.Fatalf("expected %d rounds, got %d", len(expect), len(rounds))
+	}
+	for i, rnd := range rounds {
+		if rnd.Inclusion != expect[i] {
+			t.Errorf("round at %d: expected %s, got %s", rnd.Epoch, expect[i], rnd.Inclusion)
+		}
+	}
+
+	// pending rounds are picked up after restarts
+	h = newRoundHistory(ds)
+	if len(h.pending) != 1 || h.pending[0].Epoch != 6 {
+		t.Fatalf("expected the round at 6 to be pending, got %+v", h.pending)
+	}
+
+	h.checkInclusion(context.TODO(), chain, mock.TipSet(mock.MkBlock(head, 1, 11)))
+	rounds, err = h.list(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rounds) != 1 || rounds[0].Inclusion != api.BlockIncluded || len(h.pending) != 0 {
+		t.Fatalf("expected the round at 6 to be included, got %+v", rounds)
+	}
+}
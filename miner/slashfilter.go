@@ -0,0 +1,132 @@
+package miner
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+var (
+	slashFilterEpochs  = datastore.NewKey("/slashfilter/epoch")
+	slashFilterParents = datastore.NewKey("/slashfilter/parents")
+)
+
+// MinedBlock is a block produced by this miner, as recorded by the slash
+// filter
+type MinedBlock struct {
+	Cid       cid.Cid
+	Height    abi.ChainEpoch
+	Parents   []cid.Cid
+	Timestamp uint64
+}
+
+// SlashFilter persists every block the miner produces, and refuses blocks
+// which would be a consensus fault together with an earlier one. Records
+// survive restarts, unlike the in-memory check it replaces
+type SlashFilter struct {
+	byEpoch   datastore.Datastore
+	byParents datastore.Datastore
+}
+
+func NewSlashFilter(ds datastore.Batching) *SlashFilter {
+	return &SlashFilter{
+		byEpoch:   namespace.Wrap(ds, slashFilterEpochs),
+		byParents: namespace.Wrap(ds, slashFilterParents),
+	}
+}
+
+// MinedBlock checks a newly produced block against earlier blocks, and
+// records it. It returns an error if submitting the block could get the
+// miner slashed
+func (f *SlashFilter) MinedBlock(bh *types.BlockHeader, parentEpoch abi.ChainEpoch) error {
+	blkCid := bh.Cid()
+
+	epochKey := datastore.NewKey(fmt.Sprintf("/%d", bh.Height))
+	prev, err := f.getEpoch(epochKey)
+	if err != nil {
+		return err
+	}
+	if prev != nil {
+		if prev.Cid.Equals(blkCid) {
+			// same block, submitting it again is fine
+			return nil
+		}
+		return xerrors.Errorf("produced block would trigger a double-fork mining fault; block: %s, already mined %s at height %d", blkCid, prev.Cid, bh.Height)
+	}
+
+	parentsKey := datastore.NewKey(fmt.Sprintf("/%x", types.NewTipSetKey(bh.Parents...).Bytes()))
+	otherb, err := f.byParents.Get(parentsKey)
+	switch err {
+	case nil:
+		_, other, err := cid.CidFromBytes(otherb)
+		if err != nil {
+			return xerrors.Errorf("parsing recorded block cid: %w", err)
+		}
+		return xerrors.Errorf("produced block would trigger a time-offset mining fault; block: %s, already mined %s on the same parents", blkCid, other)
+	case datastore.ErrNotFound:
+	default:
+		return xerrors.Errorf("checking blocks mined on the same parents: %w", err)
+	}
+
+	// if we mined at the parent epoch, our block must be one of the parents
+	parent, err := f.getEpoch(datastore.NewKey(fmt.Sprintf("/%d", parentEpoch)))
+	if err != nil {
+		return err
+	}
+	if parent != nil {
+		var found bool
+		for _, c := range bh.Parents {
+			if c.Equals(parent.Cid) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return xerrors.Errorf("produced block would trigger a parent-grinding fault; block: %s, expected parent: %s", blkCid, parent.Cid)
+		}
+	}
+
+	rec, err := json.Marshal(&MinedBlock{
+		Cid:       blkCid,
+		Height:    bh.Height,
+		Parents:   bh.Parents,
+		Timestamp: bh.Timestamp,
+	})
+	if err != nil {
+		return xerrors.Errorf("marshaling mined block record: %w", err)
+	}
+
+	if err := f.byParents.Put(parentsKey, blkCid.Bytes()); err != nil {
+		return xerrors.Errorf("recording mined block parents: %w", err)
+	}
+	if err := f.byEpoch.Put(epochKey, rec); err != nil {
+		return xerrors.Errorf("recording mined block: %w", err)
+	}
+
+	return nil
+}
+
+func (f *SlashFilter) getEpoch(k datastore.Key) (*MinedBlock, error) {
+	b, err := f.byEpoch.Get(k)
+	switch err {
+	case nil:
+	case datastore.ErrNotFound:
+		return nil, nil
+	default:
+		return nil, xerrors.Errorf("getting mined block record: %w", err)
+	}
+
+	var out MinedBlock
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, xerrors.Errorf("unmarshaling mined block record: %w", err)
+	}
+	return &out, nil
+}
@@ -0,0 +1,67 @@
+package miner
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+var dummyCid, _ = cid.Parse("bafkqaaa")
+
+func testBlock(t *testing.T, height abi.ChainEpoch, ts uint64, parents ...cid.Cid) *types.BlockHeader {
+	t.Helper()
+
+	return &types.BlockHeader{
+		Miner:                 mustIDAddr(1000),
+		Height:                height,
+		Timestamp:             ts,
+		Parents:               parents,
+		ParentWeight:          types.NewInt(0),
+		ParentStateRoot:       dummyCid,
+		ParentMessageReceipts: dummyCid,
+		Messages:              dummyCid,
+	}
+}
+
+func TestSlashFilter(t *testing.T) {
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	sf := NewSlashFilter(ds)
+
+	p1 := testBlock(t, 1, 10, dummyCid).Cid()
+	p2 := testBlock(t, 1, 11, dummyCid).Cid()
+
+	b := testBlock(t, 2, 20, p1)
+	if err := sf.MinedBlock(b, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// submitting the same block again is fine
+	if err := sf.MinedBlock(b, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// records survive restarts
+	sf = NewSlashFilter(ds)
+
+	if err := sf.MinedBlock(testBlock(t, 2, 21, p2), 1); err == nil {
+		t.Fatal("expected double-fork mining fault")
+	}
+
+	if err := sf.MinedBlock(testBlock(t, 3, 30, p1), 2); err == nil {
+		t.Fatal("expected time-offset mining fault")
+	}
+
+	if err := sf.MinedBlock(testBlock(t, 3, 30, p2), 2); err == nil {
+		t.Fatal("expected parent-grinding fault")
+	}
+
+	if err := sf.MinedBlock(testBlock(t, 3, 30, b.Cid()), 2); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -7,23 +7,22 @@ import (
 	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/chain/beacon"
 	"github.com/filecoin-project/lotus/chain/gen"
-	lru "github.com/hashicorp/golang-lru"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
 )
 
 func NewTestMiner(nextCh <-chan func(bool), addr address.Address) func(api.FullNode, gen.WinningPoStProver, beacon.RandomBeacon) *Miner {
 	return func(api api.FullNode, epp gen.WinningPoStProver, b beacon.RandomBeacon) *Miner {
-		arc, err := lru.NewARC(10000)
-		if err != nil {
-			panic(err)
-		}
+		ds := dssync.MutexWrap(datastore.NewMapDatastore())
 
 		m := &Miner{
-			beacon:            b,
-			api:               api,
-			waitFunc:          chanWaiter(nextCh),
-			epp:               epp,
-			minedBlockHeights: arc,
-			address:           addr,
+			beacon:   b,
+			api:      api,
+			waitFunc: chanWaiter(nextCh),
+			epp:      epp,
+			sf:       NewSlashFilter(ds),
+			rounds:   newRoundHistory(ds),
+			address:  addr,
 		}
 
 		if err := m.Start(context.TODO()); err != nil {
@@ -41,14 +41,20 @@ import (
 	"github.com/filecoin-project/lotus/chain/types"
 	"github.com/filecoin-project/lotus/chain/vm"
 	"github.com/filecoin-project/lotus/chain/wallet"
+	"github.com/filecoin-project/lotus/lib/conngater"
 	"github.com/filecoin-project/lotus/lib/peermgr"
+	"github.com/filecoin-project/lotus/lib/peerrep"
 	_ "github.com/filecoin-project/lotus/lib/sigs/bls"
 	_ "github.com/filecoin-project/lotus/lib/sigs/secp"
+	"github.com/filecoin-project/lotus/markets/dealfilter"
+	"github.com/filecoin-project/lotus/markets/retrievaladapter"
+	"github.com/filecoin-project/lotus/markets/retrievalpolicy"
 	"github.com/filecoin-project/lotus/markets/storageadapter"
 	"github.com/filecoin-project/lotus/miner"
 	"github.com/filecoin-project/lotus/node/config"
 	"github.com/filecoin-project/lotus/node/hello"
 	"github.com/filecoin-project/lotus/node/impl"
+	"github.com/filecoin-project/lotus/node/impl/client"
 	"github.com/filecoin-project/lotus/node/impl/common"
 	"github.com/filecoin-project/lotus/node/modules"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
@@ -58,6 +64,7 @@ import (
 	"github.com/filecoin-project/lotus/node/repo"
 	"github.com/filecoin-project/lotus/paychmgr"
 	"github.com/filecoin-project/lotus/storage"
+	"github.com/filecoin-project/lotus/storage/sealworker"
 	"github.com/filecoin-project/lotus/storage/sectorblocks"
 	sectorstorage "github.com/filecoin-project/sector-storage"
 	"github.com/filecoin-project/sector-storage/ffiwrapper"
@@ -83,6 +90,7 @@ var (
 	NatPortMapKey        = special{8}  // Libp2p option
 	ConnectionManagerKey = special{9}  // Libp2p option
 	AutoNATSvcKey        = special{10} // Libp2p option
+	BandwidthReporterKey = special{11} // Libp2p option
 )
 
 type invoke int
@@ -92,8 +100,10 @@ const (
 	// libp2p
 
 	PstoreAddSelfKeysKey = invoke(iota)
+	AttachConnGaterKey
 	StartListeningKey
 	BootstrapKey
+	RunPeerRepKey
 
 	// filecoin
 	SetGenesisKey
@@ -112,6 +122,7 @@ const (
 	// storage miner
 	GetParamsKey
 	HandleDealsKey
+	RenewStorageAskKey
 	HandleRetrievalKey
 	RunSectorServiceKey
 	RegisterProviderValidatorKey
@@ -177,11 +188,16 @@ func libp2p() Option {
 
 		Override(ConnectionManagerKey, lp2p.ConnectionManager(50, 200, 20*time.Second, nil)),
 		Override(AutoNATSvcKey, lp2p.AutoNATService),
+		Override(BandwidthReporterKey, lp2p.BandwidthCounter),
 
+		Override(new(*conngater.Gater), modules.ConnGater),
+		Override(new(*peerrep.PeerRep), modules.NewPeerRep),
 		Override(new(*pubsub.PubSub), lp2p.GossipSub(&config.Pubsub{})),
 
 		Override(PstoreAddSelfKeysKey, lp2p.PstoreAddSelfKeys),
+		Override(AttachConnGaterKey, modules.AttachConnGater),
 		Override(StartListeningKey, lp2p.StartListening(config.DefaultFullNode().Libp2p.ListenAddresses)),
+		Override(RunPeerRepKey, modules.RunPeerRep),
 	)
 }
 
@@ -249,11 +265,14 @@ func Online() Option {
 			Override(new(retrievalmarket.PeerResolver), modules.RetrievalResolver),
 
 			Override(new(retrievalmarket.RetrievalClient), modules.RetrievalClient),
+			Override(new(*retrievaladapter.DealTracker), modules.ClientRetrievalTracker),
 			Override(new(dtypes.ClientDealStore), modules.NewClientDealStore),
 			Override(new(dtypes.ClientDatastore), modules.NewClientDatastore),
 			Override(new(dtypes.ClientDataTransfer), modules.NewClientGraphsyncDataTransfer),
 			Override(new(*requestvalidation.ClientRequestValidator), modules.NewClientRequestValidator),
 			Override(new(storagemarket.StorageClient), modules.StorageClient),
+			Override(new(*client.Imports), modules.ClientImports),
+			Override(new(*client.DealPlacer), modules.ClientDealPlacer),
 			Override(new(storagemarket.StorageClientNode), storageadapter.NewClientNodeAdapter),
 			Override(RegisterClientValidatorKey, modules.RegisterClientValidator),
 			Override(RunDealClientKey, modules.RunDealClient),
@@ -276,13 +295,20 @@ func Online() Option {
 			Override(new(*ffiwrapper.Config), modules.ProofsConfig),
 			Override(new(stores.LocalStorage), From(new(repo.LockedRepo))),
 			Override(new(sealing.SectorIDCounter), modules.SectorIDCounter),
+			Override(new(*sealworker.Tracker), sealworker.NewTracker),
 			Override(new(*sectorstorage.Manager), modules.SectorStorage),
 			Override(new(ffiwrapper.Verifier), ffiwrapper.ProofVerifier),
 
-			Override(new(sectorstorage.SectorManager), From(new(*sectorstorage.Manager))),
+			Override(new(sectorstorage.SectorManager), modules.SectorManager),
 			Override(new(storage2.Prover), From(new(sectorstorage.SectorManager))),
+			Override(new(storage.LocalPaths), From(new(*sectorstorage.Manager))),
+			Override(new(storage.FaultTracker), modules.FaultTracker),
+			Override(new(*storage.Scrubber), modules.SectorScrubber),
+			Override(new(storage.SectorRemover), modules.SectorRemover),
+			Override(new(*storage.SectorNotifier), modules.SectorNotifier),
 
 			Override(new(*sectorblocks.SectorBlocks), sectorblocks.NewSectorBlocks),
+			Override(new(*storage.WindowPoStScheduler), modules.WindowPostScheduler),
 			Override(new(*storage.Miner), modules.StorageMiner),
 			Override(new(dtypes.NetworkName), modules.StorageNetworkName),
 			Override(new(beacon.RandomBeacon), modules.MinerRandomBeacon),
@@ -291,6 +317,7 @@ func Online() Option {
 			Override(new(dtypes.StagingDAG), modules.StagingDAG),
 			Override(new(dtypes.StagingGraphsync), modules.StagingGraphsync),
 			Override(new(retrievalmarket.RetrievalProvider), modules.RetrievalProvider),
+			Override(new(*retrievaladapter.DealTracker), modules.ProviderRetrievalTracker),
 			Override(new(dtypes.ProviderDealStore), modules.NewProviderDealStore),
 			Override(new(dtypes.ProviderDataTransfer), modules.NewProviderDAGServiceDataTransfer),
 			Override(new(*requestvalidation.ProviderRequestValidator), modules.NewProviderRequestValidator),
@@ -301,6 +328,7 @@ func Online() Option {
 			Override(HandleRetrievalKey, modules.HandleRetrieval),
 			Override(GetParamsKey, modules.GetParams),
 			Override(HandleDealsKey, modules.HandleDeals),
+			Override(RenewStorageAskKey, modules.RenewStorageAsk),
 			Override(new(gen.WinningPoStProver), storage.NewWinningPoStProver),
 			Override(new(*miner.Miner), modules.SetupBlockProducer),
 		),
@@ -354,6 +382,7 @@ func ConfigCommon(cfg *config.Common) Option {
 				cfg.Libp2p.ConnMgrHigh,
 				time.Duration(cfg.Libp2p.ConnMgrGrace),
 				cfg.Libp2p.ProtectedPeers)),
+			Override(new(host.Host), lp2p.RateLimitedHost(cfg.Libp2p.ProtocolRateLimits)),
 			Override(new(*pubsub.PubSub), lp2p.GossipSub(&cfg.Pubsub)),
 
 			ApplyIf(func(s *Settings) bool { return len(cfg.Libp2p.BootstrapPeers) > 0 },
@@ -374,6 +403,7 @@ func ConfigFullNode(c interface{}) Option {
 		If(cfg.Client.UseIpfs,
 			Override(new(dtypes.ClientBlockstore), modules.IpfsClientBlockstore),
 		),
+		Override(new(*client.DealMonitor), modules.ClientDealMonitor(cfg.Client.DealMonitor)),
 
 		If(cfg.Metrics.HeadNotifs,
 			Override(HeadMetricsKey, metrics.SendHeadNotifs(cfg.Metrics.Nickname)),
@@ -391,6 +421,30 @@ func ConfigStorageMiner(c interface{}) Option {
 		ConfigCommon(&cfg.Common),
 
 		Override(new(sectorstorage.SealerConfig), cfg.Storage),
+		Override(new(*dealfilter.Filter), modules.DealFilter(cfg.Dealmaking)),
+		Override(new(*retrievaladapter.UnsealedCache), modules.UnsealedCache(cfg.Retrieval)),
+		Override(new(*retrievalpolicy.Policy), modules.RetrievalPolicy(cfg.Retrieval)),
+		Override(new(storage.ScrubConfig), storage.ScrubConfig{
+			Interval: time.Duration(cfg.Scrub.Interval),
+			Verify:   cfg.Scrub.Verify,
+			Repair:   cfg.Scrub.Repair,
+		}),
+		Override(new(storage.SectorNotifyConfig), modules.SectorNotifyConfig(cfg.Notify)),
+		Override(new(storage.SealingLimits), storage.SealingLimits{
+			MaxSealingSectors: cfg.Sealing.MaxSealingSectors,
+			MaxPreCommit1:     cfg.Sealing.MaxPreCommit1,
+			MaxPreCommit2:     cfg.Sealing.MaxPreCommit2,
+			MaxWaitSeed:       cfg.Sealing.MaxWaitSeed,
+			MaxCommit:         cfg.Sealing.MaxCommit,
+			AutoPledge:        cfg.Sealing.AutoPledge,
+		}),
+		Override(new(miner.LeaseConfig), miner.LeaseConfig{
+			Path: cfg.Mining.LeasePath,
+			TTL:  time.Duration(cfg.Mining.LeaseTTL),
+		}),
+		Override(new(sealworker.Config), sealworker.Config{
+			TaskAffinity: cfg.Sealing.TaskAffinity,
+		}),
 	)
 }
 
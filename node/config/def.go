@@ -5,6 +5,8 @@ import (
 	"time"
 
 	sectorstorage "github.com/filecoin-project/sector-storage"
+
+	"github.com/filecoin-project/lotus/chain/types"
 )
 
 // Common is common config between full node and miner
@@ -27,7 +29,13 @@ type FullNode struct {
 type StorageMiner struct {
 	Common
 
-	Storage sectorstorage.SealerConfig
+	Dealmaking DealmakingConfig
+	Retrieval  RetrievalConfig
+	Sealing    SealingConfig
+	Storage    sectorstorage.SealerConfig
+	Scrub      Scrub
+	Notify     SectorNotify
+	Mining     MiningConfig
 }
 
 // API contains configs for API endpoint
@@ -46,6 +54,11 @@ type Libp2p struct {
 	ConnMgrLow   uint
 	ConnMgrHigh  uint
 	ConnMgrGrace Duration
+
+	// ProtocolRateLimits caps bandwidth used by libp2p protocols, in bytes per
+	// second in each direction. Keys are protocol ID prefixes, e.g.
+	// "/fil/sync/blk" or "/ipfs/graphsync"
+	ProtocolRateLimits map[string]uint64
 }
 
 type Pubsub struct {
@@ -54,6 +67,116 @@ type Pubsub struct {
 	RemoteTracer string
 }
 
+// // Storage Miner
+
+// DealmakingConfig configures which storage deals the miner accepts
+type DealmakingConfig struct {
+	// AllowedClients, when set, limits deals to these client addresses
+	AllowedClients []string
+	BlockedClients []string
+
+	// Piece size limits in bytes, 0 means no limit
+	MinPieceSize uint64
+	MaxPieceSize uint64
+
+	// Deal duration limits in epochs, 0 means no limit
+	MinDuration uint64
+	MaxDuration uint64
+
+	// StartEpochBuffer is the minimum number of epochs between receiving a deal
+	// and its start epoch
+	StartEpochBuffer uint64
+
+	// MaxDealsInProgress limits accepted deals which aren't active yet, 0 means
+	// no limit
+	MaxDealsInProgress int
+
+	// Filter is a shell command called with the deal proposal as JSON on
+	// stdin. The deal is accepted if it exits with 0, otherwise its output is
+	// sent to the client as the rejection reason
+	Filter string
+}
+
+// RetrievalConfig configures retrieval prices, and which clients can
+// retrieve data from the miner. Once a policy is set through the API, the
+// stored policy is used instead
+type RetrievalConfig struct {
+	// PricePerByte is charged for each byte sent, in FIL
+	PricePerByte types.FIL
+	// UnsealPrice is charged for retrievals from pieces which have to be
+	// unsealed, spread over the bytes of the piece, in FIL
+	UnsealPrice types.FIL
+
+	// PaymentInterval is how many bytes are sent before the client has to
+	// pay, it grows by PaymentIntervalIncrease after each payment
+	PaymentInterval         uint64
+	PaymentIntervalIncrease uint64
+
+	// AllowedPeers, when set, limits retrievals to these client peer IDs
+	AllowedPeers []string
+	BlockedPeers []string
+
+	// HotPieceRetrievals keeps an unsealed copy of a piece once it was
+	// retrieved this many times, 0 unseals for every retrieval
+	HotPieceRetrievals int
+	// UnsealedCacheSize limits the size of kept unsealed copies in bytes, the
+	// least recently used are removed first. 0 means no limit
+	UnsealedCacheSize uint64
+}
+
+// SealingConfig limits how many sectors are sealed at once. Sectors aren't
+// pledged while any of the limits is reached, 0 means no limit
+type SealingConfig struct {
+	// MaxSealingSectors limits all sectors from packing until proving
+	MaxSealingSectors int
+
+	MaxPreCommit1 int
+	MaxPreCommit2 int
+	MaxWaitSeed   int
+	MaxCommit     int
+
+	// AutoPledge keeps the sealing pipeline full with committed capacity
+	// sectors, up to MaxSealingSectors
+	AutoPledge bool
+
+	// TaskAffinity keeps sealing tasks of a sector, like PreCommit1 and
+	// PreCommit2, on the worker holding its files
+	TaskAffinity bool
+}
+
+// Scrub configures the background sector storage scrubber
+type Scrub struct {
+	// Interval between full scrubs, 0 disables background scrubbing
+	Interval Duration
+	// Verify proves each sector against its on-chain SealedCID
+	Verify bool
+	// Repair moves misplaced sector files into long-term storage, and fetches
+	// damaged files again from a good copy. Files are only changed when enabled
+	Repair bool
+}
+
+// SectorNotify configures webhooks receiving sector state changes
+type SectorNotify struct {
+	// Webhooks are URLs each sector state change is POSTed to as JSON
+	Webhooks []string
+	// States limits webhook delivery to changes into these states, e.g.
+	// "Proving" or "SealFailed". All changes are delivered if empty
+	States []string
+	// Timeout of a single webhook request
+	Timeout Duration
+}
+
+// MiningConfig configures block production
+type MiningConfig struct {
+	// LeasePath is a lease file on storage shared with standby miner
+	// processes. Only the process holding the lease produces blocks, empty
+	// disables the lease
+	LeasePath string
+	// LeaseTTL is how long the lease is valid without renewal, a standby
+	// takes over this long after the active process stops
+	LeaseTTL Duration
+}
+
 // // Full Node
 
 type Metrics struct {
@@ -63,6 +186,25 @@ type Metrics struct {
 
 type Client struct {
 	UseIpfs bool
+
+	DealMonitor DealMonitorConfig
+}
+
+// DealMonitorConfig configures watching active storage deals for slashing,
+// faults and expiry
+type DealMonitorConfig struct {
+	// CheckInterval is how many epochs pass between checks of active deals
+	CheckInterval uint64
+	// ExpiryWarning is how many epochs before its end a deal is reported as
+	// near expiry, and renewed if Renew is set
+	ExpiryWarning uint64
+
+	// Renew starts a new deal with the same miner for deals near expiry
+	Renew bool
+	// RenewMaxPrice per GiB per epoch. When set and Renew is enabled, slashed
+	// deals and deals which couldn't be renewed with their miner are renewed
+	// with automatically selected miners
+	RenewMaxPrice types.FIL
 }
 
 func defCommon() Common {
@@ -94,6 +236,14 @@ func defCommon() Common {
 func DefaultFullNode() *FullNode {
 	return &FullNode{
 		Common: defCommon(),
+
+		Client: Client{
+			DealMonitor: DealMonitorConfig{
+				CheckInterval: 120,
+				ExpiryWarning: 20160,
+				RenewMaxPrice: types.FIL(types.NewInt(0)),
+			},
+		},
 	}
 }
 
@@ -106,6 +256,25 @@ func DefaultStorageMiner() *StorageMiner {
 			AllowPreCommit2: true,
 			AllowCommit:     true,
 		},
+
+		Retrieval: RetrievalConfig{
+			PricePerByte:            types.FIL(types.NewInt(2)),
+			UnsealPrice:             types.FIL(types.NewInt(0)),
+			PaymentInterval:         1 << 20,
+			PaymentIntervalIncrease: 1 << 20,
+		},
+
+		Scrub: Scrub{
+			Interval: Duration(24 * time.Hour),
+		},
+
+		Notify: SectorNotify{
+			Timeout: Duration(10 * time.Second),
+		},
+
+		Mining: MiningConfig{
+			LeaseTTL: Duration(2 * time.Minute),
+		},
 	}
 	cfg.Common.API.ListenAddress = "/ip4/127.0.0.1/tcp/2345/http"
 	cfg.Common.API.RemoteListenAddress = "127.0.0.1:2345"
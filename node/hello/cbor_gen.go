@@ -159,6 +159,206 @@ func (t *HelloMessage) UnmarshalCBOR(r io.Reader) error {
 	return nil
 }
 
+var lengthBufHelloMessageV2 = []byte{134}
+
+func (t *HelloMessageV2) MarshalCBOR(w io.Writer) error {
+	if t == nil {
+		_, err := w.Write(cbg.CborNull)
+		return err
+	}
+	if _, err := w.Write(lengthBufHelloMessageV2); err != nil {
+		return err
+	}
+
+	scratch := make([]byte, 9)
+
+	// t.HeaviestTipSet ([]cid.Cid) (slice)
+	if len(t.HeaviestTipSet) > cbg.MaxLength {
+		return xerrors.Errorf("Slice value in field t.HeaviestTipSet was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajArray, uint64(len(t.HeaviestTipSet))); err != nil {
+		return err
+	}
+	for _, v := range t.HeaviestTipSet {
+		if err := cbg.WriteCidBuf(scratch, w, v); err != nil {
+			return xerrors.Errorf("failed writing cid field t.HeaviestTipSet: %w", err)
+		}
+	}
+
+	// t.HeaviestTipSetHeight (abi.ChainEpoch) (int64)
+	if t.HeaviestTipSetHeight >= 0 {
+		if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.HeaviestTipSetHeight)); err != nil {
+			return err
+		}
+	} else {
+		if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajNegativeInt, uint64(-t.HeaviestTipSetHeight-1)); err != nil {
+			return err
+		}
+	}
+
+	// t.HeaviestTipSetWeight (big.Int) (struct)
+	if err := t.HeaviestTipSetWeight.MarshalCBOR(w); err != nil {
+		return err
+	}
+
+	// t.GenesisHash (cid.Cid) (struct)
+
+	if err := cbg.WriteCidBuf(scratch, w, t.GenesisHash); err != nil {
+		return xerrors.Errorf("failed to write cid field t.GenesisHash: %w", err)
+	}
+
+	// t.Capabilities (uint64) (uint64)
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.Capabilities)); err != nil {
+		return err
+	}
+
+	// t.OldestStateHeight (abi.ChainEpoch) (int64)
+	if t.OldestStateHeight >= 0 {
+		if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.OldestStateHeight)); err != nil {
+			return err
+		}
+	} else {
+		if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajNegativeInt, uint64(-t.OldestStateHeight-1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *HelloMessageV2) UnmarshalCBOR(r io.Reader) error {
+	br := cbg.GetPeeker(r)
+	scratch := make([]byte, 8)
+
+	maj, extra, err := cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return err
+	}
+	if maj != cbg.MajArray {
+		return fmt.Errorf("cbor input should be of type array")
+	}
+
+	if extra != 6 {
+		return fmt.Errorf("cbor input had wrong number of fields")
+	}
+
+	// t.HeaviestTipSet ([]cid.Cid) (slice)
+
+	maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return err
+	}
+
+	if extra > cbg.MaxLength {
+		return fmt.Errorf("t.HeaviestTipSet: array too large (%d)", extra)
+	}
+
+	if maj != cbg.MajArray {
+		return fmt.Errorf("expected cbor array")
+	}
+
+	if extra > 0 {
+		t.HeaviestTipSet = make([]cid.Cid, extra)
+	}
+
+	for i := 0; i < int(extra); i++ {
+
+		c, err := cbg.ReadCid(br)
+		if err != nil {
+			return xerrors.Errorf("reading cid field t.HeaviestTipSet failed: %w", err)
+		}
+		t.HeaviestTipSet[i] = c
+	}
+
+	// t.HeaviestTipSetHeight (abi.ChainEpoch) (int64)
+	{
+		maj, extra, err := cbg.CborReadHeaderBuf(br, scratch)
+		var extraI int64
+		if err != nil {
+			return err
+		}
+		switch maj {
+		case cbg.MajUnsignedInt:
+			extraI = int64(extra)
+			if extraI < 0 {
+				return fmt.Errorf("int64 positive overflow")
+			}
+		case cbg.MajNegativeInt:
+			extraI = int64(extra)
+			if extraI < 0 {
+				return fmt.Errorf("int64 negative oveflow")
+			}
+			extraI = -1 - extraI
+		default:
+			return fmt.Errorf("wrong type for int64 field: %d", maj)
+		}
+
+		t.HeaviestTipSetHeight = abi.ChainEpoch(extraI)
+	}
+	// t.HeaviestTipSetWeight (big.Int) (struct)
+
+	{
+
+		if err := t.HeaviestTipSetWeight.UnmarshalCBOR(br); err != nil {
+			return xerrors.Errorf("unmarshaling t.HeaviestTipSetWeight: %w", err)
+		}
+
+	}
+	// t.GenesisHash (cid.Cid) (struct)
+
+	{
+
+		c, err := cbg.ReadCid(br)
+		if err != nil {
+			return xerrors.Errorf("failed to read cid field t.GenesisHash: %w", err)
+		}
+
+		t.GenesisHash = c
+
+	}
+	// t.Capabilities (uint64) (uint64)
+
+	{
+
+		maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+		if err != nil {
+			return err
+		}
+		if maj != cbg.MajUnsignedInt {
+			return fmt.Errorf("wrong type for uint64 field")
+		}
+		t.Capabilities = uint64(extra)
+
+	}
+	// t.OldestStateHeight (abi.ChainEpoch) (int64)
+	{
+		maj, extra, err := cbg.CborReadHeaderBuf(br, scratch)
+		var extraI int64
+		if err != nil {
+			return err
+		}
+		switch maj {
+		case cbg.MajUnsignedInt:
+			extraI = int64(extra)
+			if extraI < 0 {
+				return fmt.Errorf("int64 positive overflow")
+			}
+		case cbg.MajNegativeInt:
+			extraI = int64(extra)
+			if extraI < 0 {
+				return fmt.Errorf("int64 negative oveflow")
+			}
+			extraI = -1 - extraI
+		default:
+			return fmt.Errorf("wrong type for int64 field: %d", maj)
+		}
+
+		t.OldestStateHeight = abi.ChainEpoch(extraI)
+	}
+	return nil
+}
+
 var lengthBufLatencyMessage = []byte{130}
 
 func (t *LatencyMessage) MarshalCBOR(w io.Writer) error {
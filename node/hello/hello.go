@@ -2,27 +2,40 @@ package hello
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/filecoin-project/specs-actors/actors/abi"
 
 	"github.com/filecoin-project/specs-actors/actors/abi/big"
 	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	gsnet "github.com/ipfs/go-graphsync/network"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/libp2p/go-libp2p-core/host"
 	inet "github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
 	protocol "github.com/libp2p/go-libp2p-core/protocol"
+	"golang.org/x/xerrors"
 
 	cborutil "github.com/filecoin-project/go-cbor-util"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
 	"github.com/filecoin-project/lotus/chain"
+	"github.com/filecoin-project/lotus/chain/blocksync"
 	"github.com/filecoin-project/lotus/chain/store"
 	"github.com/filecoin-project/lotus/chain/types"
 	"github.com/filecoin-project/lotus/lib/peermgr"
+	"github.com/filecoin-project/lotus/lib/peerrep"
+	"github.com/filecoin-project/lotus/node/modules/dtypes"
 )
 
 const ProtocolID = "/fil/hello/1.0.0"
 
+// ProtocolIDv2 extends hello with advertisement of served protocols and
+// available chain history
+const ProtocolIDv2 = "/fil/hello/2.0.0"
+
 var log = logging.Logger("hello")
 
 type HelloMessage struct {
@@ -31,6 +44,20 @@ type HelloMessage struct {
 	HeaviestTipSetWeight big.Int
 	GenesisHash          cid.Cid
 }
+
+type HelloMessageV2 struct {
+	HeaviestTipSet       []cid.Cid
+	HeaviestTipSetHeight abi.ChainEpoch
+	HeaviestTipSetWeight big.Int
+	GenesisHash          cid.Cid
+
+	// Capabilities is a peermgr.Capability bitmask of services the peer serves
+	Capabilities uint64
+	// OldestStateHeight is the height of the oldest tipset the peer has state
+	// for, 0 if it doesn't know yet
+	OldestStateHeight abi.ChainEpoch
+}
+
 type LatencyMessage struct {
 	TArrial int64
 	TSent   int64
@@ -43,9 +70,15 @@ type Service struct {
 	cs     *store.ChainStore
 	syncer *chain.Syncer
 	pmgr   *peermgr.PeerMgr
+	rep    *peerrep.PeerRep
+	ds     dtypes.MetadataDS
+
+	oldestLk    sync.Mutex
+	oldestState abi.ChainEpoch
+	oldestKnown bool
 }
 
-func NewHelloService(h host.Host, cs *store.ChainStore, syncer *chain.Syncer, pmgr peermgr.MaybePeerMgr) *Service {
+func NewHelloService(h host.Host, cs *store.ChainStore, syncer *chain.Syncer, pmgr peermgr.MaybePeerMgr, rep *peerrep.PeerRep, ds dtypes.MetadataDS) *Service {
 	if pmgr.Mgr == nil {
 		log.Warn("running without peer manager")
 	}
@@ -56,16 +89,43 @@ func NewHelloService(h host.Host, cs *store.ChainStore, syncer *chain.Syncer, pm
 		cs:     cs,
 		syncer: syncer,
 		pmgr:   pmgr.Mgr,
+		rep:    rep,
+		ds:     ds,
 	}
 }
 
 func (hs *Service) HandleStream(s inet.Stream) {
+	var hmsg HelloMessageV2
+
+	switch s.Protocol() {
+	case ProtocolIDv2:
+		if err := cborutil.ReadCborRPC(s, &hmsg); err != nil {
+			log.Infow("failed to read hello message, diconnecting", "error", err)
+			s.Conn().Close()
+			return
+		}
 
-	var hmsg HelloMessage
-	if err := cborutil.ReadCborRPC(s, &hmsg); err != nil {
-		log.Infow("failed to read hello message, diconnecting", "error", err)
-		s.Conn().Close()
-		return
+		caps := peermgr.PeerCapabilities{
+			Capabilities:      peermgr.Capability(hmsg.Capabilities),
+			OldestStateHeight: hmsg.OldestStateHeight,
+		}
+		if err := peermgr.SetPeerCapabilities(hs.h.Peerstore(), s.Conn().RemotePeer(), caps); err != nil {
+			log.Warnf("failed to record peer capabilities: %s", err)
+		}
+	default:
+		var v1 HelloMessage
+		if err := cborutil.ReadCborRPC(s, &v1); err != nil {
+			log.Infow("failed to read hello message, diconnecting", "error", err)
+			s.Conn().Close()
+			return
+		}
+
+		hmsg = HelloMessageV2{
+			HeaviestTipSet:       v1.HeaviestTipSet,
+			HeaviestTipSetHeight: v1.HeaviestTipSetHeight,
+			HeaviestTipSetWeight: v1.HeaviestTipSetWeight,
+			GenesisHash:          v1.GenesisHash,
+		}
 	}
 	arrived := time.Now()
 
@@ -76,6 +136,7 @@ func (hs *Service) HandleStream(s inet.Stream) {
 
 	if hmsg.GenesisHash != hs.syncer.Genesis.Cids()[0] {
 		log.Warnf("other peer has different genesis! (%s)", hmsg.GenesisHash)
+		hs.rep.Record(s.Conn().RemotePeer(), peerrep.EvtHelloBadGenesis)
 		s.Conn().Close()
 		return
 	}
@@ -108,6 +169,8 @@ func (hs *Service) HandleStream(s inet.Stream) {
 		return
 	}
 
+	hs.rep.Record(s.Conn().RemotePeer(), peerrep.EvtHelloOK)
+
 	if ts.TipSet().Height() > 0 {
 		hs.h.ConnManager().TagPeer(s.Conn().RemotePeer(), "fcpeer", 10)
 
@@ -122,7 +185,7 @@ func (hs *Service) HandleStream(s inet.Stream) {
 }
 
 func (hs *Service) SayHello(ctx context.Context, pid peer.ID) error {
-	s, err := hs.h.NewStream(ctx, pid, ProtocolID)
+	s, err := hs.h.NewStream(ctx, pid, ProtocolIDv2, ProtocolID)
 	if err != nil {
 		return err
 	}
@@ -138,13 +201,25 @@ func (hs *Service) SayHello(ctx context.Context, pid peer.ID) error {
 		return err
 	}
 
-	hmsg := &HelloMessage{
-		HeaviestTipSet:       hts.Cids(),
-		HeaviestTipSetHeight: hts.Height(),
-		HeaviestTipSetWeight: weight,
-		GenesisHash:          gen.Cid(),
+	var hmsg interface{}
+	if s.Protocol() == ProtocolIDv2 {
+		hmsg = &HelloMessageV2{
+			HeaviestTipSet:       hts.Cids(),
+			HeaviestTipSetHeight: hts.Height(),
+			HeaviestTipSetWeight: weight,
+			GenesisHash:          gen.Cid(),
+			Capabilities:         uint64(hs.capabilities()),
+			OldestStateHeight:    hs.oldestStateHeight(),
+		}
+	} else {
+		hmsg = &HelloMessage{
+			HeaviestTipSet:       hts.Cids(),
+			HeaviestTipSetHeight: hts.Height(),
+			HeaviestTipSetWeight: weight,
+			GenesisHash:          gen.Cid(),
+		}
 	}
-	log.Debug("Sending hello message: ", hts.Cids(), hts.Height(), gen.Cid())
+	log.Debug("Sending hello message: ", hts.Cids(), hts.Height(), gen.Cid(), s.Protocol())
 
 	t0 := time.Now()
 	if err := cborutil.WriteCborRPC(s, hmsg); err != nil {
@@ -181,3 +256,114 @@ func (hs *Service) SayHello(ctx context.Context, pid peer.ID) error {
 
 	return nil
 }
+
+// capabilities returns the set of services this node serves, based on the
+// protocols registered with the host. CapSnapshot is never set, chain exports
+// are only served through the API, not to peers
+func (hs *Service) capabilities() peermgr.Capability {
+	var caps peermgr.Capability
+	for _, proto := range hs.h.Mux().Protocols() {
+		switch protocol.ID(proto) {
+		case blocksync.BlockSyncProtocolID:
+			caps |= peermgr.CapBlockSync
+		case gsnet.ProtocolGraphsync:
+			caps |= peermgr.CapGraphsyncSync
+		case retrievalmarket.QueryProtocolID:
+			caps |= peermgr.CapRetrieval
+		case storagemarket.DealProtocolID:
+			caps |= peermgr.CapStorage
+		}
+	}
+	return caps
+}
+
+// oldestStateHeight returns the height of the oldest tipset we have state
+// for, or 0 (unknown) until FindOldestState completes
+func (hs *Service) oldestStateHeight() abi.ChainEpoch {
+	hs.oldestLk.Lock()
+	defer hs.oldestLk.Unlock()
+
+	if !hs.oldestKnown {
+		return 0
+	}
+	return hs.oldestState
+}
+
+var oldestStateKey = datastore.NewKey("/hello/oldest-state")
+
+// FindOldestState walks the chain back until it finds a tipset with missing
+// state (e.g. on nodes started from a chain snapshot). The walk starts from
+// the oldest tipset found on a previous run if we still have its state, or
+// from the current head
+func (hs *Service) FindOldestState(ctx context.Context) error {
+	bs := hs.cs.Blockstore()
+
+	cur, err := hs.loadOldestState()
+	if err != nil {
+		log.Warnw("failed to load oldest state from a previous run", "error", err)
+	}
+	if cur == nil {
+		cur = hs.cs.GetHeaviestTipSet()
+	}
+
+	for cur.Height() > 0 {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		next, err := hs.cs.LoadTipSet(cur.Parents())
+		if err != nil {
+			log.Infow("missing chain history", "height", cur.Height()-1, "error", err)
+			break
+		}
+
+		has, err := bs.Has(next.ParentState())
+		if err != nil {
+			return xerrors.Errorf("checking state of tipset at %d: %w", next.Height(), err)
+		}
+		if !has {
+			break
+		}
+		cur = next
+	}
+
+	log.Infow("oldest available state", "height", cur.Height())
+
+	if err := hs.ds.Put(oldestStateKey, cur.Key().Bytes()); err != nil {
+		log.Warnw("failed to store oldest state", "error", err)
+	}
+
+	hs.oldestLk.Lock()
+	hs.oldestState = cur.Height()
+	hs.oldestKnown = true
+	hs.oldestLk.Unlock()
+
+	return nil
+}
+
+// loadOldestState returns the oldest tipset with state found on a previous
+// run, nil if there is none or its state is gone
+func (hs *Service) loadOldestState() (*types.TipSet, error) {
+	b, err := hs.ds.Get(oldestStateKey)
+	if err == datastore.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tsk, err := types.TipSetKeyFromBytes(b)
+	if err != nil {
+		return nil, xerrors.Errorf("decoding tipset key: %w", err)
+	}
+	ts, err := hs.cs.LoadTipSet(tsk)
+	if err != nil {
+		return nil, xerrors.Errorf("loading tipset: %w", err)
+	}
+
+	has, err := hs.cs.Blockstore().Has(ts.ParentState())
+	if err != nil || !has {
+		return nil, err
+	}
+	return ts, nil
+}
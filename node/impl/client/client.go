@@ -2,12 +2,8 @@ package client
 
 import (
 	"context"
-	"errors"
 
 	"github.com/filecoin-project/go-fil-markets/pieceio"
-	basicnode "github.com/ipld/go-ipld-prime/node/basic"
-	"github.com/ipld/go-ipld-prime/traversal/selector"
-	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
 
 	"io"
 	"os"
@@ -17,6 +13,7 @@ import (
 	"github.com/ipfs/go-blockservice"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-filestore"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	chunker "github.com/ipfs/go-ipfs-chunker"
 	offline "github.com/ipfs/go-ipfs-exchange-offline"
 	files "github.com/ipfs/go-ipfs-files"
@@ -25,6 +22,7 @@ import (
 	unixfile "github.com/ipfs/go-unixfs/file"
 	"github.com/ipfs/go-unixfs/importer/balanced"
 	ihelper "github.com/ipfs/go-unixfs/importer/helpers"
+	uio "github.com/ipfs/go-unixfs/io"
 	"github.com/ipld/go-car"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"go.uber.org/fx"
@@ -41,6 +39,8 @@ import (
 	"github.com/filecoin-project/lotus/build"
 	"github.com/filecoin-project/lotus/chain/store"
 	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/lib/ipfsbstore"
+	"github.com/filecoin-project/lotus/markets/retrievaladapter"
 	"github.com/filecoin-project/lotus/markets/utils"
 	"github.com/filecoin-project/lotus/node/impl/full"
 	"github.com/filecoin-project/lotus/node/impl/paych"
@@ -62,6 +62,13 @@ type API struct {
 	Retrieval    retrievalmarket.RetrievalClient
 	Chain        *store.ChainStore
 
+	RetrievalTracker *retrievaladapter.DealTracker
+
+	Proposer DealProposer
+	Placer   *DealPlacer
+	Monitor  *DealMonitor
+	Imports  *Imports
+
 	LocalDAG   dtypes.ClientDAG
 	Blockstore dtypes.ClientBlockstore
 	Filestore  dtypes.ClientFilestore `optional:"true"`
@@ -76,6 +83,22 @@ func calcDealExpiration(minDuration uint64, md *miner.DeadlineInfo, startEpoch a
 }
 
 func (a *API) ClientStartDeal(ctx context.Context, params *api.StartDealParams) (*cid.Cid, error) {
+	return a.Proposer.ProposeDeal(ctx, params)
+}
+
+// DealProposer proposes storage deals with a chosen miner. It's used by
+// ClientStartDeal, and by the DealPlacer for the miners it selects
+type DealProposer struct {
+	fx.In
+
+	full.ChainAPI
+	full.StateAPI
+
+	SMDealClient storagemarket.StorageClient
+	Imports      *Imports
+}
+
+func (a *DealProposer) ProposeDeal(ctx context.Context, params *api.StartDealParams) (*cid.Cid, error) {
 	exist, err := a.WalletHas(ctx, params.Wallet)
 	if err != nil {
 		return nil, xerrors.Errorf("failed getting addr from wallet: %w", params.Wallet)
@@ -131,9 +154,58 @@ func (a *API) ClientStartDeal(ctx context.Context, params *api.StartDealParams)
 		return nil, xerrors.Errorf("failed to start deal: %w", err)
 	}
 
+	if err := a.Imports.AddDeal(params.Data.Root, result.ProposalCid); err != nil {
+		log.Warnf("recording deal %s for import %s: %+v", result.ProposalCid, params.Data.Root, err)
+	}
+
 	return &result.ProposalCid, nil
 }
 
+func (a *API) ClientStartDealAuto(ctx context.Context, params *api.StartDealAutoParams) (*api.DealPlacement, error) {
+	if params.Replicas <= 0 {
+		return nil, xerrors.New("number of replicas must be positive")
+	}
+	if params.MaxPrice.Int == nil {
+		return nil, xerrors.New("max price not set")
+	}
+
+	exist, err := a.WalletHas(ctx, params.Wallet)
+	if err != nil {
+		return nil, xerrors.Errorf("failed getting addr from wallet: %w", err)
+	}
+	if !exist {
+		return nil, xerrors.Errorf("provided address doesn't exist in wallet")
+	}
+
+	size := params.Data.PieceSize.Padded()
+	if params.Data.PieceSize == 0 {
+		local := merkledag.NewDAGService(blockservice.New(a.Blockstore, offline.Exchange(a.Blockstore)))
+		cs, err := carSize(ctx, local, params.Data.Root)
+		if err != nil {
+			return nil, xerrors.Errorf("computing data size: %w", err)
+		}
+		size = paddedPieceSize(cs)
+	}
+
+	return a.Placer.Place(ctx, *params, size)
+}
+
+func (a *API) ClientListDealPlacements(ctx context.Context) ([]api.DealPlacement, error) {
+	return a.Placer.List(), nil
+}
+
+func (a *API) ClientMonitoredDeals(ctx context.Context) ([]api.MonitoredDeal, error) {
+	return a.Monitor.List(), nil
+}
+
+func (a *API) ClientDealAlerts(ctx context.Context) (<-chan api.MonitoredDeal, error) {
+	return a.Monitor.Alerts(ctx), nil
+}
+
+func (a *API) ClientRenewDeal(ctx context.Context, proposal cid.Cid, miner address.Address, maxPrice types.BigInt) error {
+	return a.Monitor.Renew(ctx, proposal, miner, maxPrice)
+}
+
 func (a *API) ClientListDeals(ctx context.Context) ([]api.DealInfo, error) {
 	deals, err := a.SMDealClient.ListLocalDeals(ctx)
 	if err != nil {
@@ -160,6 +232,14 @@ func (a *API) ClientListDeals(ctx context.Context) ([]api.DealInfo, error) {
 	return out, nil
 }
 
+func (a *API) ClientListRetrievals(ctx context.Context) ([]api.RetrievalInfo, error) {
+	return a.RetrievalTracker.List()
+}
+
+func (a *API) ClientGetRetrievalUpdates(ctx context.Context) (<-chan api.RetrievalInfo, error) {
+	return a.RetrievalTracker.Updates(ctx), nil
+}
+
 func (a *API) ClientGetDealInfo(ctx context.Context, d cid.Cid) (*api.DealInfo, error) {
 	v, err := a.SMDealClient.GetLocalDeal(ctx, d)
 	if err != nil {
@@ -221,7 +301,14 @@ func (a *API) ClientFindData(ctx context.Context, root cid.Cid) ([]api.QueryOffe
 }
 
 func (a *API) ClientImport(ctx context.Context, ref api.FileRef) (cid.Cid, error) {
+	defer a.Imports.Importing()()
+
+	return a.importFile(ctx, ref)
+}
 
+// importFile imports the file and records the import, callers must keep GC
+// from running
+func (a *API) importFile(ctx context.Context, ref api.FileRef) (cid.Cid, error) {
 	bufferedDS := ipld.NewBufferedDAG(ctx, a.LocalDAG)
 	nd, err := a.clientImport(ref, bufferedDS)
 
@@ -229,10 +316,20 @@ func (a *API) ClientImport(ctx context.Context, ref api.FileRef) (cid.Cid, error
 		return cid.Undef, err
 	}
 
+	st, err := os.Stat(ref.Path)
+	if err != nil {
+		return cid.Undef, err
+	}
+	if err := a.Imports.Add(nd, ref.Path, uint64(st.Size())); err != nil {
+		return cid.Undef, xerrors.Errorf("recording import: %w", err)
+	}
+
 	return nd, nil
 }
 
 func (a *API) ClientImportLocal(ctx context.Context, f io.Reader) (cid.Cid, error) {
+	defer a.Imports.Importing()()
+
 	file := files.NewReaderFile(f)
 
 	bufferedDS := ipld.NewBufferedDAG(ctx, a.LocalDAG)
@@ -253,19 +350,64 @@ func (a *API) ClientImportLocal(ctx context.Context, f io.Reader) (cid.Cid, erro
 		return cid.Undef, err
 	}
 
-	return nd.Cid(), bufferedDS.Commit()
+	if err := bufferedDS.Commit(); err != nil {
+		return cid.Undef, err
+	}
+
+	size, err := nd.Size()
+	if err != nil {
+		return cid.Undef, err
+	}
+	if err := a.Imports.Add(nd.Cid(), "", size); err != nil {
+		return cid.Undef, xerrors.Errorf("recording import: %w", err)
+	}
+
+	return nd.Cid(), nil
 }
 
 func (a *API) ClientListImports(ctx context.Context) ([]api.Import, error) {
+	out, err := a.Imports.List()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range out {
+		out[i].Status = filestore.StatusOk
+		if out[i].FilePath == "" {
+			continue
+		}
+		if _, err := os.Stat(out[i].FilePath); os.IsNotExist(err) {
+			out[i].Status = filestore.StatusFileNotFound
+		}
+	}
+
 	if a.Filestore == nil {
-		return nil, errors.New("listing imports is not supported with in-memory dag yet")
+		return out, nil
 	}
-	next, err := filestore.ListAll(a.Filestore, false)
+
+	legacy, err := a.unrecordedImports()
 	if err != nil {
 		return nil, err
 	}
+	return append(out, legacy...), nil
+}
 
-	// TODO: make this less very bad by tracking root cids instead of using ListAll
+// unrecordedImports lists files referenced from the filestore without
+// recorded import metadata, they were imported before it was recorded
+func (a *API) unrecordedImports() ([]api.Import, error) {
+	recorded, err := a.Imports.List()
+	if err != nil {
+		return nil, err
+	}
+	paths := map[string]struct{}{}
+	for _, imp := range recorded {
+		paths[imp.FilePath] = struct{}{}
+	}
+
+	next, err := filestore.ListAll(a.Filestore, false)
+	if err != nil {
+		return nil, err
+	}
 
 	out := make([]api.Import, 0)
 	lowest := make([]uint64, 0)
@@ -274,6 +416,10 @@ func (a *API) ClientListImports(ctx context.Context) ([]api.Import, error) {
 		if r == nil {
 			return out, nil
 		}
+		if _, ok := paths[r.FilePath]; ok {
+			continue
+		}
+
 		matched := false
 		for i := range out {
 			if out[i].FilePath == r.FilePath {
@@ -302,7 +448,221 @@ func (a *API) ClientListImports(ctx context.Context) ([]api.Import, error) {
 	}
 }
 
+func (a *API) ClientRemoveImport(ctx context.Context, root cid.Cid) error {
+	done, err := a.Imports.Collecting()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	has, err := a.Imports.Has(root)
+	if err != nil {
+		return err
+	}
+	if !has {
+		return xerrors.Errorf("no import with root %s", root)
+	}
+
+	pending, err := a.pendingDealRoots(ctx)
+	if err != nil {
+		return err
+	}
+	if pending.Has(root) {
+		return xerrors.Errorf("storage deals for %s aren't finished yet", root)
+	}
+
+	if _, err := a.removeUnused(ctx, root, pending); err != nil {
+		return err
+	}
+
+	if err := a.Imports.Remove(root); err != nil {
+		return xerrors.Errorf("removing import record: %w", err)
+	}
+	return nil
+}
+
+func (a *API) ClientGCBlockstore(ctx context.Context) (*api.ClientGCResult, error) {
+	done, err := a.Imports.Collecting()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	if a.Filestore != nil {
+		// record files imported before import metadata was, their references
+		// are removed if the file is gone
+		legacy, err := a.unrecordedImports()
+		if err != nil {
+			return nil, err
+		}
+		for _, imp := range legacy {
+			if _, err := os.Stat(imp.FilePath); err != nil {
+				continue
+			}
+			if _, err := a.importFile(ctx, api.FileRef{Path: imp.FilePath}); err != nil {
+				return nil, xerrors.Errorf("recording import of %s: %w", imp.FilePath, err)
+			}
+		}
+	}
+
+	keep, err := a.pendingDealRoots(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	imps, err := a.Imports.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, imp := range imps {
+		keep.Add(imp.Key)
+	}
+
+	return a.sweep(ctx, keep)
+}
+
+// pendingDealRoots returns the roots of data of storage deals which may
+// still need to be transferred
+func (a *API) pendingDealRoots(ctx context.Context) (*cid.Set, error) {
+	deals, err := a.SMDealClient.ListLocalDeals(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("listing deals: %w", err)
+	}
+
+	out := cid.NewSet()
+	for _, d := range deals {
+		if d.DataRef != nil && !dealDone(d.State) {
+			out.Add(d.DataRef.Root)
+		}
+	}
+	return out, nil
+}
+
+// errRemoveNotSupported is returned when blocks can't be removed from the
+// client blockstore, with UseIpfs blocks are stored by the ipfs node
+var errRemoveNotSupported = xerrors.New("removing data from the client blockstore is not supported with UseIpfs")
+
+// removeUnused removes the blocks of the DAG below root which aren't used by
+// the other recorded imports or the roots, callers must be Collecting
+func (a *API) removeUnused(ctx context.Context, root cid.Cid, roots *cid.Set) (int, error) {
+	local := merkledag.NewDAGService(blockservice.New(a.Blockstore, offline.Exchange(a.Blockstore)))
+
+	imps, err := a.Imports.List()
+	if err != nil {
+		return 0, err
+	}
+	keepRoots := cid.NewSet()
+	for _, imp := range imps {
+		if imp.Key != root {
+			keepRoots.Add(imp.Key)
+		}
+	}
+	_ = roots.ForEach(func(c cid.Cid) error {
+		keepRoots.Add(c)
+		return nil
+	})
+
+	keep := cid.NewSet()
+	if err := keepRoots.ForEach(func(c cid.Cid) error {
+		return dagBlocks(ctx, local, c, keep)
+	}); err != nil {
+		return 0, xerrors.Errorf("listing blocks in use: %w", err)
+	}
+
+	blocks := cid.NewSet()
+	if err := dagBlocks(ctx, local, root, blocks); err != nil {
+		return 0, xerrors.Errorf("listing blocks of %s: %w", root, err)
+	}
+
+	var removed int
+	err = blocks.ForEach(func(c cid.Cid) error {
+		if keep.Has(c) {
+			return nil
+		}
+		if err := a.deleteBlock(c); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	return removed, err
+}
+
+// sweep removes all blocks which aren't part of the DAGs below the roots,
+// callers must be Collecting
+func (a *API) sweep(ctx context.Context, roots *cid.Set) (*api.ClientGCResult, error) {
+	local := merkledag.NewDAGService(blockservice.New(a.Blockstore, offline.Exchange(a.Blockstore)))
+
+	keep := cid.NewSet()
+	if err := roots.ForEach(func(c cid.Cid) error {
+		return dagBlocks(ctx, local, c, keep)
+	}); err != nil {
+		return nil, xerrors.Errorf("listing blocks in use: %w", err)
+	}
+
+	keys, err := a.Blockstore.AllKeysChan(ctx)
+	if xerrors.Is(err, ipfsbstore.ErrNotSupported) {
+		return nil, errRemoveNotSupported
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("listing blocks: %w", err)
+	}
+
+	// the blockstore lists keys as raw CIDs, so blocks are compared by their
+	// multihash
+	keepHashes := make(map[string]struct{}, keep.Len())
+	if err := keep.ForEach(func(c cid.Cid) error {
+		keepHashes[string(c.Hash())] = struct{}{}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	var res api.ClientGCResult
+	var remove []cid.Cid
+	for c := range keys {
+		if _, ok := keepHashes[string(c.Hash())]; ok {
+			res.Kept++
+			continue
+		}
+		remove = append(remove, c)
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	for _, c := range remove {
+		if err := a.deleteBlock(c); err != nil {
+			return nil, err
+		}
+		res.Removed++
+	}
+
+	log.Infow("client blockstore GC done", "kept", res.Kept, "removed", res.Removed)
+	return &res, nil
+}
+
+func (a *API) deleteBlock(c cid.Cid) error {
+	err := a.Blockstore.DeleteBlock(c)
+	switch {
+	case err == nil, err == blockstore.ErrNotFound:
+		return nil
+	case xerrors.Is(err, ipfsbstore.ErrNotSupported):
+		return errRemoveNotSupported
+	default:
+		return xerrors.Errorf("removing block %s: %w", c, err)
+	}
+}
+
 func (a *API) ClientRetrieve(ctx context.Context, order api.RetrievalOrder, ref api.FileRef) error {
+	defer a.Imports.Importing()()
+
+	// recorded before retrieving, so GC keeps partially retrieved data for
+	// resuming
+	if err := a.Imports.AddRetrieval(order.Root, order.Size); err != nil {
+		return xerrors.Errorf("recording retrieval: %w", err)
+	}
+
 	if order.MinerPeerID == "" {
 		mi, err := a.StateMinerInfo(ctx, order.Miner, types.EmptyTSK)
 		if err != nil {
@@ -316,63 +676,99 @@ func (a *API) ClientRetrieve(ctx context.Context, order api.RetrievalOrder, ref
 		return xerrors.Errorf("cannot make retrieval deal for zero bytes")
 	}
 
-	retrievalResult := make(chan error, 1)
+	ppb := types.BigDiv(order.Total, types.NewInt(order.Size))
 
-	unsubscribe := a.Retrieval.SubscribeToEvents(func(event retrievalmarket.ClientEvent, state retrievalmarket.ClientDealState) {
-		if state.PayloadCID.Equals(order.Root) {
-			switch state.Status {
-			case retrievalmarket.DealStatusFailed, retrievalmarket.DealStatusErrored:
-				retrievalResult <- xerrors.Errorf("Retrieval Error: %s", state.Message)
-			case retrievalmarket.DealStatusCompleted:
-				retrievalResult <- nil
-			}
-		}
-	})
+	r := &retriever{
+		a:     a,
+		order: order,
+		ppb:   ppb,
+		local: merkledag.NewDAGService(blockservice.New(a.Blockstore, offline.Exchange(a.Blockstore))),
+	}
+	r.deal = r.retrieve
 
-	ppb := types.BigDiv(order.Total, types.NewInt(order.Size))
+	root, err := r.resolvePath(ctx, order.Root, order.Path)
+	if err != nil {
+		return err
+	}
 
-	a.Retrieval.Retrieve(
-		ctx,
-		order.Root,
-		retrievalmarket.NewParamsV0(ppb, order.PaymentInterval, order.PaymentIntervalIncrease),
-		order.Total,
-		order.MinerPeerID,
-		order.Client,
-		order.Miner)
-	select {
-	case <-ctx.Done():
-		return xerrors.New("Retrieval Timed Out")
-	case err := <-retrievalResult:
-		if err != nil {
-			return xerrors.Errorf("RetrieveUnixfs: %w", err)
+	ranged := order.Offset > 0 || order.Length > 0
+	if ranged {
+		if ref.IsCAR {
+			return xerrors.Errorf("byte ranges can't be exported to a car file")
+		}
+		err = r.fetchRange(ctx, root, order.Offset, order.Length)
+	} else {
+		size := order.Size
+		if root != order.Root {
+			size = 0
 		}
+		err = r.fetchAll(ctx, root, size)
+	}
+	if err != nil {
+		return xerrors.Errorf("RetrieveUnixfs: %w", err)
 	}
-
-	unsubscribe()
 
 	if ref.IsCAR {
 		f, err := os.OpenFile(ref.Path, os.O_CREATE|os.O_WRONLY, 0644)
 		if err != nil {
 			return err
 		}
-		err = car.WriteCar(ctx, a.LocalDAG, []cid.Cid{order.Root}, f)
+		err = car.WriteCar(ctx, r.local, []cid.Cid{root}, f)
 		if err != nil {
 			return err
 		}
 		return f.Close()
 	}
 
-	nd, err := a.LocalDAG.Get(ctx, order.Root)
+	nd, err := r.local.Get(ctx, root)
 	if err != nil {
 		return xerrors.Errorf("ClientRetrieve: %w", err)
 	}
-	file, err := unixfile.NewUnixfsFile(ctx, a.LocalDAG, nd)
+
+	if ranged {
+		return writeRange(ctx, r.local, nd, order.Offset, order.Length, ref.Path)
+	}
+
+	file, err := unixfile.NewUnixfsFile(ctx, r.local, nd)
 	if err != nil {
 		return xerrors.Errorf("ClientRetrieve: %w", err)
 	}
 	return files.WriteTo(file, ref.Path)
 }
 
+func writeRange(ctx context.Context, dag ipld.DAGService, nd ipld.Node, offset, length uint64, path string) error {
+	dr, err := uio.NewDagReader(ctx, nd, dag)
+	if err != nil {
+		return xerrors.Errorf("opening unixfs file: %w", err)
+	}
+	defer dr.Close()
+
+	if _, err := dr.Seek(int64(offset), io.SeekStart); err != nil {
+		return xerrors.Errorf("seeking to %d: %w", offset, err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if length > 0 {
+		_, err = io.CopyN(f, dr, int64(length))
+		if err == io.EOF {
+			// range past the end of the file
+			err = nil
+		}
+	} else {
+		_, err = io.Copy(f, dr)
+	}
+	if err != nil {
+		_ = f.Close()
+		return xerrors.Errorf("writing range: %w", err)
+	}
+
+	return f.Close()
+}
+
 func (a *API) ClientQueryAsk(ctx context.Context, p peer.ID, miner address.Address) (*storagemarket.SignedStorageAsk, error) {
 	info := utils.NewStorageProviderInfo(miner, address.Undef, 0, p)
 	signedAsk, err := a.SMDealClient.GetAsk(ctx, info)
@@ -416,33 +812,62 @@ func (a *API) ClientCalcCommP(ctx context.Context, inpath string, miner address.
 }
 
 func (a *API) ClientGenCar(ctx context.Context, ref api.FileRef, outputPath string) error {
+	done := a.Imports.Importing()
+	c, err := a.genCar(ctx, ref, outputPath)
+	done()
+
+	if c.Defined() {
+		// the blocks were only needed for writing the car
+		a.removeCarBlocks(ctx, c)
+	}
+	return err
+}
 
+func (a *API) genCar(ctx context.Context, ref api.FileRef, outputPath string) (cid.Cid, error) {
 	bufferedDS := ipld.NewBufferedDAG(ctx, a.LocalDAG)
 	c, err := a.clientImport(ref, bufferedDS)
 
 	if err != nil {
-		return err
+		return cid.Undef, err
 	}
 
-	defer bufferedDS.Remove(ctx, c)
-	ssb := builder.NewSelectorSpecBuilder(basicnode.Style.Any)
-
-	// entire DAG selector
-	allSelector := ssb.ExploreRecursive(selector.RecursionLimitNone(),
-		ssb.ExploreAll(ssb.ExploreRecursiveEdge())).Node()
-
 	f, err := os.Create(outputPath)
-	defer f.Close()
 	if err != nil {
-		return err
+		return c, err
 	}
+	defer f.Close() //nolint:errcheck
 
 	sc := car.NewSelectiveCar(ctx, a.Blockstore, []car.Dag{{Root: c, Selector: allSelector}})
 	if err = sc.Write(f); err != nil {
-		return err
+		return c, err
 	}
 
-	return nil
+	return c, f.Close()
+}
+
+// removeCarBlocks removes blocks written for generating a car, unless the
+// data was imported, leftover blocks are removed by GC
+func (a *API) removeCarBlocks(ctx context.Context, c cid.Cid) {
+	done, err := a.Imports.Collecting()
+	if err != nil {
+		log.Infof("not removing car blocks now: %s", err)
+		return
+	}
+	defer done()
+
+	imported, err := a.Imports.Has(c)
+	if err != nil || imported {
+		return
+	}
+
+	pending, err := a.pendingDealRoots(ctx)
+	if err != nil {
+		log.Warnf("not removing car blocks: %+v", err)
+		return
+	}
+	if _, err := a.removeUnused(ctx, c, pending); err != nil {
+		log.Warnf("removing car blocks: %+v", err)
+	}
 }
 
 func (a *API) clientImport(ref api.FileRef, bufferedDS *ipld.BufferedDAG) (cid.Cid, error) {
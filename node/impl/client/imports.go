@@ -0,0 +1,234 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	ipld "github.com/ipfs/go-ipld-format"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+)
+
+// Imports records metadata of data imported into the client blockstore, so
+// imports can be listed and removed, and everything else garbage collected
+type Imports struct {
+	ds datastore.Datastore
+
+	// running counts imports and retrievals which may have written blocks
+	// not recorded yet, blocks can only be removed while there are none
+	gcLk       sync.Mutex
+	gcCond     *sync.Cond
+	running    int
+	collecting bool
+
+	lk sync.Mutex
+}
+
+// ErrImportsRunning is returned when blocks can't be removed because imports
+// or retrievals are running
+var ErrImportsRunning = xerrors.New("imports or retrievals are running, try again when they finish")
+
+func NewImports(ds datastore.Datastore) *Imports {
+	im := &Imports{ds: ds}
+	im.gcCond = sync.NewCond(&im.gcLk)
+	return im
+}
+
+// Importing keeps blocks from being removed until done is called, it waits
+// for running removals to finish
+func (im *Imports) Importing() (done func()) {
+	im.gcLk.Lock()
+	defer im.gcLk.Unlock()
+
+	for im.collecting {
+		im.gcCond.Wait()
+	}
+	im.running++
+
+	return func() {
+		im.gcLk.Lock()
+		defer im.gcLk.Unlock()
+
+		im.running--
+		im.gcCond.Broadcast()
+	}
+}
+
+// Collecting keeps imports from starting until done is called, removals
+// don't wait for running imports, which can take hours, and fail with
+// ErrImportsRunning instead
+func (im *Imports) Collecting() (done func(), err error) {
+	im.gcLk.Lock()
+	defer im.gcLk.Unlock()
+
+	for im.collecting {
+		im.gcCond.Wait()
+	}
+	if im.running > 0 {
+		return nil, ErrImportsRunning
+	}
+	im.collecting = true
+
+	return func() {
+		im.gcLk.Lock()
+		defer im.gcLk.Unlock()
+
+		im.collecting = false
+		im.gcCond.Broadcast()
+	}, nil
+}
+
+// Add records an import, importing the same data again keeps its deals
+func (im *Imports) Add(root cid.Cid, path string, size uint64) error {
+	im.lk.Lock()
+	defer im.lk.Unlock()
+
+	imp, err := im.get(root)
+	if err != nil && err != datastore.ErrNotFound {
+		return err
+	}
+	if imp == nil {
+		imp = &api.Import{Key: root}
+	}
+
+	imp.FilePath = path
+	imp.Size = size
+	imp.Retrieved = false
+	imp.Imported = time.Now()
+
+	return im.put(imp)
+}
+
+// AddRetrieval records data being retrieved, so partially retrieved data is
+// kept for resuming, it does nothing for data which was already imported
+func (im *Imports) AddRetrieval(root cid.Cid, size uint64) error {
+	im.lk.Lock()
+	defer im.lk.Unlock()
+
+	_, err := im.get(root)
+	if err == nil {
+		return nil
+	}
+	if err != datastore.ErrNotFound {
+		return err
+	}
+
+	return im.put(&api.Import{
+		Key:       root,
+		Size:      size,
+		Imported:  time.Now(),
+		Retrieved: true,
+	})
+}
+
+// AddDeal records a deal proposed for imported data, it does nothing for
+// data which wasn't imported
+func (im *Imports) AddDeal(root cid.Cid, proposal cid.Cid) error {
+	im.lk.Lock()
+	defer im.lk.Unlock()
+
+	imp, err := im.get(root)
+	if err == datastore.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	imp.Deals = append(imp.Deals, proposal)
+	return im.put(imp)
+}
+
+func (im *Imports) Has(root cid.Cid) (bool, error) {
+	return im.ds.Has(datastore.NewKey(root.String()))
+}
+
+func (im *Imports) Remove(root cid.Cid) error {
+	im.lk.Lock()
+	defer im.lk.Unlock()
+
+	return im.ds.Delete(datastore.NewKey(root.String()))
+}
+
+// List returns all recorded imports, oldest first
+func (im *Imports) List() ([]api.Import, error) {
+	im.lk.Lock()
+	defer im.lk.Unlock()
+
+	res, err := im.ds.Query(query.Query{})
+	if err != nil {
+		return nil, xerrors.Errorf("querying imports: %w", err)
+	}
+	ents, err := res.Rest()
+	if err != nil {
+		return nil, xerrors.Errorf("reading imports: %w", err)
+	}
+
+	out := make([]api.Import, len(ents))
+	for i, ent := range ents {
+		if err := json.Unmarshal(ent.Value, &out[i]); err != nil {
+			return nil, xerrors.Errorf("unmarshaling import %s: %w", ent.Key, err)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Imported.Before(out[j].Imported)
+	})
+	return out, nil
+}
+
+func (im *Imports) get(root cid.Cid) (*api.Import, error) {
+	b, err := im.ds.Get(datastore.NewKey(root.String()))
+	if err != nil {
+		return nil, err
+	}
+
+	var imp api.Import
+	if err := json.Unmarshal(b, &imp); err != nil {
+		return nil, xerrors.Errorf("unmarshaling import %s: %w", root, err)
+	}
+	return &imp, nil
+}
+
+func (im *Imports) put(imp *api.Import) error {
+	b, err := json.Marshal(imp)
+	if err != nil {
+		return xerrors.Errorf("marshaling import %s: %w", imp.Key, err)
+	}
+	return im.ds.Put(datastore.NewKey(imp.Key.String()), b)
+}
+
+// dagBlocks adds the blocks of the DAG below root to the set, skipping
+// blocks which aren't stored
+func dagBlocks(ctx context.Context, dag ipld.DAGService, root cid.Cid, set *cid.Set) error {
+	var walk func(c cid.Cid) error
+	walk = func(c cid.Cid) error {
+		if !set.Visit(c) {
+			return nil
+		}
+
+		nd, err := dag.Get(ctx, c)
+		if err == ipld.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return xerrors.Errorf("getting %s: %w", c, err)
+		}
+
+		for _, l := range nd.Links() {
+			if err := walk(l.Cid); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return walk(root)
+}
@@ -0,0 +1,237 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+)
+
+func newTestImports() *Imports {
+	return NewImports(dssync.MutexWrap(datastore.NewMapDatastore()))
+}
+
+func newTestDAG() (blockstore.Blockstore, ipld.DAGService) {
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	return bs, merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+}
+
+// addNode stores a node linking to the children
+func addNode(t *testing.T, dag ipld.DAGService, data string, children ...ipld.Node) ipld.Node {
+	t.Helper()
+
+	var nd ipld.Node
+	if len(children) == 0 {
+		nd = merkledag.NewRawNode([]byte(data))
+	} else {
+		pn := merkledag.NodeWithData([]byte(data))
+		for _, c := range children {
+			if err := pn.AddNodeLink(c.Cid().String(), c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		nd = pn
+	}
+
+	if err := dag.Add(context.TODO(), nd); err != nil {
+		t.Fatal(err)
+	}
+	return nd
+}
+
+func mustHave(t *testing.T, bs blockstore.Blockstore, nd ipld.Node, expect bool) {
+	t.Helper()
+
+	has, err := bs.Has(nd.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has != expect {
+		t.Fatalf("block %q: expected stored %t, got %t", nd.RawData(), expect, has)
+	}
+}
+
+func TestImportsRecords(t *testing.T) {
+	im := newTestImports()
+	_, dag := newTestDAG()
+	a := addNode(t, dag, "a").Cid()
+	b := addNode(t, dag, "b").Cid()
+	deal := addNode(t, dag, "deal").Cid()
+
+	if err := im.Add(a, "/data/a", 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := im.AddDeal(a, deal); err != nil {
+		t.Fatal(err)
+	}
+	// deals for data which wasn't imported aren't recorded
+	if err := im.AddDeal(b, deal); err != nil {
+		t.Fatal(err)
+	}
+	// retrieving imported data doesn't change the record
+	if err := im.AddRetrieval(a, 20); err != nil {
+		t.Fatal(err)
+	}
+	if err := im.AddRetrieval(b, 30); err != nil {
+		t.Fatal(err)
+	}
+	// importing again keeps the deals
+	if err := im.Add(a, "/data/a2", 10); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := im.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("expected 2 imports, got %d", len(list))
+	}
+	// List is ordered by import time
+	imp, ret := list[1], list[0]
+	if imp.Key != a || imp.FilePath != "/data/a2" || imp.Size != 10 || imp.Retrieved {
+		t.Errorf("unexpected import %+v", imp)
+	}
+	if len(imp.Deals) != 1 || imp.Deals[0] != deal {
+		t.Errorf("expected deal %s, got %v", deal, imp.Deals)
+	}
+	if ret.Key != b || !ret.Retrieved || ret.Size != 30 || len(ret.Deals) != 0 {
+		t.Errorf("unexpected retrieval %+v", ret)
+	}
+
+	if err := im.Remove(a); err != nil {
+		t.Fatal(err)
+	}
+	has, err := im.Has(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has {
+		t.Fatal("expected import to be removed")
+	}
+}
+
+func TestImportsCollecting(t *testing.T) {
+	im := newTestImports()
+
+	done := im.Importing()
+	if _, err := im.Collecting(); err != ErrImportsRunning {
+		t.Fatalf("expected ErrImportsRunning, got %v", err)
+	}
+	done()
+
+	collected, err := im.Collecting()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	go func() {
+		im.Importing()()
+		close(started)
+	}()
+
+	select {
+	case <-started:
+		t.Fatal("import started while collecting")
+	default:
+	}
+	collected()
+	<-started
+}
+
+func TestDagBlocks(t *testing.T) {
+	bs, dag := newTestDAG()
+
+	leaf := addNode(t, dag, "leaf")
+	gone := addNode(t, dag, "gone")
+	mid := addNode(t, dag, "mid", leaf, gone)
+	root := addNode(t, dag, "root", mid, leaf)
+
+	if err := bs.DeleteBlock(gone.Cid()); err != nil {
+		t.Fatal(err)
+	}
+
+	set := cid.NewSet()
+	if err := dagBlocks(context.TODO(), dag, root.Cid(), set); err != nil {
+		t.Fatal(err)
+	}
+
+	// missing blocks are included, but not walked
+	for _, nd := range []ipld.Node{root, mid, leaf, gone} {
+		if !set.Has(nd.Cid()) {
+			t.Errorf("expected %q in the set", nd.RawData())
+		}
+	}
+	if set.Len() != 4 {
+		t.Errorf("expected 4 blocks, got %d", set.Len())
+	}
+}
+
+func TestRemoveUnused(t *testing.T) {
+	bs, dag := newTestDAG()
+	a := &API{Blockstore: bs, Imports: newTestImports()}
+
+	shared := addNode(t, dag, "shared")
+	own := addNode(t, dag, "own")
+	dealOnly := addNode(t, dag, "deal only")
+	removed := addNode(t, dag, "removed", shared, own, dealOnly)
+	other := addNode(t, dag, "other", shared)
+	deal := addNode(t, dag, "deal", dealOnly)
+
+	for _, nd := range []ipld.Node{removed, other} {
+		if err := a.Imports.Add(nd.Cid(), "", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	roots := cid.NewSet()
+	roots.Add(deal.Cid())
+
+	n, err := a.removeUnused(context.TODO(), removed.Cid(), roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 blocks removed, got %d", n)
+	}
+
+	mustHave(t, bs, removed, false)
+	mustHave(t, bs, own, false)
+	mustHave(t, bs, shared, true)
+	mustHave(t, bs, dealOnly, true)
+	mustHave(t, bs, other, true)
+}
+
+func TestSweep(t *testing.T) {
+	bs, dag := newTestDAG()
+	a := &API{Blockstore: bs, Imports: newTestImports()}
+
+	leaf := addNode(t, dag, "leaf")
+	root := addNode(t, dag, "root", leaf)
+	garbage := addNode(t, dag, "garbage")
+	orphan := addNode(t, dag, "orphan", garbage)
+
+	roots := cid.NewSet()
+	roots.Add(root.Cid())
+
+	res, err := a.sweep(context.TODO(), roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Kept != 2 || res.Removed != 2 {
+		t.Errorf("expected 2 kept and 2 removed, got %+v", res)
+	}
+
+	mustHave(t, bs, root, true)
+	mustHave(t, bs, leaf, true)
+	mustHave(t, bs, garbage, false)
+	mustHave(t, bs, orphan, false)
+}
@@ -0,0 +1,453 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/events"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/node/config"
+)
+
+// checkConfidence is how many epochs the monitor waits before checking deals
+// at a height, so short reorgs don't cause false alerts
+const checkConfidence = 5
+
+// monitorAPI is what the monitor checks deals with, and renews them with
+// their miner
+type monitorAPI interface {
+	StateMarketStorageDeal(ctx context.Context, dealId abi.DealID, tsk types.TipSetKey) (*api.MarketDeal, error)
+	StateMinerSectors(ctx context.Context, addr address.Address, filter *abi.BitField, filterOut bool, tsk types.TipSetKey) ([]*api.ChainSectorInfo, error)
+	StateMinerFaults(ctx context.Context, addr address.Address, tsk types.TipSetKey) ([]abi.SectorNumber, error)
+	ProposeDeal(ctx context.Context, params *api.StartDealParams) (*cid.Cid, error)
+}
+
+// DealMonitor watches active storage deals on chain. It alerts when deals get
+// slashed, their sector is faulty or they are near expiry, and can renew them
+type DealMonitor struct {
+	cfg      config.DealMonitorConfig
+	proposer DealProposer
+	api      monitorAPI
+	placer   *DealPlacer
+	ds       datastore.Datastore
+
+	ctx context.Context
+	ev  *events.Events
+
+	// scheduled is the last height a check was scheduled at. Checks are
+	// applied again after reorgs, they don't schedule the next check again
+	schedLk   sync.Mutex
+	scheduled abi.ChainEpoch
+
+	lk    sync.Mutex
+	deals map[cid.Cid]*api.MonitoredDeal
+	subs  map[chan api.MonitoredDeal]struct{}
+}
+
+func NewDealMonitor(cfg config.DealMonitorConfig, ds datastore.Datastore, proposer DealProposer, placer *DealPlacer) (*DealMonitor, error) {
+	if cfg.CheckInterval == 0 {
+		return nil, xerrors.New("deal monitor check interval must be positive")
+	}
+
+	m := &DealMonitor{
+		cfg:      cfg,
+		proposer: proposer,
+		placer:   placer,
+		ds:       ds,
+
+		scheduled: -1,
+
+		deals: map[cid.Cid]*api.MonitoredDeal{},
+		subs:  map[chan api.MonitoredDeal]struct{}{},
+	}
+	m.api = &m.proposer
+
+	res, err := ds.Query(query.Query{})
+	if err != nil {
+		return nil, xerrors.Errorf("querying monitored deals: %w", err)
+	}
+	ents, err := res.Rest()
+	if err != nil {
+		return nil, xerrors.Errorf("reading monitored deals: %w", err)
+	}
+
+	for _, ent := range ents {
+		var d api.MonitoredDeal
+		if err := json.Unmarshal(ent.Value, &d); err != nil {
+			return nil, xerrors.Errorf("unmarshaling monitored deal %s: %w", ent.Key, err)
+		}
+		m.deals[d.ProposalCid] = &d
+	}
+
+	return m, nil
+}
+
+// Run starts checking deals every CheckInterval epochs
+func (m *DealMonitor) Run(ctx context.Context) error {
+	m.ctx = ctx
+	m.ev = events.NewEvents(ctx, &m.proposer)
+
+	head, err := m.proposer.ChainHead(ctx)
+	if err != nil {
+		return xerrors.Errorf("getting chain head: %w", err)
+	}
+
+	return m.schedule(head.Height())
+}
+
+// schedule checks deals at the height, unless a check at it or a later height
+// is already scheduled
+func (m *DealMonitor) schedule(h abi.ChainEpoch) error {
+	m.schedLk.Lock()
+	defer m.schedLk.Unlock()
+
+	if h <= m.scheduled {
+		return nil
+	}
+
+	err := m.ev.ChainAt(func(ctx context.Context, ts *types.TipSet, curH abi.ChainEpoch) error {
+		go m.checkAll(ts, h)
+		return nil
+	}, func(ctx context.Context, ts *types.TipSet) error {
+		// deals are checked again at the next interval anyway
+		return nil
+	}, checkConfidence, h)
+	if err != nil {
+		return err
+	}
+
+	m.scheduled = h
+	return nil
+}
+
+// checkAll checks all deals which are still live at the tipset, and
+// schedules the next check
+func (m *DealMonitor) checkAll(ts *types.TipSet, h abi.ChainEpoch) {
+	defer func() {
+		if err := m.schedule(h + abi.ChainEpoch(m.cfg.CheckInterval)); err != nil {
+			log.Errorf("scheduling deal check: %+v", err)
+		}
+	}()
+
+	if ts == nil {
+		log.Warnf("no tipset to check deals at height %d", h)
+		return
+	}
+
+	if err := m.sync(m.ctx); err != nil {
+		log.Errorf("syncing active deals: %+v", err)
+	}
+
+	m.lk.Lock()
+	var live []api.MonitoredDeal
+	for _, d := range m.deals {
+		if d.Health != api.DealExpired && d.Health != api.DealSlashed {
+			live = append(live, *d)
+		}
+	}
+	m.lk.Unlock()
+
+	sectors := map[address.Address][]*api.ChainSectorInfo{}
+	for _, d := range live {
+		prev := d.Health
+		d.Health, d.Message = m.health(m.ctx, &d, ts, sectors)
+		d.Checked = ts.Height()
+
+		m.put(d)
+
+		if d.Health != prev && d.Health != api.DealHealthy {
+			m.alert(d)
+			m.autoRenew(d)
+		}
+	}
+}
+
+// sync starts monitoring deals which became active
+func (m *DealMonitor) sync(ctx context.Context) error {
+	deals, err := m.proposer.SMDealClient.ListLocalDeals(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	for _, deal := range deals {
+		if deal.State != storagemarket.StorageDealActive {
+			continue
+		}
+		if _, ok := m.deals[deal.ProposalCid]; ok {
+			continue
+		}
+
+		d := &api.MonitoredDeal{
+			ProposalCid:   deal.ProposalCid,
+			DealID:        deal.DealID,
+			Provider:      deal.Proposal.Provider,
+			Client:        deal.Proposal.Client,
+			Data:          deal.DataRef,
+			PieceCID:      deal.Proposal.PieceCID,
+			PieceSize:     deal.Proposal.PieceSize,
+			PricePerEpoch: deal.Proposal.StoragePricePerEpoch,
+			StartEpoch:    deal.Proposal.StartEpoch,
+			EndEpoch:      deal.Proposal.EndEpoch,
+			Health:        api.DealHealthy,
+		}
+		m.deals[d.ProposalCid] = d
+		m.save(d)
+	}
+
+	return nil
+}
+
+// health returns the state of the deal at the tipset, finding its sector if
+// it isn't known yet
+func (m *DealMonitor) health(ctx context.Context, d *api.MonitoredDeal, ts *types.TipSet, sectors map[address.Address][]*api.ChainSectorInfo) (api.DealHealth, string) {
+	if ts.Height() >= d.EndEpoch {
+		return api.DealExpired, ""
+	}
+
+	md, err := m.api.StateMarketStorageDeal(ctx, d.DealID, ts.Key())
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			// slashed deals are removed from the market state
+			return api.DealSlashed, "deal was removed from the market before its end epoch"
+		}
+		log.Warnf("getting deal %d: %+v", d.DealID, err)
+		return d.Health, d.Message
+	}
+	if md.State.SlashEpoch > 0 {
+		return api.DealSlashed, ""
+	}
+
+	if !d.SectorKnown {
+		ss, ok := sectors[d.Provider]
+		if !ok {
+			ss, err = m.api.StateMinerSectors(ctx, d.Provider, nil, false, ts.Key())
+			if err != nil {
+				log.Warnf("getting sectors of %s: %+v", d.Provider, err)
+			}
+			sectors[d.Provider] = ss
+		}
+
+		for _, s := range ss {
+			for _, id := range s.Info.Info.DealIDs {
+				if id == d.DealID {
+					d.Sector, d.SectorKnown = s.ID, true
+				}
+			}
+		}
+	}
+
+	if d.SectorKnown {
+		faults, err := m.api.StateMinerFaults(ctx, d.Provider, ts.Key())
+		if err != nil {
+			log.Warnf("getting faults of %s: %+v", d.Provider, err)
+		}
+		for _, f := range faults {
+			if f == d.Sector {
+				return api.DealFaulted, ""
+			}
+		}
+	}
+
+	if d.EndEpoch-ts.Height() <= abi.ChainEpoch(m.cfg.ExpiryWarning) {
+		return api.DealExpiring, ""
+	}
+
+	return api.DealHealthy, ""
+}
+
+func (m *DealMonitor) alert(d api.MonitoredDeal) {
+	log.Warnw("storage deal needs attention", "deal", d.DealID, "proposal", d.ProposalCid, "provider", d.Provider, "health", d.Health, "message", d.Message)
+
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	for sub := range m.subs {
+		select {
+		case sub <- d:
+		default:
+			log.Warnw("deal alert subscriber too slow, dropping alert", "deal", d.DealID)
+		}
+	}
+}
+
+// autoRenew renews expiring deals with their miner and, with a max price
+// set, slashed deals and those the miner didn't renew with other miners
+func (m *DealMonitor) autoRenew(d api.MonitoredDeal) {
+	if !m.cfg.Renew || len(d.Renewals) > 0 || len(d.RenewalPlacements) > 0 {
+		return
+	}
+
+	switch d.Health {
+	case api.DealExpiring:
+		err := m.renew(m.ctx, d, d.Provider, types.EmptyInt)
+		if err == nil {
+			return
+		}
+		log.Warnw("renewing deal with its miner failed", "deal", d.DealID, "provider", d.Provider, "error", err)
+	case api.DealSlashed:
+	default:
+		return
+	}
+
+	maxPrice := types.BigInt(m.cfg.RenewMaxPrice)
+	if maxPrice.Int == nil || maxPrice.IsZero() {
+		return
+	}
+	if err := m.renew(m.ctx, d, address.Undef, maxPrice); err != nil {
+		log.Errorw("renewing deal with other miners failed", "deal", d.DealID, "error", err)
+	}
+}
+
+// Renew starts a new deal for the data of a monitored deal
+func (m *DealMonitor) Renew(ctx context.Context, proposal cid.Cid, miner address.Address, maxPrice types.BigInt) error {
+	m.lk.Lock()
+	d, ok := m.deals[proposal]
+	var dc api.MonitoredDeal
+	if ok {
+		dc = *d
+	}
+	m.lk.Unlock()
+
+	if !ok {
+		return xerrors.Errorf("deal %s isn't monitored", proposal)
+	}
+
+	if miner == address.Undef && (maxPrice.Int == nil || maxPrice.IsZero()) {
+		maxPrice = types.BigInt(m.cfg.RenewMaxPrice)
+	}
+	return m.renew(ctx, dc, miner, maxPrice)
+}
+
+func (m *DealMonitor) renew(ctx context.Context, d api.MonitoredDeal, miner address.Address, maxPrice types.BigInt) error {
+	if d.Data == nil {
+		return xerrors.New("no data reference for the deal")
+	}
+
+	duration := uint64(d.EndEpoch - d.StartEpoch)
+
+	if miner != address.Undef {
+		pcid, err := m.api.ProposeDeal(ctx, &api.StartDealParams{
+			Data:              d.Data,
+			Wallet:            d.Client,
+			Miner:             miner,
+			EpochPrice:        d.PricePerEpoch,
+			MinBlocksDuration: duration,
+		})
+		if err != nil {
+			return xerrors.Errorf("renewing with %s: %w", miner, err)
+		}
+
+		log.Infow("renewed deal", "deal", d.DealID, "provider", miner, "proposal", pcid)
+		return m.modify(d.ProposalCid, func(d *api.MonitoredDeal) {
+			d.Renewals = append(d.Renewals, *pcid)
+		})
+	}
+
+	if maxPrice.Int == nil || maxPrice.IsZero() {
+		return xerrors.New("no max price to select miners with")
+	}
+
+	pl, err := m.placer.Place(ctx, api.StartDealAutoParams{
+		Data:              d.Data,
+		Wallet:            d.Client,
+		MaxPrice:          maxPrice,
+		MinBlocksDuration: duration,
+		Replicas:          1,
+		Exclude:           []address.Address{d.Provider},
+	}, d.PieceSize)
+	if err != nil {
+		return xerrors.Errorf("renewing with selected miners: %w", err)
+	}
+
+	log.Infow("renewing deal with selected miners", "deal", d.DealID, "placement", pl.ID)
+	return m.modify(d.ProposalCid, func(d *api.MonitoredDeal) {
+		d.RenewalPlacements = append(d.RenewalPlacements, pl.ID)
+	})
+}
+
+// put stores the checked deal, keeping renewals made in the meantime
+func (m *DealMonitor) put(d api.MonitoredDeal) {
+	_ = m.modify(d.ProposalCid, func(cur *api.MonitoredDeal) {
+		d.Renewals = cur.Renewals
+		d.RenewalPlacements = cur.RenewalPlacements
+		*cur = d
+	})
+}
+
+func (m *DealMonitor) modify(proposal cid.Cid, mod func(*api.MonitoredDeal)) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	d, ok := m.deals[proposal]
+	if !ok {
+		return xerrors.Errorf("deal %s isn't monitored", proposal)
+	}
+	mod(d)
+	m.save(d)
+	return nil
+}
+
+// save stores the deal, called with the lock held
+func (m *DealMonitor) save(d *api.MonitoredDeal) {
+	b, err := json.Marshal(d)
+	if err != nil {
+		log.Errorf("marshaling monitored deal %s: %+v", d.ProposalCid, err)
+		return
+	}
+	if err := m.ds.Put(datastore.NewKey(d.ProposalCid.String()), b); err != nil {
+		log.Errorf("storing monitored deal %s: %+v", d.ProposalCid, err)
+	}
+}
+
+// List returns the monitored deals ordered by deal ID
+func (m *DealMonitor) List() []api.MonitoredDeal {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	out := make([]api.MonitoredDeal, 0, len(m.deals))
+	for _, d := range m.deals {
+		out = append(out, *d)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].DealID < out[j].DealID
+	})
+	return out
+}
+
+// Alerts returns a channel of deals which need attention, closed when ctx is
+// done
+func (m *DealMonitor) Alerts(ctx context.Context) <-chan api.MonitoredDeal {
+	ch := make(chan api.MonitoredDeal, 16)
+
+	m.lk.Lock()
+	m.subs[ch] = struct{}{}
+	m.lk.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		m.lk.Lock()
+		delete(m.subs, ch)
+		m.lk.Unlock()
+
+		close(ch)
+	}()
+
+	return ch
+}
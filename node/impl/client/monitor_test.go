@@ -0,0 +1,178 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/types/mock"
+	"github.com/filecoin-project/lotus/node/config"
+)
+
+type monitorTestAPI struct {
+	deals   map[abi.DealID]*api.MarketDeal
+	sectors map[address.Address][]*api.ChainSectorInfo
+	faults  map[address.Address][]abi.SectorNumber
+
+	proposeErr error
+	proposed   []*api.StartDealParams
+}
+
+func (a *monitorTestAPI) StateMarketStorageDeal(ctx context.Context, dealId abi.DealID, tsk types.TipSetKey) (*api.MarketDeal, error) {
+	if dealId == 99 {
+		return nil, xerrors.New("state unavailable")
+	}
+
+	d, ok := a.deals[dealId]
+	if !ok {
+		return nil, xerrors.Errorf("deal %d not found", dealId)
+	}
+	return d, nil
+}
+
+func (a *monitorTestAPI) StateMinerSectors(ctx context.Context, addr address.Address, filter *abi.BitField, filterOut bool, tsk types.TipSetKey) ([]*api.ChainSectorInfo, error) {
+	return a.sectors[addr], nil
+}
+
+func (a *monitorTestAPI) StateMinerFaults(ctx context.Context, addr address.Address, tsk types.TipSetKey) ([]abi.SectorNumber, error) {
+	return a.faults[addr], nil
+}
+
+func (a *monitorTestAPI) ProposeDeal(ctx context.Context, params *api.StartDealParams) (*cid.Cid, error) {
+	if a.proposeErr != nil {
+		return nil, a.proposeErr
+	}
+
+	a.proposed = append(a.proposed, params)
+	pcid := params.Data.Root
+	return &pcid, nil
+}
+
+func newTestMonitor(t *testing.T, cfg config.DealMonitorConfig) (*DealMonitor, *monitorTestAPI) {
+	m, err := NewDealMonitor(cfg, dssync.MutexWrap(datastore.NewMapDatastore()), DealProposer{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tapi := &monitorTestAPI{
+		deals:   map[abi.DealID]*api.MarketDeal{},
+		sectors: map[address.Address][]*api.ChainSectorInfo{},
+		faults:  map[address.Address][]abi.SectorNumber{},
+	}
+	m.api = tapi
+	m.ctx = context.TODO()
+	return m, tapi
+}
+
+func TestMonitorHealth(t *testing.T) {
+	m, tapi := newTestMonitor(t, config.DealMonitorConfig{CheckInterval: 1, ExpiryWarning: 10})
+
+	faulty, healthy := mustIDAddr(t, 1000), mustIDAddr(t, 1001)
+	ts := mock.TipSet(mock.MkBlock(mock.TipSet(mock.MkBlock(nil, 1, 1)), 1, 2))
+
+	for id := abi.DealID(3); id <= 6; id++ {
+		tapi.deals[id] = &api.MarketDeal{}
+	}
+	tapi.deals[3].State.SlashEpoch = 1
+	tapi.sectors[faulty] = []*api.ChainSectorInfo{{
+		ID:   7,
+		Info: miner.SectorOnChainInfo{Info: miner.SectorPreCommitInfo{SectorNumber: 7, DealIDs: []abi.DealID{4}}},
+	}}
+	tapi.faults[faulty] = []abi.SectorNumber{7}
+
+	for _, tc := range []struct {
+		name   string
+		deal   api.MonitoredDeal
+		expect api.DealHealth
+	}{
+		{"ended", api.MonitoredDeal{DealID: 1, EndEpoch: 1}, api.DealExpired},
+		{"removed from the market", api.MonitoredDeal{DealID: 2, EndEpoch: 100}, api.DealSlashed},
+		{"slashed", api.MonitoredDeal{DealID: 3, EndEpoch: 100}, api.DealSlashed},
+		{"faulty sector", api.MonitoredDeal{DealID: 4, Provider: faulty, EndEpoch: 100}, api.DealFaulted},
+		{"near expiry", api.MonitoredDeal{DealID: 5, Provider: healthy, EndEpoch: 11}, api.DealExpiring},
+		{"healthy", api.MonitoredDeal{DealID: 6, Provider: healthy, EndEpoch: 100}, api.DealHealthy},
+		// errors getting the deal keep the last health
+		{"state error", api.MonitoredDeal{DealID: 99, EndEpoch: 100, Health: api.DealFaulted}, api.DealFaulted},
+	} {
+		d := tc.deal
+		if h, _ := m.health(context.TODO(), &d, ts, map[address.Address][]*api.ChainSectorInfo{}); h != tc.expect {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.expect, h)
+		}
+		if tc.deal.DealID == 4 && (!d.SectorKnown || d.Sector != 7) {
+			t.Errorf("expected the sector of the deal to be found, got %d", d.Sector)
+		}
+	}
+}
+
+func TestMonitorAutoRenew(t *testing.T) {
+	_, dag := newTestDAG()
+	data := &storagemarket.DataRef{Root: addNode(t, dag, "data").Cid()}
+
+	monitored := func(m *DealMonitor, health api.DealHealth) api.MonitoredDeal {
+		d := api.MonitoredDeal{
+			ProposalCid:   addNode(t, dag, string(health)).Cid(),
+			DealID:        1,
+			Provider:      mustIDAddr(t, 1000),
+			Client:        mustIDAddr(t, 100),
+			Data:          data,
+			PricePerEpoch: types.NewInt(5),
+			StartEpoch:    10,
+			EndEpoch:      110,
+			Health:        health,
+		}
+		m.deals[d.ProposalCid] = &d
+		return d
+	}
+
+	m, tapi := newTestMonitor(t, config.DealMonitorConfig{CheckInterval: 1})
+	m.autoRenew(monitored(m, api.DealExpiring))
+	if len(tapi.proposed) != 0 {
+		t.Fatal("expected no renewals when disabled")
+	}
+
+	m, tapi = newTestMonitor(t, config.DealMonitorConfig{CheckInterval: 1, Renew: true})
+
+	// slashed deals are only renewed with selected miners
+	m.autoRenew(monitored(m, api.DealSlashed))
+	if len(tapi.proposed) != 0 {
+		t.Fatal("expected no renewal of slashed deals without a max price")
+	}
+
+	d := monitored(m, api.DealExpiring)
+	m.autoRenew(d)
+	if len(tapi.proposed) != 1 {
+		t.Fatalf("expected 1 renewal, got %d", len(tapi.proposed))
+	}
+	p := tapi.proposed[0]
+	if p.Miner != d.Provider || p.Wallet != d.Client || p.MinBlocksDuration != 100 || !p.EpochPrice.Equals(d.PricePerEpoch) {
+		t.Errorf("unexpected renewal %+v", p)
+	}
+	if r := m.deals[d.ProposalCid].Renewals; len(r) != 1 || r[0] != data.Root {
+		t.Errorf("expected the renewal to be recorded, got %v", r)
+	}
+
+	// renewed deals aren't renewed again
+	m.autoRenew(*m.deals[d.ProposalCid])
+	if len(tapi.proposed) != 1 {
+		t.Fatalf("expected no new renewal, got %d", len(tapi.proposed))
+	}
+
+	tapi.proposeErr = xerrors.New("miner offline")
+	d = monitored(m, api.DealFaulted)
+	d.Health = api.DealExpiring
+	m.autoRenew(d)
+	if r := m.deals[d.ProposalCid].Renewals; len(r) != 0 {
+		t.Errorf("expected no renewal recorded, got %v", r)
+	}
+}
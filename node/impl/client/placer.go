@@ -0,0 +1,629 @@
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	ipld "github.com/ipfs/go-ipld-format"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/markets/utils"
+)
+
+var log = logging.Logger("client")
+
+const (
+	// askTimeout limits how long querying the ask of a single miner can take
+	askTimeout = 15 * time.Second
+	// askParallel is how many miners are queried at once
+	askParallel = 32
+)
+
+// weights of the parts of the candidate score
+const (
+	priceWeight   = 0.5
+	powerWeight   = 0.2
+	successWeight = 0.3
+)
+
+// minerHistory counts how deals with a miner ended
+type minerHistory struct {
+	Succeeded int
+	Failed    int
+}
+
+// DealPlacer starts deals for replicas of data with miners it selects by
+// price, power and how past deals with them went. Deals that fail are retried
+// with the next best miner
+type DealPlacer struct {
+	proposer DealProposer
+	ds       datastore.Datastore
+
+	ctx         context.Context
+	unsubscribe func()
+
+	lk         sync.Mutex
+	next       uint64
+	placements map[uint64]*api.DealPlacement
+	// proposals maps deals which aren't active or failed yet to their
+	// placement
+	proposals map[cid.Cid]uint64
+	// filling marks placements with a running fill
+	filling map[uint64]struct{}
+}
+
+func NewDealPlacer(ds datastore.Datastore, proposer DealProposer) (*DealPlacer, error) {
+	p := &DealPlacer{
+		proposer:   proposer,
+		ds:         ds,
+		placements: map[uint64]*api.DealPlacement{},
+		proposals:  map[cid.Cid]uint64{},
+		filling:    map[uint64]struct{}{},
+	}
+
+	res, err := ds.Query(query.Query{Prefix: "/placements"})
+	if err != nil {
+		return nil, xerrors.Errorf("querying deal placements: %w", err)
+	}
+	ents, err := res.Rest()
+	if err != nil {
+		return nil, xerrors.Errorf("reading deal placements: %w", err)
+	}
+
+	for _, ent := range ents {
+		var pl api.DealPlacement
+		if err := json.Unmarshal(ent.Value, &pl); err != nil {
+			return nil, xerrors.Errorf("unmarshaling deal placement %s: %w", ent.Key, err)
+		}
+
+		p.placements[pl.ID] = &pl
+		if pl.ID >= p.next {
+			p.next = pl.ID + 1
+		}
+		for _, d := range pl.Deals {
+			if d.ProposalCid.Defined() && !dealDone(d.State) {
+				p.proposals[d.ProposalCid] = pl.ID
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// Run starts following deal state changes
+func (p *DealPlacer) Run(ctx context.Context) {
+	p.ctx = ctx
+	p.unsubscribe = p.proposer.SMDealClient.SubscribeToEvents(func(event storagemarket.ClientEvent, deal storagemarket.ClientDeal) {
+		p.update(deal.ProposalCid, deal.State, deal.Message)
+	})
+
+	// deals may have changed while the node was down
+	p.lk.Lock()
+	pending := make([]cid.Cid, 0, len(p.proposals))
+	for c := range p.proposals {
+		pending = append(pending, c)
+	}
+	p.lk.Unlock()
+
+	go func() {
+		for _, c := range pending {
+			p.refresh(ctx, c)
+		}
+	}()
+}
+
+func (p *DealPlacer) Stop() {
+	if p.unsubscribe != nil {
+		p.unsubscribe()
+	}
+}
+
+// Place selects miners for the data and starts a deal with the best ones,
+// until the requested number of replicas is reached
+func (p *DealPlacer) Place(ctx context.Context, params api.StartDealAutoParams, size abi.PaddedPieceSize) (*api.DealPlacement, error) {
+	cands, err := p.candidates(ctx, size, params.MaxPrice, params.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	if len(cands) == 0 {
+		return nil, xerrors.Errorf("no miners accept a %s piece for at most %s per GiB per epoch", types.SizeStr(types.NewInt(uint64(size))), types.FIL(params.MaxPrice))
+	}
+
+	p.lk.Lock()
+	pl := &api.DealPlacement{
+		ID:         p.next,
+		Params:     params,
+		PieceSize:  size,
+		Candidates: p.rank(cands, params.MaxPrice),
+		Created:    time.Now(),
+	}
+	p.next++
+	p.placements[pl.ID] = pl
+	p.save(pl)
+	p.lk.Unlock()
+
+	ferr := p.fill(ctx, pl.ID)
+
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	if pending(pl) == 0 {
+		if ferr != nil {
+			return nil, ferr
+		}
+		return nil, xerrors.Errorf("starting deals failed with all %d candidates", len(pl.Deals))
+	}
+
+	out := copyPlacement(pl)
+	return &out, nil
+}
+
+// List returns all placements, oldest first
+func (p *DealPlacer) List() []api.DealPlacement {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	out := make([]api.DealPlacement, 0, len(p.placements))
+	for _, pl := range p.placements {
+		out = append(out, copyPlacement(pl))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+func copyPlacement(pl *api.DealPlacement) api.DealPlacement {
+	out := *pl
+	out.Deals = append([]api.PlacedDeal(nil), pl.Deals...)
+	out.Candidates = append([]api.DealCandidate(nil), pl.Candidates...)
+	return out
+}
+
+// candidates returns the miners which can store a piece of the given size
+// for at most maxPrice per GiB per epoch
+func (p *DealPlacer) candidates(ctx context.Context, size abi.PaddedPieceSize, maxPrice types.BigInt, exclude []address.Address) ([]api.DealCandidate, error) {
+	miners, err := p.proposer.StateListMiners(ctx, types.EmptyTSK)
+	if err != nil {
+		return nil, xerrors.Errorf("listing miners: %w", err)
+	}
+
+	excluded := map[address.Address]struct{}{}
+	for _, a := range exclude {
+		excluded[a] = struct{}{}
+	}
+
+	var (
+		lk    sync.Mutex
+		out   []api.DealCandidate
+		wg    sync.WaitGroup
+		throt = make(chan struct{}, askParallel)
+	)
+
+	for _, maddr := range miners {
+		if _, ok := excluded[maddr]; ok {
+			continue
+		}
+
+		wg.Add(1)
+		throt <- struct{}{}
+		go func(maddr address.Address) {
+			defer wg.Done()
+			defer func() {
+				<-throt
+			}()
+
+			c, err := p.candidate(ctx, maddr, size, maxPrice)
+			if err != nil {
+				log.Debugw("skipping miner for deal", "miner", maddr, "reason", err)
+				return
+			}
+
+			lk.Lock()
+			out = append(out, *c)
+			lk.Unlock()
+		}(maddr)
+	}
+	wg.Wait()
+
+	return out, nil
+}
+
+func (p *DealPlacer) candidate(ctx context.Context, maddr address.Address, size abi.PaddedPieceSize, maxPrice types.BigInt) (*api.DealCandidate, error) {
+	pow, err := p.proposer.StateMinerPower(ctx, maddr, types.EmptyTSK)
+	if err != nil {
+		return nil, xerrors.Errorf("getting power: %w", err)
+	}
+	if pow.MinerPower.QualityAdjPower.IsZero() {
+		return nil, xerrors.New("miner has no power")
+	}
+
+	mi, err := p.proposer.StateMinerInfo(ctx, maddr, types.EmptyTSK)
+	if err != nil {
+		return nil, xerrors.Errorf("getting miner info: %w", err)
+	}
+	if mi.PeerId == "" {
+		return nil, xerrors.New("miner has no peer ID")
+	}
+	if size > abi.PaddedPieceSize(mi.SectorSize) {
+		return nil, xerrors.New("piece doesn't fit in a sector")
+	}
+
+	actx, cancel := context.WithTimeout(ctx, askTimeout)
+	defer cancel()
+
+	ask, err := p.proposer.SMDealClient.GetAsk(actx, utils.NewStorageProviderInfo(maddr, mi.Worker, mi.SectorSize, mi.PeerId))
+	if err != nil {
+		return nil, xerrors.Errorf("querying ask: %w", err)
+	}
+	if ask.Ask == nil {
+		return nil, xerrors.New("empty ask")
+	}
+	if ask.Ask.Price.GreaterThan(maxPrice) {
+		return nil, xerrors.Errorf("price %s above max", types.FIL(ask.Ask.Price))
+	}
+	if size < ask.Ask.MinPieceSize || size > ask.Ask.MaxPieceSize {
+		return nil, xerrors.Errorf("piece size not within %d-%d", ask.Ask.MinPieceSize, ask.Ask.MaxPieceSize)
+	}
+
+	return &api.DealCandidate{
+		Miner: maddr,
+		Peer:  mi.PeerId,
+		Price: ask.Ask.Price,
+		Power: pow.MinerPower.QualityAdjPower,
+	}, nil
+}
+
+// rank scores the candidates with the deal history of each miner and sorts
+// them best first
+func (p *DealPlacer) rank(cands []api.DealCandidate, maxPrice types.BigInt) []api.DealCandidate {
+	hist := map[address.Address]minerHistory{}
+	for _, c := range cands {
+		h, err := p.history(c.Miner)
+		if err != nil {
+			log.Warnf("getting deal history of %s: %+v", c.Miner, err)
+		}
+		hist[c.Miner] = h
+	}
+
+	return rankCandidates(cands, hist, maxPrice)
+}
+
+func rankCandidates(cands []api.DealCandidate, hist map[address.Address]minerHistory, maxPrice types.BigInt) []api.DealCandidate {
+	out := append([]api.DealCandidate(nil), cands...)
+
+	var maxPower float64
+	for _, c := range out {
+		if pow := toFloat(c.Power); pow > maxPower {
+			maxPower = pow
+		}
+	}
+	maxp := toFloat(maxPrice)
+
+	for i, c := range out {
+		var score float64
+
+		if maxp > 0 {
+			score += priceWeight * (1 - toFloat(c.Price)/maxp)
+		} else {
+			score += priceWeight
+		}
+		if maxPower > 0 {
+			score += powerWeight * toFloat(c.Power) / maxPower
+		}
+
+		// miners without history start in the middle
+		h := hist[c.Miner]
+		score += successWeight * float64(h.Succeeded+1) / float64(h.Succeeded+h.Failed+2)
+
+		out[i].Score = score
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].Miner.String() < out[j].Miner.String()
+	})
+	return out
+}
+
+func toFloat(i types.BigInt) float64 {
+	if i.Int == nil {
+		return 0
+	}
+	f, _ := new(big.Float).SetInt(i.Int).Float64()
+	return f
+}
+
+// pending counts the deals of the placement which didn't fail
+func pending(pl *api.DealPlacement) int {
+	var n int
+	for _, d := range pl.Deals {
+		if !dealFailed(d.State) {
+			n++
+		}
+	}
+	return n
+}
+
+// fill starts deals with the next candidates until enough deals are pending,
+// or there are no candidates left. Only one fill runs for a placement, others
+// return right away, as the running one checks for failed deals before
+// starting each deal.
+//
+// Errors starting a deal are local, like missing funds, and would happen with
+// any miner, so fill stops at the first one and returns it
+func (p *DealPlacer) fill(ctx context.Context, id uint64) error {
+	p.lk.Lock()
+	if _, ok := p.filling[id]; ok {
+		p.lk.Unlock()
+		return nil
+	}
+	p.filling[id] = struct{}{}
+	p.lk.Unlock()
+
+	for {
+		p.lk.Lock()
+		pl, ok := p.placements[id]
+		if !ok || pending(pl) >= pl.Params.Replicas || len(pl.Candidates) == 0 {
+			if ok && pending(pl) < pl.Params.Replicas {
+				log.Warnw("no miners left to place deal with", "placement", id, "replicas", pl.Params.Replicas, "pending", pending(pl))
+			}
+			delete(p.filling, id)
+			p.lk.Unlock()
+			return nil
+		}
+
+		c := pl.Candidates[0]
+		pl.Candidates = pl.Candidates[1:]
+		params := &api.StartDealParams{
+			Data:              pl.Params.Data,
+			Wallet:            pl.Params.Wallet,
+			Miner:             c.Miner,
+			EpochPrice:        types.BigDiv(types.BigMul(c.Price, types.NewInt(uint64(pl.PieceSize))), types.NewInt(1<<30)),
+			MinBlocksDuration: pl.Params.MinBlocksDuration,
+			DealStartEpoch:    pl.Params.DealStartEpoch,
+		}
+		p.lk.Unlock()
+
+		pcid, err := p.proposer.ProposeDeal(ctx, params)
+
+		p.lk.Lock()
+		if err != nil {
+			log.Warnw("starting deal failed", "placement", id, "miner", c.Miner, "error", err)
+			pl.Deals = append(pl.Deals, api.PlacedDeal{
+				Miner:   c.Miner,
+				State:   storagemarket.StorageDealError,
+				Message: err.Error(),
+			})
+			p.save(pl)
+			delete(p.filling, id)
+			p.lk.Unlock()
+
+			return xerrors.Errorf("starting deal with %s: %w", c.Miner, err)
+		}
+
+		pl.Deals = append(pl.Deals, api.PlacedDeal{
+			Miner:       c.Miner,
+			ProposalCid: *pcid,
+			State:       storagemarket.StorageDealUnknown,
+		})
+		p.proposals[*pcid] = id
+		p.save(pl)
+		p.lk.Unlock()
+
+		// the deal may have failed before we started tracking it
+		p.refresh(ctx, *pcid)
+	}
+}
+
+// refresh updates the deal from the state kept by the storage client
+func (p *DealPlacer) refresh(ctx context.Context, proposal cid.Cid) {
+	d, err := p.proposer.SMDealClient.GetLocalDeal(ctx, proposal)
+	if err != nil {
+		log.Warnf("getting deal %s: %+v", proposal, err)
+		return
+	}
+	p.update(proposal, d.State, d.Message)
+}
+
+func (p *DealPlacer) update(proposal cid.Cid, state storagemarket.StorageDealStatus, msg string) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	id, ok := p.proposals[proposal]
+	if !ok {
+		return
+	}
+	pl := p.placements[id]
+
+	var (
+		miner address.Address
+		local bool
+	)
+	for i := range pl.Deals {
+		if pl.Deals[i].ProposalCid.Equals(proposal) {
+			local = localDealState(pl.Deals[i].State)
+			pl.Deals[i].State = state
+			pl.Deals[i].Message = msg
+			miner = pl.Deals[i].Miner
+		}
+	}
+
+	failed := dealFailed(state)
+	if dealDone(state) {
+		delete(p.proposals, proposal)
+		// only count failures the miner is responsible for
+		if !failed || !local {
+			p.record(miner, !failed)
+		}
+	}
+	p.save(pl)
+
+	switch {
+	case failed && local:
+		log.Warnw("placed deal failed before reaching the miner, not retrying", "placement", id, "miner", miner, "message", msg)
+	case failed:
+		log.Warnw("placed deal failed, trying next miner", "placement", id, "miner", miner, "message", msg)
+		go func() {
+			if err := p.fill(p.ctx, id); err != nil {
+				log.Warnf("retrying deal placement %d: %+v", id, err)
+			}
+		}()
+	}
+}
+
+func dealFailed(state storagemarket.StorageDealStatus) bool {
+	switch state {
+	case storagemarket.StorageDealProposalNotFound,
+		storagemarket.StorageDealProposalRejected,
+		storagemarket.StorageDealFailing,
+		storagemarket.StorageDealNotFound,
+		storagemarket.StorageDealError:
+		return true
+	}
+	return false
+}
+
+// localDealState returns whether a deal in the state didn't reach the miner
+// yet, so failing from it is the client's failure
+func localDealState(state storagemarket.StorageDealStatus) bool {
+	switch state {
+	case storagemarket.StorageDealEnsureClientFunds,
+		storagemarket.StorageDealClientFunding:
+		return true
+	}
+	return false
+}
+
+// dealDone returns whether the deal won't change anymore, as far as placing
+// it is concerned
+func dealDone(state storagemarket.StorageDealStatus) bool {
+	return dealFailed(state) || state == storagemarket.StorageDealActive || state == storagemarket.StorageDealCompleted
+}
+
+func placementKey(id uint64) datastore.Key {
+	return datastore.NewKey(fmt.Sprintf("/placements/%d", id))
+}
+
+func minerKey(maddr address.Address) datastore.Key {
+	return datastore.NewKey("/miners/" + maddr.String())
+}
+
+// save stores the placement, called with the lock held
+func (p *DealPlacer) save(pl *api.DealPlacement) {
+	b, err := json.Marshal(pl)
+	if err != nil {
+		log.Errorf("marshaling deal placement %d: %+v", pl.ID, err)
+		return
+	}
+	if err := p.ds.Put(placementKey(pl.ID), b); err != nil {
+		log.Errorf("storing deal placement %d: %+v", pl.ID, err)
+	}
+}
+
+func (p *DealPlacer) history(maddr address.Address) (minerHistory, error) {
+	var h minerHistory
+
+	b, err := p.ds.Get(minerKey(maddr))
+	switch err {
+	case nil:
+		if err := json.Unmarshal(b, &h); err != nil {
+			return minerHistory{}, err
+		}
+	case datastore.ErrNotFound:
+	default:
+		return minerHistory{}, err
+	}
+	return h, nil
+}
+
+// record counts how a deal with the miner ended, called with the lock held
+func (p *DealPlacer) record(maddr address.Address, success bool) {
+	if maddr == address.Undef {
+		return
+	}
+
+	h, err := p.history(maddr)
+	if err != nil {
+		log.Errorf("getting deal history of %s: %+v", maddr, err)
+		return
+	}
+	if success {
+		h.Succeeded++
+	} else {
+		h.Failed++
+	}
+
+	b, err := json.Marshal(&h)
+	if err != nil {
+		log.Errorf("marshaling deal history of %s: %+v", maddr, err)
+		return
+	}
+	if err := p.ds.Put(minerKey(maddr), b); err != nil {
+		log.Errorf("storing deal history of %s: %+v", maddr, err)
+	}
+}
+
+// carSize estimates the size of a car file with the DAG below root
+func carSize(ctx context.Context, dag ipld.DAGService, root cid.Cid) (uint64, error) {
+	// header with the root
+	size := uint64(64)
+	seen := cid.NewSet()
+	buf := make([]byte, binary.MaxVarintLen64)
+
+	var walk func(c cid.Cid) error
+	walk = func(c cid.Cid) error {
+		if !seen.Visit(c) {
+			return nil
+		}
+
+		nd, err := dag.Get(ctx, c)
+		if err != nil {
+			return xerrors.Errorf("getting %s: %w", c, err)
+		}
+
+		n := uint64(len(c.Bytes()) + len(nd.RawData()))
+		size += n + uint64(binary.PutUvarint(buf, n))
+
+		for _, l := range nd.Links() {
+			if err := walk(l.Cid); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(root); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// paddedPieceSize returns the size of a piece holding size bytes, after
+// fr32 padding and rounding up to a power of two
+func paddedPieceSize(size uint64) abi.PaddedPieceSize {
+	padded := (size*128 + 126) / 127
+	if padded <= 128 {
+		return 128
+	}
+	return abi.PaddedPieceSize(1) << bits.Len64(padded-1)
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+func mustIDAddr(t *testing.T, id uint64) address.Address {
+	t.Helper()
+
+	a, err := address.NewIDAddress(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestRankCandidates(t *testing.T) {
+	cheap, strong, flaky := mustIDAddr(t, 1000), mustIDAddr(t, 1001), mustIDAddr(t, 1002)
+
+	cands := []api.DealCandidate{
+		{Miner: flaky, Price: types.NewInt(10), Power: types.NewInt(100)},
+		{Miner: strong, Price: types.NewInt(20), Power: types.NewInt(100)},
+		{Miner: cheap, Price: types.NewInt(10), Power: types.NewInt(50)},
+	}
+	hist := map[address.Address]minerHistory{
+		flaky: {Succeeded: 0, Failed: 8},
+	}
+
+	ranked := rankCandidates(cands, hist, types.NewInt(100))
+
+	expect := []address.Address{strong, cheap, flaky}
+	for i, c := range ranked {
+		if c.Miner != expect[i] {
+			t.Fatalf("candidate %d: expected %s, got %s", i, expect[i], c.Miner)
+		}
+	}
+	if ranked[0].Score <= ranked[1].Score {
+		t.Fatal("expected scores to decrease")
+	}
+}
+
+func TestPaddedPieceSize(t *testing.T) {
+	for in, expect := range map[uint64]abi.PaddedPieceSize{
+		0:    128,
+		127:  128,
+		128:  256,
+		1016: 1024,
+		1017: 2048,
+	} {
+		if got := paddedPieceSize(in); got != expect {
+			t.Errorf("%d bytes: expected %d, got %d", in, expect, got)
+		}
+	}
+}
+
+func TestPlacerUpdate(t *testing.T) {
+	p, err := NewDealPlacer(dssync.MutexWrap(datastore.NewMapDatastore()), DealProposer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, dag := newTestDAG()
+	prop := func(data string) cid.Cid {
+		return addNode(t, dag, data).Cid()
+	}
+	funding, rejected, active := prop("funding"), prop("rejected"), prop("active")
+	poor, picky, good := mustIDAddr(t, 1000), mustIDAddr(t, 1001), mustIDAddr(t, 1002)
+
+	// without candidates left, failed deals aren't retried
+	p.placements[0] = &api.DealPlacement{
+		Params: api.StartDealAutoParams{Replicas: 3},
+		Deals: []api.PlacedDeal{
+			{Miner: poor, ProposalCid: funding, State: storagemarket.StorageDealClientFunding},
+			{Miner: picky, ProposalCid: rejected, State: storagemarket.StorageDealUnknown},
+			{Miner: good, ProposalCid: active, State: storagemarket.StorageDealSealing},
+		},
+	}
+	for _, c := range []cid.Cid{funding, rejected, active} {
+		p.proposals[c] = 0
+	}
+
+	p.update(funding, storagemarket.StorageDealFailing, "not enough funds")
+	p.update(rejected, storagemarket.StorageDealProposalRejected, "price too low")
+	p.update(active, storagemarket.StorageDealActive, "")
+	// updates of done deals are ignored
+	p.update(active, storagemarket.StorageDealError, "")
+
+	// the client running out of funds isn't the miner's failure
+	for maddr, expect := range map[address.Address]minerHistory{
+		poor:  {},
+		picky: {Failed: 1},
+		good:  {Succeeded: 1},
+	} {
+		h, err := p.history(maddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h != expect {
+			t.Errorf("%s: expected history %+v, got %+v", maddr, expect, h)
+		}
+	}
+
+	pl := p.List()[0]
+	if pending(&pl) != 1 || pl.Deals[0].Message != "not enough funds" {
+		t.Errorf("unexpected placement %+v", pl)
+	}
+	if len(p.proposals) != 0 {
+		t.Errorf("expected no tracked proposals, got %d", len(p.proposals))
+	}
+}
+
+func TestFillRunning(t *testing.T) {
+	p, err := NewDealPlacer(dssync.MutexWrap(datastore.NewMapDatastore()), DealProposer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.placements[0] = &api.DealPlacement{
+		Params:     api.StartDealAutoParams{Replicas: 1},
+		Candidates: []api.DealCandidate{{Miner: mustIDAddr(t, 1000)}},
+	}
+	p.filling[0] = struct{}{}
+
+	// the running fill starts the deals
+	if err := p.fill(context.TODO(), 0); err != nil {
+		t.Fatal(err)
+	}
+	if pl := p.List()[0]; len(pl.Deals) != 0 || len(pl.Candidates) != 1 {
+		t.Fatalf("expected no deals started, got %+v", pl)
+	}
+}
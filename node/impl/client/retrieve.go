@@ -0,0 +1,369 @@
+package client
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-unixfs"
+	ipldprime "github.com/ipld/go-ipld-prime"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+var ssb = builder.NewSelectorSpecBuilder(basicnode.Style.Any)
+
+var (
+	// selects the entire DAG below the root
+	allSelector ipldprime.Node
+	// selects only the root block
+	rootSelector ipldprime.Node
+)
+
+func init() {
+	allSelector = allSpec().Node()
+	rootSelector = ssb.Matcher().Node()
+}
+
+func allSpec() builder.SelectorSpec {
+	return ssb.ExploreRecursive(selector.RecursionLimitNone(),
+		ssb.ExploreAll(ssb.ExploreRecursiveEdge()))
+}
+
+// retriever fetches the parts of a DAG missing from the local blockstore, so
+// interrupted retrievals resume and only the data actually needed gets paid
+// for. Missing sub-DAGs are retrieved with a single deal selecting them
+type retriever struct {
+	a     *API
+	order api.RetrievalOrder
+	ppb   types.BigInt
+
+	// local only reads blocks from the client blockstore
+	local ipld.DAGService
+
+	// deal makes a retrieval deal for the selected part of the DAG at root,
+	// it's retrieve outside of tests
+	deal func(ctx context.Context, root cid.Cid, sel ipldprime.Node, size uint64) error
+}
+
+// selection selects parts of a DAG to retrieve
+type selection struct {
+	spec builder.SelectorSpec
+	// size is how many bytes the provider sends for the selection, 0 if
+	// unknown
+	size uint64
+	// missing counts the selected sub-DAGs which aren't stored locally
+	missing int
+}
+
+// linkSelections collects selections below the links of a locally stored
+// dag-pb node
+type linkSelections struct {
+	size    uint64
+	unknown bool
+	missing int
+	links   []builder.SelectorSpec
+}
+
+func newLinkSelections(nd ipld.Node) *linkSelections {
+	// the provider sends the node again when traversing it
+	return &linkSelections{size: uint64(len(nd.RawData()))}
+}
+
+func (ls *linkSelections) add(i int, s *selection) {
+	if s == nil {
+		return
+	}
+
+	ls.missing += s.missing
+	ls.size += s.size
+	if s.size == 0 {
+		ls.unknown = true
+	}
+
+	spec := s.spec
+	ls.links = append(ls.links, ssb.ExploreIndex(i, ssb.ExploreFields(func(efsb builder.ExploreFieldsSpecBuilder) {
+		efsb.Insert("Hash", spec)
+	})))
+}
+
+// selection returns nil if nothing below the links was selected
+func (ls *linkSelections) selection() *selection {
+	if len(ls.links) == 0 {
+		return nil
+	}
+
+	links := ls.links[0]
+	if len(ls.links) > 1 {
+		links = ssb.ExploreUnion(ls.links...)
+	}
+
+	out := &selection{
+		spec: ssb.ExploreFields(func(efsb builder.ExploreFieldsSpecBuilder) {
+			efsb.Insert("Links", links)
+		}),
+		size:    ls.size,
+		missing: ls.missing,
+	}
+	if ls.unknown {
+		out.size = 0
+	}
+	return out
+}
+
+// missing walks the local DAG below c, and selects the sub-DAGs which aren't
+// stored locally. It returns nil if nothing is missing
+func (r *retriever) missing(ctx context.Context, c cid.Cid, size uint64, seen *cid.Set) (*selection, error) {
+	if !seen.Visit(c) {
+		return nil, nil
+	}
+
+	nd, err := r.local.Get(ctx, c)
+	if err == ipld.ErrNotFound {
+		return &selection{spec: allSpec(), size: size, missing: 1}, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("getting node %s: %w", c, err)
+	}
+
+	ls := newLinkSelections(nd)
+	for i, l := range nd.Links() {
+		s, err := r.missing(ctx, l.Cid, l.Size, seen)
+		if err != nil {
+			return nil, err
+		}
+		ls.add(i, s)
+	}
+
+	sel := ls.selection()
+	if _, ok := nd.(*merkledag.ProtoNode); sel != nil && !ok {
+		// only links of dag-pb nodes can be selected, retrieve the whole
+		// sub-DAG again
+		return &selection{spec: allSpec(), size: size, missing: sel.missing}, nil
+	}
+	return sel, nil
+}
+
+// fetchAll retrieves everything below root which isn't stored locally yet
+func (r *retriever) fetchAll(ctx context.Context, root cid.Cid, size uint64) error {
+	sel, err := r.missing(ctx, root, size, cid.NewSet())
+	if err != nil {
+		return xerrors.Errorf("walking local dag: %w", err)
+	}
+	if sel == nil {
+		return nil
+	}
+
+	if err := r.deal(ctx, root, sel.spec.Node(), sel.size); err != nil {
+		return err
+	}
+
+	// a retrieval which completed without sending all blocks is an error
+	sel, err = r.missing(ctx, root, size, cid.NewSet())
+	if err != nil {
+		return xerrors.Errorf("walking local dag: %w", err)
+	}
+	if sel != nil {
+		return xerrors.Errorf("%d sub-DAGs still missing after retrieval", sel.missing)
+	}
+
+	return nil
+}
+
+// node returns the node from the local blockstore, retrieving only its block
+// if it's missing
+func (r *retriever) node(ctx context.Context, c cid.Cid, size uint64) (ipld.Node, error) {
+	nd, err := r.local.Get(ctx, c)
+	if err == ipld.ErrNotFound {
+		if err := r.deal(ctx, c, rootSelector, size); err != nil {
+			return nil, err
+		}
+		nd, err = r.local.Get(ctx, c)
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("getting node %s: %w", c, err)
+	}
+	return nd, nil
+}
+
+// resolvePath follows unixfs link names from root, retrieving only the
+// directory nodes along the path
+func (r *retriever) resolvePath(ctx context.Context, root cid.Cid, path string) (cid.Cid, error) {
+	size := r.order.Size
+	for _, seg := range strings.Split(strings.Trim(path, "/"), "/") {
+		if seg == "" {
+			continue
+		}
+
+		nd, err := r.node(ctx, root, size)
+		if err != nil {
+			return cid.Undef, err
+		}
+
+		pn, ok := nd.(*merkledag.ProtoNode)
+		if !ok {
+			return cid.Undef, xerrors.Errorf("resolving %q: %s is not a unixfs directory", seg, root)
+		}
+
+		lnk, err := pn.GetNodeLink(seg)
+		if err != nil {
+			return cid.Undef, xerrors.Errorf("resolving %q in %s: %w", seg, root, err)
+		}
+		root, size = lnk.Cid, lnk.Size
+	}
+
+	return root, nil
+}
+
+// fetchRange retrieves the parts of the unixfs file at root needed to read
+// length bytes at offset, a zero length reads to the end of the file. Nodes
+// at the edges of the range are retrieved one by one to find which children
+// are in the range, the sub-DAGs in the range with a single deal
+func (r *retriever) fetchRange(ctx context.Context, root cid.Cid, offset, length uint64) error {
+	nd, err := r.node(ctx, root, r.order.Size)
+	if err != nil {
+		return err
+	}
+
+	if pn, ok := nd.(*merkledag.ProtoNode); ok {
+		fsn, err := unixfs.FSNodeFromBytes(pn.Data())
+		if err != nil {
+			return xerrors.Errorf("parsing unixfs node %s: %w", root, err)
+		}
+		if t := fsn.Type(); t != unixfs.TFile && t != unixfs.TRaw {
+			return xerrors.Errorf("byte ranges can only be retrieved from unixfs files, %s is %s", root, t)
+		}
+	}
+
+	sel, err := r.selectRange(ctx, nd, offset, length)
+	if err != nil {
+		return err
+	}
+	if sel == nil {
+		return nil
+	}
+
+	if err := r.deal(ctx, root, sel.spec.Node(), sel.size); err != nil {
+		return err
+	}
+
+	sel, err = r.selectRange(ctx, nd, offset, length)
+	if err != nil {
+		return err
+	}
+	if sel != nil {
+		return xerrors.Errorf("%d sub-DAGs still missing after retrieval", sel.missing)
+	}
+	return nil
+}
+
+// selectRange selects the sub-DAGs of the unixfs file node needed to read
+// length bytes at offset which aren't stored locally, retrieving the nodes
+// at the edges of the range
+func (r *retriever) selectRange(ctx context.Context, nd ipld.Node, offset, length uint64) (*selection, error) {
+	end := ^uint64(0)
+	if length > 0 {
+		end = offset + length
+	}
+	seen := cid.NewSet()
+
+	var walk func(nd ipld.Node, start uint64) (*selection, error)
+	walk = func(nd ipld.Node, start uint64) (*selection, error) {
+		pn, ok := nd.(*merkledag.ProtoNode)
+		if !ok {
+			// raw leaf, all data is in the block
+			return nil, nil
+		}
+
+		fsn, err := unixfs.FSNodeFromBytes(pn.Data())
+		if err != nil {
+			return nil, xerrors.Errorf("parsing unixfs node %s: %w", pn.Cid(), err)
+		}
+		if fsn.NumChildren() != len(pn.Links()) {
+			return nil, xerrors.Errorf("unixfs node %s has %d block sizes for %d links", pn.Cid(), fsn.NumChildren(), len(pn.Links()))
+		}
+
+		ls := newLinkSelections(pn)
+		pos := start + uint64(len(fsn.Data()))
+		for i, l := range pn.Links() {
+			cstart, cend := pos, pos+fsn.BlockSize(i)
+			pos = cend
+
+			if cend <= offset || cstart >= end {
+				continue
+			}
+
+			var s *selection
+			if cstart >= offset && cend <= end {
+				// whole child is in the range
+				s, err = r.missing(ctx, l.Cid, l.Size, seen)
+			} else {
+				var child ipld.Node
+				child, err = r.node(ctx, l.Cid, l.Size)
+				if err != nil {
+					return nil, err
+				}
+				s, err = walk(child, cstart)
+			}
+			if err != nil {
+				return nil, err
+			}
+			ls.add(i, s)
+		}
+		return ls.selection(), nil
+	}
+
+	return walk(nd, 0)
+}
+
+// retrieve makes a retrieval deal for the selected part of the DAG at root,
+// and waits for it to complete
+func (r *retriever) retrieve(ctx context.Context, root cid.Cid, sel ipldprime.Node, size uint64) error {
+	if size == 0 || size > r.order.Size {
+		size = r.order.Size
+	}
+	total := types.BigMul(r.ppb, types.NewInt(size))
+
+	retrievalResult := make(chan error, 1)
+
+	unsubscribe := r.a.Retrieval.SubscribeToEvents(func(event retrievalmarket.ClientEvent, state retrievalmarket.ClientDealState) {
+		if state.PayloadCID.Equals(root) {
+			switch state.Status {
+			case retrievalmarket.DealStatusFailed, retrievalmarket.DealStatusErrored:
+				retrievalResult <- xerrors.Errorf("Retrieval Error: %s", state.Message)
+			case retrievalmarket.DealStatusCompleted:
+				retrievalResult <- nil
+			}
+		}
+	})
+	defer unsubscribe()
+
+	r.a.Retrieval.Retrieve(
+		ctx,
+		root,
+		retrievalmarket.NewParamsV1(r.ppb, r.order.PaymentInterval, r.order.PaymentIntervalIncrease, sel, nil),
+		total,
+		r.order.MinerPeerID,
+		r.order.Client,
+		r.order.Miner)
+
+	select {
+	case <-ctx.Done():
+		return xerrors.New("Retrieval Timed Out")
+	case err := <-retrievalResult:
+		if err != nil {
+			return xerrors.Errorf("retrieving %s: %w", root, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,315 @@
+package client
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-unixfs"
+	ipldprime "github.com/ipld/go-ipld-prime"
+	"github.com/libp2p/go-libp2p-core/test"
+
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/markets/retrievaladapter"
+)
+
+type testDeal struct {
+	root     cid.Cid
+	size     uint64
+	rootOnly bool
+}
+
+// testRetrieval retrieves blocks from a remote DAG into the local one. Deals
+// for more than the root block get the whole DAG below it
+type testRetrieval struct {
+	remote ipld.DAGService
+	local  blockstore.Blockstore
+
+	deals []testDeal
+}
+
+func (tr *testRetrieval) deal(ctx context.Context, root cid.Cid, sel ipldprime.Node, size uint64) error {
+	rootOnly := reflect.DeepEqual(sel, rootSelector)
+	tr.deals = append(tr.deals, testDeal{root: root, size: size, rootOnly: rootOnly})
+
+	var copyDAG func(c cid.Cid) error
+	copyDAG = func(c cid.Cid) error {
+		nd, err := tr.remote.Get(ctx, c)
+		if err != nil {
+			return err
+		}
+		if err := tr.local.Put(nd); err != nil {
+			return err
+		}
+		if rootOnly {
+			return nil
+		}
+
+		for _, l := range nd.Links() {
+			if err := copyDAG(l.Cid); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return copyDAG(root)
+}
+
+func newTestRetriever() (*retriever, *testRetrieval, blockstore.Blockstore) {
+	_, remote := newTestDAG()
+	lbs, local := newTestDAG()
+
+	tr := &testRetrieval{remote: remote, local: lbs}
+	r := &retriever{
+		order: api.RetrievalOrder{Size: 1000},
+		local: local,
+		deal:  tr.deal,
+	}
+	return r, tr, lbs
+}
+
+func putNodes(t *testing.T, bs blockstore.Blockstore, nds ...ipld.Node) {
+	t.Helper()
+
+	for _, nd := range nds {
+		if err := bs.Put(nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// addFile stores a unixfs file node with the chunks
+func addFile(t *testing.T, dag ipld.DAGService, chunks ...ipld.Node) ipld.Node {
+	t.Helper()
+
+	fsn := unixfs.NewFSNode(unixfs.TFile)
+	pn := new(merkledag.ProtoNode)
+	for _, c := range chunks {
+		if err := pn.AddNodeLink("", c); err != nil {
+			t.Fatal(err)
+		}
+
+		fsn.AddBlockSize(fileSize(t, c))
+	}
+
+	b, err := fsn.GetBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pn.SetData(b)
+
+	if err := dag.Add(context.TODO(), pn); err != nil {
+		t.Fatal(err)
+	}
+	return pn
+}
+
+func fileSize(t *testing.T, nd ipld.Node) uint64 {
+	t.Helper()
+
+	pn, ok := nd.(*merkledag.ProtoNode)
+	if !ok {
+		return uint64(len(nd.RawData()))
+	}
+
+	fsn, err := unixfs.FSNodeFromBytes(pn.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fsn.FileSize()
+}
+
+func rawSize(nds ...ipld.Node) uint64 {
+	var out uint64
+	for _, nd := range nds {
+		out += uint64(len(nd.RawData()))
+	}
+	return out
+}
+
+func TestRetrieverMissing(t *testing.T) {
+	r, tr, lbs := newTestRetriever()
+
+	a1, a2, b := addNode(t, tr.remote, "a1"), addNode(t, tr.remote, "a2"), addNode(t, tr.remote, "b")
+	a := addNode(t, tr.remote, "a", a1, a2)
+	root := addNode(t, tr.remote, "root", a, b)
+
+	sel, err := r.missing(context.TODO(), root.Cid(), 100, cid.NewSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sel == nil || sel.missing != 1 || sel.size != 100 {
+		t.Fatalf("expected the whole DAG to be selected, got %+v", sel)
+	}
+
+	putNodes(t, lbs, root, a, a1)
+
+	sel, err = r.missing(context.TODO(), root.Cid(), 100, cid.NewSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// stored nodes along the way are sent again
+	if expect := rawSize(root, a, a2, b); sel == nil || sel.missing != 2 || sel.size != expect {
+		t.Fatalf("expected 2 missing sub-DAGs of %d bytes, got %+v", expect, sel)
+	}
+
+	if err := r.fetchAll(context.TODO(), root.Cid(), 100); err != nil {
+		t.Fatal(err)
+	}
+	if len(tr.deals) != 1 || tr.deals[0].root != root.Cid() || tr.deals[0].rootOnly {
+		t.Fatalf("expected a single deal for the missing sub-DAGs, got %+v", tr.deals)
+	}
+	for _, nd := range []ipld.Node{a2, b} {
+		mustHave(t, lbs, nd, true)
+	}
+
+	if err := r.fetchAll(context.TODO(), root.Cid(), 100); err != nil {
+		t.Fatal(err)
+	}
+	if len(tr.deals) != 1 {
+		t.Fatalf("expected no deal for a complete DAG, got %d", len(tr.deals))
+	}
+}
+
+func TestRetrieverResolvePath(t *testing.T) {
+	r, tr, lbs := newTestRetriever()
+
+	file := addNode(t, tr.remote, "file")
+	other := addNode(t, tr.remote, "other", addNode(t, tr.remote, "big"))
+
+	docs := merkledag.NodeWithData(unixfs.FolderPBData())
+	if err := docs.AddNodeLink("file", file); err != nil {
+		t.Fatal(err)
+	}
+	root := merkledag.NodeWithData(unixfs.FolderPBData())
+	if err := root.AddNodeLink("docs", docs); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.AddNodeLink("other", other); err != nil {
+		t.Fatal(err)
+	}
+	for _, nd := range []ipld.Node{docs, root} {
+		if err := tr.remote.Add(context.TODO(), nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := r.resolvePath(context.TODO(), root.Cid(), "/docs/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != file.Cid() {
+		t.Fatalf("expected %s, got %s", file.Cid(), c)
+	}
+
+	// only the directories along the path are retrieved
+	if len(tr.deals) != 2 || !tr.deals[0].rootOnly || !tr.deals[1].rootOnly || tr.deals[1].root != docs.Cid() {
+		t.Fatalf("unexpected deals %+v", tr.deals)
+	}
+	mustHave(t, lbs, file, false)
+	mustHave(t, lbs, other, false)
+
+	if _, err := r.resolvePath(context.TODO(), root.Cid(), "/docs/missing"); err == nil {
+		t.Fatal("expected error resolving a missing name")
+	}
+}
+
+func TestRetrieverRange(t *testing.T) {
+	r, tr, lbs := newTestRetriever()
+
+	var chunks []ipld.Node
+	for _, d := range []string{"0000000000", "1111111111", "2222222222", "3333333333"} {
+		chunks = append(chunks, addNode(t, tr.remote, d))
+	}
+	inner0 := addFile(t, tr.remote, chunks[0], chunks[1])
+	inner1 := addFile(t, tr.remote, chunks[2], chunks[3])
+	root := addFile(t, tr.remote, inner0, inner1)
+
+	putNodes(t, lbs, root, inner0, inner1)
+
+	// bytes 10-29 are the whole second and third chunk
+	sel, err := r.selectRange(context.TODO(), root, 10, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := rawSize(root, inner0, inner1, chunks[1], chunks[2]); sel == nil || sel.missing != 2 || sel.size != expect {
+		t.Fatalf("expected 2 missing chunks with %d bytes, got %+v", expect, sel)
+	}
+	if len(tr.deals) != 0 {
+		t.Fatalf("expected no deals for stored edge nodes, got %+v", tr.deals)
+	}
+
+	// bytes 15-24 are in parts of the second and third chunk, which are
+	// retrieved one by one
+	if err := r.fetchRange(context.TODO(), root.Cid(), 15, 10); err != nil {
+		t.Fatal(err)
+	}
+	if len(tr.deals) != 2 || !tr.deals[0].rootOnly || tr.deals[0].root != chunks[1].Cid() || tr.deals[1].root != chunks[2].Cid() {
+		t.Fatalf("unexpected deals %+v", tr.deals)
+	}
+	mustHave(t, lbs, chunks[0], false)
+	mustHave(t, lbs, chunks[3], false)
+
+	// the rest of the file is retrieved with one deal
+	if err := r.fetchRange(context.TODO(), root.Cid(), 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(tr.deals) != 3 || tr.deals[2].rootOnly || tr.deals[2].root != root.Cid() || tr.deals[2].size != rawSize(root, inner0, inner1, chunks[0], chunks[3]) {
+		t.Fatalf("unexpected deals %+v", tr.deals)
+	}
+	mustHave(t, lbs, chunks[0], true)
+	mustHave(t, lbs, chunks[3], true)
+}
+
+func TestClientListRetrievals(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tracker := retrievaladapter.NewDealTracker(dssync.MutexWrap(datastore.NewMapDatastore()))
+	a := &API{RetrievalTracker: tracker}
+
+	updates, err := a.ClientGetRetrievalUpdates(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prov := test.RandPeerIDFatal(t)
+	state := retrievalmarket.ClientDealState{
+		DealProposal: retrievalmarket.DealProposal{ID: 7},
+		Status:       retrievalmarket.DealStatusNew,
+		Sender:       prov,
+	}
+	tracker.ClientEvent(retrievalmarket.ClientEventOpen, state)
+
+	state.Status = retrievalmarket.DealStatusFailed
+	state.Message = "provider went away"
+	tracker.ClientEvent(retrievalmarket.ClientEventReadDealResponseErrored, state)
+
+	for _, status := range []retrievalmarket.DealStatus{retrievalmarket.DealStatusNew, retrievalmarket.DealStatusFailed} {
+		select {
+		case r := <-updates:
+			if r.ID != 7 || r.Status != status {
+				t.Fatalf("expected deal 7 in %d, got %+v", status, r)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for update")
+		}
+	}
+
+	deals, err := a.ClientListRetrievals(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deals) != 1 || deals[0].Peer != prov || deals[0].Status != retrievalmarket.DealStatusFailed || deals[0].Message != "provider went away" {
+		t.Fatalf("expected the failed deal to be listed, got %+v", deals)
+	}
+}
@@ -2,6 +2,7 @@ package common
 
 import (
 	"context"
+	"time"
 
 	"github.com/filecoin-project/lotus/node/modules/lp2p"
 
@@ -9,8 +10,10 @@ import (
 
 	"github.com/gbrlsnchs/jwt/v3"
 	"github.com/libp2p/go-libp2p-core/host"
+	metrics "github.com/libp2p/go-libp2p-core/metrics"
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
+	protocol "github.com/libp2p/go-libp2p-core/protocol"
 	swarm "github.com/libp2p/go-libp2p-swarm"
 	ma "github.com/multiformats/go-multiaddr"
 	"go.uber.org/fx"
@@ -18,6 +21,8 @@ import (
 
 	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/lib/conngater"
+	"github.com/filecoin-project/lotus/lib/peerrep"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
 )
 
@@ -27,6 +32,9 @@ type CommonAPI struct {
 	APISecret *dtypes.APIAlg
 	Host      host.Host
 	Router    lp2p.BaseIpfsRouting
+	PeerRep   *peerrep.PeerRep
+	Reporter  metrics.Reporter
+	Gater     *conngater.Gater
 }
 
 type jwtPayload struct {
@@ -93,6 +101,60 @@ func (a *CommonAPI) NetFindPeer(ctx context.Context, p peer.ID) (peer.AddrInfo,
 	return a.Router.FindPeer(ctx, p)
 }
 
+func (a *CommonAPI) NetPeerScores(context.Context) ([]api.PeerScore, error) {
+	scores := a.PeerRep.Scores()
+	out := make([]api.PeerScore, len(scores))
+	for i, s := range scores {
+		out[i] = api.PeerScore{
+			ID:        s.ID,
+			Score:     s.Score,
+			Protected: s.Protected,
+			Events:    s.Events,
+		}
+	}
+
+	return out, nil
+}
+
+func (a *CommonAPI) NetBandwidthStats(ctx context.Context) (metrics.Stats, error) {
+	return a.Reporter.GetBandwidthTotals(), nil
+}
+
+func (a *CommonAPI) NetBandwidthStatsByPeer(ctx context.Context) (map[string]metrics.Stats, error) {
+	out := make(map[string]metrics.Stats)
+	for p, s := range a.Reporter.GetBandwidthByPeer() {
+		out[p.String()] = s
+	}
+	return out, nil
+}
+
+func (a *CommonAPI) NetBandwidthStatsByProtocol(ctx context.Context) (map[protocol.ID]metrics.Stats, error) {
+	return a.Reporter.GetBandwidthByProtocol(), nil
+}
+
+func (a *CommonAPI) NetBlockAdd(ctx context.Context, target string, dur time.Duration, reason string) error {
+	return a.Gater.Add(target, dur, reason)
+}
+
+func (a *CommonAPI) NetBlockRemove(ctx context.Context, target string) error {
+	return a.Gater.Remove(target)
+}
+
+func (a *CommonAPI) NetBlockList(ctx context.Context) ([]api.NetBlockRule, error) {
+	rules := a.Gater.List()
+	out := make([]api.NetBlockRule, len(rules))
+	for i, r := range rules {
+		out[i] = api.NetBlockRule{
+			Type:    string(r.Type),
+			Target:  r.Target,
+			Reason:  r.Reason,
+			Created: r.Created,
+			Expires: r.Expires,
+		}
+	}
+	return out, nil
+}
+
 func (a *CommonAPI) ID(context.Context) (peer.ID, error) {
 	return a.Host.ID(), nil
 }
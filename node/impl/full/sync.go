@@ -38,8 +38,12 @@ func (a *SyncAPI) SyncState(ctx context.Context) (*api.SyncState, error) {
 			Start:   ss.Start,
 			End:     ss.End,
 			Message: ss.Message,
+
+			LastProgress: ss.LastProgress,
 		})
 	}
+
+	out.Recoveries = a.Syncer.Recoveries()
 	return out, nil
 }
 
@@ -3,28 +3,38 @@ package impl
 import (
 	"context"
 	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/ipfs/go-cid"
 	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/retrievalmarket"
 	storagemarket "github.com/filecoin-project/go-fil-markets/storagemarket"
 	sectorstorage "github.com/filecoin-project/sector-storage"
 	"github.com/filecoin-project/sector-storage/ffiwrapper"
 	"github.com/filecoin-project/sector-storage/stores"
 	"github.com/filecoin-project/sector-storage/storiface"
 	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
 	sealing "github.com/filecoin-project/storage-fsm"
 
 	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/api/apistruct"
 	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/markets/dealfilter"
+	"github.com/filecoin-project/lotus/markets/retrievaladapter"
+	"github.com/filecoin-project/lotus/markets/retrievalpolicy"
 	"github.com/filecoin-project/lotus/miner"
 	"github.com/filecoin-project/lotus/node/impl/common"
 	"github.com/filecoin-project/lotus/storage"
+	"github.com/filecoin-project/lotus/storage/sealworker"
 	"github.com/filecoin-project/lotus/storage/sectorblocks"
 )
 
@@ -34,11 +44,20 @@ type StorageMinerAPI struct {
 	ProofsConfig *ffiwrapper.Config
 	SectorBlocks *sectorblocks.SectorBlocks
 
-	StorageProvider storagemarket.StorageProvider
-	Miner           *storage.Miner
-	BlockMiner      *miner.Miner
-	Full            api.FullNode
-	StorageMgr      *sectorstorage.Manager `optional:"true"`
+	StorageProvider   storagemarket.StorageProvider
+	RetrievalProvider retrievalmarket.RetrievalProvider
+	RetrievalPolicy   *retrievalpolicy.Policy
+	RetrievalTracker  *retrievaladapter.DealTracker
+	DealFilter        *dealfilter.Filter
+	Miner             *storage.Miner
+	Scrubber          *storage.Scrubber
+	SectorRemover     storage.SectorRemover
+	SectorNotifier    *storage.SectorNotifier
+	PoStScheduler     *storage.WindowPoStScheduler
+	BlockMiner        *miner.Miner
+	Full              api.FullNode
+	StorageMgr        *sectorstorage.Manager `optional:"true"`
+	WorkerTracker     *sealworker.Tracker
 	*stores.Index
 }
 
@@ -49,7 +68,7 @@ func (sm *StorageMinerAPI) ServeRemote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sm.StorageMgr.ServeHTTP(w, r)
+	storage.RemoteStatHandler(sm.StorageMgr, sm.StorageMgr.ServeHTTP)(w, r)
 }
 
 func (sm *StorageMinerAPI) WorkerStats(context.Context) (map[uint64]storiface.WorkerStats, error) {
@@ -68,6 +87,10 @@ func (sm *StorageMinerAPI) MiningBase(ctx context.Context) (*types.TipSet, error
 	return mb.TipSet, nil
 }
 
+func (sm *StorageMinerAPI) MinerRoundsHistory(ctx context.Context, n int) ([]api.MiningRound, error) {
+	return sm.BlockMiner.RoundsHistory(n)
+}
+
 func (sm *StorageMinerAPI) ActorSectorSize(ctx context.Context, addr address.Address) (abi.SectorSize, error) {
 	mi, err := sm.Full.StateMinerInfo(ctx, addr, types.EmptyTSK)
 	if err != nil {
@@ -80,6 +103,10 @@ func (sm *StorageMinerAPI) PledgeSector(ctx context.Context) error {
 	return sm.Miner.PledgeSector()
 }
 
+func (sm *StorageMinerAPI) PledgeSectors(ctx context.Context, n int) error {
+	return sm.Miner.PledgeSectors(n)
+}
+
 func (sm *StorageMinerAPI) SectorsStatus(ctx context.Context, sid abi.SectorNumber) (api.SectorInfo, error) {
 	info, err := sm.Miner.GetSectorInfo(sid)
 	if err != nil {
@@ -168,6 +195,58 @@ func (sm *StorageMinerAPI) SectorsUpdate(ctx context.Context, id abi.SectorNumbe
 	return sm.Miner.ForceSectorState(ctx, id, sealing.SectorState(state))
 }
 
+func (sm *StorageMinerAPI) SectorsExtend(ctx context.Context, sectors []abi.SectorNumber, newExpiration abi.ChainEpoch) ([]cid.Cid, error) {
+	return sm.Miner.ExtendSectors(ctx, sectors, newExpiration)
+}
+
+func (sm *StorageMinerAPI) SectorsTerminateFee(ctx context.Context, sectors []abi.SectorNumber) (types.BigInt, error) {
+	return sm.Miner.TerminationFee(ctx, sectors)
+}
+
+func (sm *StorageMinerAPI) SectorsTerminate(ctx context.Context, sectors []abi.SectorNumber) (cid.Cid, error) {
+	return sm.Miner.TerminateSectors(ctx, sectors)
+}
+
+func (sm *StorageMinerAPI) SectorsInactive(ctx context.Context) ([]abi.SectorNumber, error) {
+	return sm.Miner.InactiveSectors(ctx)
+}
+
+func (sm *StorageMinerAPI) SectorsRemove(ctx context.Context, sectors []abi.SectorNumber) error {
+	for _, snum := range sectors {
+		if err := sm.Miner.CheckRemovable(ctx, snum); err != nil {
+			return err
+		}
+	}
+
+	for _, snum := range sectors {
+		if err := sm.Miner.RemoveSector(ctx, sm.Index, sm.SectorRemover, snum); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (sm *StorageMinerAPI) SectorsNotify(ctx context.Context) (<-chan api.SectorChange, error) {
+	return sm.SectorNotifier.Subscribe(ctx), nil
+}
+
+func (sm *StorageMinerAPI) SectorsCheck(ctx context.Context, sectors []abi.SectorNumber, opts api.ScrubOptions) ([]api.SectorCheck, error) {
+	return sm.Scrubber.Check(ctx, sectors, opts)
+}
+
+func (sm *StorageMinerAPI) SectorsScrubStatus(context.Context) (api.ScrubStatus, error) {
+	return sm.Scrubber.Status(), nil
+}
+
+func (sm *StorageMinerAPI) ProvingHistory(context.Context) ([]api.WindowPoStAttempt, error) {
+	return sm.PoStScheduler.History()
+}
+
+func (sm *StorageMinerAPI) ProvingDryRun(ctx context.Context, deadline uint64) (api.WindowPoStAttempt, error) {
+	return sm.PoStScheduler.DryRun(ctx, deadline)
+}
+
 func (sm *StorageMinerAPI) WorkerConnect(ctx context.Context, url string) error {
 	w, err := connectRemoteWorker(ctx, sm, url)
 	if err != nil {
@@ -176,7 +255,30 @@ func (sm *StorageMinerAPI) WorkerConnect(ctx context.Context, url string) error
 
 	log.Infof("Connected to a remote worker at %s", url)
 
-	return sm.StorageMgr.AddWorker(ctx, w)
+	limits, err := w.Limits(ctx)
+	if err != nil {
+		log.Warnf("getting limits of worker %s, assuming none: %s", url, err)
+		limits = api.WorkerLimits{}
+	}
+
+	tw, err := sm.WorkerTracker.Wrap(ctx, url, w, limits)
+	if err != nil {
+		return xerrors.Errorf("tracking worker: %w", err)
+	}
+
+	return sm.StorageMgr.AddWorker(ctx, tw)
+}
+
+func (sm *StorageMinerAPI) WorkerTasks(context.Context) (map[string]api.WorkerTasks, error) {
+	return sm.WorkerTracker.Tasks(), nil
+}
+
+func (sm *StorageMinerAPI) WorkerJobs(context.Context) ([]api.WorkerJob, error) {
+	return sm.WorkerTracker.Jobs(), nil
+}
+
+func (sm *StorageMinerAPI) SealingAbort(ctx context.Context, job uint64) error {
+	return sm.WorkerTracker.Abort(job)
 }
 
 func (sm *StorageMinerAPI) MarketImportDealData(ctx context.Context, propCid cid.Cid, path string) error {
@@ -186,9 +288,39 @@ func (sm *StorageMinerAPI) MarketImportDealData(ctx context.Context, propCid cid
 	}
 	defer fi.Close()
 
+	if err := sm.checkDeal(ctx, propCid); err != nil {
+		return err
+	}
+
 	return sm.StorageProvider.ImportDataForDeal(ctx, propCid, fi)
 }
 
+// checkDeal runs the deal filter on deals imported offline
+func (sm *StorageMinerAPI) checkDeal(ctx context.Context, propCid cid.Cid) error {
+	deals, err := sm.StorageProvider.ListLocalDeals()
+	if err != nil {
+		return xerrors.Errorf("listing deals: %w", err)
+	}
+
+	head, err := sm.Full.ChainHead(ctx)
+	if err != nil {
+		return xerrors.Errorf("getting chain head: %w", err)
+	}
+
+	for _, deal := range deals {
+		if !deal.ProposalCid.Equals(propCid) {
+			continue
+		}
+
+		if err := sm.DealFilter.Check(ctx, deal, head.Height()); err != nil {
+			return xerrors.Errorf("deal %s rejected: %w", propCid, err)
+		}
+		return nil
+	}
+
+	return xerrors.Errorf("deal %s not found", propCid)
+}
+
 func (sm *StorageMinerAPI) MarketListDeals(ctx context.Context) ([]storagemarket.StorageDeal, error) {
 	return sm.StorageProvider.ListDeals(ctx)
 }
@@ -197,14 +329,146 @@ func (sm *StorageMinerAPI) MarketListIncompleteDeals(ctx context.Context) ([]sto
 	return sm.StorageProvider.ListLocalDeals()
 }
 
+func (sm *StorageMinerAPI) MarketListRetrievalDeals(ctx context.Context) ([]api.RetrievalInfo, error) {
+	return sm.RetrievalTracker.List()
+}
+
+func (sm *StorageMinerAPI) MarketGetRetrievalPolicy(ctx context.Context) (*api.RetrievalPolicy, error) {
+	p := sm.RetrievalPolicy.Get()
+	return &p, nil
+}
+
+func (sm *StorageMinerAPI) MarketSetRetrievalPolicy(ctx context.Context, policy *api.RetrievalPolicy) error {
+	if err := sm.RetrievalPolicy.Set(*policy); err != nil {
+		return err
+	}
+
+	sm.RetrievalProvider.SetPricePerByte(policy.PricePerByte)
+	sm.RetrievalProvider.SetPaymentInterval(policy.PaymentInterval, policy.PaymentIntervalIncrease)
+	return nil
+}
+
 func (sm *StorageMinerAPI) MarketSetPrice(ctx context.Context, p types.BigInt) error {
-	return sm.StorageProvider.AddAsk(abi.TokenAmount(p), 60*60*24*100) // lasts for 100 days?
+	ask, err := sm.MarketGetAsk(ctx)
+	if err != nil {
+		return err
+	}
+
+	// only change the price, keep piece size limits
+	return sm.MarketSetAsk(ctx, p, ask.Ask.MinPieceSize, ask.Ask.MaxPieceSize, 100*builtin.EpochsInDay)
+}
+
+func (sm *StorageMinerAPI) MarketSetAsk(ctx context.Context, price types.BigInt, minPieceSize, maxPieceSize abi.PaddedPieceSize, duration abi.ChainEpoch) error {
+	if minPieceSize > maxPieceSize {
+		return xerrors.Errorf("min piece size %d larger than max piece size %d", minPieceSize, maxPieceSize)
+	}
+	if duration <= 0 {
+		return xerrors.Errorf("ask duration must be positive")
+	}
+
+	return sm.StorageProvider.AddAsk(abi.TokenAmount(price), duration,
+		storagemarket.MinPieceSize(minPieceSize),
+		storagemarket.MaxPieceSize(maxPieceSize))
+}
+
+func (sm *StorageMinerAPI) MarketGetAsk(ctx context.Context) (*storagemarket.SignedStorageAsk, error) {
+	maddr, err := sm.ActorAddress(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	asks := sm.StorageProvider.ListAsks(maddr)
+	if len(asks) == 0 {
+		return nil, xerrors.Errorf("no storage ask set")
+	}
+
+	return asks[0], nil
 }
 
 func (sm *StorageMinerAPI) DealsList(ctx context.Context) ([]storagemarket.StorageDeal, error) {
 	return sm.StorageProvider.ListDeals(ctx)
 }
 
+func (sm *StorageMinerAPI) DealsPendingImport(ctx context.Context) ([]storagemarket.MinerDeal, error) {
+	deals, err := sm.StorageProvider.ListLocalDeals()
+	if err != nil {
+		return nil, xerrors.Errorf("listing deals: %w", err)
+	}
+
+	var out []storagemarket.MinerDeal
+	for _, deal := range deals {
+		if deal.State != storagemarket.StorageDealWaitingForData {
+			continue
+		}
+		if deal.Ref == nil || deal.Ref.TransferType != storagemarket.TTManual {
+			continue
+		}
+		out = append(out, deal)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Proposal.StartEpoch < out[j].Proposal.StartEpoch
+	})
+	return out, nil
+}
+
+func (sm *StorageMinerAPI) DealsImportDir(ctx context.Context, dir string) ([]api.DealImportResult, error) {
+	pending, err := sm.DealsPendingImport(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byPiece := map[cid.Cid][]cid.Cid{}
+	for _, deal := range pending {
+		byPiece[deal.Proposal.PieceCID] = append(byPiece[deal.Proposal.PieceCID], deal.ProposalCid)
+	}
+
+	ents, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, xerrors.Errorf("reading import dir: %w", err)
+	}
+
+	var out []api.DealImportResult
+	for _, ent := range ents {
+		if ent.IsDir() {
+			continue
+		}
+
+		name := ent.Name()
+		pieceCid, err := cid.Decode(strings.TrimSuffix(name, filepath.Ext(name)))
+		if err != nil {
+			// not named after a piece
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		props, ok := byPiece[pieceCid]
+		if !ok {
+			out = append(out, api.DealImportResult{
+				File:     path,
+				PieceCID: pieceCid,
+				Error:    "no pending deal for the piece",
+			})
+			continue
+		}
+
+		for _, prop := range props {
+			res := api.DealImportResult{
+				File:        path,
+				PieceCID:    pieceCid,
+				ProposalCid: prop,
+			}
+			if err := sm.DealsImportData(ctx, prop, path); err != nil {
+				log.Warnw("importing offline deal data", "proposal", prop, "file", path, "error", err)
+				res.Error = err.Error()
+			}
+			out = append(out, res)
+		}
+	}
+
+	return out, nil
+}
+
 func (sm *StorageMinerAPI) DealsImportData(ctx context.Context, deal cid.Cid, fname string) error {
 	fi, err := os.Open(fname)
 	if err != nil {
@@ -212,6 +476,10 @@ func (sm *StorageMinerAPI) DealsImportData(ctx context.Context, deal cid.Cid, fn
 	}
 	defer fi.Close()
 
+	if err := sm.checkDeal(ctx, deal); err != nil {
+		return err
+	}
+
 	return sm.StorageProvider.ImportDataForDeal(ctx, deal, fi)
 }
 
@@ -0,0 +1,163 @@
+package impl
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/specs-actors/actors/builtin/market"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/types/mock"
+	"github.com/filecoin-project/lotus/markets/dealfilter"
+	"github.com/filecoin-project/lotus/node/config"
+)
+
+type testProvider struct {
+	storagemarket.StorageProvider
+
+	deals []storagemarket.MinerDeal
+	// imported is the data imported for each proposal
+	imported map[cid.Cid]string
+	fail     map[cid.Cid]bool
+}
+
+func (p *testProvider) ListLocalDeals() ([]storagemarket.MinerDeal, error) {
+	return p.deals, nil
+}
+
+func (p *testProvider) ImportDataForDeal(ctx context.Context, propCid cid.Cid, data io.Reader) error {
+	if p.fail[propCid] {
+		return xerrors.New("bad data")
+	}
+
+	b, err := ioutil.ReadAll(data)
+	if err != nil {
+		return err
+	}
+	p.imported[propCid] = string(b)
+	return nil
+}
+
+type testChainHead struct {
+	api.FullNode
+}
+
+func (testChainHead) ChainHead(context.Context) (*types.TipSet, error) {
+	return mock.TipSet(mock.MkBlock(nil, 1, 1)), nil
+}
+
+func testCid(s string) cid.Cid {
+	return blocks.NewBlock([]byte(s)).Cid()
+}
+
+func offlineDeal(prop, piece cid.Cid, state storagemarket.StorageDealStatus, transfer string) storagemarket.MinerDeal {
+	return storagemarket.MinerDeal{
+		ClientDealProposal: market.ClientDealProposal{
+			Proposal: market.DealProposal{PieceCID: piece},
+		},
+		ProposalCid: prop,
+		State:       state,
+		Ref:         &storagemarket.DataRef{TransferType: transfer},
+	}
+}
+
+func TestDealsImportDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lotus-deals-import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint:errcheck
+
+	piece, other, unknown := testCid("piece"), testCid("other"), testCid("unknown")
+	prop1, prop2, prop3, online := testCid("prop1"), testCid("prop2"), testCid("prop3"), testCid("online")
+
+	files := map[string]string{
+		piece.String() + ".car": "piece data",
+		other.String():          "other data",
+		unknown.String():        "unknown data",
+		"README":                "not a piece",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// directories aren't imported, even if named after a piece
+	if err := os.Mkdir(filepath.Join(dir, piece.String()), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	filter, err := dealfilter.New(config.DealmakingConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prov := &testProvider{
+		deals: []storagemarket.MinerDeal{
+			// both deals for the same piece get the data
+			offlineDeal(prop1, piece, storagemarket.StorageDealWaitingForData, storagemarket.TTManual),
+			offlineDeal(prop2, piece, storagemarket.StorageDealWaitingForData, storagemarket.TTManual),
+			offlineDeal(prop3, other, storagemarket.StorageDealWaitingForData, storagemarket.TTManual),
+			// not waiting for a manual import
+			offlineDeal(online, unknown, storagemarket.StorageDealWaitingForData, storagemarket.TTGraphsync),
+		},
+		imported: map[cid.Cid]string{},
+		fail:     map[cid.Cid]bool{prop3: true},
+	}
+
+	sm := &StorageMinerAPI{
+		StorageProvider: prov,
+		DealFilter:      filter,
+		Full:            testChainHead{},
+	}
+
+	res, err := sm.DealsImportDir(context.TODO(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byProp := map[cid.Cid]api.DealImportResult{}
+	var unmatched []api.DealImportResult
+	for _, r := range res {
+		if !r.ProposalCid.Defined() {
+			unmatched = append(unmatched, r)
+			continue
+		}
+		byProp[r.ProposalCid] = r
+	}
+
+	if len(res) != 4 || len(byProp) != 3 || len(unmatched) != 1 {
+		t.Fatalf("expected results for 3 deals and 1 unknown piece, got %+v", res)
+	}
+
+	for _, prop := range []cid.Cid{prop1, prop2} {
+		r := byProp[prop]
+		if r.Error != "" || r.PieceCID != piece || r.File != filepath.Join(dir, piece.String()+".car") {
+			t.Errorf("unexpected result for %s: %+v", prop, r)
+		}
+		if prov.imported[prop] != "piece data" {
+			t.Errorf("expected piece data imported for %s, got %q", prop, prov.imported[prop])
+		}
+	}
+
+	if r := byProp[prop3]; r.Error == "" || r.PieceCID != other {
+		t.Errorf("expected import error for %s, got %+v", prop3, r)
+	}
+
+	if r := unmatched[0]; r.PieceCID != unknown || r.Error == "" {
+		t.Errorf("expected the unknown piece to be reported, got %+v", r)
+	}
+	if _, ok := prov.imported[online]; ok {
+		t.Error("expected no import for a deal which isn't offline")
+	}
+}
@@ -29,6 +29,8 @@ import (
 	"github.com/ipfs/go-filestore"
 
 	"github.com/filecoin-project/lotus/markets/retrievaladapter"
+	"github.com/filecoin-project/lotus/node/config"
+	"github.com/filecoin-project/lotus/node/impl/client"
 	"github.com/filecoin-project/lotus/node/impl/full"
 	payapi "github.com/filecoin-project/lotus/node/impl/paych"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
@@ -130,3 +132,65 @@ func RetrievalClient(h host.Host, bs dtypes.ClientBlockstore, pmgr *paychmgr.Man
 	sc := storedcounter.New(ds, datastore.NewKey("/retr"))
 	return retrievalimpl.NewClient(network, bs, adapter, resolver, ds, sc)
 }
+
+// ClientRetrievalTracker records retrieval deals made by the client
+func ClientRetrievalTracker(lc fx.Lifecycle, ds dtypes.MetadataDS, c retrievalmarket.RetrievalClient) *retrievaladapter.DealTracker {
+	t := retrievaladapter.NewDealTracker(namespace.Wrap(ds, datastore.NewKey("/retrievals/client")))
+	unsubscribe := c.SubscribeToEvents(t.ClientEvent)
+
+	lc.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			unsubscribe()
+			return nil
+		},
+	})
+
+	return t
+}
+
+// ClientImports records metadata of data imported into the client blockstore
+func ClientImports(ds dtypes.MetadataDS) *client.Imports {
+	return client.NewImports(namespace.Wrap(ds, datastore.NewKey("/clientimports")))
+}
+
+// ClientDealPlacer starts deals with automatically selected miners
+func ClientDealPlacer(mctx helpers.MetricsCtx, lc fx.Lifecycle, ds dtypes.MetadataDS, proposer client.DealProposer) (*client.DealPlacer, error) {
+	p, err := client.NewDealPlacer(namespace.Wrap(ds, datastore.NewKey("/dealplacer")), proposer)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := helpers.LifecycleCtx(mctx, lc)
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			p.Run(ctx)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			p.Stop()
+			return nil
+		},
+	})
+
+	return p, nil
+}
+
+// ClientDealMonitor watches active deals of the client for slashing, faults
+// and expiry
+func ClientDealMonitor(cfg config.DealMonitorConfig) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, ds dtypes.MetadataDS, proposer client.DealProposer, placer *client.DealPlacer) (*client.DealMonitor, error) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, ds dtypes.MetadataDS, proposer client.DealProposer, placer *client.DealPlacer) (*client.DealMonitor, error) {
+		m, err := client.NewDealMonitor(cfg, namespace.Wrap(ds, datastore.NewKey("/dealmonitor")), proposer, placer)
+		if err != nil {
+			return nil, err
+		}
+
+		ctx := helpers.LifecycleCtx(mctx, lc)
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				return m.Run(ctx)
+			},
+		})
+
+		return m, nil
+	}
+}
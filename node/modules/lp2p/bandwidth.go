@@ -0,0 +1,180 @@
+package lp2p
+
+import (
+	"context"
+	"strings"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/metrics"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"golang.org/x/time/rate"
+)
+
+// TopicProtocolID is the pseudo protocol under which inbound pubsub traffic is
+// accounted per topic. Pubsub multiplexes all topics over a single stream, so
+// this traffic is also included in the pubsub protocol totals
+func TopicProtocolID(topic string) protocol.ID {
+	return protocol.ID("/pubsub/topic/" + topic)
+}
+
+// MeteredValidator wraps a pubsub topic validator, accounting received
+// messages in the bandwidth reporter
+func MeteredValidator(bwc metrics.Reporter, topic string, v func(context.Context, peer.ID, *pubsub.Message) pubsub.ValidationResult) func(context.Context, peer.ID, *pubsub.Message) pubsub.ValidationResult {
+	proto := TopicProtocolID(topic)
+	return func(ctx context.Context, pid peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+		bwc.LogRecvMessageStream(int64(msg.Size()), proto, pid)
+		return v(ctx, pid, msg)
+	}
+}
+
+// RateLimitedHost caps bandwidth used by streams of the given protocols.
+// Limits are in bytes per second, applied separately to inbound and outbound
+// traffic, and keyed by protocol ID prefix
+func RateLimitedHost(limits map[string]uint64) func(rh RawHost, r BaseIpfsRouting) host.Host {
+	return func(rh RawHost, r BaseIpfsRouting) host.Host {
+		h := RoutedHost(rh, r)
+		if len(limits) == 0 {
+			return h
+		}
+
+		lh := &limitedHost{
+			Host:     h,
+			limiters: map[string]*protoLimiter{},
+		}
+		for prefix, bps := range limits {
+			lh.limiters[prefix] = &protoLimiter{
+				in:  newLimiter(bps),
+				out: newLimiter(bps),
+			}
+		}
+		return lh
+	}
+}
+
+func newLimiter(bps uint64) *rate.Limiter {
+	burst := int(bps)
+	if burst < minBurst {
+		burst = minBurst
+	}
+	return rate.NewLimiter(rate.Limit(bps), burst)
+}
+
+// minBurst makes sure that a single read or write of a reasonable size can
+// always go through the limiter, even with very low limits
+const minBurst = 64 << 10
+
+type protoLimiter struct {
+	in  *rate.Limiter
+	out *rate.Limiter
+}
+
+type limitedHost struct {
+	host.Host
+
+	limiters map[string]*protoLimiter
+}
+
+func (lh *limitedHost) limiterFor(proto protocol.ID) *protoLimiter {
+	var best string
+	var out *protoLimiter
+	for prefix, l := range lh.limiters {
+		if strings.HasPrefix(string(proto), prefix) && len(prefix) >= len(best) {
+			best = prefix
+			out = l
+		}
+	}
+	return out
+}
+
+func (lh *limitedHost) wrapHandler(handler network.StreamHandler) network.StreamHandler {
+	return func(s network.Stream) {
+		handler(lh.wrapStream(s))
+	}
+}
+
+func (lh *limitedHost) wrapStream(s network.Stream) network.Stream {
+	l := lh.limiterFor(s.Protocol())
+	if l == nil {
+		return s
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &limitedStream{Stream: s, l: l, ctx: ctx, cancel: cancel}
+}
+
+func (lh *limitedHost) SetStreamHandler(pid protocol.ID, handler network.StreamHandler) {
+	lh.Host.SetStreamHandler(pid, lh.wrapHandler(handler))
+}
+
+func (lh *limitedHost) SetStreamHandlerMatch(pid protocol.ID, m func(string) bool, handler network.StreamHandler) {
+	lh.Host.SetStreamHandlerMatch(pid, m, lh.wrapHandler(handler))
+}
+
+func (lh *limitedHost) NewStream(ctx context.Context, p peer.ID, pids ...protocol.ID) (network.Stream, error) {
+	s, err := lh.Host.NewStream(ctx, p, pids...)
+	if err != nil {
+		return nil, err
+	}
+	return lh.wrapStream(s), nil
+}
+
+type limitedStream struct {
+	network.Stream
+
+	l *protoLimiter
+
+	// ctx is cancelled when the stream is closed or reset, so reads and
+	// writes don't stay blocked in the limiter
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (ls *limitedStream) Close() error {
+	ls.cancel()
+	return ls.Stream.Close()
+}
+
+func (ls *limitedStream) Reset() error {
+	ls.cancel()
+	return ls.Stream.Reset()
+}
+
+func (ls *limitedStream) Read(b []byte) (int, error) {
+	if len(b) > ls.l.in.Burst() {
+		b = b[:ls.l.in.Burst()]
+	}
+
+	n, err := ls.Stream.Read(b)
+	if n > 0 {
+		// account for what we've read after the fact, this delays the next
+		// read, which makes the remote side back off
+		if werr := ls.l.in.WaitN(ls.ctx, n); werr != nil && ls.ctx.Err() == nil {
+			log.Warnf("waiting for inbound rate limiter: %s", werr)
+		}
+	}
+	return n, err
+}
+
+func (ls *limitedStream) Write(b []byte) (int, error) {
+	var written int
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > ls.l.out.Burst() {
+			chunk = chunk[:ls.l.out.Burst()]
+		}
+
+		if err := ls.l.out.WaitN(ls.ctx, len(chunk)); err != nil {
+			return written, err
+		}
+
+		n, err := ls.Stream.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
@@ -0,0 +1,172 @@
+package lp2p
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/protocol"
+)
+
+// testStream is a stream of a protocol which reads from and writes into a
+// buffer
+type testStream struct {
+	network.Stream
+
+	proto   protocol.ID
+	in, out bytes.Buffer
+	reset   bool
+	closed  bool
+}
+
+func (s *testStream) Protocol() protocol.ID {
+	return s.proto
+}
+
+func (s *testStream) Read(b []byte) (int, error) {
+	return s.in.Read(b)
+}
+
+func (s *testStream) Write(b []byte) (int, error) {
+	return s.out.Write(b)
+}
+
+func (s *testStream) Reset() error {
+	s.reset = true
+	return nil
+}
+
+func (s *testStream) Close() error {
+	s.closed = true
+	return nil
+}
+
+func newTestLimitedHost(limits map[string]uint64) *limitedHost {
+	lh := &limitedHost{limiters: map[string]*protoLimiter{}}
+	for prefix, bps := range limits {
+		lh.limiters[prefix] = &protoLimiter{
+			in:  newLimiter(bps),
+			out: newLimiter(bps),
+		}
+	}
+	return lh
+}
+
+func TestLimiterFor(t *testing.T) {
+	lh := newTestLimitedHost(map[string]uint64{
+		"/fil/":          1,
+		"/fil/sync/":     2,
+		"/fil/sync/blk/": 3,
+	})
+
+	for proto, prefix := range map[protocol.ID]string{
+		"/fil/sync/blk/0.0.1": "/fil/sync/blk/",
+		"/fil/sync/msg/0.0.1": "/fil/sync/",
+		"/fil/hello/1.0.0":    "/fil/",
+		"/meshsub/1.0.0":      "",
+	} {
+		l := lh.limiterFor(proto)
+		if prefix == "" {
+			if l != nil {
+				t.Errorf("%s: expected no limiter", proto)
+			}
+			continue
+		}
+		if l != lh.limiters[prefix] {
+			t.Errorf("%s: expected the limiter of %s", proto, prefix)
+		}
+	}
+
+	s := &testStream{proto: "/meshsub/1.0.0"}
+	if lh.wrapStream(s) != network.Stream(s) {
+		t.Error("expected streams without a limit not to be wrapped")
+	}
+}
+
+// waitBlocked runs f and checks that it is still blocked after a while
+func waitBlocked(t *testing.T, f func() error) <-chan error {
+	t.Helper()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- f()
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("expected to block on the limiter, returned %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	return done
+}
+
+func TestLimitedStreamWrite(t *testing.T) {
+	lh := newTestLimitedHost(map[string]uint64{"/fil/": 1})
+	s := &testStream{proto: "/fil/sync/blk/0.0.1"}
+	ls := lh.wrapStream(s)
+
+	// the burst goes through right away
+	if n, err := ls.Write(make([]byte, minBurst)); err != nil || n != minBurst {
+		t.Fatalf("expected the burst to be written, wrote %d: %v", n, err)
+	}
+
+	done := waitBlocked(t, func() error {
+		_, err := ls.Write([]byte("more"))
+		return err
+	})
+	if s.out.Len() != minBurst {
+		t.Fatalf("expected nothing written while blocked, got %d bytes", s.out.Len())
+	}
+
+	if err := ls.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected the blocked write to fail after reset")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("write still blocked after reset")
+	}
+	if !s.reset || s.out.Len() != minBurst {
+		t.Fatalf("expected the stream to be reset with nothing more written, got reset %t, %d bytes", s.reset, s.out.Len())
+	}
+}
+
+func TestLimitedStreamRead(t *testing.T) {
+	lh := newTestLimitedHost(map[string]uint64{"/fil/": 1})
+	s := &testStream{proto: "/fil/sync/blk/0.0.1"}
+	s.in.Write(make([]byte, 2*minBurst))
+	ls := lh.wrapStream(s)
+
+	// reads are capped at the burst, and accounted after the fact
+	buf := make([]byte, 2*minBurst)
+	if n, err := ls.Read(buf); err != nil || n != minBurst {
+		t.Fatalf("expected to read the burst, read %d: %v", n, err)
+	}
+
+	read := make(chan int, 1)
+	done := waitBlocked(t, func() error {
+		n, err := ls.Read(buf)
+		read <- n
+		return err
+	})
+
+	if err := ls.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		// the data was read before waiting in the limiter
+		if n := <-read; err != nil || n != minBurst {
+			t.Fatalf("expected the rest of the data, read %d: %v", n, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("read still blocked after close")
+	}
+	if !s.closed {
+		t.Fatal("expected the stream to be closed")
+	}
+}
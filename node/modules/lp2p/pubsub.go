@@ -13,6 +13,7 @@ import (
 	"go.uber.org/fx"
 
 	"github.com/filecoin-project/lotus/build"
+	"github.com/filecoin-project/lotus/lib/peerrep"
 	"github.com/filecoin-project/lotus/node/config"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
 	"github.com/filecoin-project/lotus/node/modules/helpers"
@@ -29,7 +30,7 @@ func init() {
 }
 
 func GossipSub(cfg *config.Pubsub) interface{} {
-	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, host host.Host, nn dtypes.NetworkName, bp dtypes.BootstrapPeers) (service *pubsub.PubSub, err error) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, host host.Host, nn dtypes.NetworkName, bp dtypes.BootstrapPeers, rep *peerrep.PeerRep) (service *pubsub.PubSub, err error) {
 		bootstrappers := make(map[peer.ID]struct{})
 		for _, pi := range bp {
 			bootstrappers[pi.ID] = struct{}{}
@@ -51,9 +52,9 @@ func GossipSub(cfg *config.Pubsub) interface{} {
 							return 2500
 						}
 
-						// TODO: we want to  plug the application specific score to the node itself in order
-						//       to provide feedback to the pubsub system based on observed behaviour
-						return 0
+						// feed back the reputation observed in chain protocols (hello,
+						// blocksync, block validation and sync) into the pubsub system
+						return rep.Score(p)
 					},
 					AppSpecificWeight: 1,
 
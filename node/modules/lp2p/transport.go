@@ -3,12 +3,31 @@ package lp2p
 import (
 	"github.com/libp2p/go-libp2p"
 	metrics "github.com/libp2p/go-libp2p-core/metrics"
+	"github.com/libp2p/go-libp2p-core/transport"
 	libp2pquic "github.com/libp2p/go-libp2p-quic-transport"
 	secio "github.com/libp2p/go-libp2p-secio"
 	tls "github.com/libp2p/go-libp2p-tls"
+	tptu "github.com/libp2p/go-libp2p-transport-upgrader"
+	tcp "github.com/libp2p/go-tcp-transport"
+	ws "github.com/libp2p/go-ws-transport"
+
+	"github.com/filecoin-project/lotus/lib/conngater"
 )
 
-var DefaultTransports = simpleOpt(libp2p.DefaultTransports)
+// DefaultTransports are the libp2p default TCP and websocket transports,
+// which don't connect to peers and addresses blocked by the gater
+func DefaultTransports(g *conngater.Gater) (opts Libp2pOpts) {
+	opts.Opts = append(opts.Opts,
+		libp2p.Transport(func(u *tptu.Upgrader) transport.Transport {
+			return g.Transport(tcp.NewTCPTransport(u))
+		}),
+		libp2p.Transport(func(u *tptu.Upgrader) transport.Transport {
+			return g.Transport(ws.New(u))
+		}),
+	)
+	return opts
+}
+
 var QUIC = simpleOpt(libp2p.Transport(libp2pquic.NewTransport))
 
 func Security(enabled, preferTLS bool) interface{} {
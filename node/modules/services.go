@@ -2,10 +2,12 @@ package modules
 
 import (
 	"context"
+	"time"
 
 	eventbus "github.com/libp2p/go-eventbus"
 	event "github.com/libp2p/go-libp2p-core/event"
 	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/metrics"
 	"github.com/libp2p/go-libp2p-core/peer"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	"go.uber.org/fx"
@@ -22,14 +24,27 @@ import (
 	"github.com/filecoin-project/lotus/chain/messagepool"
 	"github.com/filecoin-project/lotus/chain/store"
 	"github.com/filecoin-project/lotus/chain/sub"
+	"github.com/filecoin-project/lotus/lib/conngater"
 	"github.com/filecoin-project/lotus/lib/peermgr"
+	"github.com/filecoin-project/lotus/lib/peerrep"
 	"github.com/filecoin-project/lotus/node/hello"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
 	"github.com/filecoin-project/lotus/node/modules/helpers"
+	"github.com/filecoin-project/lotus/node/modules/lp2p"
 )
 
+// badBlockBanDuration is how long peers sending invalid blocks are banned for
+const badBlockBanDuration = 24 * time.Hour
+
 func RunHello(mctx helpers.MetricsCtx, lc fx.Lifecycle, h host.Host, svc *hello.Service) error {
 	h.SetStreamHandler(hello.ProtocolID, svc.HandleStream)
+	h.SetStreamHandler(hello.ProtocolIDv2, svc.HandleStream)
+
+	go func() {
+		if err := svc.FindOldestState(helpers.LifecycleCtx(mctx, lc)); err != nil {
+			log.Warnw("failed to find oldest available state", "error", err)
+		}
+	}()
 
 	sub, err := h.EventBus().Subscribe(new(event.EvtPeerIdentificationCompleted), eventbus.BufSize(1024))
 	if err != nil {
@@ -54,11 +69,33 @@ func RunPeerMgr(mctx helpers.MetricsCtx, lc fx.Lifecycle, pmgr *peermgr.PeerMgr)
 	go pmgr.Run(helpers.LifecycleCtx(mctx, lc))
 }
 
+func ConnGater(mctx helpers.MetricsCtx, lc fx.Lifecycle, ds dtypes.MetadataDS) (*conngater.Gater, error) {
+	g, err := conngater.NewGater(ds)
+	if err != nil {
+		return nil, err
+	}
+
+	go g.Run(helpers.LifecycleCtx(mctx, lc))
+	return g, nil
+}
+
+func AttachConnGater(h host.Host, g *conngater.Gater) {
+	g.Attach(h)
+}
+
+func NewPeerRep(h host.Host, g *conngater.Gater) *peerrep.PeerRep {
+	return peerrep.NewPeerRep(h.ConnManager(), g.BlockPeer)
+}
+
+func RunPeerRep(mctx helpers.MetricsCtx, lc fx.Lifecycle, rep *peerrep.PeerRep) {
+	go rep.Run(helpers.LifecycleCtx(mctx, lc))
+}
+
 func RunBlockSync(h host.Host, svc *blocksync.BlockSyncService) {
 	h.SetStreamHandler(blocksync.BlockSyncProtocolID, svc.HandleStream)
 }
 
-func HandleIncomingBlocks(mctx helpers.MetricsCtx, lc fx.Lifecycle, ps *pubsub.PubSub, s *chain.Syncer, h host.Host, nn dtypes.NetworkName) {
+func HandleIncomingBlocks(mctx helpers.MetricsCtx, lc fx.Lifecycle, ps *pubsub.PubSub, s *chain.Syncer, h host.Host, nn dtypes.NetworkName, rep *peerrep.PeerRep, bwc metrics.Reporter, g *conngater.Gater) {
 	ctx := helpers.LifecycleCtx(mctx, lc)
 
 	blocksub, err := ps.Subscribe(build.BlocksTopic(nn))
@@ -69,16 +106,17 @@ func HandleIncomingBlocks(mctx helpers.MetricsCtx, lc fx.Lifecycle, ps *pubsub.P
 	v := sub.NewBlockValidator(func(p peer.ID) {
 		ps.BlacklistPeer(p)
 		h.ConnManager().TagPeer(p, "badblock", -1000)
-	})
+		g.BlockPeer(p, badBlockBanDuration, "sent invalid block")
+	}, rep)
 
-	if err := ps.RegisterTopicValidator(build.BlocksTopic(nn), v.Validate); err != nil {
+	if err := ps.RegisterTopicValidator(build.BlocksTopic(nn), lp2p.MeteredValidator(bwc, build.BlocksTopic(nn), v.Validate)); err != nil {
 		panic(err)
 	}
 
 	go sub.HandleIncomingBlocks(ctx, blocksub, s, h.ConnManager(), v)
 }
 
-func HandleIncomingMessages(mctx helpers.MetricsCtx, lc fx.Lifecycle, ps *pubsub.PubSub, mpool *messagepool.MessagePool, nn dtypes.NetworkName) {
+func HandleIncomingMessages(mctx helpers.MetricsCtx, lc fx.Lifecycle, ps *pubsub.PubSub, mpool *messagepool.MessagePool, nn dtypes.NetworkName, rep *peerrep.PeerRep, bwc metrics.Reporter) {
 	ctx := helpers.LifecycleCtx(mctx, lc)
 
 	msgsub, err := ps.Subscribe(build.MessagesTopic(nn))
@@ -86,9 +124,9 @@ func HandleIncomingMessages(mctx helpers.MetricsCtx, lc fx.Lifecycle, ps *pubsub
 		panic(err)
 	}
 
-	v := sub.NewMessageValidator(mpool)
+	v := sub.NewMessageValidator(mpool, rep)
 
-	if err := ps.RegisterTopicValidator(build.MessagesTopic(nn), v.Validate); err != nil {
+	if err := ps.RegisterTopicValidator(build.MessagesTopic(nn), lp2p.MeteredValidator(bwc, build.MessagesTopic(nn), v.Validate)); err != nil {
 		panic(err)
 	}
 
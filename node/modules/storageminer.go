@@ -3,6 +3,8 @@ package modules
 import (
 	"context"
 	"net/http"
+	"path/filepath"
+	"time"
 
 	"github.com/ipfs/go-bitswap"
 	"github.com/ipfs/go-bitswap/network"
@@ -39,16 +41,21 @@ import (
 	"github.com/filecoin-project/lotus/chain/beacon/drand"
 	"github.com/filecoin-project/lotus/chain/gen"
 	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/markets/dealfilter"
 	"github.com/filecoin-project/lotus/markets/retrievaladapter"
+	"github.com/filecoin-project/lotus/markets/retrievalpolicy"
 	"github.com/filecoin-project/lotus/miner"
+	"github.com/filecoin-project/lotus/node/config"
 	"github.com/filecoin-project/lotus/node/modules/dtypes"
 	"github.com/filecoin-project/lotus/node/modules/helpers"
 	"github.com/filecoin-project/lotus/node/repo"
 	"github.com/filecoin-project/lotus/storage"
+	"github.com/filecoin-project/lotus/storage/sealworker"
 	sectorstorage "github.com/filecoin-project/sector-storage"
 	"github.com/filecoin-project/sector-storage/ffiwrapper"
 	"github.com/filecoin-project/sector-storage/stores"
 	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
 	sealing "github.com/filecoin-project/storage-fsm"
 )
 
@@ -120,30 +127,44 @@ func SectorIDCounter(ds dtypes.MetadataDS) sealing.SectorIDCounter {
 	return &sidsc{sc}
 }
 
-func StorageMiner(mctx helpers.MetricsCtx, lc fx.Lifecycle, api lapi.FullNode, h host.Host, ds dtypes.MetadataDS, sealer sectorstorage.SectorManager, sc sealing.SectorIDCounter, verif ffiwrapper.Verifier) (*storage.Miner, error) {
+func WindowPostScheduler(api lapi.FullNode, ds dtypes.MetadataDS, sealer sectorstorage.SectorManager, ft storage.FaultTracker) (*storage.WindowPoStScheduler, error) {
 	maddr, err := minerAddrFromDS(ds)
 	if err != nil {
 		return nil, err
 	}
 
-	ctx := helpers.LifecycleCtx(mctx, lc)
+	mi, err := api.StateMinerInfo(context.TODO(), maddr, types.EmptyTSK)
+	if err != nil {
+		return nil, err
+	}
 
-	mi, err := api.StateMinerInfo(ctx, maddr, types.EmptyTSK)
+	worker, err := api.StateAccountKey(context.TODO(), mi.Worker, types.EmptyTSK)
 	if err != nil {
 		return nil, err
 	}
 
-	worker, err := api.StateAccountKey(ctx, mi.Worker, types.EmptyTSK)
+	return storage.NewWindowedPoStScheduler(api, sealer, ft, ds, maddr, worker)
+}
+
+func StorageMiner(mctx helpers.MetricsCtx, lc fx.Lifecycle, api lapi.FullNode, h host.Host, ds dtypes.MetadataDS, sealer sectorstorage.SectorManager, sc sealing.SectorIDCounter, verif ffiwrapper.Verifier, fps *storage.WindowPoStScheduler, notif *storage.SectorNotifier, limits storage.SealingLimits) (*storage.Miner, error) {
+	maddr, err := minerAddrFromDS(ds)
 	if err != nil {
 		return nil, err
 	}
 
-	fps, err := storage.NewWindowedPoStScheduler(api, sealer, maddr, worker)
+	ctx := helpers.LifecycleCtx(mctx, lc)
+
+	mi, err := api.StateMinerInfo(ctx, maddr, types.EmptyTSK)
 	if err != nil {
 		return nil, err
 	}
 
-	sm, err := storage.NewMiner(api, maddr, worker, h, ds, sealer, sc, verif)
+	worker, err := api.StateAccountKey(ctx, mi.Worker, types.EmptyTSK)
+	if err != nil {
+		return nil, err
+	}
+
+	sm, err := storage.NewMiner(api, maddr, worker, h, ds, sealer, sc, verif, notif, limits)
 	if err != nil {
 		return nil, err
 	}
@@ -159,6 +180,34 @@ func StorageMiner(mctx helpers.MetricsCtx, lc fx.Lifecycle, api lapi.FullNode, h
 	return sm, nil
 }
 
+func SectorNotifyConfig(cfg config.SectorNotify) storage.SectorNotifyConfig {
+	states := make([]lapi.SectorState, len(cfg.States))
+	for i, st := range cfg.States {
+		states[i] = lapi.SectorState(st)
+	}
+
+	return storage.SectorNotifyConfig{
+		Webhooks: cfg.Webhooks,
+		States:   states,
+		Timeout:  time.Duration(cfg.Timeout),
+	}
+}
+
+func SectorNotifier(mctx helpers.MetricsCtx, lc fx.Lifecycle, cfg storage.SectorNotifyConfig) *storage.SectorNotifier {
+	ctx := helpers.LifecycleCtx(mctx, lc)
+
+	n := storage.NewSectorNotifier(cfg)
+
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			n.Run(ctx)
+			return nil
+		},
+	})
+
+	return n
+}
+
 func HandleRetrieval(host host.Host, lc fx.Lifecycle, m retrievalmarket.RetrievalProvider) {
 	lc.Append(fx.Hook{
 		OnStart: func(context.Context) error {
@@ -187,6 +236,71 @@ func HandleDeals(mctx helpers.MetricsCtx, lc fx.Lifecycle, host host.Host, h sto
 	})
 }
 
+// AskRenewalBuffer is how long before expiry the storage ask gets re-signed
+var AskRenewalBuffer = abi.ChainEpoch(builtin.EpochsInDay)
+
+var askCheckInterval = 5 * time.Minute
+
+// RenewStorageAsk re-signs the storage ask before it expires, so clients don't
+// see a stale ask
+func RenewStorageAsk(mctx helpers.MetricsCtx, lc fx.Lifecycle, fapi lapi.FullNode, ds dtypes.MetadataDS, p storagemarket.StorageProvider) error {
+	maddr, err := minerAddrFromDS(ds)
+	if err != nil {
+		return err
+	}
+
+	ctx := helpers.LifecycleCtx(mctx, lc)
+
+	renew := func() error {
+		asks := p.ListAsks(maddr)
+		if len(asks) == 0 {
+			return nil
+		}
+		ask := asks[0].Ask
+
+		head, err := fapi.ChainHead(ctx)
+		if err != nil {
+			return xerrors.Errorf("getting chain head: %w", err)
+		}
+
+		duration := ask.Expiry - ask.Timestamp
+		buffer := AskRenewalBuffer
+		if duration/2 < buffer {
+			buffer = duration / 2
+		}
+		if ask.Expiry-head.Height() > buffer {
+			return nil
+		}
+
+		log.Infow("renewing storage ask", "expiry", ask.Expiry, "height", head.Height(), "duration", duration)
+		return p.AddAsk(ask.Price, duration, storagemarket.MinPieceSize(ask.MinPieceSize), storagemarket.MaxPieceSize(ask.MaxPieceSize))
+	}
+
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				tick := time.NewTicker(askCheckInterval)
+				defer tick.Stop()
+
+				for {
+					if err := renew(); err != nil {
+						log.Errorf("renewing storage ask: %+v", err)
+					}
+
+					select {
+					case <-tick.C:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+			return nil
+		},
+	})
+
+	return nil
+}
+
 // RegisterProviderValidator is an initialization hook that registers the provider
 // request validator with the data transfer module as the validator for
 // StorageDataTransferVoucher types
@@ -258,13 +372,18 @@ func StagingGraphsync(mctx helpers.MetricsCtx, lc fx.Lifecycle, ibs dtypes.Stagi
 	return gs
 }
 
-func SetupBlockProducer(lc fx.Lifecycle, ds dtypes.MetadataDS, api lapi.FullNode, epp gen.WinningPoStProver, beacon beacon.RandomBeacon) (*miner.Miner, error) {
+func SetupBlockProducer(lc fx.Lifecycle, ds dtypes.MetadataDS, api lapi.FullNode, epp gen.WinningPoStProver, beacon beacon.RandomBeacon, lcfg miner.LeaseConfig) (*miner.Miner, error) {
 	minerAddr, err := minerAddrFromDS(ds)
 	if err != nil {
 		return nil, err
 	}
 
-	m := miner.NewMiner(api, epp, beacon, minerAddr)
+	lease, err := miner.NewLease(lcfg)
+	if err != nil {
+		return nil, xerrors.Errorf("setting up mining lease: %w", err)
+	}
+
+	m := miner.NewMiner(api, epp, beacon, minerAddr, ds, lease)
 
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
@@ -285,12 +404,17 @@ func NewProviderRequestValidator(deals dtypes.ProviderDealStore) *requestvalidat
 	return requestvalidation.NewProviderRequestValidator(deals)
 }
 
-func StorageProvider(ctx helpers.MetricsCtx, fapi lapi.FullNode, h host.Host, ds dtypes.MetadataDS, ibs dtypes.StagingBlockstore, r repo.LockedRepo, pieceStore dtypes.ProviderPieceStore, dataTransfer dtypes.ProviderDataTransfer, spn storagemarket.StorageProviderNode) (storagemarket.StorageProvider, error) {
+func DealFilter(cfg config.DealmakingConfig) func() (*dealfilter.Filter, error) {
+	return func() (*dealfilter.Filter, error) {
+		return dealfilter.New(cfg)
+	}
+}
+
+func StorageProvider(ctx helpers.MetricsCtx, fapi lapi.FullNode, h host.Host, ds dtypes.MetadataDS, ibs dtypes.StagingBlockstore, r repo.LockedRepo, pieceStore dtypes.ProviderPieceStore, dataTransfer dtypes.ProviderDataTransfer, spn storagemarket.StorageProviderNode, filter *dealfilter.Filter) (storagemarket.StorageProvider, error) {
 	store, err := piecefilestore.NewLocalFileStore(piecefilestore.OsPath(r.Path()))
 	if err != nil {
 		return nil, err
 	}
-	net := smnet.NewFromLibp2pHost(h)
 	addr, err := ds.Get(datastore.NewKey("miner-address"))
 	if err != nil {
 		return nil, err
@@ -301,6 +425,8 @@ func StorageProvider(ctx helpers.MetricsCtx, fapi lapi.FullNode, h host.Host, ds
 		return nil, err
 	}
 
+	net := dealfilter.NewNetwork(smnet.NewFromLibp2pHost(h), filter, spn, minerAddress)
+
 	mi, err := fapi.StateMinerInfo(ctx, minerAddress, types.EmptyTSK)
 	if err != nil {
 		return nil, err
@@ -315,6 +441,7 @@ func StorageProvider(ctx helpers.MetricsCtx, fapi lapi.FullNode, h host.Host, ds
 	if err != nil {
 		return p, err
 	}
+	filter.SetDealLister(p.ListLocalDeals)
 
 	// Hacky way to set max piece size to the sector size
 	a := p.ListAsks(minerAddress)[0].Ask
@@ -326,20 +453,63 @@ func StorageProvider(ctx helpers.MetricsCtx, fapi lapi.FullNode, h host.Host, ds
 	return p, nil
 }
 
+func UnsealedCache(cfg config.RetrievalConfig) func(r repo.LockedRepo) (*retrievaladapter.UnsealedCache, error) {
+	return func(r repo.LockedRepo) (*retrievaladapter.UnsealedCache, error) {
+		if cfg.HotPieceRetrievals <= 0 {
+			return nil, nil
+		}
+		return retrievaladapter.NewUnsealedCache(filepath.Join(r.Path(), "unsealed-cache"), cfg.HotPieceRetrievals, cfg.UnsealedCacheSize)
+	}
+}
+
+func RetrievalPolicy(cfg config.RetrievalConfig) func(ds dtypes.MetadataDS, pieceStore dtypes.ProviderPieceStore, cache *retrievaladapter.UnsealedCache) (*retrievalpolicy.Policy, error) {
+	return func(ds dtypes.MetadataDS, pieceStore dtypes.ProviderPieceStore, cache *retrievaladapter.UnsealedCache) (*retrievalpolicy.Policy, error) {
+		return retrievalpolicy.New(cfg, ds, pieceStore, cache)
+	}
+}
+
 // RetrievalProvider creates a new retrieval provider attached to the provider blockstore
-func RetrievalProvider(h host.Host, miner *storage.Miner, sealer sectorstorage.SectorManager, full lapi.FullNode, ds dtypes.MetadataDS, pieceStore dtypes.ProviderPieceStore, ibs dtypes.StagingBlockstore) (retrievalmarket.RetrievalProvider, error) {
-	adapter := retrievaladapter.NewRetrievalProviderNode(miner, sealer, full)
+func RetrievalProvider(h host.Host, miner *storage.Miner, sealer sectorstorage.SectorManager, full lapi.FullNode, ds dtypes.MetadataDS, pieceStore dtypes.ProviderPieceStore, ibs dtypes.StagingBlockstore, policy *retrievalpolicy.Policy, cache *retrievaladapter.UnsealedCache) (retrievalmarket.RetrievalProvider, error) {
+	adapter := retrievaladapter.NewRetrievalProviderNode(miner, sealer, full, cache)
 	address, err := minerAddrFromDS(ds)
 	if err != nil {
 		return nil, err
 	}
-	network := rmnet.NewFromLibp2pHost(h)
-	return retrievalimpl.NewProvider(address, adapter, network, pieceStore, ibs, ds)
+	network := retrievalpolicy.NewNetwork(rmnet.NewFromLibp2pHost(h), policy)
+	p, err := retrievalimpl.NewProvider(address, adapter, network, pieceStore, ibs, ds)
+	if err != nil {
+		return nil, err
+	}
+
+	pol := policy.Get()
+	p.SetPricePerByte(pol.PricePerByte)
+	p.SetPaymentInterval(pol.PaymentInterval, pol.PaymentIntervalIncrease)
+
+	return p, nil
+}
+
+// ProviderRetrievalTracker records retrieval deals served by the miner
+func ProviderRetrievalTracker(lc fx.Lifecycle, ds dtypes.MetadataDS, p retrievalmarket.RetrievalProvider) *retrievaladapter.DealTracker {
+	t := retrievaladapter.NewDealTracker(namespace.Wrap(ds, datastore.NewKey("/retrievals/provider")))
+	unsubscribe := p.SubscribeToEvents(t.ProviderEvent)
+
+	lc.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			unsubscribe()
+			return nil
+		},
+	})
+
+	return t
 }
 
-func SectorStorage(mctx helpers.MetricsCtx, lc fx.Lifecycle, ls stores.LocalStorage, si stores.SectorIndex, cfg *ffiwrapper.Config, sc sectorstorage.SealerConfig, urls sectorstorage.URLs, sa sectorstorage.StorageAuth) (*sectorstorage.Manager, error) {
+func SectorStorage(mctx helpers.MetricsCtx, lc fx.Lifecycle, ls stores.LocalStorage, si stores.SectorIndex, cfg *ffiwrapper.Config, sc sectorstorage.SealerConfig, urls sectorstorage.URLs, sa sectorstorage.StorageAuth, wcfg sealworker.Config) (*sectorstorage.Manager, error) {
 	ctx := helpers.LifecycleCtx(mctx, lc)
 
+	if wcfg.TaskAffinity {
+		si = sealworker.AffinityIndex(si)
+	}
+
 	sst, err := sectorstorage.New(ctx, ls, si, cfg, sc, urls, sa)
 	if err != nil {
 		return nil, err
@@ -358,6 +528,56 @@ func SectorStorage(mctx helpers.MetricsCtx, lc fx.Lifecycle, ls stores.LocalStor
 	return sst, nil
 }
 
+// SectorManager lists sealing calls of the manager as worker jobs
+func SectorManager(m *sectorstorage.Manager, t *sealworker.Tracker) sectorstorage.SectorManager {
+	return t.Manager(m)
+}
+
+func FaultTracker(si stores.SectorIndex, paths storage.LocalPaths, sa sectorstorage.StorageAuth) storage.FaultTracker {
+	return storage.NewFaultTracker(si, paths, http.Header(sa))
+}
+
+// noLocalStorage has no storage paths
+type noLocalStorage struct {
+	stores.LocalStorage
+}
+
+func (noLocalStorage) GetStorage() (stores.StorageConfig, error) {
+	return stores.StorageConfig{}, nil
+}
+
+// SectorRemover removes sector files through the storage holding them. Its
+// local store has no paths, so files in the miner's storage are removed by
+// the sector manager's store over its storage URL, like files of workers
+func SectorRemover(mctx helpers.MetricsCtx, lc fx.Lifecycle, si stores.SectorIndex, sa sectorstorage.StorageAuth) (storage.SectorRemover, error) {
+	local, err := stores.NewLocal(helpers.LifecycleCtx(mctx, lc), noLocalStorage{}, si, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return stores.NewRemote(local, si, http.Header(sa)), nil
+}
+
+func SectorScrubber(mctx helpers.MetricsCtx, lc fx.Lifecycle, api lapi.FullNode, ds dtypes.MetadataDS, si *stores.Index, paths storage.LocalPaths, sealer sectorstorage.SectorManager, verif ffiwrapper.Verifier, sa sectorstorage.StorageAuth, cfg storage.ScrubConfig) (*storage.Scrubber, error) {
+	maddr, err := minerAddrFromDS(ds)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := helpers.LifecycleCtx(mctx, lc)
+
+	scrub := storage.NewScrubber(api, si, paths, sealer, sealer, verif, http.Header(sa), maddr, cfg)
+
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go scrub.Run(ctx)
+			return nil
+		},
+	})
+
+	return scrub, nil
+}
+
 func StorageAuth(ctx helpers.MetricsCtx, ca lapi.Common) (sectorstorage.StorageAuth, error) {
 	token, err := ca.AuthNew(ctx, []lapi.Permission{"admin"})
 	if err != nil {
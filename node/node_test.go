@@ -44,6 +44,7 @@ import (
 	"github.com/filecoin-project/lotus/node/modules"
 	modtest "github.com/filecoin-project/lotus/node/modules/testing"
 	"github.com/filecoin-project/lotus/node/repo"
+	lstorage "github.com/filecoin-project/lotus/storage"
 	sectorstorage "github.com/filecoin-project/sector-storage"
 	"github.com/filecoin-project/sector-storage/mock"
 )
@@ -396,6 +397,8 @@ func mockSbBuilder(t *testing.T, nFull int, storage []test.StorageMiner) ([]test
 				return mock.NewMockSectorMgr(build.DefaultSectorSize()), nil
 			}),
 			node.Override(new(ffiwrapper.Verifier), mock.MockVerifier),
+			node.Override(new(lstorage.FaultTracker), mockstorage.FaultTracker{}),
+			node.Override(new(lstorage.LocalPaths), mockstorage.LocalPaths{}),
 			node.Unset(new(*sectorstorage.Manager)),
 		))
 	}
@@ -0,0 +1,262 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/sector-storage/stores"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+)
+
+// FaultTracker checks whether sectors can be proven
+type FaultTracker interface {
+	// CheckProvable returns sectors which can't be proven, with the reason why
+	CheckProvable(ctx context.Context, spt abi.RegisteredProof, sectors []abi.SectorID) (map[abi.SectorID]string, error)
+}
+
+// LocalPaths returns local storage paths by storage ID
+type LocalPaths interface {
+	StorageLocal(ctx context.Context) (map[stores.ID]string, error)
+}
+
+type sectorFaultTracker struct {
+	index stores.SectorIndex
+	local LocalPaths
+	auth  http.Header
+}
+
+// NewFaultTracker creates a FaultTracker which checks that sealed sector
+// files and the cache files needed for PoSt are present. Files in local
+// storage are checked directly, files in storage of workers are checked
+// through their storage URLs
+func NewFaultTracker(index stores.SectorIndex, local LocalPaths, auth http.Header) FaultTracker {
+	return &sectorFaultTracker{
+		index: index,
+		local: local,
+		auth:  auth,
+	}
+}
+
+// files in the sector cache directory required to generate PoSt
+var postCacheFiles = []string{"p_aux", "t_aux"}
+
+const treeRLastGlob = "sc-*-data-tree-r-last*.dat"
+
+func (ft *sectorFaultTracker) CheckProvable(ctx context.Context, spt abi.RegisteredProof, sectors []abi.SectorID) (map[abi.SectorID]string, error) {
+	ssize, err := spt.SectorSize()
+	if err != nil {
+		return nil, xerrors.Errorf("getting sector size: %w", err)
+	}
+
+	paths, err := ft.local.StorageLocal(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("getting local storage paths: %w", err)
+	}
+
+	bad := map[abi.SectorID]string{}
+	for _, sid := range sectors {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if err := ft.check(ctx, paths, sid, stores.FTSealed, func(path string) error {
+			return checkSealed(path, ssize)
+		}); err != nil {
+			bad[sid] = err.Error()
+			continue
+		}
+		if err := ft.check(ctx, paths, sid, stores.FTCache, checkCache); err != nil {
+			bad[sid] = err.Error()
+			continue
+		}
+	}
+
+	return bad, nil
+}
+
+// check finds sector files in the index, and checks them with checkLocal if
+// they are in local storage, or requests them from the storage holding them
+func (ft *sectorFaultTracker) check(ctx context.Context, paths map[stores.ID]string, sid abi.SectorID, typ stores.SectorFileType, checkLocal func(string) error) error {
+	si, err := ft.index.StorageFindSector(ctx, sid, typ, false)
+	if err != nil {
+		return xerrors.Errorf("finding %s sector files: %w", typ, err)
+	}
+	if len(si) == 0 {
+		return xerrors.Errorf("%s sector files not found in any storage", typ)
+	}
+
+	for _, info := range si {
+		if _, ok := paths[info.ID]; ok {
+			return ft.checkCopy(ctx, paths, info, sid, typ, checkLocal)
+		}
+	}
+
+	var errs []string
+	for _, info := range si {
+		err := ft.checkCopy(ctx, paths, info, sid, typ, checkLocal)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err.Error())
+	}
+
+	return xerrors.Errorf("%s sector files not available from storage holding them: %s", typ, strings.Join(errs, "; "))
+}
+
+// checkCopy checks sector files in one storage, with checkLocal if the
+// storage is local, or through its storage URLs
+func (ft *sectorFaultTracker) checkCopy(ctx context.Context, paths map[stores.ID]string, info stores.StorageInfo, sid abi.SectorID, typ stores.SectorFileType, checkLocal func(string) error) error {
+	if p, ok := paths[info.ID]; ok {
+		return checkLocal(filepath.Join(p, typ.String(), stores.SectorName(sid)))
+	}
+
+	if len(info.URLs) == 0 {
+		return xerrors.Errorf("storage %s has no URLs", info.ID)
+	}
+
+	var errs []string
+	for _, u := range info.URLs {
+		err := ft.remoteStat(ctx, u)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err.Error())
+	}
+	return xerrors.New(strings.Join(errs, "; "))
+}
+
+// remoteStat sends a HEAD request for the sector file URL, which storage
+// serving RemoteStatHandler answers without sending the file
+func (ft *sectorFaultTracker) remoteStat(ctx context.Context, url string) error {
+	req, err := http.NewRequest("HEAD", url, nil)
+	if err != nil {
+		return xerrors.Errorf("request: %w", err)
+	}
+	req.Header = ft.auth.Clone()
+	req = req.WithContext(ctx)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return xerrors.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close() // nolint:errcheck
+
+	if resp.StatusCode != 200 {
+		return xerrors.Errorf("%s: non-200 code: %d", url, resp.StatusCode)
+	}
+	return nil
+}
+
+// RemoteStatHandler answers HEAD requests for /remote/{type}/{id} by checking
+// that the sector file is in one of the local storage paths. Other requests
+// are passed to next, which serves the files
+func RemoteStatHandler(local LocalPaths, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "HEAD" {
+			next(w, r)
+			return
+		}
+
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/remote/"), "/")
+		if len(parts) != 2 {
+			w.WriteHeader(404)
+			return
+		}
+		if _, err := stores.ParseSectorID(parts[1]); err != nil {
+			w.WriteHeader(400)
+			return
+		}
+		known := false
+		for _, typ := range stores.PathTypes {
+			known = known || typ.String() == parts[0]
+		}
+		if !known {
+			w.WriteHeader(400)
+			return
+		}
+
+		paths, err := local.StorageLocal(r.Context())
+		if err != nil {
+			log.Errorf("getting local storage paths: %+v", err)
+			w.WriteHeader(500)
+			return
+		}
+		for _, p := range paths {
+			if _, err := os.Stat(filepath.Join(p, parts[0], parts[1])); err == nil {
+				w.WriteHeader(200)
+				return
+			}
+		}
+		w.WriteHeader(404)
+	}
+}
+
+// StorePaths returns the paths of a local store by storage ID
+type StorePaths struct {
+	*stores.Local
+}
+
+func (s StorePaths) StorageLocal(ctx context.Context) (map[stores.ID]string, error) {
+	l, err := s.Local.Local(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := map[stores.ID]string{}
+	for _, st := range l {
+		out[st.ID] = st.LocalPath
+	}
+	return out, nil
+}
+
+func checkSealed(path string, ssize abi.SectorSize) error {
+	st, err := os.Stat(path)
+	if err != nil {
+		return xerrors.Errorf("sealed sector file: %w", err)
+	}
+
+	if st.Size() != int64(ssize) {
+		return xerrors.Errorf("sealed sector file %s has wrong size %d, expected %d", path, st.Size(), ssize)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return xerrors.Errorf("opening sealed sector file: %w", err)
+	}
+	defer f.Close() // nolint:errcheck
+
+	// make sure the data is actually readable, this catches storage which is
+	// mounted, but broken
+	if _, err := f.ReadAt(make([]byte, 1), int64(ssize)-1); err != nil {
+		return xerrors.Errorf("reading sealed sector file: %w", err)
+	}
+
+	return nil
+}
+
+func checkCache(path string) error {
+	for _, name := range postCacheFiles {
+		st, err := os.Stat(filepath.Join(path, name))
+		if err != nil {
+			return xerrors.Errorf("sector cache: %w", err)
+		}
+		if st.Size() == 0 {
+			return xerrors.Errorf("sector cache file %s is empty", name)
+		}
+	}
+
+	tree, err := filepath.Glob(filepath.Join(path, treeRLastGlob))
+	if err != nil {
+		return xerrors.Errorf("looking for tree-r-last: %w", err)
+	}
+	if len(tree) == 0 {
+		return xerrors.Errorf("sector cache %s is missing tree-r-last", path)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/filecoin-project/sector-storage/stores"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+)
+
+type testPaths map[stores.ID]string
+
+func (p testPaths) StorageLocal(ctx context.Context) (map[stores.ID]string, error) {
+	return p, nil
+}
+
+func TestCheckProvable(t *testing.T) {
+	ts := newTestStorage(t)
+	defer ts.close()
+
+	ts.attach("local", true, true)
+
+	ssize, err := testProof.SectorSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the worker holds sector 3, the files of sector 4 are gone
+	workerDir := filepath.Join(ts.root, "worker")
+	writeSectorFiles(t, workerDir, abi.SectorID{Miner: 1000, Number: 3}, int64(ssize))
+
+	stat := RemoteStatHandler(testPaths{"worker": workerDir}, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected %s request for %s", r.Method, r.URL.Path)
+		w.WriteHeader(405)
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(401)
+			return
+		}
+		stat(w, r)
+	}))
+	defer srv.Close()
+
+	err = ts.index.StorageAttach(context.TODO(), stores.StorageInfo{
+		ID:       "worker",
+		URLs:     []string{srv.URL + "/remote"},
+		CanStore: true,
+	}, stores.FsStat{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sid := func(n abi.SectorNumber) abi.SectorID {
+		return abi.SectorID{Miner: 1000, Number: n}
+	}
+
+	ts.addSector("local", sid(1))
+	ts.addSector("local", sid(2))
+	ts.addSector("worker", sid(3))
+	ts.addSector("worker", sid(4))
+	// sector 5 isn't stored anywhere
+
+	if err := os.RemoveAll(filepath.Join(ts.paths["local"], stores.FTCache.String(), stores.SectorName(sid(2)), "p_aux")); err != nil {
+		t.Fatal(err)
+	}
+
+	auth := http.Header{}
+	auth.Set("Authorization", "Bearer token")
+	ft := NewFaultTracker(ts.index, ts, auth)
+
+	bad, err := ft.CheckProvable(context.TODO(), testProof, []abi.SectorID{sid(1), sid(2), sid(3), sid(4), sid(5)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := map[abi.SectorNumber]string{
+		2: "sector cache",
+		4: "non-200 code: 404",
+		5: "not found in any storage",
+	}
+	if len(bad) != len(expect) {
+		t.Errorf("expected %d bad sectors, got %v", len(expect), bad)
+	}
+	for num, reason := range expect {
+		if got, ok := bad[sid(num)]; !ok || !strings.Contains(got, reason) {
+			t.Errorf("sector %d: expected %q, got %q", num, reason, got)
+		}
+	}
+}
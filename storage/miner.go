@@ -37,11 +37,14 @@ type Miner struct {
 	ds     datastore.Batching
 	sc     sealing.SectorIDCounter
 	verif  ffiwrapper.Verifier
+	notif  *SectorNotifier
+	limits SealingLimits
 
 	maddr  address.Address
 	worker address.Address
 
 	sealing *sealing.Sealing
+	pledger *pledger
 }
 
 type storageMinerApi interface {
@@ -58,6 +61,7 @@ type storageMinerApi interface {
 	StateGetReceipt(context.Context, cid.Cid, types.TipSetKey) (*types.MessageReceipt, error)
 	StateMarketStorageDeal(context.Context, abi.DealID, types.TipSetKey) (*api.MarketDeal, error)
 	StateMinerFaults(context.Context, address.Address, types.TipSetKey) ([]abi.SectorNumber, error)
+	StateMinerRecoveries(context.Context, address.Address, types.TipSetKey) ([]abi.SectorNumber, error)
 
 	MpoolPushMessage(context.Context, *types.Message) (*types.SignedMessage, error)
 
@@ -74,7 +78,7 @@ type storageMinerApi interface {
 	WalletHas(context.Context, address.Address) (bool, error)
 }
 
-func NewMiner(api storageMinerApi, maddr, worker address.Address, h host.Host, ds datastore.Batching, sealer sectorstorage.SectorManager, sc sealing.SectorIDCounter, verif ffiwrapper.Verifier) (*Miner, error) {
+func NewMiner(api storageMinerApi, maddr, worker address.Address, h host.Host, ds datastore.Batching, sealer sectorstorage.SectorManager, sc sealing.SectorIDCounter, verif ffiwrapper.Verifier, notif *SectorNotifier, limits SealingLimits) (*Miner, error) {
 	m := &Miner{
 		api:    api,
 		h:      h,
@@ -82,6 +86,8 @@ func NewMiner(api storageMinerApi, maddr, worker address.Address, h host.Host, d
 		ds:     ds,
 		sc:     sc,
 		verif:  verif,
+		notif:  notif,
+		limits: limits,
 
 		maddr:  maddr,
 		worker: worker,
@@ -103,9 +109,12 @@ func (m *Miner) Run(ctx context.Context) error {
 	evts := events.NewEvents(ctx, m.api)
 	adaptedAPI := NewSealingAPIAdapter(m.api)
 	pcp := sealing.NewBasicPreCommitPolicy(adaptedAPI, 10000000, md.PeriodStart%miner.WPoStProvingPeriod)
-	m.sealing = sealing.New(adaptedAPI, NewEventsAdapter(evts), m.maddr, m.ds, m.sealer, m.sc, m.verif, &pcp)
+	m.sealing = sealing.New(adaptedAPI, NewEventsAdapter(evts), m.maddr, m.notif.Wrap(m.ds), m.sealer, m.sc, m.verif, &pcp)
+
+	m.pledger = newPledger(m.limits, m.sealing, m.notif)
 
 	go m.sealing.Run(ctx)
+	go m.pledger.run(ctx)
 
 	return nil
 }
@@ -0,0 +1,24 @@
+package mockstorage
+
+import (
+	"context"
+
+	"github.com/filecoin-project/sector-storage/stores"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+)
+
+// FaultTracker reports all sectors as provable, for use with the mock sector
+// manager which doesn't store sector files
+type FaultTracker struct{}
+
+func (FaultTracker) CheckProvable(ctx context.Context, spt abi.RegisteredProof, sectors []abi.SectorID) (map[abi.SectorID]string, error) {
+	return map[abi.SectorID]string{}, nil
+}
+
+// LocalPaths has no storage paths, the mock sector manager doesn't store
+// sector files
+type LocalPaths struct{}
+
+func (LocalPaths) StorageLocal(ctx context.Context) (map[stores.ID]string, error) {
+	return map[stores.ID]string{}, nil
+}
@@ -0,0 +1,267 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	sealing "github.com/filecoin-project/storage-fsm"
+
+	"github.com/filecoin-project/lotus/api"
+)
+
+const (
+	// pledgeCheckInterval is how often queued and automatic pledges are
+	// reconsidered when no sector changes state
+	pledgeCheckInterval = time.Minute
+	// pledgeStartTimeout is how long a started pledge counts against the
+	// limits before its sector shows up in the sealing state machine
+	pledgeStartTimeout = 2 * time.Hour
+)
+
+// SealingLimits configures how many sectors may be sealed at once. Zero
+// values mean no limit
+type SealingLimits struct {
+	// MaxSealingSectors limits all sectors in flight, from packing until
+	// proving
+	MaxSealingSectors int
+
+	MaxPreCommit1 int
+	MaxPreCommit2 int
+	MaxWaitSeed   int
+	MaxCommit     int
+
+	// AutoPledge pledges committed capacity sectors whenever the pipeline has
+	// room below the limits. Requires MaxSealingSectors to be set
+	AutoPledge bool
+}
+
+// stage groups sealing states which count against the same limit
+type stage int
+
+const (
+	stagePreCommit1 stage = iota
+	stagePreCommit2
+	stageWaitSeed
+	stageCommit
+	stageOther
+)
+
+func sealingStage(st sealing.SectorState) stage {
+	switch st {
+	case sealing.Empty, sealing.Packing, sealing.PreCommit1:
+		return stagePreCommit1
+	case sealing.PreCommit2:
+		return stagePreCommit2
+	case sealing.PreCommitting, sealing.WaitSeed:
+		return stageWaitSeed
+	case sealing.Committing, sealing.CommitWait:
+		return stageCommit
+	default:
+		return stageOther
+	}
+}
+
+// inFlight reports whether a sector in the given state still occupies the
+// sealing pipeline
+func inFlight(st sealing.SectorState) bool {
+	switch st {
+	case sealing.Proving, sealing.FailedUnrecoverable, sealing.Faulty, sealing.FaultReported, sealing.FaultedFinal:
+		return false
+	default:
+		return true
+	}
+}
+
+// pledgeSealing is the part of the sealing state machine the pledger uses
+type pledgeSealing interface {
+	PledgeSector() error
+	ListSectors() ([]sealing.SectorInfo, error)
+	GetSectorInfo(abi.SectorNumber) (sealing.SectorInfo, error)
+}
+
+// pledger starts committed capacity sectors while the sealing pipeline is
+// below the configured limits
+type pledger struct {
+	limits  SealingLimits
+	sealing pledgeSealing
+	notif   *SectorNotifier
+
+	lk      sync.Mutex
+	queued  int
+	started []time.Time
+
+	wake chan struct{}
+}
+
+func newPledger(limits SealingLimits, s pledgeSealing, notif *SectorNotifier) *pledger {
+	if limits.AutoPledge && limits.MaxSealingSectors <= 0 {
+		log.Warn("auto-pledge requires MaxSealingSectors to be set, disabling")
+		limits.AutoPledge = false
+	}
+
+	return &pledger{
+		limits:  limits,
+		sealing: s,
+		notif:   notif,
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// pledge starts a sector right away, regardless of the limits. It counts
+// against them like queued pledges
+func (p *pledger) pledge() error {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	if err := p.sealing.PledgeSector(); err != nil {
+		return err
+	}
+
+	p.started = append(p.started, time.Now())
+	return nil
+}
+
+// enqueue adds n sectors to be pledged as soon as limits allow
+func (p *pledger) enqueue(n int) {
+	p.lk.Lock()
+	p.queued += n
+	p.lk.Unlock()
+
+	p.poke()
+}
+
+func (p *pledger) poke() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (p *pledger) run(ctx context.Context) {
+	changes := p.notif.Subscribe(ctx)
+
+	tick := time.NewTicker(pledgeCheckInterval)
+	defer tick.Stop()
+
+	for {
+		if err := p.pledgeAvailable(); err != nil {
+			log.Errorf("pledging sectors: %+v", err)
+		}
+
+		select {
+		case change, ok := <-changes:
+			if !ok {
+				return
+			}
+			// new sectors start in Packing
+			if change.To == api.SectorState(sealing.Packing) && change.From != change.To {
+				p.sectorCreated(change.Sector)
+			}
+		case <-p.wake:
+		case <-tick.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sectorCreated stops counting the oldest started pledge once a pledged
+// sector enters the state machine. Sectors for deals don't count, their
+// pieces are in deals
+func (p *pledger) sectorCreated(num abi.SectorNumber) {
+	si, err := p.sealing.GetSectorInfo(num)
+	if err != nil {
+		log.Warnf("getting info of new sector %d: %+v", num, err)
+		return
+	}
+	if !pledged(si) {
+		return
+	}
+
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	if len(p.started) > 0 {
+		p.started = p.started[1:]
+	}
+}
+
+// pledged reports whether the sector only holds pledge pieces
+func pledged(si sealing.SectorInfo) bool {
+	for _, piece := range si.Pieces {
+		if piece.DealInfo != nil {
+			return false
+		}
+	}
+	return len(si.Pieces) > 0
+}
+
+func (p *pledger) pledgeAvailable() error {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+
+	if p.queued == 0 && !p.limits.AutoPledge {
+		return nil
+	}
+
+	for len(p.started) > 0 && time.Since(p.started[0]) > pledgeStartTimeout {
+		p.started = p.started[1:]
+	}
+
+	sectors, err := p.sealing.ListSectors()
+	if err != nil {
+		return xerrors.Errorf("listing sectors: %w", err)
+	}
+
+	var total int
+	stages := map[stage]int{}
+	for _, s := range sectors {
+		if !inFlight(s.State) {
+			continue
+		}
+		total++
+		stages[sealingStage(s.State)]++
+	}
+
+	// pledges which didn't create their sector yet are on the way into
+	// PreCommit1
+	total += len(p.started)
+	stages[stagePreCommit1] += len(p.started)
+
+	for p.queued > 0 || p.limits.AutoPledge {
+		if !p.limits.allows(total, stages) {
+			return nil
+		}
+
+		if err := p.sealing.PledgeSector(); err != nil {
+			return err
+		}
+
+		if p.queued > 0 {
+			p.queued--
+		}
+		p.started = append(p.started, time.Now())
+		total++
+		stages[stagePreCommit1]++
+	}
+
+	return nil
+}
+
+// allows reports whether another sector can be pledged. New sectors aren't
+// started while any stage of the pipeline is full
+func (l SealingLimits) allows(total int, stages map[stage]int) bool {
+	return under(total, l.MaxSealingSectors) &&
+		under(stages[stagePreCommit1], l.MaxPreCommit1) &&
+		under(stages[stagePreCommit2], l.MaxPreCommit2) &&
+		under(stages[stageWaitSeed], l.MaxWaitSeed) &&
+		under(stages[stageCommit], l.MaxCommit)
+}
+
+func under(n, limit int) bool {
+	return limit <= 0 || n < limit
+}
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	sealing "github.com/filecoin-project/storage-fsm"
+)
+
+type testPledgeSealing struct {
+	sectors map[abi.SectorNumber]sealing.SectorInfo
+	pledged int
+}
+
+func (s *testPledgeSealing) PledgeSector() error {
+	s.pledged++
+	return nil
+}
+
+func (s *testPledgeSealing) ListSectors() ([]sealing.SectorInfo, error) {
+	out := make([]sealing.SectorInfo, 0, len(s.sectors))
+	for _, si := range s.sectors {
+		out = append(out, si)
+	}
+	return out, nil
+}
+
+func (s *testPledgeSealing) GetSectorInfo(num abi.SectorNumber) (sealing.SectorInfo, error) {
+	return s.sectors[num], nil
+}
+
+func (s *testPledgeSealing) add(num abi.SectorNumber, state sealing.SectorState, deal bool) {
+	piece := sealing.Piece{Piece: abi.PieceInfo{Size: 2048}}
+	if deal {
+		piece.DealInfo = &sealing.DealInfo{DealID: 1}
+	}
+
+	s.sectors[num] = sealing.SectorInfo{
+		SectorNumber: num,
+		State:        state,
+		Pieces:       []sealing.Piece{piece},
+	}
+}
+
+func newTestPledger(limits SealingLimits) (*pledger, *testPledgeSealing) {
+	s := &testPledgeSealing{sectors: map[abi.SectorNumber]sealing.SectorInfo{}}
+	return newPledger(limits, s, nil), s
+}
+
+func TestPledgeAvailable(t *testing.T) {
+	p, s := newTestPledger(SealingLimits{MaxSealingSectors: 5, MaxPreCommit1: 2})
+	s.add(1, sealing.PreCommit2, false)
+	s.add(2, sealing.Proving, false)
+
+	p.enqueue(3)
+	if err := p.pledgeAvailable(); err != nil {
+		t.Fatal(err)
+	}
+	// PreCommit1 is full after two pledges
+	if s.pledged != 2 || p.queued != 1 || len(p.started) != 2 {
+		t.Fatalf("expected 2 pledged and 1 queued, got %d and %d", s.pledged, p.queued)
+	}
+
+	// a new deal sector is still on the way into PreCommit1
+	s.add(3, sealing.Packing, true)
+	p.sectorCreated(3)
+	if len(p.started) != 2 {
+		t.Fatalf("expected deal sector not to count as pledge, got %d started", len(p.started))
+	}
+
+	s.add(4, sealing.Packing, false)
+	p.sectorCreated(4)
+	if len(p.started) != 1 {
+		t.Fatalf("expected 1 pledge still starting, got %d", len(p.started))
+	}
+
+	// sectors 3 and 4, and the pledge still starting fill PreCommit1
+	if err := p.pledgeAvailable(); err != nil {
+		t.Fatal(err)
+	}
+	if s.pledged != 2 {
+		t.Fatalf("expected no more pledges, got %d", s.pledged)
+	}
+
+	s.add(3, sealing.PreCommit2, true)
+	s.add(4, sealing.PreCommit2, false)
+	if err := p.pledgeAvailable(); err != nil {
+		t.Fatal(err)
+	}
+	// 1, 3, 4, the starting pledge and the new one reach MaxSealingSectors
+	if s.pledged != 3 || p.queued != 0 {
+		t.Fatalf("expected all queued sectors pledged, got %d pledged, %d queued", s.pledged, p.queued)
+	}
+}
+
+func TestPledgeSector(t *testing.T) {
+	p, s := newTestPledger(SealingLimits{MaxSealingSectors: 1})
+	s.add(1, sealing.PreCommit1, false)
+
+	// pledging a single sector doesn't wait for the limits
+	if err := p.pledge(); err != nil {
+		t.Fatal(err)
+	}
+	if s.pledged != 1 || len(p.started) != 1 {
+		t.Fatalf("expected a started pledge, got %d", s.pledged)
+	}
+
+	p.enqueue(1)
+	if err := p.pledgeAvailable(); err != nil {
+		t.Fatal(err)
+	}
+	if s.pledged != 1 || p.queued != 1 {
+		t.Fatalf("expected the queued pledge to wait, got %d pledged", s.pledged)
+	}
+}
+
+func TestAutoPledge(t *testing.T) {
+	p, _ := newTestPledger(SealingLimits{AutoPledge: true})
+	if p.limits.AutoPledge {
+		t.Fatal("expected auto-pledge without MaxSealingSectors to be disabled")
+	}
+
+	p, s := newTestPledger(SealingLimits{AutoPledge: true, MaxSealingSectors: 3})
+	s.add(1, sealing.WaitSeed, false)
+	if err := p.pledgeAvailable(); err != nil {
+		t.Fatal(err)
+	}
+	if s.pledged != 2 {
+		t.Fatalf("expected pledges up to the limit, got %d", s.pledged)
+	}
+}
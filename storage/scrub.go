@@ -0,0 +1,644 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/sector-storage/ffiwrapper"
+	"github.com/filecoin-project/sector-storage/stores"
+	"github.com/filecoin-project/sector-storage/tarutil"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-storage/storage"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+// ScrubConfig configures the background sector storage scrubber
+type ScrubConfig struct {
+	// Interval between full scrubs, 0 disables background scrubbing
+	Interval time.Duration
+	// Verify proves each sector against its on-chain SealedCID
+	Verify bool
+	// Repair moves misplaced sector files into long-term storage, and fetches
+	// damaged files again from a good copy
+	Repair bool
+}
+
+// SectorFinalizer moves sealed sector files into long-term storage
+type SectorFinalizer interface {
+	FinalizeSector(ctx context.Context, sector abi.SectorID) error
+}
+
+// Scrubber checks that files of proven sectors are present in long-term
+// storage of the miner or its workers, and optionally repairs sectors which
+// aren't. Misplaced files are moved through the sector manager, which owns
+// the storage paths, damaged files are fetched again from a good copy
+type Scrubber struct {
+	api    storageMinerApi
+	index  *stores.Index
+	paths  LocalPaths
+	sealer SectorFinalizer
+	prover storage.Prover
+	verif  ffiwrapper.Verifier
+	ft     *sectorFaultTracker
+
+	maddr address.Address
+	cfg   ScrubConfig
+
+	// only one scrub at a time, repairs of the same sector would race
+	runLk sync.Mutex
+
+	lk     sync.Mutex
+	status api.ScrubStatus
+}
+
+func NewScrubber(api storageMinerApi, index *stores.Index, paths LocalPaths, sealer SectorFinalizer, prover storage.Prover, verif ffiwrapper.Verifier, auth http.Header, maddr address.Address, cfg ScrubConfig) *Scrubber {
+	return &Scrubber{
+		api:    api,
+		index:  index,
+		paths:  paths,
+		sealer: sealer,
+		prover: prover,
+		verif:  verif,
+		ft: &sectorFaultTracker{
+			index: index,
+			local: paths,
+			auth:  auth,
+		},
+
+		maddr: maddr,
+		cfg:   cfg,
+	}
+}
+
+func (s *Scrubber) Run(ctx context.Context) {
+	if s.cfg.Interval <= 0 {
+		log.Info("background sector scrubbing disabled")
+		return
+	}
+
+	tick := time.NewTicker(s.cfg.Interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return
+		}
+
+		res, err := s.Check(ctx, nil, api.ScrubOptions{Verify: s.cfg.Verify, Repair: s.cfg.Repair})
+		if err != nil {
+			log.Errorf("sector scrub failed: %+v", err)
+			continue
+		}
+
+		for _, r := range res {
+			switch {
+			case r.Err != "":
+				log.Warnw("sector scrub found a bad sector", "sector", r.Sector, "error", r.Err)
+			case r.Repaired != "":
+				log.Infow("sector scrub repaired sector", "sector", r.Sector, "repair", r.Repaired)
+			}
+		}
+	}
+}
+
+// Status returns the results of the last full scrub
+func (s *Scrubber) Status() api.ScrubStatus {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	out := s.status
+	out.Results = make([]api.SectorCheck, len(s.status.Results))
+	copy(out.Results, s.status.Results)
+	return out
+}
+
+// Check checks the given sectors, or all sectors in storage and on chain if
+// none are given
+func (s *Scrubber) Check(ctx context.Context, sectors []abi.SectorNumber, opts api.ScrubOptions) ([]api.SectorCheck, error) {
+	s.runLk.Lock()
+	defer s.runLk.Unlock()
+
+	full := len(sectors) == 0
+	if full {
+		s.lk.Lock()
+		s.status.Running = true
+		s.lk.Unlock()
+
+		defer func() {
+			s.lk.Lock()
+			s.status.Running = false
+			s.lk.Unlock()
+		}()
+	}
+
+	mid, err := address.IDFromAddress(s.maddr)
+	if err != nil {
+		return nil, err
+	}
+
+	mi, err := s.api.StateMinerInfo(ctx, s.maddr, types.EmptyTSK)
+	if err != nil {
+		return nil, xerrors.Errorf("getting miner info: %w", err)
+	}
+
+	onChain, err := s.api.StateMinerSectors(ctx, s.maddr, nil, false, types.EmptyTSK)
+	if err != nil {
+		return nil, xerrors.Errorf("getting miner sectors: %w", err)
+	}
+
+	sealedCIDs := map[abi.SectorNumber]abi.SectorInfo{}
+	for _, info := range onChain {
+		sealedCIDs[info.ID] = abi.SectorInfo{
+			RegisteredProof: info.Info.Info.RegisteredProof,
+			SectorNumber:    info.ID,
+			SealedCID:       info.Info.Info.SealedCID,
+		}
+	}
+
+	if full {
+		sectors, err = s.listSectors(ctx, abi.ActorID(mid), sealedCIDs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]api.SectorCheck, 0, len(sectors))
+	for _, num := range sectors {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		info, ok := sealedCIDs[num]
+		res := api.SectorCheck{
+			Sector:  num,
+			OnChain: ok,
+		}
+
+		if err := s.checkSector(ctx, &res, abi.ActorID(mid), mi.SealProofType, info, opts); err != nil {
+			res.Err = err.Error()
+		}
+		res.Checked = time.Now()
+
+		out = append(out, res)
+	}
+
+	if full {
+		s.lk.Lock()
+		s.status.LastRun = time.Now()
+		s.status.Results = out
+		s.lk.Unlock()
+	}
+
+	return out, nil
+}
+
+// listSectors returns sectors of this miner declared in any storage, and
+// all sectors on chain
+func (s *Scrubber) listSectors(ctx context.Context, mid abi.ActorID, onChain map[abi.SectorNumber]abi.SectorInfo) ([]abi.SectorNumber, error) {
+	decls, err := s.index.StorageList(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("listing storage: %w", err)
+	}
+
+	found := map[abi.SectorNumber]struct{}{}
+	for num := range onChain {
+		found[num] = struct{}{}
+	}
+	for _, ds := range decls {
+		for _, decl := range ds {
+			if decl.Miner != mid || decl.SectorFileType&(stores.FTSealed|stores.FTCache) == 0 {
+				continue
+			}
+			found[decl.Number] = struct{}{}
+		}
+	}
+
+	out := make([]abi.SectorNumber, 0, len(found))
+	for num := range found {
+		out = append(out, num)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i] < out[j]
+	})
+
+	return out, nil
+}
+
+func (s *Scrubber) checkSector(ctx context.Context, res *api.SectorCheck, mid abi.ActorID, spt abi.RegisteredProof, info abi.SectorInfo, opts api.ScrubOptions) error {
+	sid := abi.SectorID{Miner: mid, Number: res.Sector}
+
+	if _, err := s.findStorage(ctx, res, sid); err != nil {
+		return err
+	}
+
+	if !res.OnChain {
+		// still sealing, the sealing pipeline takes care of those files
+		return nil
+	}
+
+	if len(res.Sealed) == 0 || len(res.Cache) == 0 {
+		return xerrors.Errorf("sector files not found in any storage (sealed: %d, cache: %d)", len(res.Sealed), len(res.Cache))
+	}
+
+	ssize, err := spt.SectorSize()
+	if err != nil {
+		return err
+	}
+
+	paths, err := s.localPaths(ctx)
+	if err != nil {
+		return err
+	}
+
+	copies, err := s.checkCopies(ctx, res, sid, paths, ssize)
+	if err != nil {
+		return err
+	}
+
+	if opts.Repair {
+		var repaired []string
+		for _, c := range copies {
+			if len(c.bad) == 0 {
+				continue
+			}
+
+			r, err := s.refetch(ctx, paths, sid, c)
+			if err != nil {
+				return xerrors.Errorf("repairing %s: %w", c.typ, err)
+			}
+			repaired = append(repaired, r)
+		}
+
+		if len(repaired) > 0 {
+			if copies, err = s.checkCopies(ctx, res, sid, paths, ssize); err != nil {
+				return err
+			}
+		}
+
+		if misplaced(copies) {
+			// finalizing moves the files into long-term storage on the worker
+			// holding them, the same way sealing does
+			if err := s.sealer.FinalizeSector(ctx, sid); err != nil {
+				return xerrors.Errorf("moving sector files to long-term storage: %w", err)
+			}
+
+			if copies, err = s.checkCopies(ctx, res, sid, paths, ssize); err != nil {
+				return err
+			}
+			if misplaced(copies) {
+				return xerrors.Errorf("sector files still not in long-term storage after repair")
+			}
+			repaired = append(repaired, "moved to long-term storage")
+		}
+
+		res.Repaired = strings.Join(repaired, ", ")
+	}
+
+	res.Misplaced = misplaced(copies)
+	for _, c := range copies {
+		if len(c.bad) > 0 {
+			return c.err()
+		}
+	}
+
+	if !opts.Verify {
+		return nil
+	}
+
+	// the prover only reads files from local storage
+	for _, c := range copies {
+		if !c.local(paths) {
+			return xerrors.Errorf("can't verify, %s not in local storage", c.typ)
+		}
+	}
+
+	if err := s.verify(ctx, mid, info); err != nil {
+		return err
+	}
+	res.Verified = true
+
+	return nil
+}
+
+// sectorCopies are the copies of a sector file type, by whether they pass
+// the file checks
+type sectorCopies struct {
+	typ  stores.SectorFileType
+	good []stores.StorageInfo
+	bad  []stores.StorageInfo
+	errs []string
+}
+
+func (c *sectorCopies) err() error {
+	ids := storageIDs(c.bad)
+	names := make([]string, len(ids))
+	for i, id := range ids {
+		names[i] = string(id)
+	}
+	return xerrors.Errorf("damaged %s in storage %s: %s", c.typ, strings.Join(names, ", "), strings.Join(c.errs, "; "))
+}
+
+func (c *sectorCopies) local(paths map[stores.ID]stores.StoragePath) bool {
+	for _, info := range c.good {
+		if _, ok := paths[info.ID]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func misplaced(copies []*sectorCopies) bool {
+	for _, c := range copies {
+		if !inLongTerm(c.good) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCopies checks every copy of the sealed sector file and the sector
+// cache, local copies directly and copies held by workers through their
+// storage URLs
+func (s *Scrubber) checkCopies(ctx context.Context, res *api.SectorCheck, sid abi.SectorID, paths map[stores.ID]stores.StoragePath, ssize abi.SectorSize) ([]*sectorCopies, error) {
+	found, err := s.findStorage(ctx, res, sid)
+	if err != nil {
+		return nil, err
+	}
+
+	local := map[stores.ID]string{}
+	for id, p := range paths {
+		local[id] = p.LocalPath
+	}
+
+	checks := map[stores.SectorFileType]func(string) error{
+		stores.FTSealed: func(path string) error {
+			return checkSealed(path, ssize)
+		},
+		stores.FTCache: checkCache,
+	}
+
+	var out []*sectorCopies
+	for _, typ := range []stores.SectorFileType{stores.FTSealed, stores.FTCache} {
+		c := &sectorCopies{typ: typ}
+		for _, info := range found[typ] {
+			if err := s.ft.checkCopy(ctx, local, info, sid, typ, checks[typ]); err != nil {
+				c.bad = append(c.bad, info)
+				c.errs = append(c.errs, err.Error())
+				continue
+			}
+			c.good = append(c.good, info)
+		}
+
+		if len(c.good) == 0 {
+			return nil, xerrors.Errorf("no good copy of %s: %s", typ, strings.Join(c.errs, "; "))
+		}
+		out = append(out, c)
+	}
+
+	return out, nil
+}
+
+// refetch replaces damaged copies with a good copy in local long-term
+// storage, fetched from the storage holding it unless long-term storage
+// already has one. Damaged copies are dropped from the index, and removed if
+// they are local
+func (s *Scrubber) refetch(ctx context.Context, paths map[stores.ID]stores.StoragePath, sid abi.SectorID, c *sectorCopies) (string, error) {
+	name := filepath.Join(c.typ.String(), stores.SectorName(sid))
+
+	var fetched stores.ID
+	if !inLongTerm(c.good) {
+		dest, ok := fetchDest(paths, c.bad)
+		if !ok {
+			return "", xerrors.Errorf("no local long-term storage to fetch into")
+		}
+
+		var urls []string
+		for _, info := range c.good {
+			urls = append(urls, info.URLs...)
+		}
+		if err := s.fetch(ctx, urls, filepath.Join(dest.LocalPath, name)); err != nil {
+			return "", err
+		}
+		if err := s.index.StorageDeclareSector(ctx, dest.ID, sid, c.typ); err != nil {
+			return "", xerrors.Errorf("declaring fetched %s: %w", c.typ, err)
+		}
+		fetched = dest.ID
+	}
+
+	for _, info := range c.bad {
+		if info.ID == fetched {
+			// replaced by the fetched copy
+			continue
+		}
+
+		if p, ok := paths[info.ID]; ok {
+			if err := os.RemoveAll(filepath.Join(p.LocalPath, name)); err != nil {
+				return "", xerrors.Errorf("removing damaged %s: %w", c.typ, err)
+			}
+		}
+		if err := s.index.StorageDropSector(ctx, info.ID, sid, c.typ); err != nil {
+			return "", xerrors.Errorf("dropping damaged %s from the index: %w", c.typ, err)
+		}
+	}
+
+	if fetched != "" {
+		return fmt.Sprintf("fetched %s into %s", c.typ, fetched), nil
+	}
+	return fmt.Sprintf("dropped damaged %s", c.typ), nil
+}
+
+// fetchDest picks the local long-term storage holding a damaged copy, or the
+// one with the highest weight
+func fetchDest(paths map[stores.ID]stores.StoragePath, bad []stores.StorageInfo) (stores.StoragePath, bool) {
+	for _, info := range bad {
+		if p, ok := paths[info.ID]; ok && p.CanStore {
+			return p, true
+		}
+	}
+
+	var best stores.StoragePath
+	for _, p := range paths {
+		if p.CanStore && (best.ID == "" || p.Weight > best.Weight) {
+			best = p
+		}
+	}
+	return best, best.ID != ""
+}
+
+// fetch downloads sector files from the first URL serving them into dest,
+// replacing anything there only once the download is complete
+func (s *Scrubber) fetch(ctx context.Context, urls []string, dest string) error {
+	tmp := dest + ".fetch"
+
+	var errs []string
+	for _, u := range urls {
+		if err := s.fetchURL(ctx, u, tmp); err != nil {
+			errs = append(errs, err.Error())
+			_ = os.RemoveAll(tmp)
+			continue
+		}
+
+		if err := os.RemoveAll(dest); err != nil {
+			return xerrors.Errorf("removing damaged files: %w", err)
+		}
+		if err := os.Rename(tmp, dest); err != nil {
+			return xerrors.Errorf("moving fetched files: %w", err)
+		}
+		return nil
+	}
+
+	return xerrors.Errorf("fetching sector files: %s", strings.Join(errs, "; "))
+}
+
+func (s *Scrubber) fetchURL(ctx context.Context, url string, out string) error {
+	log.Infof("fetching %s -> %s", url, out)
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return xerrors.Errorf("request: %w", err)
+	}
+	req.Header = s.ft.auth.Clone()
+	req = req.WithContext(ctx)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return xerrors.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close() // nolint:errcheck
+
+	if resp.StatusCode != 200 {
+		return xerrors.Errorf("%s: non-200 code: %d", url, resp.StatusCode)
+	}
+
+	mediatype, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return xerrors.Errorf("parse media type: %w", err)
+	}
+
+	switch mediatype {
+	case "application/x-tar":
+		return tarutil.ExtractTar(resp.Body, out)
+	case "application/octet-stream":
+		f, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, resp.Body); err != nil {
+			_ = f.Close()
+			return err
+		}
+		return f.Close()
+	default:
+		return xerrors.Errorf("%s: unknown content type: '%s'", url, mediatype)
+	}
+}
+
+// findStorage finds the storage holding sealed and cache files of the sector
+func (s *Scrubber) findStorage(ctx context.Context, res *api.SectorCheck, sid abi.SectorID) (map[stores.SectorFileType][]stores.StorageInfo, error) {
+	sealed, err := s.index.StorageFindSector(ctx, sid, stores.FTSealed, false)
+	if err != nil {
+		return nil, xerrors.Errorf("finding sealed sector: %w", err)
+	}
+	cache, err := s.index.StorageFindSector(ctx, sid, stores.FTCache, false)
+	if err != nil {
+		return nil, xerrors.Errorf("finding sector cache: %w", err)
+	}
+
+	res.Sealed = storageIDs(sealed)
+	res.Cache = storageIDs(cache)
+	return map[stores.SectorFileType][]stores.StorageInfo{
+		stores.FTSealed: sealed,
+		stores.FTCache:  cache,
+	}, nil
+}
+
+// verify generates a single sector PoSt over a random challenge and checks
+// it against the on-chain SealedCID
+func (s *Scrubber) verify(ctx context.Context, mid abi.ActorID, info abi.SectorInfo) error {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return xerrors.Errorf("generating challenge: %w", err)
+	}
+	// make sure the challenge is a valid field element
+	challenge[31] &= 0x3f
+
+	ssi := []abi.SectorInfo{info}
+
+	proofs, err := s.prover.GenerateWinningPoSt(ctx, mid, ssi, challenge)
+	if err != nil {
+		return xerrors.Errorf("generating proof: %w", err)
+	}
+
+	ok, err := s.verif.VerifyWinningPoSt(ctx, abi.WinningPoStVerifyInfo{
+		Randomness:        challenge,
+		Proofs:            proofs,
+		ChallengedSectors: ssi,
+		Prover:            mid,
+	})
+	if err != nil {
+		return xerrors.Errorf("verifying proof: %w", err)
+	}
+	if !ok {
+		return xerrors.Errorf("proof doesn't verify against on-chain SealedCID %s", info.SealedCID)
+	}
+
+	return nil
+}
+
+func (s *Scrubber) localPaths(ctx context.Context) (map[stores.ID]stores.StoragePath, error) {
+	local, err := s.paths.StorageLocal(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("getting local storage paths: %w", err)
+	}
+
+	out := map[stores.ID]stores.StoragePath{}
+	for id, path := range local {
+		info, err := s.index.StorageInfo(ctx, id)
+		if err != nil {
+			return nil, xerrors.Errorf("getting storage %s info: %w", id, err)
+		}
+
+		out[id] = stores.StoragePath{
+			ID:        id,
+			Weight:    info.Weight,
+			LocalPath: path,
+			CanSeal:   info.CanSeal,
+			CanStore:  info.CanStore,
+		}
+	}
+	return out, nil
+}
+
+func storageIDs(infos []stores.StorageInfo) []stores.ID {
+	out := make([]stores.ID, len(infos))
+	for i, info := range infos {
+		out[i] = info.ID
+	}
+	return out
+}
+
+func inLongTerm(infos []stores.StorageInfo) bool {
+	for _, info := range infos {
+		if info.CanStore {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,457 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/sector-storage/ffiwrapper"
+	"github.com/filecoin-project/sector-storage/stores"
+	"github.com/filecoin-project/sector-storage/tarutil"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+	"github.com/filecoin-project/specs-storage/storage"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+const testProof = abi.RegisteredProof_StackedDRG2KiBSeal
+
+// testStorage is local storage with sector files in temporary directories
+type testStorage struct {
+	t     *testing.T
+	root  string
+	index *stores.Index
+	paths map[stores.ID]string
+}
+
+func newTestStorage(t *testing.T) *testStorage {
+	root, err := ioutil.TempDir("", "lotus-storage-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testStorage{
+		t:     t,
+		root:  root,
+		index: stores.NewIndex(),
+		paths: map[stores.ID]string{},
+	}
+}
+
+func (ts *testStorage) close() {
+	_ = os.RemoveAll(ts.root)
+}
+
+// attach adds a storage path, local paths are returned by StorageLocal
+func (ts *testStorage) attach(id stores.ID, canStore bool, local bool) string {
+	dir := filepath.Join(ts.root, string(id))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		ts.t.Fatal(err)
+	}
+
+	err := ts.index.StorageAttach(context.TODO(), stores.StorageInfo{
+		ID:       id,
+		URLs:     []string{"http://" + string(id) + ".invalid/remote"},
+		Weight:   10,
+		CanSeal:  !canStore,
+		CanStore: canStore,
+	}, stores.FsStat{})
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+
+	if local {
+		ts.paths[id] = dir
+	}
+	return dir
+}
+
+// addSector writes sealed and cache files of the sector and declares them
+func (ts *testStorage) addSector(id stores.ID, sid abi.SectorID) {
+	ssize, err := testProof.SectorSize()
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+
+	if dir, ok := ts.paths[id]; ok {
+		writeSectorFiles(ts.t, dir, sid, int64(ssize))
+	}
+
+	for _, typ := range []stores.SectorFileType{stores.FTSealed, stores.FTCache} {
+		if err := ts.index.StorageDeclareSector(context.TODO(), id, sid, typ); err != nil {
+			ts.t.Fatal(err)
+		}
+	}
+}
+
+// attachWorker adds storage of a worker, serving its files over HTTP the
+// way the worker does
+func (ts *testStorage) attachWorker(id stores.ID, canStore bool) (string, func()) {
+	dir := filepath.Join(ts.root, string(id))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		ts.t.Fatal(err)
+	}
+
+	get := func(w http.ResponseWriter, r *http.Request) {
+		path := filepath.Join(dir, strings.TrimPrefix(r.URL.Path, "/remote/"))
+		st, err := os.Stat(path)
+		if err != nil {
+			w.WriteHeader(404)
+			return
+		}
+
+		var rd io.ReadCloser
+		if st.IsDir() {
+			rd, err = tarutil.TarDirectory(path)
+			w.Header().Set("Content-Type", "application/x-tar")
+		} else {
+			rd, err = os.Open(path)
+			w.Header().Set("Content-Type", "application/octet-stream")
+		}
+		if err != nil {
+			w.WriteHeader(500)
+			return
+		}
+		defer rd.Close() // nolint:errcheck
+
+		w.WriteHeader(200)
+		_, _ = io.Copy(w, rd)
+	}
+	srv := httptest.NewServer(RemoteStatHandler(testPaths{id: dir}, get))
+
+	err := ts.index.StorageAttach(context.TODO(), stores.StorageInfo{
+		ID:       id,
+		URLs:     []string{srv.URL + "/remote"},
+		Weight:   10,
+		CanSeal:  !canStore,
+		CanStore: canStore,
+	}, stores.FsStat{})
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+
+	return dir, srv.Close
+}
+
+func (ts *testStorage) StorageLocal(ctx context.Context) (map[stores.ID]string, error) {
+	return ts.paths, nil
+}
+
+func writeSectorFiles(t *testing.T, dir string, sid abi.SectorID, ssize int64) {
+	t.Helper()
+
+	name := stores.SectorName(sid)
+	cache := filepath.Join(dir, stores.FTCache.String(), name)
+	if err := os.MkdirAll(cache, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, stores.FTSealed.String()), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []string{"p_aux", "t_aux", "sc-02-data-tree-r-last.dat"} {
+		if err := ioutil.WriteFile(filepath.Join(cache, f), []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, stores.FTSealed.String(), name), make([]byte, ssize), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type scrubTestAPI struct {
+	storageMinerApi
+	sectors []abi.SectorNumber
+}
+
+func (a *scrubTestAPI) StateMinerInfo(context.Context, address.Address, types.TipSetKey) (miner.MinerInfo, error) {
+	return miner.MinerInfo{SealProofType: testProof}, nil
+}
+
+func (a *scrubTestAPI) StateMinerSectors(context.Context, address.Address, *abi.BitField, bool, types.TipSetKey) ([]*api.ChainSectorInfo, error) {
+	out := make([]*api.ChainSectorInfo, len(a.sectors))
+	for i, num := range a.sectors {
+		out[i] = &api.ChainSectorInfo{
+			ID: num,
+			Info: miner.SectorOnChainInfo{
+				Info: miner.SectorPreCommitInfo{
+					RegisteredProof: testProof,
+					SectorNumber:    num,
+				},
+			},
+		}
+	}
+	return out, nil
+}
+
+// testFinalizer moves sector files into the long-term storage path
+type testFinalizer struct {
+	ts        *testStorage
+	from, to  stores.ID
+	finalized []abi.SectorID
+}
+
+func (f *testFinalizer) FinalizeSector(ctx context.Context, sid abi.SectorID) error {
+	f.finalized = append(f.finalized, sid)
+
+	for _, typ := range []stores.SectorFileType{stores.FTSealed, stores.FTCache} {
+		name := filepath.Join(typ.String(), stores.SectorName(sid))
+		if err := os.Rename(filepath.Join(f.ts.paths[f.from], name), filepath.Join(f.ts.paths[f.to], name)); err != nil {
+			return err
+		}
+		if err := f.ts.index.StorageDropSector(ctx, f.from, sid, typ); err != nil {
+			return err
+		}
+		if err := f.ts.index.StorageDeclareSector(ctx, f.to, sid, typ); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type testProver struct {
+	storage.Prover
+}
+
+func (testProver) GenerateWinningPoSt(ctx context.Context, minerID abi.ActorID, sectorInfo []abi.SectorInfo, randomness abi.PoStRandomness) ([]abi.PoStProof, error) {
+	return []abi.PoStProof{{RegisteredProof: testProof, ProofBytes: []byte("proof")}}, nil
+}
+
+type testVerifier struct {
+	ffiwrapper.Verifier
+	valid map[abi.SectorNumber]bool
+}
+
+func (v *testVerifier) VerifyWinningPoSt(ctx context.Context, info abi.WinningPoStVerifyInfo) (bool, error) {
+	return v.valid[info.ChallengedSectors[0].SectorNumber], nil
+}
+
+func newTestScrubber(t *testing.T, sectors ...abi.SectorNumber) (*Scrubber, *testStorage, *testFinalizer, *testVerifier) {
+	maddr, err := address.NewIDAddress(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newTestStorage(t)
+	ts.attach("seal", false, true)
+	ts.attach("store", true, true)
+
+	fin := &testFinalizer{ts: ts, from: "seal", to: "store"}
+	verif := &testVerifier{valid: map[abi.SectorNumber]bool{}}
+
+	s := NewScrubber(&scrubTestAPI{sectors: sectors}, ts.index, ts, fin, testProver{}, verif, http.Header{}, maddr, ScrubConfig{})
+	return s, ts, fin, verif
+}
+
+func checkResults(t *testing.T, res []api.SectorCheck) map[abi.SectorNumber]api.SectorCheck {
+	t.Helper()
+
+	out := map[abi.SectorNumber]api.SectorCheck{}
+	for _, r := range res {
+		out[r.Sector] = r
+	}
+	return out
+}
+
+func TestScrubCheck(t *testing.T) {
+	s, ts, fin, _ := newTestScrubber(t, 1, 2, 3, 4, 6, 7)
+	defer ts.close()
+	sid := func(n abi.SectorNumber) abi.SectorID {
+		return abi.SectorID{Miner: 1000, Number: n}
+	}
+
+	workerDir, closeWorker := ts.attachWorker("worker", true)
+	defer closeWorker()
+
+	ts.addSector("store", sid(1))
+	ts.addSector("store", sid(2))
+	ts.addSector("seal", sid(3))
+	// sector 4 isn't stored anywhere
+	// sector 5 is still sealing
+	ts.addSector("seal", sid(5))
+	// sector 6 is in long-term storage of a worker
+	writeSectorFiles(t, workerDir, sid(6), 2048)
+	ts.addSector("worker", sid(6))
+	// the worker lost the files of sector 7
+	ts.addSector("worker", sid(7))
+
+	// truncate the sealed file of sector 2
+	sealed := filepath.Join(ts.paths["store"], stores.FTSealed.String(), stores.SectorName(sid(2)))
+	if err := os.Truncate(sealed, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := s.Check(context.TODO(), nil, api.ScrubOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := checkResults(t, res)
+	if len(checks) != 7 {
+		t.Fatalf("expected 7 checked sectors, got %d", len(checks))
+	}
+
+	if c := checks[1]; c.Err != "" || c.Misplaced || !c.OnChain {
+		t.Errorf("sector 1: unexpected result %+v", c)
+	}
+	if c := checks[2]; !strings.Contains(c.Err, "wrong size") {
+		t.Errorf("sector 2: expected wrong size error, got %+v", c)
+	}
+	if c := checks[3]; !c.Misplaced || c.Repaired != "" {
+		t.Errorf("sector 3: expected misplaced and not repaired, got %+v", c)
+	}
+	if c := checks[4]; !strings.Contains(c.Err, "not found in any storage") {
+		t.Errorf("sector 4: expected missing files error, got %+v", c)
+	}
+	if c := checks[5]; c.OnChain || c.Err != "" {
+		t.Errorf("sector 5: expected sealing sector to be skipped, got %+v", c)
+	}
+	if c := checks[6]; c.Err != "" || c.Misplaced {
+		t.Errorf("sector 6: expected files on the worker to be found, got %+v", c)
+	}
+	if c := checks[7]; !strings.Contains(c.Err, "non-200 code: 404") {
+		t.Errorf("sector 7: expected files missing on the worker, got %+v", c)
+	}
+	if len(fin.finalized) != 0 {
+		t.Fatalf("expected no files moved without repair, got %v", fin.finalized)
+	}
+
+	if st := s.Status(); len(st.Results) != 7 || st.Running {
+		t.Errorf("unexpected status %+v", st)
+	}
+
+	res, err = s.Check(context.TODO(), []abi.SectorNumber{3}, api.ScrubOptions{Repair: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := res[0]; c.Err != "" || c.Misplaced || c.Repaired == "" {
+		t.Errorf("sector 3: expected repair, got %+v", c)
+	}
+	if len(fin.finalized) != 1 || fin.finalized[0] != sid(3) {
+		t.Errorf("expected sector 3 to be finalized, got %v", fin.finalized)
+	}
+}
+
+func TestScrubRefetch(t *testing.T) {
+	s, ts, fin, _ := newTestScrubber(t, 1, 2)
+	defer ts.close()
+	sid := func(n abi.SectorNumber) abi.SectorID {
+		return abi.SectorID{Miner: 1000, Number: n}
+	}
+
+	workerDir, closeWorker := ts.attachWorker("worker", true)
+	defer closeWorker()
+
+	// the worker has a good copy of sector 1, the local copy is damaged
+	ts.addSector("store", sid(1))
+	writeSectorFiles(t, workerDir, sid(1), 2048)
+	ts.addSector("worker", sid(1))
+
+	sealed := filepath.Join(ts.paths["store"], stores.FTSealed.String(), stores.SectorName(sid(1)))
+	if err := os.Truncate(sealed, 100); err != nil {
+		t.Fatal(err)
+	}
+	cache := filepath.Join(ts.paths["store"], stores.FTCache.String(), stores.SectorName(sid(1)))
+	if err := os.Remove(filepath.Join(cache, "p_aux")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the only copy of sector 2 is damaged
+	ts.addSector("store", sid(2))
+	if err := os.Truncate(filepath.Join(ts.paths["store"], stores.FTSealed.String(), stores.SectorName(sid(2))), 100); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := s.Check(context.TODO(), nil, api.ScrubOptions{Repair: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := checkResults(t, res)
+
+	if c := checks[1]; c.Err != "" || !strings.Contains(c.Repaired, "dropped damaged sealed") || !strings.Contains(c.Repaired, "dropped damaged cache") {
+		t.Errorf("sector 1: expected damaged copies dropped, got %+v", c)
+	}
+	if c := checks[2]; !strings.Contains(c.Err, "no good copy") || c.Repaired != "" {
+		t.Errorf("sector 2: expected no repair without a good copy, got %+v", c)
+	}
+	if len(fin.finalized) != 0 {
+		t.Errorf("expected nothing finalized, got %v", fin.finalized)
+	}
+
+	// the worker copy is in long-term storage, so the damaged local copy is
+	// only dropped
+	if _, err := os.Stat(sealed); !os.IsNotExist(err) {
+		t.Errorf("expected the damaged sealed file to be removed, got %v", err)
+	}
+	si, err := ts.index.StorageFindSector(context.TODO(), sid(1), stores.FTSealed, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(si) != 1 || si[0].ID != "worker" {
+		t.Errorf("expected only the worker copy in the index, got %+v", si)
+	}
+}
+
+func TestScrubRefetchFromSealing(t *testing.T) {
+	s, ts, _, _ := newTestScrubber(t, 1)
+	defer ts.close()
+	sid := abi.SectorID{Miner: 1000, Number: 1}
+
+	// a worker still holds a good copy in sealing storage
+	workerDir, closeWorker := ts.attachWorker("worker", false)
+	defer closeWorker()
+	writeSectorFiles(t, workerDir, sid, 2048)
+	ts.addSector("worker", sid)
+
+	ts.addSector("store", sid)
+	sealed := filepath.Join(ts.paths["store"], stores.FTSealed.String(), stores.SectorName(sid))
+	if err := os.Truncate(sealed, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := s.Check(context.TODO(), nil, api.ScrubOptions{Repair: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := res[0]; c.Err != "" || c.Misplaced || !strings.Contains(c.Repaired, "fetched sealed into store") {
+		t.Fatalf("expected the sealed file to be fetched, got %+v", c)
+	}
+
+	st, err := os.Stat(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Size() != 2048 {
+		t.Errorf("expected the fetched file to replace the damaged one, got size %d", st.Size())
+	}
+}
+
+func TestScrubVerify(t *testing.T) {
+	s, ts, _, verif := newTestScrubber(t, 1, 2)
+	defer ts.close()
+
+	ts.addSector("store", abi.SectorID{Miner: 1000, Number: 1})
+	ts.addSector("store", abi.SectorID{Miner: 1000, Number: 2})
+	verif.valid[1] = true
+
+	res, err := s.Check(context.TODO(), []abi.SectorNumber{1, 2}, api.ScrubOptions{Verify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := checkResults(t, res)
+
+	if c := checks[1]; c.Err != "" || !c.Verified {
+		t.Errorf("sector 1: expected verified, got %+v", c)
+	}
+	if c := checks[2]; c.Verified || !strings.Contains(c.Err, "doesn't verify") {
+		t.Errorf("sector 2: expected verification failure, got %+v", c)
+	}
+}
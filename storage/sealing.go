@@ -4,6 +4,8 @@ import (
 	"context"
 	"io"
 
+	"golang.org/x/xerrors"
+
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/specs-actors/actors/abi"
 
@@ -32,8 +34,21 @@ func (m *Miner) GetSectorInfo(sid abi.SectorNumber) (sealing.SectorInfo, error)
 	return m.sealing.GetSectorInfo(sid)
 }
 
+// PledgeSector starts a committed capacity sector right away, without waiting
+// for the sealing limits
 func (m *Miner) PledgeSector() error {
-	return m.sealing.PledgeSector()
+	return m.pledger.pledge()
+}
+
+// PledgeSectors queues n committed capacity sectors, which are started as
+// soon as the sealing pipeline is below configured limits
+func (m *Miner) PledgeSectors(n int) error {
+	if n <= 0 {
+		return xerrors.Errorf("number of sectors to pledge must be positive, got %d", n)
+	}
+
+	m.pledger.enqueue(n)
+	return nil
 }
 
 func (m *Miner) ForceSectorState(ctx context.Context, id abi.SectorNumber, state sealing.SectorState) error {
@@ -0,0 +1,34 @@
+package sealworker
+
+import (
+	"context"
+
+	"github.com/filecoin-project/sector-storage/stores"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+)
+
+// AffinityIndex wraps the sector index used for scheduling. When a sector
+// already has files in some storage, lookups which allow fetching only
+// return that storage, so tasks like PreCommit2 run on the worker which ran
+// PreCommit1 instead of fetching its files elsewhere
+func AffinityIndex(index stores.SectorIndex) stores.SectorIndex {
+	return &affinityIndex{SectorIndex: index}
+}
+
+type affinityIndex struct {
+	stores.SectorIndex
+}
+
+func (i *affinityIndex) StorageFindSector(ctx context.Context, sector abi.SectorID, ft stores.SectorFileType, allowFetch bool) ([]stores.StorageInfo, error) {
+	if allowFetch {
+		have, err := i.SectorIndex.StorageFindSector(ctx, sector, ft, false)
+		if err != nil {
+			return nil, err
+		}
+		if len(have) > 0 {
+			return have, nil
+		}
+	}
+
+	return i.SectorIndex.StorageFindSector(ctx, sector, ft, allowFetch)
+}
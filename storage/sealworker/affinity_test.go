@@ -0,0 +1,57 @@
+package sealworker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/sector-storage/stores"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+)
+
+func TestAffinityIndex(t *testing.T) {
+	index := stores.NewIndex()
+	for _, id := range []stores.ID{"a", "b"} {
+		err := index.StorageAttach(context.TODO(), stores.StorageInfo{
+			ID:      id,
+			URLs:    []string{"http://" + string(id) + "/remote"},
+			Weight:  10,
+			CanSeal: true,
+		}, stores.FsStat{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sealing := abi.SectorID{Miner: 1000, Number: 1}
+	if err := index.StorageDeclareSector(context.TODO(), "b", sealing, stores.FTCache); err != nil {
+		t.Fatal(err)
+	}
+
+	ai := AffinityIndex(index)
+
+	// storage holding files of the sector is preferred over fetching
+	si, err := ai.StorageFindSector(context.TODO(), sealing, stores.FTCache, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(si) != 1 || si[0].ID != "b" {
+		t.Fatalf("expected only storage b, got %+v", si)
+	}
+
+	// without files anywhere, all storage is returned
+	si, err = ai.StorageFindSector(context.TODO(), abi.SectorID{Miner: 1000, Number: 2}, stores.FTCache, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(si) != 2 {
+		t.Fatalf("expected both storages, got %+v", si)
+	}
+
+	si, err = ai.StorageFindSector(context.TODO(), sealing, stores.FTSealed, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(si) != 0 {
+		t.Fatalf("expected no storage with sealed files, got %+v", si)
+	}
+}
@@ -0,0 +1,507 @@
+package sealworker
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+
+	"golang.org/x/xerrors"
+
+	sectorstorage "github.com/filecoin-project/sector-storage"
+	"github.com/filecoin-project/sector-storage/sealtasks"
+	"github.com/filecoin-project/sector-storage/stores"
+	"github.com/filecoin-project/sector-storage/storiface"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-storage/storage"
+
+	"github.com/filecoin-project/lotus/api"
+)
+
+var log = logging.Logger("sealworker")
+
+// Config configures how sealing tasks are placed on workers
+type Config struct {
+	// TaskAffinity keeps tasks of a sector on the worker which holds its
+	// sealing files, instead of fetching them to another worker
+	TaskAffinity bool
+}
+
+// Tracker keeps track of sealing tasks, from when the miner schedules them
+// until the worker running them is done
+type Tracker struct {
+	lk      sync.Mutex
+	workers map[string]*Worker
+	jobs    map[uint64]*job
+	nextJob uint64
+}
+
+type job struct {
+	api.WorkerJob
+
+	// refs counts the manager and worker calls of the job, it's removed when
+	// both returned
+	refs   int
+	cancel context.CancelFunc
+	// aborted is closed when the job is aborted
+	aborted chan struct{}
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		workers: map[string]*Worker{},
+		jobs:    map[uint64]*job{},
+	}
+}
+
+// Wrap returns a worker enforcing the given limits, with its tasks tracked
+// under the worker URL
+func (t *Tracker) Wrap(ctx context.Context, url string, w sectorstorage.Worker, limits api.WorkerLimits) (*Worker, error) {
+	info, err := w.Info(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("getting worker info: %w", err)
+	}
+
+	tw := &Worker{
+		Worker:   w,
+		t:        t,
+		url:      url,
+		hostname: info.Hostname,
+		limits:   limits,
+
+		slots:   map[sealtasks.TaskType]chan struct{}{},
+		running: map[sealtasks.TaskType]int{},
+		queued:  map[sealtasks.TaskType]int{},
+	}
+	for tt, max := range limits.MaxTasks {
+		if max > 0 {
+			tw.slots[tt] = make(chan struct{}, max)
+		}
+	}
+
+	t.lk.Lock()
+	t.workers[url] = tw
+	t.lk.Unlock()
+
+	return tw, nil
+}
+
+// Manager wraps the sector manager, so sealing calls are listed as jobs from
+// when they are scheduled. Jobs which aren't assigned to a tracked worker wait
+// in the scheduler, or run on the miner's own worker
+func (t *Tracker) Manager(m sectorstorage.SectorManager) sectorstorage.SectorManager {
+	return &manager{SectorManager: m, t: t}
+}
+
+// Tasks returns task counts of all tracked workers by URL
+func (t *Tracker) Tasks() map[string]api.WorkerTasks {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	out := make(map[string]api.WorkerTasks, len(t.workers))
+	for url, w := range t.workers {
+		out[url] = w.tasks()
+	}
+	return out
+}
+
+// Jobs lists scheduled jobs, and running and queued jobs of all tracked
+// workers, oldest first
+func (t *Tracker) Jobs() []api.WorkerJob {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	out := make([]api.WorkerJob, 0, len(t.jobs))
+	for _, j := range t.jobs {
+		out = append(out, j.WorkerJob)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// Abort fails the sealing call of a job, which moves the sector into a failed
+// state the sealing state machine retries from.
+//
+// Workers can't stop a task once it started, so a job on a remote worker
+// keeps its task slot until the worker call returns. Jobs which aren't on a
+// remote worker are canceled in the scheduler. If such a job already runs on
+// the miner's own worker, the task also runs to the end, and the scheduler
+// keeps its resources until then
+func (t *Tracker) Abort(id uint64) error {
+	t.lk.Lock()
+	j, ok := t.jobs[id]
+	if !ok {
+		t.lk.Unlock()
+		return xerrors.Errorf("job %d not found", id)
+	}
+	if j.Aborted {
+		t.lk.Unlock()
+		return xerrors.Errorf("job %d is already aborted", id)
+	}
+
+	j.Aborted = true
+	close(j.aborted)
+	assigned := j.Worker != ""
+	t.lk.Unlock()
+
+	log.Warnw("aborting sealing job", "job", id, "sector", j.Sector, "task", j.Task, "worker", j.Worker)
+	if !assigned {
+		j.cancel()
+	}
+	return nil
+}
+
+// newJob must be called with the lock held
+func (t *Tracker) newJob(sector abi.SectorID, tt sealtasks.TaskType, cancel context.CancelFunc) *job {
+	j := &job{
+		WorkerJob: api.WorkerJob{
+			ID:     t.nextJob,
+			Sector: sector,
+			Task:   tt,
+			Start:  time.Now(),
+		},
+		refs:    1,
+		cancel:  cancel,
+		aborted: make(chan struct{}),
+	}
+	t.nextJob++
+	t.jobs[j.ID] = j
+
+	return j
+}
+
+// schedule records a job for a sealing call made through the manager. The
+// returned context is canceled when the job is aborted before a tracked
+// worker runs it
+func (t *Tracker) schedule(ctx context.Context, sector abi.SectorID, tt sealtasks.TaskType) (context.Context, *job) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	return ctx, t.newJob(sector, tt, cancel)
+}
+
+// assign gives the oldest scheduled job of the task to the worker, or records
+// a new job for calls which weren't scheduled through the tracker
+func (t *Tracker) assign(w *Worker, sector abi.SectorID, tt sealtasks.TaskType) *job {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	var j *job
+	for _, sj := range t.jobs {
+		if sj.Worker != "" || sj.Aborted || sj.Sector != sector || sj.Task != tt {
+			continue
+		}
+		if j == nil || sj.ID < j.ID {
+			j = sj
+		}
+	}
+
+	if j != nil {
+		j.refs++
+	} else {
+		j = t.newJob(sector, tt, func() {})
+	}
+
+	j.Worker = w.url
+	j.Hostname = w.hostname
+	return j
+}
+
+func (t *Tracker) jobRunning(j *job) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	j.Running = true
+	j.Start = time.Now()
+}
+
+// release drops a reference to the job, removing it after the last one
+func (t *Tracker) release(j *job) {
+	t.lk.Lock()
+	j.refs--
+	last := j.refs == 0
+	if last {
+		delete(t.jobs, j.ID)
+	}
+	t.lk.Unlock()
+
+	if last {
+		j.cancel()
+	}
+}
+
+func (t *Tracker) remove(w *Worker) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	if t.workers[w.url] == w {
+		delete(t.workers, w.url)
+	}
+}
+
+// Worker wraps a remote worker, limiting how many tasks of each type run on
+// it at once and budgeting its resources
+type Worker struct {
+	sectorstorage.Worker
+
+	t        *Tracker
+	url      string
+	hostname string
+	limits   api.WorkerLimits
+
+	// slots hold a token for each running task of a limited type
+	slots map[sealtasks.TaskType]chan struct{}
+
+	lk      sync.Mutex
+	running map[sealtasks.TaskType]int
+	queued  map[sealtasks.TaskType]int
+}
+
+func (w *Worker) tasks() api.WorkerTasks {
+	w.lk.Lock()
+	defer w.lk.Unlock()
+
+	out := api.WorkerTasks{
+		Hostname: w.hostname,
+		Limits:   w.limits,
+		Running:  make(map[sealtasks.TaskType]int, len(w.running)),
+		Queued:   make(map[sealtasks.TaskType]int, len(w.queued)),
+	}
+	for tt, n := range w.running {
+		out.Running[tt] = n
+	}
+	for tt, n := range w.queued {
+		out.Queued[tt] = n
+	}
+	return out
+}
+
+// start assigns a job to the worker, and waits for a free slot for its task
+// type. The returned function must be called once the worker call returned
+func (w *Worker) start(ctx context.Context, sector abi.SectorID, tt sealtasks.TaskType) (*job, func(), error) {
+	j := w.t.assign(w, sector, tt)
+
+	w.lk.Lock()
+	w.queued[tt]++
+	w.lk.Unlock()
+
+	slots, limited := w.slots[tt]
+	if limited {
+		var err error
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-j.aborted:
+			err = xerrors.Errorf("job %d aborted", j.ID)
+		}
+
+		if err != nil {
+			w.lk.Lock()
+			w.queued[tt]--
+			w.lk.Unlock()
+
+			w.t.release(j)
+			return nil, nil, err
+		}
+	}
+
+	w.lk.Lock()
+	w.queued[tt]--
+	w.running[tt]++
+	w.lk.Unlock()
+
+	w.t.jobRunning(j)
+
+	return j, func() {
+		w.lk.Lock()
+		w.running[tt]--
+		w.lk.Unlock()
+
+		if limited {
+			<-slots
+		}
+
+		w.t.release(j)
+	}, nil
+}
+
+// run makes a worker call once a slot for its task type is free. When the job
+// is aborted, run returns right away, but the call keeps its slot until it
+// returns: the worker can't stop a running task, and freeing the slot early
+// would start another task of the type beyond the limit
+func (w *Worker) run(ctx context.Context, sector abi.SectorID, tt sealtasks.TaskType, call func(context.Context) error) error {
+	j, done, err := w.start(ctx, sector, tt)
+	if err != nil {
+		return err
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		err := call(ctx)
+		done()
+		errs <- err
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-j.aborted:
+		return xerrors.Errorf("job %d aborted, the task keeps running on %s until the worker finishes it", j.ID, w.hostname)
+	}
+}
+
+// TaskTypes hides task types whose limit is reached, so the scheduler
+// assigns them to other workers
+func (w *Worker) TaskTypes(ctx context.Context) (map[sealtasks.TaskType]struct{}, error) {
+	tts, err := w.Worker.TaskTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	w.lk.Lock()
+	defer w.lk.Unlock()
+
+	out := make(map[sealtasks.TaskType]struct{}, len(tts))
+	for tt := range tts {
+		if max := w.limits.MaxTasks[tt]; max > 0 && w.running[tt]+w.queued[tt] >= max {
+			continue
+		}
+		out[tt] = struct{}{}
+	}
+	return out, nil
+}
+
+// Info reports worker resources reduced to the configured budgets
+func (w *Worker) Info(ctx context.Context) (storiface.WorkerInfo, error) {
+	info, err := w.Worker.Info(ctx)
+	if err != nil {
+		return storiface.WorkerInfo{}, err
+	}
+
+	if w.limits.CPUs > 0 && w.limits.CPUs < info.Resources.CPUs {
+		info.Resources.CPUs = w.limits.CPUs
+	}
+	if w.limits.Memory > 0 && w.limits.Memory < info.Resources.MemPhysical {
+		info.Resources.MemPhysical = w.limits.Memory
+	}
+
+	return info, nil
+}
+
+func (w *Worker) SealPreCommit1(ctx context.Context, sector abi.SectorID, ticket abi.SealRandomness, pieces []abi.PieceInfo) (storage.PreCommit1Out, error) {
+	var out storage.PreCommit1Out
+	err := w.run(ctx, sector, sealtasks.TTPreCommit1, func(ctx context.Context) (err error) {
+		out, err = w.Worker.SealPreCommit1(ctx, sector, ticket, pieces)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (w *Worker) SealPreCommit2(ctx context.Context, sector abi.SectorID, p1o storage.PreCommit1Out) (storage.SectorCids, error) {
+	var out storage.SectorCids
+	err := w.run(ctx, sector, sealtasks.TTPreCommit2, func(ctx context.Context) (err error) {
+		out, err = w.Worker.SealPreCommit2(ctx, sector, p1o)
+		return err
+	})
+	if err != nil {
+		return storage.SectorCids{}, err
+	}
+	return out, nil
+}
+
+func (w *Worker) SealCommit1(ctx context.Context, sector abi.SectorID, ticket abi.SealRandomness, seed abi.InteractiveSealRandomness, pieces []abi.PieceInfo, cids storage.SectorCids) (storage.Commit1Out, error) {
+	var out storage.Commit1Out
+	err := w.run(ctx, sector, sealtasks.TTCommit1, func(ctx context.Context) (err error) {
+		out, err = w.Worker.SealCommit1(ctx, sector, ticket, seed, pieces, cids)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (w *Worker) SealCommit2(ctx context.Context, sector abi.SectorID, c1o storage.Commit1Out) (storage.Proof, error) {
+	var out storage.Proof
+	err := w.run(ctx, sector, sealtasks.TTCommit2, func(ctx context.Context) (err error) {
+		out, err = w.Worker.SealCommit2(ctx, sector, c1o)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (w *Worker) FinalizeSector(ctx context.Context, sector abi.SectorID) error {
+	return w.run(ctx, sector, sealtasks.TTFinalize, func(ctx context.Context) error {
+		return w.Worker.FinalizeSector(ctx, sector)
+	})
+}
+
+func (w *Worker) Fetch(ctx context.Context, sector abi.SectorID, ft stores.SectorFileType, sealing bool) error {
+	return w.run(ctx, sector, sealtasks.TTFetch, func(ctx context.Context) error {
+		return w.Worker.Fetch(ctx, sector, ft, sealing)
+	})
+}
+
+func (w *Worker) Close() error {
+	w.t.remove(w)
+	return w.Worker.Close()
+}
+
+var _ sectorstorage.Worker = &Worker{}
+
+// manager lists sealing calls of the sector manager as jobs
+type manager struct {
+	sectorstorage.SectorManager
+
+	t *Tracker
+}
+
+func (m *manager) SealPreCommit1(ctx context.Context, sector abi.SectorID, ticket abi.SealRandomness, pieces []abi.PieceInfo) (storage.PreCommit1Out, error) {
+	ctx, j := m.t.schedule(ctx, sector, sealtasks.TTPreCommit1)
+	defer m.t.release(j)
+
+	return m.SectorManager.SealPreCommit1(ctx, sector, ticket, pieces)
+}
+
+func (m *manager) SealPreCommit2(ctx context.Context, sector abi.SectorID, p1o storage.PreCommit1Out) (storage.SectorCids, error) {
+	ctx, j := m.t.schedule(ctx, sector, sealtasks.TTPreCommit2)
+	defer m.t.release(j)
+
+	return m.SectorManager.SealPreCommit2(ctx, sector, p1o)
+}
+
+func (m *manager) SealCommit1(ctx context.Context, sector abi.SectorID, ticket abi.SealRandomness, seed abi.InteractiveSealRandomness, pieces []abi.PieceInfo, cids storage.SectorCids) (storage.Commit1Out, error) {
+	ctx, j := m.t.schedule(ctx, sector, sealtasks.TTCommit1)
+	defer m.t.release(j)
+
+	return m.SectorManager.SealCommit1(ctx, sector, ticket, seed, pieces, cids)
+}
+
+func (m *manager) SealCommit2(ctx context.Context, sector abi.SectorID, c1o storage.Commit1Out) (storage.Proof, error) {
+	ctx, j := m.t.schedule(ctx, sector, sealtasks.TTCommit2)
+	defer m.t.release(j)
+
+	return m.SectorManager.SealCommit2(ctx, sector, c1o)
+}
+
+func (m *manager) FinalizeSector(ctx context.Context, sector abi.SectorID) error {
+	ctx, j := m.t.schedule(ctx, sector, sealtasks.TTFinalize)
+	defer m.t.release(j)
+
+	return m.SectorManager.FinalizeSector(ctx, sector)
+}
+
+var _ sectorstorage.SectorManager = &manager{}
@@ -0,0 +1,344 @@
+package sealworker
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	sectorstorage "github.com/filecoin-project/sector-storage"
+	"github.com/filecoin-project/sector-storage/sealtasks"
+	"github.com/filecoin-project/sector-storage/storiface"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-storage/storage"
+
+	"github.com/filecoin-project/lotus/api"
+)
+
+const testURL = "http://worker/rpc/v0"
+
+// testWorker runs PreCommit1 until the test releases it
+type testWorker struct {
+	sectorstorage.Worker
+
+	started chan abi.SectorID
+	release chan struct{}
+}
+
+func newTestWorker() *testWorker {
+	return &testWorker{
+		started: make(chan abi.SectorID, 16),
+		release: make(chan struct{}),
+	}
+}
+
+func (w *testWorker) Info(context.Context) (storiface.WorkerInfo, error) {
+	return storiface.WorkerInfo{
+		Hostname: "worker",
+		Resources: storiface.WorkerResources{
+			MemPhysical: 64 << 30,
+			CPUs:        16,
+		},
+	}, nil
+}
+
+func (w *testWorker) TaskTypes(context.Context) (map[sealtasks.TaskType]struct{}, error) {
+	return map[sealtasks.TaskType]struct{}{
+		sealtasks.TTPreCommit1: {},
+		sealtasks.TTPreCommit2: {},
+	}, nil
+}
+
+func (w *testWorker) SealPreCommit1(ctx context.Context, sector abi.SectorID, ticket abi.SealRandomness, pieces []abi.PieceInfo) (storage.PreCommit1Out, error) {
+	w.started <- sector
+	<-w.release
+	return storage.PreCommit1Out("p1"), nil
+}
+
+func (w *testWorker) Close() error {
+	return nil
+}
+
+type result struct {
+	out storage.PreCommit1Out
+	err error
+}
+
+type preCommitter interface {
+	SealPreCommit1(ctx context.Context, sector abi.SectorID, ticket abi.SealRandomness, pieces []abi.PieceInfo) (storage.PreCommit1Out, error)
+}
+
+func precommit1(sealer preCommitter, n abi.SectorNumber) <-chan result {
+	res := make(chan result, 1)
+	go func() {
+		out, err := sealer.SealPreCommit1(context.TODO(), abi.SectorID{Miner: 1000, Number: n}, nil, nil)
+		res <- result{out, err}
+	}()
+	return res
+}
+
+func wrapTestWorker(t *testing.T, tr *Tracker, limits api.WorkerLimits) (*Worker, *testWorker) {
+	w := newTestWorker()
+	tw, err := tr.Wrap(context.TODO(), testURL, w, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tw, w
+}
+
+// waitJobs waits until the tracker lists jobs matching the check
+func waitJobs(t *testing.T, tr *Tracker, check func([]api.WorkerJob) bool) []api.WorkerJob {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		jobs := tr.Jobs()
+		if check(jobs) {
+			return jobs
+		}
+
+		select {
+		case <-timeout:
+			t.Fatalf("unexpected jobs %+v", jobs)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func queued(n int) func([]api.WorkerJob) bool {
+	return func(jobs []api.WorkerJob) bool {
+		q := 0
+		for _, j := range jobs {
+			if j.Worker != "" && !j.Running {
+				q++
+			}
+		}
+		return q == n
+	}
+}
+
+func started(t *testing.T, w *testWorker, n abi.SectorNumber) {
+	t.Helper()
+
+	select {
+	case sid := <-w.started:
+		if sid.Number != n {
+			t.Fatalf("expected sector %d to start, got %d", n, sid.Number)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("sector %d didn't start", n)
+	}
+}
+
+func finished(t *testing.T, res <-chan result) result {
+	t.Helper()
+
+	select {
+	case r := <-res:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("call didn't return")
+		return result{}
+	}
+}
+
+func TestWorkerAbort(t *testing.T) {
+	tr := NewTracker()
+	tw, w := wrapTestWorker(t, tr, api.WorkerLimits{
+		MaxTasks: map[sealtasks.TaskType]int{sealtasks.TTPreCommit1: 1},
+	})
+
+	first := precommit1(tw, 1)
+	started(t, w, 1)
+
+	jobs := tr.Jobs()
+	if len(jobs) != 1 || !jobs[0].Running || jobs[0].Worker != testURL || jobs[0].Hostname != "worker" {
+		t.Fatalf("unexpected jobs %+v", jobs)
+	}
+	id := jobs[0].ID
+
+	if err := tr.Abort(id); err != nil {
+		t.Fatal(err)
+	}
+	if r := finished(t, first); r.err == nil || !strings.Contains(r.err.Error(), "aborted") {
+		t.Fatalf("expected aborted error, got %v", r.err)
+	}
+	if err := tr.Abort(id); err == nil || !strings.Contains(err.Error(), "already aborted") {
+		t.Fatalf("expected error aborting again, got %v", err)
+	}
+
+	// the aborted task still holds the only PreCommit1 slot
+	second := precommit1(tw, 2)
+	jobs = waitJobs(t, tr, queued(1))
+	if len(jobs) != 2 || jobs[0].ID != id || !jobs[0].Aborted {
+		t.Fatalf("expected the aborted job to be listed, got %+v", jobs)
+	}
+	if tts, _ := tw.TaskTypes(context.TODO()); len(tts) != 1 {
+		t.Fatalf("expected PreCommit1 to be hidden, got %v", tts)
+	}
+
+	// the worker finishes the aborted task
+	w.release <- struct{}{}
+	started(t, w, 2)
+	w.release <- struct{}{}
+
+	if r := finished(t, second); r.err != nil || string(r.out) != "p1" {
+		t.Fatalf("unexpected result %+v", r)
+	}
+	waitJobs(t, tr, func(jobs []api.WorkerJob) bool {
+		return len(jobs) == 0
+	})
+
+	if err := tr.Abort(id); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected job not found, got %v", err)
+	}
+}
+
+func TestWorkerAbortQueued(t *testing.T) {
+	tr := NewTracker()
+	tw, w := wrapTestWorker(t, tr, api.WorkerLimits{
+		MaxTasks: map[sealtasks.TaskType]int{sealtasks.TTPreCommit1: 1},
+	})
+
+	first := precommit1(tw, 1)
+	started(t, w, 1)
+	second := precommit1(tw, 2)
+	jobs := waitJobs(t, tr, queued(1))
+
+	if err := tr.Abort(jobs[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if r := finished(t, second); r.err == nil || !strings.Contains(r.err.Error(), "aborted") {
+		t.Fatalf("expected aborted error, got %v", r.err)
+	}
+	if tasks := tr.Tasks()[testURL]; tasks.Queued[sealtasks.TTPreCommit1] != 0 || tasks.Running[sealtasks.TTPreCommit1] != 1 {
+		t.Fatalf("unexpected tasks %+v", tasks)
+	}
+
+	w.release <- struct{}{}
+	if r := finished(t, first); r.err != nil {
+		t.Fatal(r.err)
+	}
+}
+
+// testManager runs sealing calls on a worker, or on its own like the miner's
+// local worker
+type testManager struct {
+	sectorstorage.SectorManager
+
+	worker sectorstorage.Worker
+	local  chan struct{}
+}
+
+func (m *testManager) SealPreCommit1(ctx context.Context, sector abi.SectorID, ticket abi.SealRandomness, pieces []abi.PieceInfo) (storage.PreCommit1Out, error) {
+	if m.worker != nil {
+		return m.worker.SealPreCommit1(ctx, sector, ticket, pieces)
+	}
+
+	select {
+	case <-m.local:
+		return storage.PreCommit1Out("local"), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestManagerJobs(t *testing.T) {
+	tr := NewTracker()
+	tw, w := wrapTestWorker(t, tr, api.WorkerLimits{})
+
+	// jobs on tracked workers are listed once
+	remote := precommit1(tr.Manager(&testManager{worker: tw}), 1)
+	started(t, w, 1)
+
+	jobs := tr.Jobs()
+	if len(jobs) != 1 || jobs[0].Worker != testURL || !jobs[0].Running {
+		t.Fatalf("unexpected jobs %+v", jobs)
+	}
+
+	w.release <- struct{}{}
+	if r := finished(t, remote); r.err != nil {
+		t.Fatal(r.err)
+	}
+
+	// jobs on the miner's worker are listed without one
+	lm := &testManager{local: make(chan struct{})}
+	local := precommit1(tr.Manager(lm), 2)
+	jobs = waitJobs(t, tr, func(jobs []api.WorkerJob) bool {
+		return len(jobs) == 1
+	})
+	if jobs[0].Worker != "" || jobs[0].Sector.Number != 2 || jobs[0].Task != sealtasks.TTPreCommit1 {
+		t.Fatalf("unexpected jobs %+v", jobs)
+	}
+
+	// aborting them cancels the manager call
+	if err := tr.Abort(jobs[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if r := finished(t, local); r.err != context.Canceled {
+		t.Fatalf("expected canceled call, got %v", r.err)
+	}
+	if jobs := tr.Jobs(); len(jobs) != 0 {
+		t.Fatalf("expected no jobs, got %+v", jobs)
+	}
+}
+
+func TestWorkerLimits(t *testing.T) {
+	tr := NewTracker()
+	tw, w := wrapTestWorker(t, tr, api.WorkerLimits{
+		MaxTasks: map[sealtasks.TaskType]int{sealtasks.TTPreCommit1: 2},
+		CPUs:     4,
+		Memory:   128 << 30,
+	})
+
+	info, err := tw.Info(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// budgets above what the worker has don't apply
+	if info.Resources.CPUs != 4 || info.Resources.MemPhysical != 64<<30 {
+		t.Fatalf("unexpected resources %+v", info.Resources)
+	}
+
+	first := precommit1(tw, 1)
+	started(t, w, 1)
+	if tts, _ := tw.TaskTypes(context.TODO()); len(tts) != 2 {
+		t.Fatalf("expected all task types below the limit, got %v", tts)
+	}
+
+	second := precommit1(tw, 2)
+	started(t, w, 2)
+	third := precommit1(tw, 3)
+	waitJobs(t, tr, queued(1))
+
+	tts, err := tw.TaskTypes(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tts[sealtasks.TTPreCommit1]; ok || len(tts) != 1 {
+		t.Fatalf("expected PreCommit1 to be hidden, got %v", tts)
+	}
+
+	tasks := tr.Tasks()[testURL]
+	if tasks.Hostname != "worker" || tasks.Running[sealtasks.TTPreCommit1] != 2 || tasks.Queued[sealtasks.TTPreCommit1] != 1 {
+		t.Fatalf("unexpected tasks %+v", tasks)
+	}
+
+	w.release <- struct{}{}
+	started(t, w, 3)
+	w.release <- struct{}{}
+	w.release <- struct{}{}
+
+	for _, res := range []<-chan result{first, second, third} {
+		if r := finished(t, res); r.err != nil {
+			t.Fatal(r.err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(tr.Tasks()) != 0 {
+		t.Fatal("expected closed worker to be removed")
+	}
+}
@@ -0,0 +1,290 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/sector-storage/stores"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+
+	"github.com/filecoin-project/lotus/chain/actors"
+	"github.com/filecoin-project/lotus/chain/types"
+	sealing "github.com/filecoin-project/storage-fsm"
+)
+
+// ExtendSectors sends a message extending the expiration of each of the given
+// sectors to newExpiration
+func (m *Miner) ExtendSectors(ctx context.Context, sectors []abi.SectorNumber, newExpiration abi.ChainEpoch) ([]cid.Cid, error) {
+	active, err := m.activeSectors(ctx, sectors)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, snum := range sectors {
+		si, ok := active[snum]
+		if !ok {
+			return nil, xerrors.Errorf("sector %d is not active on chain", snum)
+		}
+		if si.Info.Expiration >= newExpiration {
+			return nil, xerrors.Errorf("sector %d already expires at %d, not before %d", snum, si.Info.Expiration, newExpiration)
+		}
+	}
+
+	out := make([]cid.Cid, 0, len(sectors))
+	for _, snum := range sectors {
+		params := &miner.ExtendSectorExpirationParams{
+			SectorNumber:  snum,
+			NewExpiration: newExpiration,
+		}
+
+		msg, err := m.minerMessage(builtin.MethodsMiner.ExtendSectorExpiration, params)
+		if err != nil {
+			return out, err
+		}
+
+		smsg, err := m.api.MpoolPushMessage(ctx, msg)
+		if err != nil {
+			return out, xerrors.Errorf("extending sector %d: %w", snum, err)
+		}
+
+		log.Infow("extending sector expiration", "sector", snum, "expiration", newExpiration, "message", smsg.Cid())
+		out = append(out, smsg.Cid())
+	}
+
+	return out, nil
+}
+
+// TerminationFee estimates the fee burned when terminating the given sectors
+// now, by executing the termination against the current chain head
+func (m *Miner) TerminationFee(ctx context.Context, sectors []abi.SectorNumber) (abi.TokenAmount, error) {
+	msg, err := m.terminateMessage(ctx, sectors)
+	if err != nil {
+		return big.Zero(), err
+	}
+
+	res, err := m.api.StateCall(ctx, msg, types.EmptyTSK)
+	if err != nil {
+		return big.Zero(), xerrors.Errorf("simulating termination: %w", err)
+	}
+	if res.MsgRct.ExitCode != 0 {
+		return big.Zero(), xerrors.Errorf("simulated termination failed with exit %d: %s", res.MsgRct.ExitCode, res.Error)
+	}
+
+	return burnedFunds(res.InternalExecutions), nil
+}
+
+// TerminateSectors sends a message terminating the given sectors early
+func (m *Miner) TerminateSectors(ctx context.Context, sectors []abi.SectorNumber) (cid.Cid, error) {
+	msg, err := m.terminateMessage(ctx, sectors)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	smsg, err := m.api.MpoolPushMessage(ctx, msg)
+	if err != nil {
+		return cid.Undef, xerrors.Errorf("pushing terminate message: %w", err)
+	}
+
+	log.Warnw("terminating sectors", "sectors", sectors, "message", smsg.Cid())
+	return smsg.Cid(), nil
+}
+
+// InactiveSectors lists sectors which finished sealing, but are no longer
+// active on chain because they expired or were terminated
+func (m *Miner) InactiveSectors(ctx context.Context) ([]abi.SectorNumber, error) {
+	sectors, err := m.sealing.ListSectors()
+	if err != nil {
+		return nil, xerrors.Errorf("listing sectors: %w", err)
+	}
+
+	proving := make([]abi.SectorNumber, 0, len(sectors))
+	for _, s := range sectors {
+		if s.State == sealing.Proving {
+			proving = append(proving, s.SectorNumber)
+		}
+	}
+	if len(proving) == 0 {
+		return nil, nil
+	}
+
+	active, err := m.activeSectors(ctx, proving)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []abi.SectorNumber
+	for _, snum := range proving {
+		if _, ok := active[snum]; !ok {
+			out = append(out, snum)
+		}
+	}
+
+	return out, nil
+}
+
+// CheckRemovable returns an error unless the sector finished sealing and
+// is no longer active on chain, so its data can be removed
+func (m *Miner) CheckRemovable(ctx context.Context, snum abi.SectorNumber) error {
+	si, err := m.sealing.GetSectorInfo(snum)
+	if err != nil {
+		return xerrors.Errorf("getting sector %d info: %w", snum, err)
+	}
+	if si.State != sealing.Proving {
+		return xerrors.Errorf("sector %d is in state %s, only sealed sectors can be removed", snum, si.State)
+	}
+
+	active, err := m.activeSectors(ctx, []abi.SectorNumber{snum})
+	if err != nil {
+		return err
+	}
+	if _, ok := active[snum]; ok {
+		return xerrors.Errorf("sector %d is still active on chain, terminate it first", snum)
+	}
+
+	return nil
+}
+
+// SectorID returns the full ID of a sector of this miner
+func (m *Miner) SectorID(snum abi.SectorNumber) (abi.SectorID, error) {
+	mid, err := address.IDFromAddress(m.maddr)
+	if err != nil {
+		return abi.SectorID{}, err
+	}
+
+	return abi.SectorID{Miner: abi.ActorID(mid), Number: snum}, nil
+}
+
+// activeSectors returns on-chain info of the given sectors which are in the
+// miner's sector set
+func (m *Miner) activeSectors(ctx context.Context, sectors []abi.SectorNumber) (map[abi.SectorNumber]miner.SectorOnChainInfo, error) {
+	onChain, err := m.api.StateMinerSectors(ctx, m.maddr, sectorsBitField(sectors), false, types.EmptyTSK)
+	if err != nil {
+		return nil, xerrors.Errorf("getting on-chain sectors: %w", err)
+	}
+
+	out := make(map[abi.SectorNumber]miner.SectorOnChainInfo, len(onChain))
+	for _, s := range onChain {
+		out[s.ID] = s.Info
+	}
+	return out, nil
+}
+
+func (m *Miner) terminateMessage(ctx context.Context, sectors []abi.SectorNumber) (*types.Message, error) {
+	if len(sectors) == 0 {
+		return nil, xerrors.New("no sectors to terminate")
+	}
+
+	active, err := m.activeSectors(ctx, sectors)
+	if err != nil {
+		return nil, err
+	}
+	for _, snum := range sectors {
+		if _, ok := active[snum]; !ok {
+			return nil, xerrors.Errorf("sector %d is not active on chain", snum)
+		}
+	}
+
+	return m.minerMessage(builtin.MethodsMiner.TerminateSectors, &miner.TerminateSectorsParams{
+		Sectors: sectorsBitField(sectors),
+	})
+}
+
+func (m *Miner) minerMessage(method abi.MethodNum, params cbg.CBORMarshaler) (*types.Message, error) {
+	enc, aerr := actors.SerializeParams(params)
+	if aerr != nil {
+		return nil, xerrors.Errorf("serializing params: %w", aerr)
+	}
+
+	return &types.Message{
+		To:       m.maddr,
+		From:     m.worker,
+		Method:   method,
+		Params:   enc,
+		Value:    types.NewInt(0),
+		GasLimit: 10000000,
+		GasPrice: types.NewInt(1),
+	}, nil
+}
+
+// burnedFunds sums value sent to the burnt funds actor by the given executions
+func burnedFunds(execs []*types.ExecutionResult) abi.TokenAmount {
+	out := big.Zero()
+	for _, e := range execs {
+		if e.Msg != nil && e.Msg.To == builtin.BurntFundsActorAddr {
+			out = big.Add(out, e.Msg.Value)
+		}
+		out = big.Add(out, burnedFunds(e.Subcalls))
+	}
+	return out
+}
+
+// SectorRemover removes sector files from the storage holding them
+type SectorRemover interface {
+	Remove(ctx context.Context, s abi.SectorID, types stores.SectorFileType) error
+}
+
+// RemoveSector removes all files of a sector which is no longer active on
+// chain, and moves it out of Proving. The sealing state machine has no state
+// for removed sectors, FaultedFinal is the final state for sectors which
+// can't be proven anymore
+func (m *Miner) RemoveSector(ctx context.Context, index stores.SectorIndex, remover SectorRemover, snum abi.SectorNumber) error {
+	if err := m.CheckRemovable(ctx, snum); err != nil {
+		return err
+	}
+
+	sid, err := m.SectorID(snum)
+	if err != nil {
+		return err
+	}
+
+	if err := RemoveSectorFiles(ctx, index, remover, sid); err != nil {
+		return xerrors.Errorf("removing sector %d: %w", snum, err)
+	}
+
+	return m.sealing.ForceSectorState(ctx, snum, sealing.FaultedFinal)
+}
+
+// RemoveSectorFiles removes all files of a sector through the stores holding
+// them, which drop them from the sector index
+func RemoveSectorFiles(ctx context.Context, index stores.SectorIndex, remover SectorRemover, sid abi.SectorID) error {
+	types := []stores.SectorFileType{stores.FTUnsealed, stores.FTSealed, stores.FTCache}
+
+	for _, typ := range types {
+		si, err := index.StorageFindSector(ctx, sid, typ, false)
+		if err != nil {
+			return xerrors.Errorf("finding %s sector files: %w", typ, err)
+		}
+		if len(si) == 0 {
+			continue
+		}
+
+		if err := remover.Remove(ctx, sid, typ); err != nil {
+			return xerrors.Errorf("removing %s sector files: %w", typ, err)
+		}
+		log.Infow("removed sector files", "sector", sid.Number, "type", typ)
+	}
+
+	// removal from storage which can't be reached is only logged
+	var remaining []stores.ID
+	for _, typ := range types {
+		si, err := index.StorageFindSector(ctx, sid, typ, false)
+		if err != nil {
+			return xerrors.Errorf("finding %s sector files: %w", typ, err)
+		}
+		for _, info := range si {
+			remaining = append(remaining, info.ID)
+		}
+	}
+	if len(remaining) > 0 {
+		return xerrors.Errorf("sector files are still in storage %v", remaining)
+	}
+
+	return nil
+}
@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/sector-storage/stores"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/abi/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+type lifecycleTestAPI struct {
+	storageMinerApi
+
+	expiration map[abi.SectorNumber]abi.ChainEpoch
+	call       *api.InvocResult
+	msgs       []*types.Message
+}
+
+func (a *lifecycleTestAPI) StateMinerSectors(ctx context.Context, maddr address.Address, filter *abi.BitField, _ bool, _ types.TipSetKey) ([]*api.ChainSectorInfo, error) {
+	var out []*api.ChainSectorInfo
+	for num, exp := range a.expiration {
+		if set, err := filter.IsSet(uint64(num)); err != nil || !set {
+			continue
+		}
+		out = append(out, &api.ChainSectorInfo{
+			ID:   num,
+			Info: miner.SectorOnChainInfo{Info: miner.SectorPreCommitInfo{SectorNumber: num, Expiration: exp}},
+		})
+	}
+	return out, nil
+}
+
+func (a *lifecycleTestAPI) StateCall(context.Context, *types.Message, types.TipSetKey) (*api.InvocResult, error) {
+	return a.call, nil
+}
+
+func (a *lifecycleTestAPI) MpoolPushMessage(ctx context.Context, msg *types.Message) (*types.SignedMessage, error) {
+	a.msgs = append(a.msgs, msg)
+	return &types.SignedMessage{Message: *msg}, nil
+}
+
+func newLifecycleTestMiner(t *testing.T) (*Miner, *lifecycleTestAPI) {
+	maddr, err := address.NewIDAddress(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worker, err := address.NewIDAddress(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tapi := &lifecycleTestAPI{
+		expiration: map[abi.SectorNumber]abi.ChainEpoch{1: 100, 2: 300},
+	}
+	return &Miner{api: tapi, maddr: maddr, worker: worker}, tapi
+}
+
+func expectError(t *testing.T, err error, contains string) {
+	t.Helper()
+
+	if err == nil || !strings.Contains(err.Error(), contains) {
+		t.Fatalf("expected error containing %q, got %v", contains, err)
+	}
+}
+
+func TestExtendSectors(t *testing.T) {
+	m, tapi := newLifecycleTestMiner(t)
+
+	_, err := m.ExtendSectors(context.TODO(), []abi.SectorNumber{1, 2}, 200)
+	expectError(t, err, "sector 2 already expires at 300")
+
+	_, err = m.ExtendSectors(context.TODO(), []abi.SectorNumber{1, 3}, 200)
+	expectError(t, err, "sector 3 is not active")
+
+	if len(tapi.msgs) != 0 {
+		t.Fatal("expected no messages for invalid extensions")
+	}
+
+	msgs, err := m.ExtendSectors(context.TODO(), []abi.SectorNumber{1}, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || len(tapi.msgs) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(tapi.msgs))
+	}
+
+	msg := tapi.msgs[0]
+	if msg.To != m.maddr || msg.From != m.worker || msg.Method != builtin.MethodsMiner.ExtendSectorExpiration {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+
+	var params miner.ExtendSectorExpirationParams
+	if err := params.UnmarshalCBOR(bytes.NewReader(msg.Params)); err != nil {
+		t.Fatal(err)
+	}
+	if params.SectorNumber != 1 || params.NewExpiration != 200 {
+		t.Fatalf("unexpected params %+v", params)
+	}
+}
+
+func TestTerminateSectors(t *testing.T) {
+	m, tapi := newLifecycleTestMiner(t)
+
+	_, err := m.TerminateSectors(context.TODO(), []abi.SectorNumber{1, 3})
+	expectError(t, err, "sector 3 is not active")
+
+	if _, err := m.TerminateSectors(context.TODO(), []abi.SectorNumber{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if len(tapi.msgs) != 1 || tapi.msgs[0].Method != builtin.MethodsMiner.TerminateSectors {
+		t.Fatalf("expected a terminate message, got %v", tapi.msgs)
+	}
+
+	var params miner.TerminateSectorsParams
+	if err := params.UnmarshalCBOR(bytes.NewReader(tapi.msgs[0].Params)); err != nil {
+		t.Fatal(err)
+	}
+	expectSectors(t, "terminated", bitFieldSectors(t, params.Sectors), 1, 2)
+}
+
+func TestTerminationFee(t *testing.T) {
+	m, tapi := newLifecycleTestMiner(t)
+
+	burn := func(v int64) *types.Message {
+		return &types.Message{To: builtin.BurntFundsActorAddr, Value: abi.NewTokenAmount(v)}
+	}
+	tapi.call = &api.InvocResult{
+		MsgRct: &types.MessageReceipt{},
+		InternalExecutions: []*types.ExecutionResult{
+			{Msg: burn(10)},
+			{Msg: &types.Message{To: m.worker, Value: abi.NewTokenAmount(1000)}, Subcalls: []*types.ExecutionResult{
+				{Msg: burn(5)},
+			}},
+		},
+	}
+
+	fee, err := m.TerminationFee(context.TODO(), []abi.SectorNumber{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fee.Equals(big.NewInt(15)) {
+		t.Fatalf("expected fee 15, got %s", fee)
+	}
+
+	tapi.call = &api.InvocResult{MsgRct: &types.MessageReceipt{ExitCode: 16}, Error: "nope"}
+	_, err = m.TerminationFee(context.TODO(), []abi.SectorNumber{1})
+	expectError(t, err, "exit 16")
+}
+
+// testRemover removes files from reachable storage, like stores.Remote, which
+// only logs failures of unreachable storage
+type testRemover struct {
+	index       stores.SectorIndex
+	unreachable stores.ID
+	removed     []stores.SectorFileType
+}
+
+func (r *testRemover) Remove(ctx context.Context, sid abi.SectorID, typ stores.SectorFileType) error {
+	if typ == stores.FTUnsealed {
+		return xerrors.New("remove failed")
+	}
+
+	si, err := r.index.StorageFindSector(ctx, sid, typ, false)
+	if err != nil {
+		return err
+	}
+	for _, info := range si {
+		if info.ID == r.unreachable {
+			continue
+		}
+		if err := r.index.StorageDropSector(ctx, info.ID, sid, typ); err != nil {
+			return err
+		}
+	}
+
+	r.removed = append(r.removed, typ)
+	return nil
+}
+
+func TestRemoveSectorFiles(t *testing.T) {
+	ts := newTestStorage(t)
+	defer ts.close()
+
+	ts.attach("local", true, false)
+	ts.attach("worker", true, false)
+
+	sid := func(n abi.SectorNumber) abi.SectorID {
+		return abi.SectorID{Miner: 1000, Number: n}
+	}
+	ts.addSector("local", sid(1))
+	ts.addSector("worker", sid(2))
+	ts.addSector("local", sid(3))
+	if err := ts.index.StorageDeclareSector(context.TODO(), "local", sid(3), stores.FTUnsealed); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &testRemover{index: ts.index, unreachable: "worker"}
+
+	if err := RemoveSectorFiles(context.TODO(), ts.index, r, sid(1)); err != nil {
+		t.Fatal(err)
+	}
+	// types without files aren't removed
+	if len(r.removed) != 2 {
+		t.Fatalf("expected sealed and cache files removed, got %v", r.removed)
+	}
+	for _, typ := range []stores.SectorFileType{stores.FTSealed, stores.FTCache} {
+		si, err := ts.index.StorageFindSector(context.TODO(), sid(1), typ, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(si) != 0 {
+			t.Fatalf("expected %s files to be dropped from the index", typ)
+		}
+	}
+
+	err := RemoveSectorFiles(context.TODO(), ts.index, r, sid(2))
+	expectError(t, err, "still in storage [worker worker]")
+
+	err = RemoveSectorFiles(context.TODO(), ts.index, r, sid(3))
+	expectError(t, err, "removing unsealed sector files")
+}
@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/lotus/api"
+	sealing "github.com/filecoin-project/storage-fsm"
+)
+
+const (
+	// sectorNotifyBuffer is how many changes can queue up for a subscriber
+	// before changes get dropped
+	sectorNotifyBuffer = 64
+	// webhookQueue is how many changes can queue up for a webhook
+	webhookQueue = 256
+	// webhookAttempts is how many times delivery of a change is attempted
+	webhookAttempts = 3
+)
+
+var sectorStorePrefix = datastore.NewKey(sealing.SectorStorePrefix)
+
+// webhookRetryDelay is multiplied by the attempt number to get the delay
+// before retrying webhook delivery
+var webhookRetryDelay = time.Second
+
+// SectorNotifyConfig configures webhook delivery of sector state changes
+type SectorNotifyConfig struct {
+	// Webhooks are URLs each change is POSTed to as JSON
+	Webhooks []string
+	// States limits webhook delivery to changes into these states, all
+	// changes are delivered if empty
+	States []api.SectorState
+	// Timeout of a single webhook request
+	Timeout time.Duration
+}
+
+// SectorNotifier publishes sector state changes made by the sealing state
+// machine to API subscribers and webhooks
+type SectorNotifier struct {
+	cfg    SectorNotifyConfig
+	states map[api.SectorState]struct{}
+	hooks  []chan api.SectorChange
+
+	lk   sync.Mutex
+	next uint64
+	subs map[uint64]chan api.SectorChange
+}
+
+func NewSectorNotifier(cfg SectorNotifyConfig) *SectorNotifier {
+	n := &SectorNotifier{
+		cfg:  cfg,
+		subs: map[uint64]chan api.SectorChange{},
+	}
+
+	if len(cfg.States) > 0 {
+		n.states = map[api.SectorState]struct{}{}
+		for _, st := range cfg.States {
+			n.states[st] = struct{}{}
+		}
+	}
+
+	return n
+}
+
+// Run delivers changes to configured webhooks until the context is canceled
+func (n *SectorNotifier) Run(ctx context.Context) {
+	client := &http.Client{Timeout: n.cfg.Timeout}
+
+	n.lk.Lock()
+	for _, url := range n.cfg.Webhooks {
+		ch := make(chan api.SectorChange, webhookQueue)
+		n.hooks = append(n.hooks, ch)
+
+		go deliverWebhook(ctx, client, url, ch)
+	}
+	n.lk.Unlock()
+}
+
+// Subscribe returns a channel receiving all sector state changes until the
+// context is canceled
+func (n *SectorNotifier) Subscribe(ctx context.Context) <-chan api.SectorChange {
+	ch := make(chan api.SectorChange, sectorNotifyBuffer)
+
+	n.lk.Lock()
+	id := n.next
+	n.next++
+	n.subs[id] = ch
+	n.lk.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		n.lk.Lock()
+		delete(n.subs, id)
+		close(ch)
+		n.lk.Unlock()
+	}()
+
+	return ch
+}
+
+func (n *SectorNotifier) publish(change api.SectorChange) {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+
+	for _, ch := range n.subs {
+		select {
+		case ch <- change:
+		default:
+			log.Warnw("sector notification subscriber too slow, dropping change", "sector", change.Sector, "state", change.To)
+		}
+	}
+
+	if n.states != nil {
+		if _, ok := n.states[change.To]; !ok {
+			return
+		}
+	}
+
+	for i, ch := range n.hooks {
+		select {
+		case ch <- change:
+		default:
+			log.Warnw("sector webhook queue full, dropping change", "webhook", n.cfg.Webhooks[i], "sector", change.Sector, "state", change.To)
+		}
+	}
+}
+
+// SectorChanged publishes the change between two states of a sector. before
+// is empty for new sectors
+func (n *SectorNotifier) SectorChanged(before, after sealing.SectorInfo) {
+	var added []sealing.Log
+	if len(after.Log) > len(before.Log) {
+		added = after.Log[len(before.Log):]
+	}
+
+	if before.State == after.State && len(added) == 0 {
+		return
+	}
+
+	change := api.SectorChange{
+		Sector:  after.SectorNumber,
+		Time:    time.Now(),
+		From:    api.SectorState(before.State),
+		To:      api.SectorState(after.State),
+		LastErr: after.LastErr,
+		Log:     make([]api.SectorLog, len(added)),
+	}
+	for i, l := range added {
+		change.Log[i] = api.SectorLog{
+			Kind:      l.Kind,
+			Timestamp: l.Timestamp,
+			Trace:     l.Trace,
+			Message:   l.Message,
+		}
+	}
+
+	n.publish(change)
+}
+
+// Wrap returns a datastore for the sealing state machine which reports
+// changes of sector state to the notifier. The state machine has no hooks for
+// state changes, but stores sector info after each of them
+func (n *SectorNotifier) Wrap(ds datastore.Batching) datastore.Batching {
+	return &notifyingDS{Batching: ds, n: n}
+}
+
+type notifyingDS struct {
+	datastore.Batching
+	n *SectorNotifier
+}
+
+func (d *notifyingDS) Put(key datastore.Key, value []byte) error {
+	if !sectorStorePrefix.IsAncestorOf(key) {
+		return d.Batching.Put(key, value)
+	}
+
+	// the state machine serializes writes to a single sector, so reading the
+	// previous value here doesn't race with other writes of this key
+	var before sealing.SectorInfo
+	prev, err := d.Batching.Get(key)
+	switch err {
+	case nil:
+		if err := before.UnmarshalCBOR(bytes.NewReader(prev)); err != nil {
+			log.Errorf("decoding previous sector info: %+v", err)
+		}
+	case datastore.ErrNotFound:
+	default:
+		return err
+	}
+
+	if err := d.Batching.Put(key, value); err != nil {
+		return err
+	}
+
+	var after sealing.SectorInfo
+	if err := after.UnmarshalCBOR(bytes.NewReader(value)); err != nil {
+		log.Errorf("decoding sector info: %+v", err)
+		return nil
+	}
+
+	d.n.SectorChanged(before, after)
+	return nil
+}
+
+func deliverWebhook(ctx context.Context, client *http.Client, url string, changes <-chan api.SectorChange) {
+	for {
+		select {
+		case change := <-changes:
+			if err := postChange(ctx, client, url, change); err != nil {
+				log.Errorw("delivering sector webhook", "webhook", url, "sector", change.Sector, "state", change.To, "error", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func postChange(ctx context.Context, client *http.Client, url string, change api.SectorChange) error {
+	b, err := json.Marshal(change)
+	if err != nil {
+		return xerrors.Errorf("marshaling change: %w", err)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < webhookAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(time.Duration(attempt) * webhookRetryDelay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		req, err := http.NewRequest("POST", url, bytes.NewReader(b))
+		if err != nil {
+			return xerrors.Errorf("creating request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp.Body.Close() // nolint:errcheck
+
+		if resp.StatusCode/100 == 2 {
+			return nil
+		}
+		lastErr = xerrors.Errorf("unexpected response status %s", resp.Status)
+	}
+
+	return xerrors.Errorf("giving up after %d attempts: %w", webhookAttempts, lastErr)
+}
@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+
+	sealing "github.com/filecoin-project/storage-fsm"
+
+	"github.com/filecoin-project/lotus/api"
+)
+
+// testWebhook records changes posted to it, failing the first fail requests
+type testWebhook struct {
+	lk       sync.Mutex
+	fail     int
+	requests int
+	changes  []api.SectorChange
+}
+
+func (h *testWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	h.requests++
+	if h.requests <= h.fail {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var change api.SectorChange
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	h.changes = append(h.changes, change)
+}
+
+func (h *testWebhook) count() int {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+	return h.requests
+}
+
+func (h *testWebhook) received() []api.SectorChange {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+	return append([]api.SectorChange{}, h.changes...)
+}
+
+func TestSectorNotifierSubscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := NewSectorNotifier(SectorNotifyConfig{})
+	changes := n.Subscribe(ctx)
+
+	packing := sealing.SectorInfo{SectorNumber: 1, State: sealing.Packing, Log: []sealing.Log{{Message: "pledged"}}}
+	n.SectorChanged(sealing.SectorInfo{}, packing)
+	// nothing changed
+	n.SectorChanged(packing, packing)
+
+	failed := packing
+	failed.State = sealing.SealFailed
+	failed.LastErr = "seal failed"
+	failed.Log = append(failed.Log, sealing.Log{Message: "seal failed"})
+	n.SectorChanged(packing, failed)
+
+	select {
+	case c := <-changes:
+		if c.Sector != 1 || c.From != "" || c.To != api.SectorState(sealing.Packing) || len(c.Log) != 1 {
+			t.Fatalf("unexpected change for a new sector %+v", c)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for change")
+	}
+
+	select {
+	case c := <-changes:
+		if c.From != api.SectorState(sealing.Packing) || c.To != api.SectorState(sealing.SealFailed) || c.LastErr != "seal failed" || len(c.Log) != 1 || c.Log[0].Message != "seal failed" {
+			t.Fatalf("unexpected change %+v", c)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for change")
+	}
+
+	cancel()
+	for range changes {
+		t.Fatal("unexpected change")
+	}
+}
+
+func TestSectorNotifierDatastore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := NewSectorNotifier(SectorNotifyConfig{})
+	changes := n.Subscribe(ctx)
+	ds := n.Wrap(dssync.MutexWrap(datastore.NewMapDatastore()))
+
+	put := func(si sealing.SectorInfo) {
+		var buf bytes.Buffer
+		if err := si.MarshalCBOR(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if err := ds.Put(sectorStorePrefix.ChildString("4"), buf.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// other keys aren't sector info
+	if err := ds.Put(datastore.NewKey("/other"), []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+
+	put(sealing.SectorInfo{SectorNumber: 4, State: sealing.Packing})
+	put(sealing.SectorInfo{SectorNumber: 4, State: sealing.PreCommit1})
+
+	for _, expect := range []api.SectorChange{
+		{Sector: 4, To: api.SectorState(sealing.Packing)},
+		{Sector: 4, From: api.SectorState(sealing.Packing), To: api.SectorState(sealing.PreCommit1)},
+	} {
+		select {
+		case c := <-changes:
+			if c.Sector != expect.Sector || c.From != expect.From || c.To != expect.To {
+				t.Fatalf("expected %s -> %s, got %+v", expect.From, expect.To, c)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for change")
+		}
+	}
+}
+
+func TestSectorNotifierWebhookFilter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hook := &testWebhook{}
+	srv := httptest.NewServer(hook)
+	defer srv.Close()
+
+	n := NewSectorNotifier(SectorNotifyConfig{
+		Webhooks: []string{srv.URL},
+		States:   []api.SectorState{api.SectorState(sealing.Proving)},
+		Timeout:  time.Second,
+	})
+	n.Run(ctx)
+
+	committing := sealing.SectorInfo{SectorNumber: 2, State: sealing.CommitWait}
+	proving := sealing.SectorInfo{SectorNumber: 2, State: sealing.Proving}
+	n.SectorChanged(sealing.SectorInfo{}, committing)
+	n.SectorChanged(committing, proving)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(hook.received()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for webhook")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	got := hook.received()
+	if len(got) != 1 || got[0].Sector != 2 || got[0].To != api.SectorState(sealing.Proving) {
+		t.Fatalf("expected only the change into Proving, got %+v", got)
+	}
+}
+
+func TestSectorWebhookRetry(t *testing.T) {
+	defer func(d time.Duration) { webhookRetryDelay = d }(webhookRetryDelay)
+	webhookRetryDelay = time.Millisecond
+
+	change := api.SectorChange{Sector: 3, To: api.SectorState(sealing.Proving)}
+
+	hook := &testWebhook{fail: webhookAttempts - 1}
+	srv := httptest.NewServer(hook)
+	defer srv.Close()
+
+	if err := postChange(context.TODO(), http.DefaultClient, srv.URL, change); err != nil {
+		t.Fatal(err)
+	}
+	if got := hook.received(); hook.count() != webhookAttempts || len(got) != 1 || got[0].Sector != 3 {
+		t.Fatalf("expected delivery on the last attempt, got %d requests, %+v", hook.count(), got)
+	}
+
+	failing := &testWebhook{fail: webhookAttempts}
+	fsrv := httptest.NewServer(failing)
+	defer fsrv.Close()
+
+	if err := postChange(context.TODO(), http.DefaultClient, fsrv.URL, change); err == nil {
+		t.Fatal("expected error after all attempts failed")
+	}
+	if failing.count() != webhookAttempts {
+		t.Fatalf("expected %d attempts, got %d", webhookAttempts, failing.count())
+	}
+}
@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+)
+
+// maxPoStHistory is the number of window PoSt attempts kept in the datastore,
+// enough for ~20 proving periods
+const maxPoStHistory = 1000
+
+var postHistoryPrefix = datastore.NewKey("/wdpost/history")
+
+// postHistory records window PoSt attempts in the metadata datastore
+type postHistory struct {
+	ds datastore.Batching
+	lk sync.Mutex
+
+	// stored is the number of attempts in the datastore
+	stored int
+	lastID uint64
+}
+
+func newPoStHistory(ds datastore.Batching) *postHistory {
+	h := &postHistory{
+		ds: namespace.Wrap(ds, postHistoryPrefix),
+	}
+
+	res, err := h.ds.Query(query.Query{KeysOnly: true})
+	if err != nil {
+		log.Errorf("counting window PoSt history: %+v", err)
+		return h
+	}
+	ents, err := res.Rest()
+	if err != nil {
+		log.Errorf("counting window PoSt history: %+v", err)
+		return h
+	}
+	h.stored = len(ents)
+
+	return h
+}
+
+func postHistoryKey(id uint64) datastore.Key {
+	// zero padded so keys sort by time
+	return datastore.NewKey(fmt.Sprintf("%020d", id))
+}
+
+func (h *postHistory) start(di *miner.DeadlineInfo, ts *types.TipSet, dryRun bool) *api.WindowPoStAttempt {
+	now := time.Now()
+
+	att := &api.WindowPoStAttempt{
+		DryRun: dryRun,
+
+		Deadline:    di.Index,
+		PeriodStart: di.PeriodStart,
+		Challenge:   di.Challenge,
+		Close:       di.Close,
+		Height:      ts.Height(),
+
+		Start:  now,
+		Result: api.PoStRunning,
+	}
+
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	// IDs are unique even if attempts start at the same time
+	att.ID = uint64(now.UnixNano())
+	if att.ID <= h.lastID {
+		att.ID = h.lastID + 1
+	}
+	h.lastID = att.ID
+
+	h.put(att)
+	h.stored++
+	if h.stored > maxPoStHistory {
+		h.prune()
+	}
+
+	return att
+}
+
+// update changes the attempt under the history lock and stores it
+func (h *postHistory) update(att *api.WindowPoStAttempt, cb func(att *api.WindowPoStAttempt)) {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	cb(att)
+	h.put(att)
+}
+
+// finish records the outcome of proof generation
+func (h *postHistory) finish(att *api.WindowPoStAttempt, result api.PoStResult, err error) {
+	h.update(att, func(att *api.WindowPoStAttempt) {
+		att.Result = result
+		if err != nil {
+			att.Error = err.Error()
+		}
+	})
+}
+
+// put stores the attempt, the history is best-effort so errors are only
+// logged. Must be called with the lock held
+func (h *postHistory) put(att *api.WindowPoStAttempt) {
+	b, err := json.Marshal(att)
+	if err != nil {
+		log.Errorf("marshaling window PoSt attempt: %+v", err)
+		return
+	}
+
+	if err := h.ds.Put(postHistoryKey(att.ID), b); err != nil {
+		log.Errorf("storing window PoSt attempt: %+v", err)
+	}
+}
+
+// prune removes the oldest attempts above maxPoStHistory. Must be called
+// with the lock held
+func (h *postHistory) prune() {
+	res, err := h.ds.Query(query.Query{
+		KeysOnly: true,
+		Orders:   []query.Order{query.OrderByKey{}},
+		Limit:    h.stored - maxPoStHistory,
+	})
+	if err != nil {
+		log.Errorf("listing window PoSt history: %+v", err)
+		return
+	}
+
+	ents, err := res.Rest()
+	if err != nil {
+		log.Errorf("listing window PoSt history: %+v", err)
+		return
+	}
+
+	for _, ent := range ents {
+		if err := h.ds.Delete(datastore.NewKey(ent.Key)); err != nil {
+			log.Errorf("pruning window PoSt history: %+v", err)
+			return
+		}
+		h.stored--
+	}
+}
+
+func (h *postHistory) list() ([]api.WindowPoStAttempt, error) {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	res, err := h.ds.Query(query.Query{})
+	if err != nil {
+		return nil, xerrors.Errorf("querying window PoSt history: %w", err)
+	}
+
+	ents, err := res.Rest()
+	if err != nil {
+		return nil, xerrors.Errorf("reading window PoSt history: %w", err)
+	}
+
+	out := make([]api.WindowPoStAttempt, 0, len(ents))
+	for _, ent := range ents {
+		var att api.WindowPoStAttempt
+		if err := json.Unmarshal(ent.Value, &att); err != nil {
+			return nil, xerrors.Errorf("unmarshaling window PoSt attempt %s: %w", ent.Key, err)
+		}
+		out = append(out, att)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ID < out[j].ID
+	})
+
+	return out, nil
+}
+
+// History returns recorded window PoSt attempts, oldest first
+func (s *WindowPoStScheduler) History() ([]api.WindowPoStAttempt, error) {
+	return s.history.list()
+}
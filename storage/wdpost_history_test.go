@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types/mock"
+)
+
+func TestPoStHistoryFinish(t *testing.T) {
+	h := newPoStHistory(dssync.MutexWrap(datastore.NewMapDatastore()))
+	ts := mock.TipSet(mock.MkBlock(nil, 1, 1))
+
+	att := h.start(&miner.DeadlineInfo{Index: 3}, ts, false)
+	dry := h.start(&miner.DeadlineInfo{Index: 4}, ts, true)
+	if dry.ID <= att.ID {
+		t.Fatalf("expected increasing IDs, got %d after %d", dry.ID, att.ID)
+	}
+
+	h.finish(att, api.PoStFailed, xerrors.New("no proof"))
+
+	list, err := h.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("expected 2 attempts, got %d", len(list))
+	}
+	if list[0].Deadline != 3 || list[0].Result != api.PoStFailed || list[0].Error != "no proof" {
+		t.Fatalf("unexpected finished attempt %+v", list[0])
+	}
+	if list[1].Deadline != 4 || !list[1].DryRun || list[1].Result != api.PoStRunning {
+		t.Fatalf("unexpected running attempt %+v", list[1])
+	}
+}
+
+func TestPoStHistoryPrune(t *testing.T) {
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	ts := mock.TipSet(mock.MkBlock(nil, 1, 1))
+
+	h := newPoStHistory(ds)
+	for i := 0; i < maxPoStHistory-2; i++ {
+		h.start(&miner.DeadlineInfo{Index: uint64(i)}, ts, false)
+	}
+
+	// the stored attempts are counted after restarts
+	h = newPoStHistory(ds)
+	if h.stored != maxPoStHistory-2 {
+		t.Fatalf("expected %d stored attempts, got %d", maxPoStHistory-2, h.stored)
+	}
+
+	for i := maxPoStHistory - 2; i < maxPoStHistory+3; i++ {
+		h.start(&miner.DeadlineInfo{Index: uint64(i)}, ts, false)
+	}
+
+	list, err := h.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != maxPoStHistory || h.stored != maxPoStHistory {
+		t.Fatalf("expected %d attempts, got %d (%d counted)", maxPoStHistory, len(list), h.stored)
+	}
+	if list[0].Deadline != 3 || list[len(list)-1].Deadline != maxPoStHistory+2 {
+		t.Fatalf("expected the oldest attempts to be pruned, got deadlines %d to %d", list[0].Deadline, list[len(list)-1].Deadline)
+	}
+}
@@ -4,16 +4,20 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-bitfield"
 	"github.com/filecoin-project/specs-actors/actors/abi"
 	"github.com/filecoin-project/specs-actors/actors/builtin"
 	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
 	"github.com/filecoin-project/specs-actors/actors/crypto"
+	cbg "github.com/whyrusleeping/cbor-gen"
 	"go.opencensus.io/trace"
 	"golang.org/x/xerrors"
 
+	"github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/chain/actors"
 	"github.com/filecoin-project/lotus/chain/types"
 )
@@ -41,45 +45,246 @@ func (s *WindowPoStScheduler) doPost(ctx context.Context, deadline *miner.Deadli
 		ctx, span := trace.StartSpan(ctx, "WindowPoStScheduler.doPost")
 		defer span.End()
 
-		proof, err := s.runPost(ctx, *deadline, ts)
+		att := s.history.start(deadline, ts, false)
+
+		proof, err := s.runPost(ctx, *deadline, ts, att)
 		switch err {
 		case errNoPartitions:
+			s.history.finish(att, api.PoStNoPartitions, nil)
 			return
 		case nil:
-			if err := s.submitPost(ctx, proof); err != nil {
+			if err := s.submitPost(ctx, proof, att); err != nil {
 				log.Errorf("submitPost failed: %+v", err)
+				s.history.finish(att, api.PoStFailed, err)
 				s.failPost(deadline)
 				return
 			}
 		default:
 			log.Errorf("runPost failed: %+v", err)
+			s.history.finish(att, failedResult(ctx), err)
 			s.failPost(deadline)
 			return
 		}
 	}()
 }
 
-func (s *WindowPoStScheduler) checkFaults(ctx context.Context, ssi []abi.SectorNumber) ([]abi.SectorNumber, error) {
-	//faults := s.prover.Scrub(ssi)
-	log.Warnf("Stub checkFaults")
+func failedResult(ctx context.Context) api.PoStResult {
+	if ctx.Err() != nil {
+		return api.PoStAborted
+	}
+	return api.PoStFailed
+}
 
-	declaredFaults := map[abi.SectorNumber]struct{}{}
+// DryRun generates a window PoSt for the given deadline without submitting
+// it. Randomness for future challenges isn't known yet, so deadlines which
+// didn't open in the current proving period use the previous period challenge
+func (s *WindowPoStScheduler) DryRun(ctx context.Context, dlIdx uint64) (api.WindowPoStAttempt, error) {
+	if dlIdx >= miner.WPoStPeriodDeadlines {
+		return api.WindowPoStAttempt{}, xerrors.Errorf("deadline %d out of range (max %d)", dlIdx, miner.WPoStPeriodDeadlines-1)
+	}
 
-	{
-		chainFaults, err := s.api.StateMinerFaults(ctx, s.actor, types.EmptyTSK)
-		if err != nil {
-			return nil, xerrors.Errorf("checking on-chain faults: %w", err)
+	ts, err := s.api.ChainHead(ctx)
+	if err != nil {
+		return api.WindowPoStAttempt{}, xerrors.Errorf("getting chain head: %w", err)
+	}
+
+	cur, err := s.api.StateMinerProvingDeadline(ctx, s.actor, ts.Key())
+	if err != nil {
+		return api.WindowPoStAttempt{}, xerrors.Errorf("getting proving deadline: %w", err)
+	}
+
+	di := miner.NewDeadlineInfo(cur.PeriodStart, dlIdx, ts.Height())
+	if di.Challenge > ts.Height() {
+		di = miner.NewDeadlineInfo(cur.PeriodStart-miner.WPoStProvingPeriod, dlIdx, ts.Height())
+	}
+	if di.Challenge < 0 {
+		return api.WindowPoStAttempt{}, xerrors.Errorf("no challenge for deadline %d yet (challenge epoch %d)", dlIdx, di.Challenge)
+	}
+
+	att := s.history.start(di, ts, true)
+
+	_, err = s.runPost(ctx, *di, ts, att)
+	switch err {
+	case errNoPartitions:
+		s.history.finish(att, api.PoStNoPartitions, nil)
+	case nil:
+		s.history.finish(att, api.PoStProved, nil)
+	default:
+		s.history.finish(att, failedResult(ctx), err)
+	}
+
+	return *att, nil
+}
+
+// checkSectors returns the sectors from the given set which can't be proven
+func (s *WindowPoStScheduler) checkSectors(ctx context.Context, check *abi.BitField) (*abi.BitField, error) {
+	mid, err := address.IDFromAddress(s.actor)
+	if err != nil {
+		return nil, err
+	}
+
+	var sectors []abi.SectorID
+	if err := check.ForEach(func(snum uint64) error {
+		sectors = append(sectors, abi.SectorID{
+			Miner:  abi.ActorID(mid),
+			Number: abi.SectorNumber(snum),
+		})
+		return nil
+	}); err != nil {
+		return nil, xerrors.Errorf("iterating over sectors: %w", err)
+	}
+
+	bad, err := s.faultTracker.CheckProvable(ctx, s.sealProofType, sectors)
+	if err != nil {
+		return nil, xerrors.Errorf("checking provable sectors: %w", err)
+	}
+
+	out := abi.NewBitField()
+	for sid, reason := range bad {
+		log.Warnw("sector can't be proven", "sector", sid.Number, "reason", reason)
+		out.Set(uint64(sid.Number))
+	}
+
+	return out, nil
+}
+
+func sectorsBitField(snums []abi.SectorNumber) *abi.BitField {
+	set := make([]uint64, len(snums))
+	for i, snum := range snums {
+		set[i] = uint64(snum)
+	}
+	return bitfield.NewFromSet(set)
+}
+
+// expectedFaults returns sectors from the given set which are faulty on chain,
+// and not declared as recovered. The actor doesn't expect proofs for those
+func (s *WindowPoStScheduler) expectedFaults(ctx context.Context, sectors *abi.BitField, ts *types.TipSet) (*abi.BitField, error) {
+	faults, err := s.api.StateMinerFaults(ctx, s.actor, ts.Key())
+	if err != nil {
+		return nil, xerrors.Errorf("getting on-chain faults: %w", err)
+	}
+
+	recoveries, err := s.api.StateMinerRecoveries(ctx, s.actor, ts.Key())
+	if err != nil {
+		return nil, xerrors.Errorf("getting on-chain recoveries: %w", err)
+	}
+
+	expected, err := bitfield.SubtractBitField(sectorsBitField(faults), sectorsBitField(recoveries))
+	if err != nil {
+		return nil, xerrors.Errorf("subtracting recoveries from faults: %w", err)
+	}
+
+	return bitfield.IntersectBitField(expected, sectors)
+}
+
+// checkNextFaults checks sectors due at the given deadline, and declares new
+// faults and recoveries of faulty sectors which became provable again. This
+// needs to happen before the deadline fault cutoff, so it's done a deadline
+// ahead of proving
+func (s *WindowPoStScheduler) checkNextFaults(ctx context.Context, periodStart abi.ChainEpoch, dlIdx uint64, deadlines *miner.Deadlines, ts *types.TipSet) error {
+	ctx, span := trace.StartSpan(ctx, "storage.checkNextFaults")
+	defer span.End()
+
+	di := miner.NewDeadlineInfo(periodStart, dlIdx, ts.Height())
+	for di.HasElapsed() {
+		di = miner.NewDeadlineInfo(di.NextPeriodStart(), dlIdx, ts.Height())
+	}
+	if di.FaultCutoffPassed() {
+		return xerrors.Errorf("fault cutoff for deadline %d already passed (cutoff: %d, height: %d)", dlIdx, di.FaultCutoff, ts.Height())
+	}
+
+	due := deadlines.Due[dlIdx]
+	if empty, err := due.IsEmpty(); err != nil || empty {
+		return err
+	}
+
+	expected, err := s.expectedFaults(ctx, due, ts)
+	if err != nil {
+		return err
+	}
+
+	bad, err := s.checkSectors(ctx, due)
+	if err != nil {
+		return err
+	}
+
+	// bad sectors which are declared as recovered are included here, declaring
+	// them as faulty again retracts the recovery
+	newFaults, err := bitfield.SubtractBitField(bad, expected)
+	if err != nil {
+		return xerrors.Errorf("computing new faults: %w", err)
+	}
+
+	recovered, err := bitfield.SubtractBitField(expected, bad)
+	if err != nil {
+		return xerrors.Errorf("computing recovered sectors: %w", err)
+	}
+
+	if empty, err := newFaults.IsEmpty(); err != nil {
+		return err
+	} else if !empty {
+		params := &miner.DeclareFaultsParams{
+			Faults: []miner.FaultDeclaration{{Deadline: dlIdx, Sectors: newFaults}},
+		}
+		if err := s.declare(ctx, "faults", builtin.MethodsMiner.DeclareFaults, params, newFaults); err != nil {
+			return err
 		}
+	}
 
-		for _, fault := range chainFaults {
-			declaredFaults[fault] = struct{}{}
+	if empty, err := recovered.IsEmpty(); err != nil {
+		return err
+	} else if !empty {
+		params := &miner.DeclareFaultsRecoveredParams{
+			Recoveries: []miner.RecoveryDeclaration{{Deadline: dlIdx, Sectors: recovered}},
+		}
+		if err := s.declare(ctx, "recoveries", builtin.MethodsMiner.DeclareFaultsRecovered, params, recovered); err != nil {
+			return err
 		}
 	}
 
-	return nil, nil
+	return nil
 }
 
-func (s *WindowPoStScheduler) runPost(ctx context.Context, di miner.DeadlineInfo, ts *types.TipSet) (*miner.SubmitWindowedPoStParams, error) {
+func (s *WindowPoStScheduler) declare(ctx context.Context, what string, method abi.MethodNum, params cbg.CBORMarshaler, sectors *abi.BitField) error {
+	enc, aerr := actors.SerializeParams(params)
+	if aerr != nil {
+		return xerrors.Errorf("could not serialize declare %s parameters: %w", what, aerr)
+	}
+
+	msg := &types.Message{
+		To:       s.actor,
+		From:     s.worker,
+		Method:   method,
+		Params:   enc,
+		Value:    types.NewInt(0),
+		GasLimit: 10000000,
+		GasPrice: types.NewInt(1),
+	}
+
+	sm, err := s.api.MpoolPushMessage(ctx, msg)
+	if err != nil {
+		return xerrors.Errorf("pushing declare %s message to mpool: %w", what, err)
+	}
+
+	count, _ := sectors.Count()
+	log.Warnw("declared "+what, "sectors", count, "message", sm.Cid())
+
+	go func() {
+		rec, err := s.api.StateWaitMsg(context.TODO(), sm.Cid())
+		if err != nil {
+			log.Error(err)
+			return
+		}
+
+		if rec.Receipt.ExitCode != 0 {
+			log.Errorf("declaring %s failed (msg %s): exit %d", what, sm.Cid(), rec.Receipt.ExitCode)
+		}
+	}()
+
+	return nil
+}
+
+func (s *WindowPoStScheduler) runPost(ctx context.Context, di miner.DeadlineInfo, ts *types.TipSet, att *api.WindowPoStAttempt) (*miner.SubmitWindowedPoStParams, error) {
 	ctx, span := trace.StartSpan(ctx, "storage.runPost")
 	defer span.End()
 
@@ -127,11 +332,43 @@ func (s *WindowPoStScheduler) runPost(ctx context.Context, di miner.DeadlineInfo
 		partitions[i] = firstPartition + uint64(i)
 	}
 
-	ssi, err := s.sortedSectorInfo(ctx, deadlines.Due[di.Index], ts)
+	att.Partitions = partitions
+	att.Sectors = dc
+
+	if !att.DryRun {
+		nextDl := (di.Index + 1) % miner.WPoStPeriodDeadlines
+		if err := s.checkNextFaults(ctx, di.PeriodStart, nextDl, deadlines, ts); err != nil {
+			log.Errorf("checking faults for next deadline %d: %+v", nextDl, err)
+		}
+	}
+
+	due := deadlines.Due[di.Index]
+
+	expected, err := s.expectedFaults(ctx, due, ts)
+	if err != nil {
+		return nil, err
+	}
+
+	toCheck, err := bitfield.SubtractBitField(due, expected)
+	if err != nil {
+		return nil, xerrors.Errorf("subtracting expected faults: %w", err)
+	}
+
+	skipped, err := s.checkSectors(ctx, toCheck)
+	if err != nil {
+		return nil, err
+	}
+
+	ssi, err := s.sortedSectorInfo(ctx, due, ts)
 	if err != nil {
 		return nil, xerrors.Errorf("getting sorted sector info: %w", err)
 	}
 
+	ssi, err = substituteFaulty(ssi, expected, skipped)
+	if err != nil {
+		return nil, err
+	}
+
 	if len(ssi) == 0 {
 		log.Warn("attempted to run windowPost without any sectors...")
 		return nil, xerrors.Errorf("no sectors to run windowPost on")
@@ -142,28 +379,23 @@ func (s *WindowPoStScheduler) runPost(ctx context.Context, di miner.DeadlineInfo
 		"deadline", di,
 		"height", ts.Height())
 
-	var snums []abi.SectorNumber
-	for _, si := range ssi {
-		snums = append(snums, si.SectorNumber)
-	}
-
-	faults, err := s.checkFaults(ctx, snums)
+	skippedCount, err := skipped.Count()
 	if err != nil {
-		log.Errorf("Failed to declare faults: %+v", err)
+		return nil, err
 	}
+	att.Skipped = skippedCount
 
 	tsStart := time.Now()
 
 	log.Infow("generating windowPost",
 		"sectors", len(ssi),
-		"faults", len(faults))
+		"skipped", skippedCount)
 
 	mid, err := address.IDFromAddress(s.actor)
 	if err != nil {
 		return nil, err
 	}
 
-	// TODO: Faults!
 	postOut, err := s.prover.GenerateWindowPoSt(ctx, abi.ActorID(mid), ssi, abi.PoStRandomness(rand))
 	if err != nil {
 		return nil, xerrors.Errorf("running post failed: %w", err)
@@ -174,15 +406,52 @@ func (s *WindowPoStScheduler) runPost(ctx context.Context, di miner.DeadlineInfo
 	}
 
 	elapsed := time.Since(tsStart)
-	log.Infow("submitting window PoSt", "elapsed", elapsed)
+	att.Elapsed = elapsed
+	log.Infow("window PoSt generated", "elapsed", elapsed, "dry-run", att.DryRun)
 
 	return &miner.SubmitWindowedPoStParams{
 		Partitions: partitions,
 		Proofs:     postOut,
-		Skipped:    *abi.NewBitField(), // TODO: Faults here?
+		Skipped:    *skipped,
 	}, nil
 }
 
+// substituteFaulty replaces faulty sectors with the first good sector, the
+// same way the actor does when verifying the proof
+func substituteFaulty(ssi []abi.SectorInfo, faults ...*abi.BitField) ([]abi.SectorInfo, error) {
+	all, err := abi.BitFieldUnion(faults...)
+	if err != nil {
+		return nil, xerrors.Errorf("merging faults: %w", err)
+	}
+
+	isFaulty, err := all.AllMap(miner.SectorsMax)
+	if err != nil {
+		return nil, xerrors.Errorf("expanding faults: %w", err)
+	}
+
+	var good *abi.SectorInfo
+	for i := range ssi {
+		if !isFaulty[uint64(ssi[i].SectorNumber)] {
+			good = &ssi[i]
+			break
+		}
+	}
+	if good == nil {
+		return nil, xerrors.Errorf("no provable sectors in deadline (%d sectors)", len(ssi))
+	}
+
+	out := make([]abi.SectorInfo, len(ssi))
+	for i, si := range ssi {
+		if isFaulty[uint64(si.SectorNumber)] {
+			out[i] = *good
+			continue
+		}
+		out[i] = si
+	}
+
+	return out, nil
+}
+
 func (s *WindowPoStScheduler) sortedSectorInfo(ctx context.Context, deadlineSectors *abi.BitField, ts *types.TipSet) ([]abi.SectorInfo, error) {
 	sset, err := s.api.StateMinerSectors(ctx, s.actor, deadlineSectors, false, ts.Key())
 	if err != nil {
@@ -201,7 +470,7 @@ func (s *WindowPoStScheduler) sortedSectorInfo(ctx context.Context, deadlineSect
 	return sbsi, nil
 }
 
-func (s *WindowPoStScheduler) submitPost(ctx context.Context, proof *miner.SubmitWindowedPoStParams) error {
+func (s *WindowPoStScheduler) submitPost(ctx context.Context, proof *miner.SubmitWindowedPoStParams, att *api.WindowPoStAttempt) error {
 	ctx, span := trace.StartSpan(ctx, "storage.commitPost")
 	defer span.End()
 
@@ -228,6 +497,12 @@ func (s *WindowPoStScheduler) submitPost(ctx context.Context, proof *miner.Submi
 
 	log.Infof("Submitted window post: %s", sm.Cid())
 
+	mcid := sm.Cid()
+	s.history.update(att, func(att *api.WindowPoStAttempt) {
+		att.Message = &mcid
+		att.Result = api.PoStSubmitted
+	})
+
 	go func() {
 		rec, err := s.api.StateWaitMsg(context.TODO(), sm.Cid())
 		if err != nil {
@@ -235,11 +510,20 @@ func (s *WindowPoStScheduler) submitPost(ctx context.Context, proof *miner.Submi
 			return
 		}
 
-		if rec.Receipt.ExitCode == 0 {
-			return
+		if rec.Receipt.ExitCode != 0 {
+			log.Errorf("Submitting window post %s failed: exit %d", sm.Cid(), rec.Receipt.ExitCode)
 		}
 
-		log.Errorf("Submitting window post %s failed: exit %d", sm.Cid(), rec.Receipt.ExitCode)
+		s.history.update(att, func(att *api.WindowPoStAttempt) {
+			att.Included = rec.TipSet.Height()
+			if rec.Receipt.ExitCode == 0 {
+				att.Result = api.PoStLanded
+				return
+			}
+
+			att.Result = api.PoStFailed
+			att.Error = fmt.Sprintf("message %s failed: exit %d", sm.Cid(), rec.Receipt.ExitCode)
+		})
 	}()
 
 	return nil
@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/specs-actors/actors/abi"
+	"github.com/filecoin-project/specs-actors/actors/builtin"
+	"github.com/filecoin-project/specs-actors/actors/builtin/miner"
+
+	"github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/types/mock"
+)
+
+type faultsTestAPI struct {
+	storageMinerApi
+
+	faults, recoveries []abi.SectorNumber
+
+	lk   sync.Mutex
+	msgs []*types.Message
+}
+
+func (a *faultsTestAPI) StateMinerFaults(context.Context, address.Address, types.TipSetKey) ([]abi.SectorNumber, error) {
+	return a.faults, nil
+}
+
+func (a *faultsTestAPI) StateMinerRecoveries(context.Context, address.Address, types.TipSetKey) ([]abi.SectorNumber, error) {
+	return a.recoveries, nil
+}
+
+func (a *faultsTestAPI) MpoolPushMessage(ctx context.Context, msg *types.Message) (*types.SignedMessage, error) {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+
+	a.msgs = append(a.msgs, msg)
+	return &types.SignedMessage{Message: *msg}, nil
+}
+
+func (a *faultsTestAPI) StateWaitMsg(context.Context, cid.Cid) (*api.MsgLookup, error) {
+	return &api.MsgLookup{}, nil
+}
+
+type testFaultTracker map[abi.SectorNumber]bool
+
+func (ft testFaultTracker) CheckProvable(ctx context.Context, spt abi.RegisteredProof, sectors []abi.SectorID) (map[abi.SectorID]string, error) {
+	out := map[abi.SectorID]string{}
+	for _, sid := range sectors {
+		if ft[sid.Number] {
+			out[sid] = "bad"
+		}
+	}
+	return out, nil
+}
+
+func bitFieldSectors(t *testing.T, bf *abi.BitField) []abi.SectorNumber {
+	t.Helper()
+
+	var out []abi.SectorNumber
+	if err := bf.ForEach(func(s uint64) error {
+		out = append(out, abi.SectorNumber(s))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func expectSectors(t *testing.T, what string, got []abi.SectorNumber, expect ...abi.SectorNumber) {
+	t.Helper()
+
+	if len(got) != len(expect) {
+		t.Fatalf("%s: expected %v, got %v", what, expect, got)
+	}
+	for i := range got {
+		if got[i] != expect[i] {
+			t.Fatalf("%s: expected %v, got %v", what, expect, got)
+		}
+	}
+}
+
+func TestCheckNextFaults(t *testing.T) {
+	const dlIdx = 2
+
+	maddr, err := address.NewIDAddress(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tapi := &faultsTestAPI{
+		faults:     []abi.SectorNumber{2, 3, 5},
+		recoveries: []abi.SectorNumber{3},
+	}
+	s := &WindowPoStScheduler{
+		api: tapi,
+		// 1 is a new fault, 3 fails again after being declared recovered,
+		// 2 recovered, 5 isn't due at this deadline
+		faultTracker:  testFaultTracker{1: true, 3: true, 5: true},
+		sealProofType: testProof,
+		actor:         maddr,
+		worker:        maddr,
+	}
+
+	deadlines := &miner.Deadlines{}
+	for i := range deadlines.Due {
+		deadlines.Due[i] = abi.NewBitField()
+	}
+	deadlines.Due[dlIdx] = sectorsBitField([]abi.SectorNumber{1, 2, 3, 4})
+
+	ts := mock.TipSet(mock.MkBlock(nil, 1, 1))
+
+	if err := s.checkNextFaults(context.TODO(), 0, dlIdx, deadlines, ts); err != nil {
+		t.Fatal(err)
+	}
+
+	tapi.lk.Lock()
+	defer tapi.lk.Unlock()
+
+	if len(tapi.msgs) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(tapi.msgs))
+	}
+
+	faults, recoveries := tapi.msgs[0], tapi.msgs[1]
+	if faults.Method != builtin.MethodsMiner.DeclareFaults || recoveries.Method != builtin.MethodsMiner.DeclareFaultsRecovered {
+		t.Fatalf("unexpected methods %d, %d", faults.Method, recoveries.Method)
+	}
+
+	var fp miner.DeclareFaultsParams
+	if err := fp.UnmarshalCBOR(bytes.NewReader(faults.Params)); err != nil {
+		t.Fatal(err)
+	}
+	if len(fp.Faults) != 1 || fp.Faults[0].Deadline != dlIdx {
+		t.Fatalf("unexpected fault declarations %+v", fp.Faults)
+	}
+	expectSectors(t, "faults", bitFieldSectors(t, fp.Faults[0].Sectors), 1, 3)
+
+	var rp miner.DeclareFaultsRecoveredParams
+	if err := rp.UnmarshalCBOR(bytes.NewReader(recoveries.Params)); err != nil {
+		t.Fatal(err)
+	}
+	if len(rp.Recoveries) != 1 || rp.Recoveries[0].Deadline != dlIdx {
+		t.Fatalf("unexpected recovery declarations %+v", rp.Recoveries)
+	}
+	expectSectors(t, "recoveries", bitFieldSectors(t, rp.Recoveries[0].Sectors), 2)
+}
+
+func TestCheckNextFaultsNothingToDeclare(t *testing.T) {
+	maddr, err := address.NewIDAddress(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tapi := &faultsTestAPI{faults: []abi.SectorNumber{2}}
+	s := &WindowPoStScheduler{
+		api:           tapi,
+		faultTracker:  testFaultTracker{2: true},
+		sealProofType: testProof,
+		actor:         maddr,
+		worker:        maddr,
+	}
+
+	deadlines := &miner.Deadlines{}
+	deadlines.Due[2] = sectorsBitField([]abi.SectorNumber{1, 2})
+
+	if err := s.checkNextFaults(context.TODO(), 0, 2, deadlines, mock.TipSet(mock.MkBlock(nil, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	if len(tapi.msgs) != 0 {
+		t.Fatalf("expected no messages, got %d", len(tapi.msgs))
+	}
+}
+
+func TestSubstituteFaulty(t *testing.T) {
+	ssi := make([]abi.SectorInfo, 4)
+	for i := range ssi {
+		ssi[i] = abi.SectorInfo{SectorNumber: abi.SectorNumber(i + 1)}
+	}
+
+	out, err := substituteFaulty(ssi, sectorsBitField([]abi.SectorNumber{1}), sectorsBitField([]abi.SectorNumber{3}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make([]abi.SectorNumber, len(out))
+	for i, si := range out {
+		got[i] = si.SectorNumber
+	}
+	// faulty sectors are replaced with the first good one
+	expectSectors(t, "substituted", got, 2, 2, 2, 4)
+
+	if _, err := substituteFaulty(ssi, sectorsBitField([]abi.SectorNumber{1, 2, 3, 4})); err == nil {
+		t.Fatal("expected an error without provable sectors")
+	}
+}
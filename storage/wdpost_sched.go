@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/ipfs/go-datastore"
 	"go.opencensus.io/trace"
 	"golang.org/x/xerrors"
 
@@ -22,7 +23,10 @@ const StartConfidence = 4 // TODO: config
 type WindowPoStScheduler struct {
 	api              storageMinerApi
 	prover           storage.Prover
+	faultTracker     FaultTracker
+	history          *postHistory
 	proofType        abi.RegisteredProof
+	sealProofType    abi.RegisteredProof
 	partitionSectors uint64
 
 	actor  address.Address
@@ -38,7 +42,7 @@ type WindowPoStScheduler struct {
 	//failLk sync.Mutex
 }
 
-func NewWindowedPoStScheduler(api storageMinerApi, sb storage.Prover, actor address.Address, worker address.Address) (*WindowPoStScheduler, error) {
+func NewWindowedPoStScheduler(api storageMinerApi, sb storage.Prover, ft FaultTracker, ds datastore.Batching, actor address.Address, worker address.Address) (*WindowPoStScheduler, error) {
 	mi, err := api.StateMinerInfo(context.TODO(), actor, types.EmptyTSK)
 	if err != nil {
 		return nil, xerrors.Errorf("getting sector size: %w", err)
@@ -52,7 +56,10 @@ func NewWindowedPoStScheduler(api storageMinerApi, sb storage.Prover, actor addr
 	return &WindowPoStScheduler{
 		api:              api,
 		prover:           sb,
+		faultTracker:     ft,
+		history:          newPoStHistory(ds),
 		proofType:        rt,
+		sealProofType:    mi.SealProofType,
 		partitionSectors: mi.WindowPoStPartitionSectors,
 
 		actor:  actor,